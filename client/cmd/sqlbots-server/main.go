@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"sqlbots-client/encryption"
+	"sqlbots-client/protocol"
+	"sqlbots-client/server"
+)
+
+func main() {
+	logger := log.New(os.Stderr, "[sqlbots-server] ", log.LstdFlags)
+
+	host := flag.String("host", getEnvOrDefault("HOST", "0.0.0.0"), "Listen host (can also use HOST env var)")
+	port := flag.String("port", getEnvOrDefault("PORT", "3000"), "Listen port (can also use PORT env var)")
+	encryptionKey := flag.String("encryption-key", os.Getenv("ENCRYPTION_KEY"), "Initial encryption key (required, can also use ENCRYPTION_KEY env var)")
+	dataFile := flag.String("data", os.Getenv("DATA_FILE"), "JSON store file (empty = in-memory store, can also use DATA_FILE env var)")
+	privateKey := flag.String("private-key", os.Getenv("SERVER_PRIVATE_KEY"), "Static X25519 private key (base64, can also use SERVER_PRIVATE_KEY env var; empty = generate one for this run)")
+	commandKey := flag.String("command-signing-key", os.Getenv("COMMAND_SIGNING_KEY"), "Ed25519 private key seed (base64) that signs commands sent to clients (can also use COMMAND_SIGNING_KEY env var; empty = generate one for this run)")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "Token for the admin API used to queue commands and update licenses (can also use ADMIN_TOKEN env var; empty = admin API disabled)")
+	schemes := flag.String("schemes", "", "Comma-separated encryption schemes to accept (default: aes-256-gcm,openssl-cbc)")
+	clockSkew := flag.Duration("clock-skew-tolerance", 5*time.Minute, "Allowed clock skew for request timestamps")
+	strictReplay := flag.Bool("strict-replay-protection", false, "Reject requests without signature and timestamp")
+	legacyIDsUntil := flag.String("legacy-machine-ids-until", os.Getenv("LEGACY_MACHINE_IDS_UNTIL"), "Stop matching machines registered with raw machine IDs after this date (RFC3339 or YYYY-MM-DD; empty = no limit)")
+	maxMachines := flag.Int("max-machines", server.DefaultMaxMachinesPerUser, "Maximum machines per user")
+	maxPendingStreams := flag.Int("max-pending-streams", server.DefaultMaxPendingStreams, "Maximum push streams not yet bound to a machine by a heartbeat")
+	seedAPIKey := flag.String("seed-api-key", os.Getenv("SEED_API_KEY"), "Create a user with this API key on startup (can also use SEED_API_KEY env var)")
+	seedUsername := flag.String("seed-username", "demo", "Username of the seeded user")
+	seedPlan := flag.String("seed-plan", "dev", "Plan type of the seeded user's license")
+	seedValidFor := flag.Duration("seed-valid-for", 365*24*time.Hour, "License validity of the seeded user (0 = never expires)")
+	flag.Parse()
+
+	if *encryptionKey == "" {
+		logger.Fatal("ENCRYPTION_KEY is required (use --encryption-key or ENCRYPTION_KEY environment variable)")
+	}
+
+	// 原始机器 ID 的迁移窗口
+	var legacyCutoff time.Time
+	if *legacyIDsUntil != "" {
+		cutoff, err := protocol.ParseTime(*legacyIDsUntil)
+		if err != nil {
+			logger.Fatalf("Invalid --legacy-machine-ids-until: %v", err)
+		}
+		legacyCutoff = cutoff
+	}
+
+	// 加载或生成服务器固定 X25519 私钥（客户端需要固定对应的公钥）
+	var staticKey *ecdh.PrivateKey
+	var err error
+	if *privateKey != "" {
+		staticKey, err = encryption.ParseX25519PrivateKey(*privateKey)
+		if err != nil {
+			logger.Fatalf("Invalid private key: %v", err)
+		}
+	} else {
+		staticKey, err = encryption.GenerateX25519Key()
+		if err != nil {
+			logger.Fatalf("Failed to generate private key: %v", err)
+		}
+		logger.Printf("Generated X25519 private key for this run: %s", encryption.EncodeX25519PrivateKey(staticKey))
+	}
+	logger.Printf("Server public key (SERVER_PUBLIC_KEY): %s", encryption.EncodeX25519PublicKey(staticKey.PublicKey()))
+
+	// 加载或生成指令签名私钥（客户端通过 COMMAND_PUBLIC_KEY 固定对应的公钥）
+	var signingKey ed25519.PrivateKey
+	if *commandKey != "" {
+		signingKey, err = encryption.ParseEd25519PrivateKey(*commandKey)
+		if err != nil {
+			logger.Fatalf("Invalid command signing key: %v", err)
+		}
+	} else {
+		signingKey, err = encryption.GenerateEd25519Key()
+		if err != nil {
+			logger.Fatalf("Failed to generate command signing key: %v", err)
+		}
+		logger.Printf("Generated command signing key for this run: %s", encryption.EncodeEd25519PrivateKey(signingKey))
+	}
+	logger.Printf("Command public key (COMMAND_PUBLIC_KEY): %s", encryption.EncodeEd25519PublicKey(signingKey.Public().(ed25519.PublicKey)))
+
+	// 初始化存储
+	var store server.Store
+	var seed func(server.User, server.License) error
+	if *dataFile != "" {
+		fileStore, err := server.NewFileStore(*dataFile)
+		if err != nil {
+			logger.Fatalf("Failed to open store: %v", err)
+		}
+		store = fileStore
+		seed = func(user server.User, license server.License) error {
+			if err := fileStore.AddUser(user); err != nil {
+				return err
+			}
+			return fileStore.SetLicense(license)
+		}
+	} else {
+		memoryStore := server.NewMemoryStore()
+		store = memoryStore
+		seed = func(user server.User, license server.License) error {
+			memoryStore.AddUser(user)
+			memoryStore.SetLicense(license)
+			return nil
+		}
+	}
+
+	// 创建演示用户
+	if *seedAPIKey != "" {
+		if _, err := store.FindUserByAPIKey(*seedAPIKey); errors.Is(err, server.ErrNotFound) {
+			license := server.License{
+				UserID:   *seedUsername,
+				PlanType: *seedPlan,
+			}
+			if *seedValidFor > 0 {
+				license.ExpiresAt = time.Now().Add(*seedValidFor).UTC().Format(time.RFC3339)
+			}
+			user := server.User{
+				ID:       *seedUsername,
+				APIKey:   *seedAPIKey,
+				Username: *seedUsername,
+			}
+			if err := seed(user, license); err != nil {
+				logger.Fatalf("Failed to seed user: %v", err)
+			}
+			logger.Printf("Seeded user %q (plan %s)", user.Username, license.PlanType)
+		}
+	}
+
+	srv := server.New(server.Config{
+		EncryptionKey:      *encryptionKey,
+		MaxMachinesPerUser: *maxMachines,
+		Schemes:            splitList(*schemes),
+		PrivateKey:         staticKey,
+
+		ClockSkewTolerance:     *clockSkew,
+		StrictReplayProtection: *strictReplay,
+		LegacyMachineIDsUntil:  legacyCutoff,
+		CommandKey:             signingKey,
+		AdminToken:             *adminToken,
+		MaxPendingStreams:      *maxPendingStreams,
+		Logger:                 logger,
+	}, store)
+
+	httpServer := &http.Server{
+		Addr:              net.JoinHostPort(*host, *port),
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// 关闭时断开推送连接（Shutdown 会等待所有请求处理完成，推送连接不会自己结束）
+	httpServer.RegisterOnShutdown(srv.CloseStreams)
+
+	// 定期清理过期会话（每5分钟）
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				srv.CleanupExpiredSessions()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Printf("Server listening on %s", httpServer.Addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// getEnvOrDefault 获取环境变量，如果不存在则返回默认值
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// splitList 解析逗号分隔的列表（忽略空项）
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"sqlbots-client/collectors"
+	"sqlbots-client/config"
+)
+
+// newCollectorRegistry 根据配置创建指标采集器注册表（没有配置采集器时返回 nil）
+func newCollectorRegistry(cfg *config.Config, onError func(name string, err error)) (*collectors.Registry, error) {
+	if len(cfg.Collectors) == 0 && cfg.CollectorsDir == "" {
+		return nil, nil
+	}
+
+	registry := collectors.NewRegistry(collectors.RegistryOptions{
+		Interval: cfg.CollectorInterval,
+		Timeout:  cfg.CollectorTimeout,
+		OnError:  onError,
+	})
+
+	for _, name := range cfg.Collectors {
+		collector, err := collectors.Builtin(name)
+		if err != nil {
+			return nil, fmt.Errorf("collectors: %w", err)
+		}
+		if err := registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CollectorsDir != "" {
+		scripts, err := collectors.Dir(cfg.CollectorsDir, cfg.CollectorInterval)
+		if err != nil {
+			return nil, err
+		}
+		for _, collector := range scripts {
+			if err := registry.Register(collector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return registry, nil
+}
@@ -0,0 +1,168 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"sqlbots-client/sysstat"
+)
+
+// builtins 内置采集器（封装 gopsutil）：每次创建采集器时调用，得到各自独立的采集函数
+var builtins = map[string]func() func(ctx context.Context) ([]Metric, error){
+	"cpu":       newCPUCollector,
+	"memory":    stateless(collectMemory),
+	"disk":      stateless(collectDisk),
+	"load":      stateless(collectLoad),
+	"network":   stateless(collectNetwork),
+	"processes": stateless(collectProcesses),
+	"uptime":    stateless(collectUptime),
+}
+
+// BuiltinNames 内置采集器名称
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin 按名称创建内置采集器（使用注册表的默认间隔）
+func Builtin(name string) (Collector, error) {
+	newCollect, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown collector %q (built-in collectors: %s)", name, strings.Join(BuiltinNames(), ", "))
+	}
+	return NewFunc(name, 0, newCollect()), nil
+}
+
+// stateless 不需要保存状态的采集函数
+func stateless(collect func(ctx context.Context) ([]Metric, error)) func() func(ctx context.Context) ([]Metric, error) {
+	return func() func(ctx context.Context) ([]Metric, error) { return collect }
+}
+
+// newCPUCollector CPU 使用率（与上一次采集之间的平均值，第一次为开机以来的平均值）
+func newCPUCollector() func(ctx context.Context) ([]Metric, error) {
+	var mu sync.Mutex
+	var last cpu.TimesStat
+
+	return func(ctx context.Context) ([]Metric, error) {
+		times, err := cpu.TimesWithContext(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(times) == 0 {
+			return nil, fmt.Errorf("no CPU times reported")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		percent, ok := sysstat.CPUPercent(last, times[0])
+		last = times[0]
+		if !ok {
+			return nil, fmt.Errorf("CPU times did not advance")
+		}
+		return []Metric{{Name: "cpu.used_percent", Type: Gauge, Value: percent, Unit: "percent"}}, nil
+	}
+}
+
+// collectMemory 内存和交换分区
+func collectMemory(ctx context.Context) ([]Metric, error) {
+	vm, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []Metric{
+		{Name: "memory.used_bytes", Type: Gauge, Value: float64(vm.Used), Unit: "bytes"},
+		{Name: "memory.available_bytes", Type: Gauge, Value: float64(vm.Available), Unit: "bytes"},
+		{Name: "memory.used_percent", Type: Gauge, Value: vm.UsedPercent, Unit: "percent"},
+	}
+	if swap, err := mem.SwapMemoryWithContext(ctx); err == nil && swap.Total > 0 {
+		metrics = append(metrics, Metric{Name: "swap.used_percent", Type: Gauge, Value: swap.UsedPercent, Unit: "percent"})
+	}
+	return metrics, nil
+}
+
+// collectDisk 每个挂载点的使用情况
+func collectDisk(ctx context.Context) ([]Metric, error) {
+	partitions, err := sysstat.Partitions(ctx, maxMetricsPerCollector/2)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]Metric, 0, 2*len(partitions))
+	for _, partition := range partitions {
+		labels := map[string]string{"mount": partition.Mountpoint, "fstype": partition.Fstype}
+		metrics = append(metrics,
+			Metric{Name: "disk.used_percent", Type: Gauge, Value: partition.Usage.UsedPercent, Unit: "percent", Labels: labels},
+			Metric{Name: "disk.free_bytes", Type: Gauge, Value: float64(partition.Usage.Free), Unit: "bytes", Labels: labels},
+		)
+	}
+	return metrics, nil
+}
+
+// collectLoad 1/5/15 分钟平均负载
+func collectLoad(ctx context.Context) ([]Metric, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Metric{
+		{Name: "load.1", Type: Gauge, Value: avg.Load1},
+		{Name: "load.5", Type: Gauge, Value: avg.Load5},
+		{Name: "load.15", Type: Gauge, Value: avg.Load15},
+	}, nil
+}
+
+// collectNetwork 每个网卡的收发字节数和错误数（累计值）
+func collectNetwork(ctx context.Context) ([]Metric, error) {
+	counters, err := psnet.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []Metric
+	for _, c := range counters {
+		if c.Name == "lo" || len(metrics) >= maxMetricsPerCollector-4 {
+			continue
+		}
+		labels := map[string]string{"interface": c.Name}
+		metrics = append(metrics,
+			Metric{Name: "network.bytes_recv", Type: Counter, Value: float64(c.BytesRecv), Unit: "bytes", Labels: labels},
+			Metric{Name: "network.bytes_sent", Type: Counter, Value: float64(c.BytesSent), Unit: "bytes", Labels: labels},
+			Metric{Name: "network.errors_in", Type: Counter, Value: float64(c.Errin), Labels: labels},
+			Metric{Name: "network.errors_out", Type: Counter, Value: float64(c.Errout), Labels: labels},
+		)
+	}
+	return metrics, nil
+}
+
+// collectProcesses 进程数量
+func collectProcesses(ctx context.Context) ([]Metric, error) {
+	pids, err := process.PidsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Metric{{Name: "processes.count", Type: Gauge, Value: float64(len(pids))}}, nil
+}
+
+// collectUptime 系统运行时间
+func collectUptime(ctx context.Context) ([]Metric, error) {
+	uptime, err := host.UptimeWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Metric{{Name: "uptime.seconds", Type: Counter, Value: float64(uptime), Unit: "seconds"}}, nil
+}
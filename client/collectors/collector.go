@@ -0,0 +1,95 @@
+// Package collectors 可插拔的指标采集器：每个采集器按自己的间隔运行，结果随心跳发送。
+// 内置采集器封装 gopsutil，exec 采集器运行外部脚本并解析其 JSON 输出，
+// 也可以实现 Collector 接口报告自定义指标（例如任务队列长度、数据库连接数）
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// 指标类型
+const (
+	Gauge   = "gauge"   // 瞬时值（例如队列长度）
+	Counter = "counter" // 单调递增的累计值（例如处理的任务总数）
+)
+
+// Metric 采集器报告的指标
+type Metric = protocol.Metric
+
+// Collector 指标采集器
+type Collector interface {
+	// Name 采集器名称（在注册表中唯一）
+	Name() string
+	// Interval 采集间隔（为 0 时使用注册表的默认间隔）
+	Interval() time.Duration
+	// Collect 采集一次指标，应当在 ctx 取消时尽快返回
+	Collect(ctx context.Context) ([]Metric, error)
+}
+
+// namePattern 采集器和指标名称的格式
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:-]{0,127}$`)
+
+// ErrInvalidMetric 指标不合法
+var ErrInvalidMetric = errors.New("invalid metric")
+
+// validateName 校验采集器或指标名称
+func validateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q (letters, digits, _ . : - up to 128 characters)", name)
+	}
+	return nil
+}
+
+// validateMetrics 校验采集器返回的指标，类型为空时视为 gauge
+//
+// NaN 和 ±Inf 无法编码为 JSON，会使整个心跳请求失败，因此和其他不合法的指标一样只作为该采集器的错误报告
+func validateMetrics(metrics []Metric) ([]Metric, error) {
+	if len(metrics) > maxMetricsPerCollector {
+		return nil, fmt.Errorf("%w: %d metrics exceed the limit of %d", ErrInvalidMetric, len(metrics), maxMetricsPerCollector)
+	}
+
+	valid := make([]Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if err := validateName(metric.Name); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMetric, err)
+		}
+		switch metric.Type {
+		case "":
+			metric.Type = Gauge
+		case Gauge, Counter:
+		default:
+			return nil, fmt.Errorf("%w: metric %s has unknown type %q", ErrInvalidMetric, metric.Name, metric.Type)
+		}
+		if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+			return nil, fmt.Errorf("%w: metric %s has non-finite value %v", ErrInvalidMetric, metric.Name, metric.Value)
+		}
+		if len(metric.Labels) > maxLabelsPerMetric {
+			return nil, fmt.Errorf("%w: metric %s has more than %d labels", ErrInvalidMetric, metric.Name, maxLabelsPerMetric)
+		}
+		valid = append(valid, metric)
+	}
+	return valid, nil
+}
+
+// funcCollector 用函数实现的采集器
+type funcCollector struct {
+	name     string
+	interval time.Duration
+	collect  func(ctx context.Context) ([]Metric, error)
+}
+
+// NewFunc 用函数创建采集器
+func NewFunc(name string, interval time.Duration, collect func(ctx context.Context) ([]Metric, error)) Collector {
+	return &funcCollector{name: name, interval: interval, collect: collect}
+}
+
+func (c *funcCollector) Name() string                                  { return c.name }
+func (c *funcCollector) Interval() time.Duration                       { return c.interval }
+func (c *funcCollector) Collect(ctx context.Context) ([]Metric, error) { return c.collect(ctx) }
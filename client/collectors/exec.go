@@ -0,0 +1,184 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxExecOutput exec 采集器读取的最大输出（标准输出和标准错误分别计算）
+const maxExecOutput = 1 << 20
+
+// windowsExecutables Windows 上作为脚本运行的扩展名
+var windowsExecutables = map[string]bool{".exe": true, ".bat": true, ".cmd": true}
+
+// ExecCollector 运行外部命令并解析标准输出中的 JSON
+//
+// 支持三种输出格式：
+//
+//	{"queue_depth": 12, "db_connections": 4}                          数值都作为 gauge
+//	[{"name": "jobs_total", "type": "counter", "value": 1024}]
+//	{"metrics": [{"name": "queue_depth", "value": 12, "labels": {"queue": "default"}}]}
+type ExecCollector struct {
+	name     string
+	interval time.Duration
+	path     string
+	args     []string
+}
+
+// NewExec 创建 exec 采集器
+func NewExec(name string, interval time.Duration, path string, args ...string) *ExecCollector {
+	return &ExecCollector{name: name, interval: interval, path: path, args: args}
+}
+
+// Name 采集器名称
+func (c *ExecCollector) Name() string { return c.name }
+
+// Interval 采集间隔
+func (c *ExecCollector) Interval() time.Duration { return c.interval }
+
+// Collect 运行命令（ctx 取消时终止进程）并解析输出
+func (c *ExecCollector) Collect(ctx context.Context) ([]Metric, error) {
+	cmd := exec.CommandContext(ctx, c.path, c.args...)
+	stdout := &limitedBuffer{limit: maxExecOutput}
+	stderr := &limitedBuffer{limit: maxExecOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// 进程被终止后，子进程可能仍然占用输出管道，最多再等待一秒
+	cmd.WaitDelay = time.Second
+	configureCommand(cmd)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to run %s: %w: %s", c.path, err, truncate(msg, 200))
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", c.path, err)
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("output of %s exceeds %d bytes", c.path, maxExecOutput)
+	}
+
+	metrics, err := ParseJSON(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output of %s: %w", c.path, err)
+	}
+	return metrics, nil
+}
+
+// ParseJSON 解析 exec 采集器的 JSON 输出
+func ParseJSON(data []byte) ([]Metric, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty output")
+	}
+
+	if data[0] == '[' {
+		var metrics []Metric
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if raw, ok := object["metrics"]; ok && len(object) == 1 && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		var metrics []Metric
+		if err := json.Unmarshal(raw, &metrics); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	}
+
+	// 扁平对象：每个键是一个 gauge
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]Metric, 0, len(names))
+	for _, name := range names {
+		var value float64
+		if err := json.Unmarshal(object[name], &value); err != nil {
+			return nil, fmt.Errorf("value of %q is not a number", name)
+		}
+		metrics = append(metrics, Metric{Name: name, Type: Gauge, Value: value})
+	}
+	return metrics, nil
+}
+
+// Dir 为目录中的每个可执行文件创建 exec 采集器（名称为去掉扩展名的文件名，按名称排序）
+func Dir(dir string, interval time.Duration) ([]Collector, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collectors directory: %w", err)
+	}
+
+	var collectors []Collector
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() || !isExecutable(file.Name(), info.Mode()) {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		collectors = append(collectors, NewExec(name, interval, filepath.Join(dir, file.Name())))
+	}
+	return collectors, nil
+}
+
+// isExecutable 文件是否可以作为脚本运行
+func isExecutable(name string, mode os.FileMode) bool {
+	if runtime.GOOS == "windows" {
+		return windowsExecutables[strings.ToLower(filepath.Ext(name))]
+	}
+	return mode&0o111 != 0
+}
+
+// limitedBuffer 超过上限后丢弃多余输出的缓冲区
+//
+// 不嵌入 bytes.Buffer：否则 io.Copy 会使用提升的 ReadFrom 绕过 Write 的上限
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write 写入输出（超过上限的部分丢弃，不返回错误，避免子进程因管道关闭而失败）
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes 已写入的输出
+func (b *limitedBuffer) Bytes() []byte { return b.buf.Bytes() }
+
+// String 已写入的输出
+func (b *limitedBuffer) String() string { return b.buf.String() }
+
+// truncate 截断过长的文本
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,185 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Metric
+	}{
+		{
+			"flat object",
+			`{"queue_depth": 12, "db_connections": 4}`,
+			[]Metric{{Name: "db_connections", Type: Gauge, Value: 4}, {Name: "queue_depth", Type: Gauge, Value: 12}},
+		},
+		{
+			"array",
+			`[{"name": "jobs_total", "type": "counter", "value": 1024}]`,
+			[]Metric{{Name: "jobs_total", Type: Counter, Value: 1024}},
+		},
+		{
+			"metrics object",
+			` {"metrics": [{"name": "queue_depth", "value": 12, "labels": {"queue": "default"}}]}` + "\n",
+			[]Metric{{Name: "queue_depth", Value: 12, Labels: map[string]string{"queue": "default"}}},
+		},
+		{
+			// 其他键与 metrics 同时存在时按扁平对象解析
+			"metrics key in flat object",
+			`{"metrics": 3, "errors": 1}`,
+			[]Metric{{Name: "errors", Type: Gauge, Value: 1}, {Name: "metrics", Type: Gauge, Value: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Name != tt.want[i].Name || got[i].Type != tt.want[i].Type || got[i].Value != tt.want[i].Value ||
+					len(got[i].Labels) != len(tt.want[i].Labels) {
+					t.Errorf("metric %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+				for k, v := range tt.want[i].Labels {
+					if got[i].Labels[k] != v {
+						t.Errorf("metric %d label %s: got %q, want %q", i, k, got[i].Labels[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	for _, input := range []string{"", "  \n", "not json", `{"queue_depth": "twelve"}`, `[{"name": 1}]`, `"text"`} {
+		if metrics, err := ParseJSON([]byte(input)); err == nil {
+			t.Errorf("%q: got %+v, want error", input, metrics)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 8}
+	for _, chunk := range []string{"abcde", "fghij", "klm"} {
+		if n, err := b.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("write %q: got (%d, %v)", chunk, n, err)
+		}
+	}
+	if b.String() != "abcdefgh" || !b.truncated {
+		t.Errorf("got %q (truncated %v), want first 8 bytes and truncated", b.String(), b.truncated)
+	}
+}
+
+// writeScript 在目录中写入 shell 脚本
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecCollector(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts")
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	t.Run("output", func(t *testing.T) {
+		c := NewExec("queue", 0, writeScript(t, dir, "queue.sh", `echo '{"queue_depth": 12}'`))
+		metrics, err := c.Collect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metrics) != 1 || metrics[0].Name != "queue_depth" || metrics[0].Value != 12 {
+			t.Errorf("unexpected metrics: %+v", metrics)
+		}
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		c := NewExec("failing", 0, writeScript(t, dir, "failing.sh", "echo 'database unreachable' >&2\nexit 3"))
+		_, err := c.Collect(ctx)
+		if err == nil || !strings.Contains(err.Error(), "database unreachable") {
+			t.Errorf("got %v, want error with stderr", err)
+		}
+	})
+
+	t.Run("output limit", func(t *testing.T) {
+		c := NewExec("large", 0, writeScript(t, dir, "large.sh", "head -c 1100000 /dev/zero"))
+		_, err := c.Collect(ctx)
+		if err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("got %v, want output limit error", err)
+		}
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		c := NewExec("text", 0, writeScript(t, dir, "text.sh", "echo hello"))
+		if _, err := c.Collect(ctx); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("got %v, want parse error", err)
+		}
+	})
+
+	t.Run("timeout kills the process group", func(t *testing.T) {
+		c := NewExec("hang", 0, writeScript(t, dir, "hang.sh", "sleep 30 &\nsleep 30"))
+		cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := c.Collect(cctx); err == nil {
+			t.Fatal("hanging script succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("collect returned after %s", elapsed)
+		}
+	})
+}
+
+func TestDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts")
+	}
+	dir := t.TempDir()
+	writeScript(t, dir, "queue.sh", "true")
+	writeScript(t, dir, "db", "true")
+	writeScript(t, dir, ".hidden.sh", "true")
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not executable"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	collectors, err := Dir(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range collectors {
+		names = append(names, c.Name())
+		if c.Interval() != time.Minute {
+			t.Errorf("%s: interval %s", c.Name(), c.Interval())
+		}
+	}
+	if strings.Join(names, ",") != "db,queue" {
+		t.Errorf("got collectors %v, want [db queue]", names)
+	}
+
+	if _, err := Dir(filepath.Join(dir, "missing"), 0); err == nil {
+		t.Error("missing directory accepted")
+	}
+}
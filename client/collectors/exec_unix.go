@@ -0,0 +1,16 @@
+//go:build !windows
+
+package collectors
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureCommand 在独立的进程组中运行脚本，超时时终止整个进程组（包括脚本启动的子进程）
+func configureCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
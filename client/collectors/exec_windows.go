@@ -0,0 +1,8 @@
+//go:build windows
+
+package collectors
+
+import "os/exec"
+
+// configureCommand Windows 上超时时只终止脚本进程
+func configureCommand(cmd *exec.Cmd) {}
@@ -0,0 +1,232 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+const (
+	// DefaultInterval 采集器没有指定间隔时的默认间隔
+	DefaultInterval = time.Minute
+	// DefaultTimeout 单次采集的默认超时
+	DefaultTimeout = 10 * time.Second
+
+	maxMetricsPerCollector = 256
+	maxLabelsPerMetric     = 16
+)
+
+// RegistryOptions 注册表选项
+type RegistryOptions struct {
+	Interval time.Duration                // 默认采集间隔（为 0 时使用 DefaultInterval）
+	Timeout  time.Duration                // 单次采集超时（为 0 时使用 DefaultTimeout）
+	OnError  func(name string, err error) // 采集失败时调用（可选，err 不包含采集器名称）
+}
+
+// entry 注册的采集器和最近一次的结果
+type entry struct {
+	collector Collector
+	running   atomic.Bool // 上一次采集还没有返回（例如忽略了 ctx 的采集器）
+
+	mu        sync.Mutex
+	result    protocol.CollectorResult
+	hasResult bool
+}
+
+// Registry 采集器注册表：每个采集器在自己的 goroutine 中按间隔运行，
+// 超时、返回错误或 panic 只影响该采集器的结果，不影响其他采集器和心跳
+type Registry struct {
+	opts RegistryOptions
+
+	mu      sync.Mutex
+	entries []*entry
+	names   map[string]bool
+	started bool
+}
+
+// NewRegistry 创建采集器注册表
+func NewRegistry(opts RegistryOptions) *Registry {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Registry{opts: opts, names: make(map[string]bool)}
+}
+
+// Register 注册采集器（名称必须唯一，需要在 Start 之前调用）
+func (r *Registry) Register(c Collector) error {
+	if err := validateName(c.Name()); err != nil {
+		return fmt.Errorf("failed to register collector: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		return fmt.Errorf("failed to register collector %s: registry already started", c.Name())
+	}
+	if r.names[c.Name()] {
+		return fmt.Errorf("failed to register collector %s: duplicate name", c.Name())
+	}
+	r.names[c.Name()] = true
+	r.entries = append(r.entries, &entry{collector: c})
+	return nil
+}
+
+// Len 注册的采集器数量
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.entries)
+}
+
+// Start 在后台运行所有采集器（每个采集器立即采集一次，之后按各自的间隔采集），直到 ctx 取消
+func (r *Registry) Start(ctx context.Context) {
+	r.mu.Lock()
+	r.started = true
+	entries := append([]*entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	for _, e := range entries {
+		go r.loop(ctx, e)
+	}
+}
+
+// CollectAll 立即运行所有采集器一次，等待全部完成或超时后返回结果
+func (r *Registry) CollectAll(ctx context.Context) []protocol.CollectorResult {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	entries := append([]*entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			r.run(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+
+	return r.Results()
+}
+
+// Results 返回每个采集器最近一次的结果（按注册顺序，还没有采集过的采集器不包含在内）
+func (r *Registry) Results() []protocol.CollectorResult {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	entries := append([]*entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	var results []protocol.CollectorResult
+	for _, e := range entries {
+		e.mu.Lock()
+		if e.hasResult {
+			results = append(results, e.result)
+		}
+		e.mu.Unlock()
+	}
+	return results
+}
+
+// loop 按间隔运行一个采集器
+func (r *Registry) loop(ctx context.Context, e *entry) {
+	interval := e.collector.Interval()
+	if interval <= 0 {
+		interval = r.opts.Interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	r.run(ctx, e)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.run(ctx, e)
+		}
+	}
+}
+
+// outcome 一次采集的结果
+type outcome struct {
+	metrics []Metric
+	err     error
+}
+
+// run 运行一次采集器（带超时，捕获 panic），并保存结果
+func (r *Registry) run(ctx context.Context, e *entry) {
+	start := time.Now()
+
+	// 上一次采集超时后仍未返回时跳过，避免堆积 goroutine
+	if !e.running.CompareAndSwap(false, true) {
+		r.record(e, start, nil, fmt.Errorf("previous collection still running"))
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	done := make(chan outcome, 1)
+	go func() {
+		defer e.running.Store(false)
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		metrics, err := e.collector.Collect(cctx)
+		done <- outcome{metrics: metrics, err: err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-cctx.Done():
+		o.err = fmt.Errorf("timed out after %s", r.opts.Timeout)
+	}
+
+	if o.err == nil {
+		o.metrics, o.err = validateMetrics(o.metrics)
+	}
+	r.record(e, start, o.metrics, o.err)
+}
+
+// record 保存采集结果（失败时保留上一次成功的指标，并记录错误）
+func (r *Registry) record(e *entry, start time.Time, metrics []Metric, err error) {
+	e.mu.Lock()
+	e.result.Collector = e.collector.Name()
+	e.result.CollectedAt = start.UTC()
+	e.result.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		e.result.Error = err.Error()
+	} else {
+		e.result.Error = ""
+		e.result.Metrics = metrics
+	}
+	e.hasResult = true
+	e.mu.Unlock()
+
+	if err != nil && r.opts.OnError != nil {
+		r.opts.OnError(e.collector.Name(), err)
+	}
+}
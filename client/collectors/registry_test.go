@@ -0,0 +1,222 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// newTestRegistry 创建超时很短的注册表并注册采集器
+func newTestRegistry(t *testing.T, timeout time.Duration, collectors ...Collector) *Registry {
+	t.Helper()
+
+	r := NewRegistry(RegistryOptions{Timeout: timeout})
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+// resultOf 按名称查找采集结果
+func resultOf(t *testing.T, results []protocol.CollectorResult, name string) protocol.CollectorResult {
+	t.Helper()
+
+	for _, result := range results {
+		if result.Collector == name {
+			return result
+		}
+	}
+	t.Fatalf("no result for collector %s in %+v", name, results)
+	return protocol.CollectorResult{}
+}
+
+// constant 每次返回同一个 gauge 的采集器
+func constant(name string, value float64) Collector {
+	return NewFunc(name, 0, func(ctx context.Context) ([]Metric, error) {
+		return []Metric{{Name: name + ".value", Value: value}}, nil
+	})
+}
+
+func TestRegisterRejectsDuplicatesAndInvalidNames(t *testing.T) {
+	r := NewRegistry(RegistryOptions{})
+	if err := r.Register(constant("queue", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(constant("queue", 2)); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	if err := r.Register(constant("bad name", 1)); err == nil {
+		t.Error("invalid name accepted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	if err := r.Register(constant("late", 1)); err == nil {
+		t.Error("collector registered after Start")
+	}
+	if r.Len() != 1 {
+		t.Errorf("got %d collectors, want 1", r.Len())
+	}
+}
+
+func TestCollectAllResults(t *testing.T) {
+	r := newTestRegistry(t, time.Second, constant("a", 1), constant("b", 2))
+
+	results := r.CollectAll(context.Background())
+	if len(results) != 2 || results[0].Collector != "a" || results[1].Collector != "b" {
+		t.Fatalf("results not in registration order: %+v", results)
+	}
+	b := resultOf(t, results, "b")
+	if b.Error != "" || len(b.Metrics) != 1 || b.Metrics[0].Value != 2 || b.Metrics[0].Type != Gauge {
+		t.Errorf("unexpected result: %+v", b)
+	}
+}
+
+// 超时的采集器只影响自己的结果；上一次仍未返回时跳过，返回后恢复正常
+func TestCollectorTimeoutAndSkip(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	slow := NewFunc("slow", 0, func(ctx context.Context) ([]Metric, error) {
+		if calls.Add(1) == 1 {
+			<-release // 忽略 ctx，模拟卡住的采集器
+		}
+		return []Metric{{Name: "slow.value", Value: 1}}, nil
+	})
+	r := newTestRegistry(t, 20*time.Millisecond, slow, constant("fast", 3))
+
+	results := r.CollectAll(context.Background())
+	if got := resultOf(t, results, "slow"); !strings.Contains(got.Error, "timed out") {
+		t.Errorf("slow collector: got error %q, want timeout", got.Error)
+	}
+	if got := resultOf(t, results, "fast"); got.Error != "" || len(got.Metrics) != 1 {
+		t.Errorf("fast collector affected by the slow one: %+v", got)
+	}
+
+	results = r.CollectAll(context.Background())
+	if got := resultOf(t, results, "slow"); !strings.Contains(got.Error, "still running") {
+		t.Errorf("second run: got error %q, want skip", got.Error)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("collector started %d times while the first run was blocked", calls.Load())
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := resultOf(t, r.CollectAll(context.Background()), "slow")
+		if got.Error == "" {
+			if len(got.Metrics) != 1 {
+				t.Errorf("unexpected metrics after recovery: %+v", got.Metrics)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("collector did not recover: %q", got.Error)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCollectorPanicIsolated(t *testing.T) {
+	var errs []string
+	r := NewRegistry(RegistryOptions{OnError: func(name string, err error) { errs = append(errs, name+": "+err.Error()) }})
+	r.Register(NewFunc("broken", 0, func(ctx context.Context) ([]Metric, error) { panic("boom") }))
+	r.Register(constant("ok", 1))
+
+	results := r.CollectAll(context.Background())
+	if got := resultOf(t, results, "broken"); !strings.Contains(got.Error, "panic: boom") {
+		t.Errorf("got error %q, want panic", got.Error)
+	}
+	if got := resultOf(t, results, "ok"); got.Error != "" || len(got.Metrics) != 1 {
+		t.Errorf("healthy collector affected by the panic: %+v", got)
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0], "broken: ") {
+		t.Errorf("OnError calls: %v", errs)
+	}
+}
+
+// 失败时保留上一次成功的指标
+func TestCollectorErrorKeepsLastMetrics(t *testing.T) {
+	var fail atomic.Bool
+	r := newTestRegistry(t, time.Second, NewFunc("flaky", 0, func(ctx context.Context) ([]Metric, error) {
+		if fail.Load() {
+			return nil, errors.New("unavailable")
+		}
+		return []Metric{{Name: "flaky.value", Value: 7}}, nil
+	}))
+
+	r.CollectAll(context.Background())
+	fail.Store(true)
+	got := resultOf(t, r.CollectAll(context.Background()), "flaky")
+	if got.Error != "unavailable" || len(got.Metrics) != 1 || got.Metrics[0].Value != 7 {
+		t.Errorf("unexpected result after failure: %+v", got)
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  Metric
+		wantErr bool
+	}{
+		{"gauge", Metric{Name: "queue_depth", Type: Gauge, Value: 1}, false},
+		{"counter", Metric{Name: "jobs.total", Type: Counter, Value: 10}, false},
+		{"default type", Metric{Name: "queue_depth", Value: 1}, false},
+		{"unknown type", Metric{Name: "queue_depth", Type: "histogram", Value: 1}, true},
+		{"invalid name", Metric{Name: "queue depth", Value: 1}, true},
+		{"NaN", Metric{Name: "ratio", Value: math.NaN()}, true},
+		{"+Inf", Metric{Name: "ratio", Value: math.Inf(1)}, true},
+		{"-Inf", Metric{Name: "ratio", Value: math.Inf(-1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := validateMetrics([]Metric{tt.metric})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMetric) {
+					t.Fatalf("got %v, want ErrInvalidMetric", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metrics[0].Type == "" {
+				t.Error("type not defaulted")
+			}
+		})
+	}
+
+	tooMany := make([]Metric, maxMetricsPerCollector+1)
+	for i := range tooMany {
+		tooMany[i] = Metric{Name: "m", Value: 1}
+	}
+	if _, err := validateMetrics(tooMany); !errors.Is(err, ErrInvalidMetric) {
+		t.Errorf("too many metrics: got %v", err)
+	}
+}
+
+// 返回 NaN 的采集器只报告错误，其他采集器的结果仍然可以编码发送
+func TestNonFiniteMetricIsolated(t *testing.T) {
+	r := newTestRegistry(t, time.Second, constant("nan", math.NaN()), constant("ok", 1))
+
+	results := r.CollectAll(context.Background())
+	if got := resultOf(t, results, "nan"); got.Error == "" || len(got.Metrics) != 0 {
+		t.Errorf("NaN metric accepted: %+v", got)
+	}
+	if got := resultOf(t, results, "ok"); got.Error != "" {
+		t.Errorf("healthy collector affected: %+v", got)
+	}
+	if _, err := json.Marshal(results); err != nil {
+		t.Errorf("results cannot be encoded: %v", err)
+	}
+}
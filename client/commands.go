@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/credentials"
+	apperrors "sqlbots-client/errors"
+)
+
+// command 子命令
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands 所有子命令（在 init 中初始化，help 需要引用它）
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "Log in and send heartbeats until interrupted (default)", runClient},
+		{"login", "Verify and save the API key and encryption key", runLogin},
+		{"logout", "Remove saved credentials", runLogout},
+		{"whoami", "Show the saved user and license", runWhoami},
+		{"status", "Show license and machine info from the last heartbeat", runStatus},
+		{"machines", "Show this machine's registration from the last heartbeat", runMachines},
+		{"heartbeat", "Send a single heartbeat (--once)", runHeartbeat},
+		{"doctor", "Check connectivity, clock skew, key exchange and encryption", runDoctor},
+		{"config", "Show the merged configuration (config show [--redacted])", runConfig},
+		{"version", "Show version and build info", runVersion},
+		{"help", "Show this help", runHelp},
+	}
+}
+
+// runCommand 执行子命令，返回退出码
+// 没有子命令或第一个参数是命令行参数时执行 run（兼容旧的用法）
+func runCommand(args []string) int {
+	if len(args) == 0 {
+		return runClient(args)
+	}
+
+	switch name := args[0]; {
+	case name == "-h" || name == "-help" || name == "--help":
+		return runHelp(nil)
+	case strings.HasPrefix(name, "-"):
+		return runClient(args)
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return apperrors.ExitUsage
+}
+
+// runHelp 显示所有子命令
+func runHelp(args []string) int {
+	printUsage(os.Stdout)
+	return apperrors.ExitOK
+}
+
+// printUsage 输出子命令列表
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: sqlbots-client [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'sqlbots-client <command> -h' for the flags of a command.\n")
+}
+
+// loadCommandConfig 加载子命令的配置，同时注册 --output 参数
+// 返回的配置为 nil 时，命令应该以返回的退出码结束
+func loadCommandConfig(name string, args []string, output *string, opts config.LoadOptions) (*config.Config, int) {
+	extra := opts.ExtraFlags
+	opts.Name = "sqlbots-client " + name
+	opts.Args = args
+	opts.ExtraFlags = func(fs *flag.FlagSet) {
+		fs.StringVar(output, "output", "text", "Output format: text or json")
+		if extra != nil {
+			extra(fs)
+		}
+	}
+
+	cfg, err := config.Load(opts)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, apperrors.ExitOK
+		}
+		return nil, commandFailed(*output, apperrors.ExitConfig, "Invalid configuration", err)
+	}
+	if err := checkOutput(*output); err != nil {
+		return nil, commandFailed("text", apperrors.ExitUsage, "Invalid arguments", err)
+	}
+	return cfg, apperrors.ExitOK
+}
+
+// checkOutput 检查 --output 参数
+func checkOutput(output string) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("--output must be text or json (got %q)", output)
+	}
+	return nil
+}
+
+// configReloader 返回用相同参数重新读取配置的函数（refresh_config 指令使用）
+//
+// 重新读取在指令分发的后台 goroutine 中进行，终端界面仍在运行，所以不能交互式输入：
+// 启动时交互输入的值（API Key 等）沿用 initial 中的值，口令保护的凭据也沿用启动时解密的结果
+func configReloader(opts config.LoadOptions, initial *config.Config) func() (*config.Config, error) {
+	opts.Output = io.Discard
+	opts.Prompt = func(key string) (string, error) {
+		if initial.Source(key) == config.SourcePrompt {
+			return initial.Value(key), nil
+		}
+		return "", nil
+	}
+	if opts.Credentials != nil {
+		load := loadCredentials(false)
+		opts.Credentials = func(cfg *config.Config) (string, string, error) {
+			apiKey, encryptionKey, err := load(cfg)
+			if !errors.Is(err, credentials.ErrPassphraseRequired) {
+				return apiKey, encryptionKey, err
+			}
+			if initial.Source("api_key") == config.SourceVault {
+				apiKey = initial.APIKey
+			}
+			if initial.Source("encryption_key") == config.SourceVault {
+				encryptionKey = initial.EncryptionKey
+			}
+			return apiKey, encryptionKey, nil
+		}
+	}
+	return func() (*config.Config, error) {
+		return config.Load(opts)
+	}
+}
+
+// commandError --output json 时的错误输出
+type commandError struct {
+	Error      string `json:"error"`
+	StatusCode string `json:"status_code,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+}
+
+// commandFailed 输出错误并返回退出码（json 输出到标准输出，text 输出到标准错误）
+func commandFailed(output string, code int, msg string, err error) int {
+	if err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, err)
+	}
+	if output == "json" {
+		printJSON(commandError{Error: msg, StatusCode: apperrors.CodeOf(err), ExitCode: code})
+	} else {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	return code
+}
+
+// printJSON 以缩进的 JSON 输出到标准输出
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// formatLocalTime 以本地时间显示（零值显示为 -）
+func formatLocalTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
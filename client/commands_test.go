@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/hardware"
+	"sqlbots-client/license"
+	"sqlbots-client/protocol"
+)
+
+// commandEnv 设置子命令读取的环境变量（配置、凭据和许可证状态都在临时目录中），返回许可证状态文件路径
+func commandEnv(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("API_KEY", testAPIKey)
+	t.Setenv("ENCRYPTION_KEY", testEncryptionKey)
+	t.Setenv("ALLOW_LEGACY_KEY_EXCHANGE", "1")
+	path := filepath.Join(dir, "license-state")
+	t.Setenv("LICENSE_STATE_FILE", path)
+	return path
+}
+
+// saveLicenseState 保存一次成功心跳的许可证状态（与 newLicenseGuard 使用相同的本机密钥）
+func saveLicenseState(t *testing.T, path string) {
+	t.Helper()
+	machineKey, err := hardware.ProtectedID("sqlbots-license")
+	if err != nil {
+		t.Skipf("no machine ID: %v", err)
+	}
+	state := &license.State{
+		Username:   "test",
+		PlanType:   "pro",
+		ExpiresAt:  time.Now().Add(30 * 24 * time.Hour),
+		VerifiedAt: time.Now(),
+		Machine:    protocol.MachineInfo{ID: "record-1", Name: "test-machine", RegisteredAt: "2026-01-01T00:00:00Z"},
+	}
+	if err := license.NewStore(path, machineKey, testAPIKey).Save(state); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runCaptured 执行子命令，返回退出码和标准输出的内容（标准错误丢弃）
+func runCaptured(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutWriter, stderr
+	defer func() { os.Stdout, os.Stderr = savedStdout, savedStderr }()
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, stdout)
+		close(done)
+	}()
+	code := runCommand(args)
+	stdoutWriter.Close()
+	<-done
+	stdout.Close()
+	return code, buf.String()
+}
+
+// jsonKeys 返回 JSON 对象的键（排序后）
+func jsonKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRunCommandExitCodes(t *testing.T) {
+	commandEnv(t)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"help"}, apperrors.ExitOK},
+		{[]string{"--help"}, apperrors.ExitOK},
+		{[]string{"unknown"}, apperrors.ExitUsage},
+		{[]string{"version"}, apperrors.ExitOK},
+		{[]string{"version", "--output", "json"}, apperrors.ExitOK},
+		{[]string{"version", "-h"}, apperrors.ExitOK},
+		{[]string{"version", "--output", "yaml"}, apperrors.ExitUsage},
+		{[]string{"version", "--output", ""}, apperrors.ExitUsage},
+		{[]string{"version", "--unknown"}, apperrors.ExitUsage},
+		{[]string{"version", "extra"}, apperrors.ExitUsage},
+		{[]string{"status", "--output", "yaml"}, apperrors.ExitUsage},
+		{[]string{"machines", "--output", "xml"}, apperrors.ExitUsage},
+		{[]string{"whoami", "--output", "csv"}, apperrors.ExitUsage},
+		{[]string{"config"}, apperrors.ExitUsage},
+		{[]string{"config", "list"}, apperrors.ExitUsage},
+		{[]string{"status"}, apperrors.ExitFailure}, // 还没有心跳记录
+		{[]string{"machines"}, apperrors.ExitFailure},
+	}
+	for _, tt := range tests {
+		if code, _ := runCaptured(t, tt.args...); code != tt.want {
+			t.Errorf("%s: exit code %d, want %d", strings.Join(tt.args, " "), code, tt.want)
+		}
+	}
+
+	t.Setenv("API_KEY", "")
+	if code, _ := runCaptured(t, "status"); code != apperrors.ExitConfig {
+		t.Errorf("status without an API key: exit code %d, want %d", code, apperrors.ExitConfig)
+	}
+}
+
+// --output json 时错误也以 JSON 输出到标准输出
+func TestCommandJSONError(t *testing.T) {
+	commandEnv(t)
+
+	code, stdout := runCaptured(t, "status", "--output", "json")
+	var result commandError
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if code != apperrors.ExitFailure || result.ExitCode != code || !strings.Contains(result.Error, "No heartbeat recorded") {
+		t.Fatalf("exit code %d, output %+v", code, result)
+	}
+}
+
+func TestStatusAndMachinesOutput(t *testing.T) {
+	saveLicenseState(t, commandEnv(t))
+
+	machineKeys := []string{"cores", "environment", "id", "instance_id", "instance_source", "machine_id", "machine_name", "ram_gb", "registered_at"}
+
+	code, stdout := runCaptured(t, "status", "--output", "json")
+	if code != apperrors.ExitOK {
+		t.Fatalf("status: exit code %d", code)
+	}
+	var status map[string]any
+	if err := json.Unmarshal([]byte(stdout), &status); err != nil {
+		t.Fatalf("status: invalid JSON %q: %v", stdout, err)
+	}
+	want := []string{"expired", "expires_at", "last_heartbeat", "machine", "offline_deadline", "plan_type", "remaining", "username"}
+	if keys := jsonKeys(status); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("status keys: %v, want %v", keys, want)
+	}
+	if status["username"] != "test" || status["plan_type"] != "pro" || status["expired"] != false {
+		t.Fatalf("status: %s", stdout)
+	}
+	machine, _ := status["machine"].(map[string]any)
+	if keys := jsonKeys(machine); !reflect.DeepEqual(keys, machineKeys) {
+		t.Fatalf("status machine keys: %v, want %v", keys, machineKeys)
+	}
+	if machine["id"] != "record-1" {
+		t.Fatalf("status machine: %v", machine)
+	}
+
+	code, stdout = runCaptured(t, "machines", "--output", "json")
+	if code != apperrors.ExitOK {
+		t.Fatalf("machines: exit code %d", code)
+	}
+	var machines []map[string]any
+	if err := json.Unmarshal([]byte(stdout), &machines); err != nil || len(machines) != 1 {
+		t.Fatalf("machines: got %q (%v), want an array with one machine", stdout, err)
+	}
+	if keys := jsonKeys(machines[0]); !reflect.DeepEqual(keys, machineKeys) {
+		t.Fatalf("machines keys: %v, want %v", keys, machineKeys)
+	}
+
+	// 文本输出
+	if code, stdout = runCaptured(t, "status"); code != apperrors.ExitOK || !strings.Contains(stdout, "username       : test\n") {
+		t.Fatalf("status text: exit code %d, output:\n%s", code, stdout)
+	}
+	if code, stdout = runCaptured(t, "machines"); code != apperrors.ExitOK || !strings.Contains(stdout, "record-1") {
+		t.Fatalf("machines text: exit code %d, output:\n%s", code, stdout)
+	}
+}
+
+func TestVersionOutput(t *testing.T) {
+	code, stdout := runCaptured(t, "version", "--output", "json")
+	if code != apperrors.ExitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	var result map[string]any
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	for _, key := range []string{"version", "go_version", "platform"} {
+		if value, _ := result[key].(string); value == "" {
+			t.Errorf("missing %s in %s", key, stdout)
+		}
+	}
+	for key := range result {
+		if key != "version" && key != "commit" && key != "build_date" && key != "go_version" && key != "platform" {
+			t.Errorf("unexpected key %s", key)
+		}
+	}
+
+	if code, stdout = runCaptured(t, "version"); code != apperrors.ExitOK || !strings.HasPrefix(stdout, "sqlbots-client "+version+"\n") {
+		t.Fatalf("text: exit code %d, output:\n%s", code, stdout)
+	}
+}
+
+// refresh_config 重新读取配置时不能交互输入，启动时输入的 API Key 沿用原来的值
+func TestConfigReloaderKeepsPromptedValues(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configFile, []byte("encryption_key = \"0123456789abcdef\"\nallow_legacy_key_exchange = true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts := 0
+	opts := config.LoadOptions{
+		Args:        []string{"--config", configFile, "--credentials-file", filepath.Join(dir, "credentials")},
+		Getenv:      func(string) string { return "" },
+		Credentials: loadCredentials(false),
+		Prompt: func(key string) (string, error) {
+			prompts++
+			return "typed-key", nil
+		},
+	}
+	initial, err := config.Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompts != 1 || initial.Source("api_key") != config.SourcePrompt {
+		t.Fatalf("initial load: %d prompts, api_key from %s", prompts, initial.Source("api_key"))
+	}
+
+	reloaded, err := configReloader(opts, initial)()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if prompts != 1 {
+		t.Fatal("reload prompted for input")
+	}
+	if reloaded.APIKey != "typed-key" || reloaded.Source("api_key") != config.SourcePrompt {
+		t.Fatalf("api_key after reload: got %q from %s", reloaded.APIKey, reloaded.Source("api_key"))
+	}
+}
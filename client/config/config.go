@@ -1,9 +1,13 @@
 package config
 
 import (
-	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sqlbots-client/retry"
 )
 
 // Config 配置结构体
@@ -11,48 +15,125 @@ type Config struct {
 	APIKey        string
 	ServerURL     string
 	EncryptionKey string
+
+	// EncryptionSchemes 密钥交换时提供给服务器的加密方案（按优先级排序，为空时使用全部支持的方案）
+	EncryptionSchemes []string
+
+	// ServerPublicKey 固定的服务器 X25519 公钥（base64），用于密钥协商
+	ServerPublicKey string
+	// AllowLegacyKeyExchange 没有配置 ServerPublicKey 时允许使用旧的密钥交换流程（会话密钥由服务器生成并用 ENCRYPTION_KEY 加密）
+	//
+	// 默认关闭：旧流程没有前向保密，必须显式开启（ALLOW_LEGACY_KEY_EXCHANGE=1）。配置了 ServerPublicKey 后不论此项如何都不会回退到旧流程
+	AllowLegacyKeyExchange bool
+
+	// ClockSkewTolerance 校验服务器响应时间戳时允许的时钟偏差（为 0 时使用默认值 5 分钟）
+	ClockSkewTolerance time.Duration
+
+	// SessionRefreshFraction 会话密钥有效期过去多少比例时在后台刷新（0 到 1 之间，为 0 时使用默认值 0.75）
+	SessionRefreshFraction float64
+
+	// RetryPolicies 按接口路径（例如 /heartbeat）配置的重试策略，未配置的接口使用默认策略
+	RetryPolicies map[string]retry.Policy
+	// RetryMaxElapsed 默认策略下单次调用的最长重试时间（为 0 时使用默认值 2 分钟）
+	RetryMaxElapsed time.Duration
+	// CircuitBreakerThreshold 连续失败多少次后打开熔断器（为 0 时使用默认值 5）
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown 熔断器打开后多久允许试探请求（为 0 时使用默认值 30 秒）
+	CircuitBreakerCooldown time.Duration
+
+	// LicenseStateFile 保存许可证状态的文件（为空时使用用户配置目录下的 sqlbots/license.state）
+	LicenseStateFile string
+	// OfflineGracePeriod 服务器不可达时允许继续运行的时长（不超过许可证过期时间，为 0 时使用默认值 24 小时）
+	OfflineGracePeriod time.Duration
+	// LicenseWarnings 许可证过期前的提醒时间点（为空时使用默认值 30 天、7 天、1 天）
+	LicenseWarnings []time.Duration
+
+	// Headless 无界面模式：不清屏、不显示横幅、不交互式输入，输出结构化日志（标准输入不是终端时自动开启）
+	Headless bool
+	// LogFormat 无界面模式的日志格式：json 或 text（默认 json）
+	LogFormat string
+	// APIKeyFile 从文件读取 API Key（例如 Docker secrets），APIKey 为空时使用
+	APIKeyFile string
+	// EncryptionKeyFile 从文件读取加密密钥，EncryptionKey 为空时使用
+	EncryptionKeyFile string
+	// CredentialsFile login 保存的加密凭据文件（为空时使用用户配置目录下的 sqlbots/credentials.vault）
+	CredentialsFile string
+	// HashMachineID 发送按租户哈希的机器 ID 和实例 ID 代替原始值（默认开启）
+	//
+	// 服务器在迁移窗口内把原始 ID 登记的机器迁移到哈希 ID；服务器不支持迁移时可以关闭，继续发送原始 ID
+	HashMachineID bool
+	// RedactHostname 发送脱敏的主机名（host- 加哈希）代替真实主机名
+	RedactHostname bool
+	// Telemetry 在心跳中附带系统遥测数据（CPU、内存、交换分区、磁盘、网络、负载、运行时间）
+	Telemetry bool
+	// TelemetryInterval 遥测采样间隔（为 0 时使用默认值 30 秒）
+	TelemetryInterval time.Duration
+	// Collectors 启用的内置采集器（cpu、memory、disk、load、network、processes、uptime）
+	Collectors []string
+	// CollectorsDir 自定义采集脚本目录（每个可执行文件作为一个 exec 采集器，输出 JSON）
+	CollectorsDir string
+	// CollectorInterval 采集器的采集间隔（为 0 时使用默认值 1 分钟）
+	CollectorInterval time.Duration
+	// CollectorTimeout 单次采集的超时（为 0 时使用默认值 10 秒）
+	CollectorTimeout time.Duration
+	// WorkloadsFile 托管进程配置文件（JSON），客户端启动、监管这些进程，许可证失效时停止它们
+	WorkloadsFile string
+	// WorkloadStopTimeout 停止托管进程时等待退出的时间，超时后强制终止（为 0 时使用默认值 10 秒）
+	WorkloadStopTimeout time.Duration
+	// CommandPublicKey 服务器签名指令的 Ed25519 公钥（base64），为空时不执行服务器下发的指令
+	CommandPublicKey string
+	// AllowedCommands 允许执行的服务器指令（为空时使用默认白名单，deregister 需要显式允许）
+	AllowedCommands []string
+	// Push 保持与服务器的推送连接（Server-Sent Events），立即接收指令和许可证变化；连接不可用时自动回到 HTTP 轮询
+	Push bool
+	// InstanceID 固定的实例名称，代替自动检测的实例 ID（例如容器重建后仍然视为同一台机器）
+	// 编排部署的容器必须设置，否则每次重新部署都会注册为新机器
+	InstanceID string
+
+	sources map[string]Source // 每个配置项的来源
+	file    string            // 使用的配置文件
 }
 
-// LoadConfig 加载配置（从命令行参数和环境变量）
+// LoadConfig 加载配置（从配置文件、环境变量和命令行参数，不交互式输入）
 func LoadConfig() (*Config, error) {
-	config := &Config{}
+	return Load(LoadOptions{Args: os.Args[1:]})
+}
 
-	// 先读取环境变量作为默认值
-	defaultAPIKey := os.Getenv("API_KEY")
-	defaultServerURL := os.Getenv("SERVER_URL")
-	if defaultServerURL == "" {
-		defaultServerURL = "https://api.sqlbots.online"
+// ParseBool 解析布尔类型的环境变量（1/true/yes/on 为真）
+func ParseBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true
 	}
-	defaultEncryptionKey := os.Getenv("ENCRYPTION_KEY")
+	return false
+}
 
-	// 命令行参数
-	flag.StringVar(&config.APIKey, "api-key", defaultAPIKey, "API Key (required, can also use API_KEY env var)")
-	flag.StringVar(&config.ServerURL, "server-url", defaultServerURL, "Server URL (default: https://api.sqlbots.online)")
-	flag.StringVar(&config.EncryptionKey, "encryption-key", defaultEncryptionKey, "Encryption key (required, can also use ENCRYPTION_KEY env var)")
-	flag.Parse()
+// ParseDurationList 解析逗号分隔的时长列表（除 time.ParseDuration 支持的单位外，还支持 d 表示天）
+func ParseDurationList(value string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
 
-	// 如果命令行参数为空，再次尝试从环境变量读取
-	if config.APIKey == "" {
-		config.APIKey = os.Getenv("API_KEY")
-	}
-	if config.ServerURL == "" {
-		if envURL := os.Getenv("SERVER_URL"); envURL != "" {
-			config.ServerURL = envURL
+		var d time.Duration
+		if days, ok := strings.CutSuffix(part, "d"); ok {
+			n, err := strconv.ParseFloat(days, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse duration %q: %w", part, err)
+			}
+			d = time.Duration(n * float64(24*time.Hour))
 		} else {
-			config.ServerURL = "https://api.sqlbots.online"
+			var err error
+			if d, err = time.ParseDuration(part); err != nil {
+				return nil, fmt.Errorf("failed to parse duration %q: %w", part, err)
+			}
 		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration %q must be positive", part)
+		}
+		durations = append(durations, d)
 	}
-	if config.EncryptionKey == "" {
-		config.EncryptionKey = os.Getenv("ENCRYPTION_KEY")
-	}
-
-	// 验证必填字段
-	if config.APIKey == "" {
-		return nil, fmt.Errorf("API_KEY is required (use --api-key or API_KEY environment variable)")
-	}
-	if config.EncryptionKey == "" {
-		return nil, fmt.Errorf("ENCRYPTION_KEY is required (use --encryption-key or ENCRYPTION_KEY environment variable)")
-	}
-
-	return config, nil
+	return durations, nil
 }
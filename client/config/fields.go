@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field 配置项：同一个配置项可以来自配置文件、环境变量、命令行参数
+type field struct {
+	key      string // 配置文件中的键（config show 也使用）
+	env      string // 环境变量
+	flag     string // 命令行参数
+	usage    string // 命令行帮助
+	secret   bool   // 是否是敏感信息（config show --redacted 时隐藏）
+	boolean  bool   // 是否是布尔参数（命令行可以不带值）
+	required bool   // 是否必填
+	set      func(c *Config, value string) error
+	get      func(c *Config) string
+}
+
+// fields 所有配置项
+var fields = []field{
+	stringField("api_key", "API_KEY", "api-key", "API Key (required)", func(c *Config) *string { return &c.APIKey }).asSecret().asRequired(),
+	stringField("server_url", "SERVER_URL", "server-url", "Server URL (default: "+DefaultServerURL+")", func(c *Config) *string { return &c.ServerURL }),
+	stringField("encryption_key", "ENCRYPTION_KEY", "encryption-key", "Encryption key (required)", func(c *Config) *string { return &c.EncryptionKey }).asSecret().asRequired(),
+	listField("encryption_schemes", "ENCRYPTION_SCHEMES", "encryption-schemes", "Comma-separated encryption schemes offered during key exchange", func(c *Config) *[]string { return &c.EncryptionSchemes }),
+	stringField("server_public_key", "SERVER_PUBLIC_KEY", "server-public-key", "Pinned server X25519 public key (base64)", func(c *Config) *string { return &c.ServerPublicKey }),
+	boolField("allow_legacy_key_exchange", "ALLOW_LEGACY_KEY_EXCHANGE", "allow-legacy-key-exchange", "Allow the legacy key exchange when no server public key is pinned (default false)", func(c *Config) *bool { return &c.AllowLegacyKeyExchange }),
+	durationField("clock_skew_tolerance", "CLOCK_SKEW_TOLERANCE", "clock-skew-tolerance", "Allowed clock skew for server timestamps (default 5m)", func(c *Config) *time.Duration { return &c.ClockSkewTolerance }),
+	floatField("session_refresh_fraction", "SESSION_REFRESH_FRACTION", "session-refresh-fraction", "Fraction of the session key lifetime after which it is refreshed (default 0.75)", func(c *Config) *float64 { return &c.SessionRefreshFraction }),
+	durationField("retry_max_elapsed", "RETRY_MAX_ELAPSED", "retry-max-elapsed", "Maximum time spent retrying a server call (default 2m)", func(c *Config) *time.Duration { return &c.RetryMaxElapsed }),
+	intField("circuit_breaker_threshold", "CIRCUIT_BREAKER_THRESHOLD", "circuit-breaker-threshold", "Consecutive failures before the circuit breaker opens (default 5)", func(c *Config) *int { return &c.CircuitBreakerThreshold }),
+	durationField("circuit_breaker_cooldown", "CIRCUIT_BREAKER_COOLDOWN", "circuit-breaker-cooldown", "Time before an open circuit breaker allows a probe request (default 30s)", func(c *Config) *time.Duration { return &c.CircuitBreakerCooldown }),
+	stringField("license_state_file", "LICENSE_STATE_FILE", "license-state-file", "File storing the last verified license state", func(c *Config) *string { return &c.LicenseStateFile }),
+	durationField("offline_grace_period", "OFFLINE_GRACE_PERIOD", "offline-grace-period", "How long to keep running while the server is unreachable (default 24h)", func(c *Config) *time.Duration { return &c.OfflineGracePeriod }),
+	boolField("headless", "SQLBOTS_HEADLESS", "headless", "Run without the interactive UI and write structured logs", func(c *Config) *bool { return &c.Headless }),
+	stringField("log_format", "LOG_FORMAT", "log-format", "Log format in headless mode: json or text (default json)", func(c *Config) *string { return &c.LogFormat }),
+	stringField("api_key_file", "API_KEY_FILE", "api-key-file", "Read the API Key from a file", func(c *Config) *string { return &c.APIKeyFile }),
+	stringField("encryption_key_file", "ENCRYPTION_KEY_FILE", "encryption-key-file", "Read the encryption key from a file", func(c *Config) *string { return &c.EncryptionKeyFile }),
+	stringField("credentials_file", "CREDENTIALS_FILE", "credentials-file", "Encrypted credentials file written by login", func(c *Config) *string { return &c.CredentialsFile }),
+	stringField("instance_id", "INSTANCE_ID", "instance-id", "Stable instance name used instead of the detected container or VM instance (required for orchestrated containers)", func(c *Config) *string { return &c.InstanceID }),
+	boolField("hash_machine_id", "HASH_MACHINE_ID", "hash-machine-id", "Send a per-tenant hash instead of the raw machine ID (default true; set to false only for servers that cannot migrate raw IDs)", func(c *Config) *bool { return &c.HashMachineID }),
+	boolField("redact_hostname", "REDACT_HOSTNAME", "redact-hostname", "Send a hashed placeholder instead of the real hostname", func(c *Config) *bool { return &c.RedactHostname }),
+	boolField("telemetry", "TELEMETRY", "telemetry", "Include CPU, memory, disk, network and load telemetry in heartbeats", func(c *Config) *bool { return &c.Telemetry }),
+	durationField("telemetry_interval", "TELEMETRY_INTERVAL", "telemetry-interval", "Telemetry sampling interval (default 30s)", func(c *Config) *time.Duration { return &c.TelemetryInterval }),
+	listField("collectors", "COLLECTORS", "collectors", "Comma-separated built-in metric collectors: cpu,memory,disk,load,network,processes,uptime", func(c *Config) *[]string { return &c.Collectors }),
+	stringField("collectors_dir", "COLLECTORS_DIR", "collectors-dir", "Directory of scripts run as metric collectors (JSON output)", func(c *Config) *string { return &c.CollectorsDir }),
+	durationField("collector_interval", "COLLECTOR_INTERVAL", "collector-interval", "Metric collection interval (default 1m)", func(c *Config) *time.Duration { return &c.CollectorInterval }),
+	durationField("collector_timeout", "COLLECTOR_TIMEOUT", "collector-timeout", "Timeout of a single metric collection (default 10s)", func(c *Config) *time.Duration { return &c.CollectorTimeout }),
+	stringField("workloads_file", "WORKLOADS_FILE", "workloads-file", "JSON file of bot processes started and supervised by the client", func(c *Config) *string { return &c.WorkloadsFile }),
+	durationField("workload_stop_timeout", "WORKLOAD_STOP_TIMEOUT", "workload-stop-timeout", "Time to wait for supervised processes to exit before killing them (default 10s)", func(c *Config) *time.Duration { return &c.WorkloadStopTimeout }),
+	stringField("command_public_key", "COMMAND_PUBLIC_KEY", "command-public-key", "Server Ed25519 public key (base64) that signs commands in heartbeat responses; empty = reject all commands", func(c *Config) *string { return &c.CommandPublicKey }),
+	listField("allowed_commands", "ALLOWED_COMMANDS", "allowed-commands", "Comma-separated server commands this machine executes (default refresh_config,rotate_keys,restart_workload,collect_diagnostics)", func(c *Config) *[]string { return &c.AllowedCommands }),
+	boolField("push", "PUSH", "push", "Keep a push connection (Server-Sent Events) to the server for immediate commands and license changes (falls back to polling)", func(c *Config) *bool { return &c.Push }),
+	durationListField("license_warnings", "LICENSE_WARNINGS", "license-warnings", "Comma-separated license expiry warning thresholds, e.g. 30d,7d,1d", func(c *Config) *[]time.Duration { return &c.LicenseWarnings }),
+}
+
+// lookupField 按配置文件中的键查找配置项
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// asSecret 标记为敏感信息
+func (f field) asSecret() field {
+	f.secret = true
+	return f
+}
+
+// asRequired 标记为必填
+func (f field) asRequired() field {
+	f.required = true
+	return f
+}
+
+// stringField 字符串配置项
+func stringField(key, env, flagName, usage string, ptr func(c *Config) *string) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			*ptr(c) = strings.TrimSpace(value)
+			return nil
+		},
+		get: func(c *Config) string { return *ptr(c) },
+	}
+}
+
+// boolField 布尔配置项（1/true/yes/on 为真，0/false/no/off 为假）
+func boolField(key, env, flagName, usage string, ptr func(c *Config) *bool) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage, boolean: true,
+		set: func(c *Config, value string) error {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "1", "true", "yes", "on":
+				*ptr(c) = true
+			case "", "0", "false", "no", "off":
+				*ptr(c) = false
+			default:
+				return fmt.Errorf("invalid boolean %q", value)
+			}
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatBool(*ptr(c)) },
+	}
+}
+
+// durationField 时长配置项
+func durationField(key, env, flagName, usage string, ptr func(c *Config) *time.Duration) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return err
+			}
+			*ptr(c) = d
+			return nil
+		},
+		get: func(c *Config) string {
+			if *ptr(c) == 0 {
+				return ""
+			}
+			return ptr(c).String()
+		},
+	}
+}
+
+// floatField 浮点数配置项
+func floatField(key, env, flagName, usage string, ptr func(c *Config) *float64) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = n
+			return nil
+		},
+		get: func(c *Config) string {
+			if *ptr(c) == 0 {
+				return ""
+			}
+			return strconv.FormatFloat(*ptr(c), 'f', -1, 64)
+		},
+	}
+}
+
+// intField 整数配置项
+func intField(key, env, flagName, usage string, ptr func(c *Config) *int) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return err
+			}
+			*ptr(c) = n
+			return nil
+		},
+		get: func(c *Config) string {
+			if *ptr(c) == 0 {
+				return ""
+			}
+			return strconv.Itoa(*ptr(c))
+		},
+	}
+}
+
+// listField 逗号分隔的字符串列表配置项
+func listField(key, env, flagName, usage string, ptr func(c *Config) *[]string) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*ptr(c) = items
+			return nil
+		},
+		get: func(c *Config) string { return strings.Join(*ptr(c), ",") },
+	}
+}
+
+// durationListField 逗号分隔的时长列表配置项（支持 d 表示天）
+func durationListField(key, env, flagName, usage string, ptr func(c *Config) *[]time.Duration) field {
+	return field{
+		key: key, env: env, flag: flagName, usage: usage,
+		set: func(c *Config, value string) error {
+			durations, err := ParseDurationList(value)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = durations
+			return nil
+		},
+		get: func(c *Config) string {
+			parts := make([]string, 0, len(*ptr(c)))
+			for _, d := range *ptr(c) {
+				parts = append(parts, d.String())
+			}
+			return strings.Join(parts, ",")
+		},
+	}
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultConfigNames 默认配置文件名（按顺序查找第一个存在的文件）
+var defaultConfigNames = []string{"config.toml", "config.yaml", "config.yml"}
+
+// DefaultConfigDir 默认配置目录（Linux 为 $XDG_CONFIG_HOME/sqlbots 或 ~/.config/sqlbots）
+func DefaultConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(dir, "sqlbots"), nil
+}
+
+// findConfigFile 查找默认配置文件（不存在时返回空字符串）
+func findConfigFile() string {
+	dir, err := DefaultConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range defaultConfigNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readConfigFile 读取配置文件，返回 键 -> 值（列表用逗号连接）
+//
+// 只支持扁平的键值对，兼容 TOML 和 YAML 的常用写法：
+//
+//	server_url = "https://api.sqlbots.online"   # TOML
+//	server_url: https://api.sqlbots.online      # YAML
+//	encryption_schemes = ["aes-256-gcm"]        # TOML 数组
+//	license_warnings:                           # YAML 列表
+//	  - 30d
+//	  - 7d
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseConfig 解析配置文件内容
+func parseConfig(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	listKey := "" // 正在读取的 YAML 列表的键
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+
+		// YAML 列表项
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			value, err := parseScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if values[listKey] != "" {
+				value = values[listKey] + "," + value
+			}
+			values[listKey] = value
+			continue
+		}
+		listKey = ""
+
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported, use top-level keys", lineNo)
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(line[:sep]), "-", "_"))
+		raw := strings.TrimSpace(line[sep+1:])
+
+		if _, ok := lookupField(key); !ok {
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNo, key)
+		}
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+
+		if raw == "" {
+			// YAML 列表的开始
+			listKey = key
+			values[key] = ""
+			continue
+		}
+
+		value, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// parseValue 解析值（标量或数组，数组用逗号连接）
+func parseValue(raw string) (string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		return parseScalar(raw)
+	}
+	if !strings.HasSuffix(raw, "]") {
+		return "", fmt.Errorf("unterminated array")
+	}
+
+	var items []string
+	for _, item := range splitArray(raw[1 : len(raw)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, err := parseScalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// parseScalar 解析标量（去掉引号）
+func parseScalar(raw string) (string, error) {
+	if len(raw) >= 2 {
+		switch {
+		case raw[0] == '"' && raw[len(raw)-1] == '"':
+			value, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", fmt.Errorf("invalid string %s", raw)
+			}
+			return value, nil
+		case raw[0] == '\'' && raw[len(raw)-1] == '\'':
+			return raw[1 : len(raw)-1], nil
+		}
+	}
+	return raw, nil
+}
+
+// splitArray 按逗号分割数组元素（忽略引号内的逗号）
+func splitArray(s string) []string {
+	var items []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// stripComment 去掉 # 开始的注释（忽略引号内的 #）
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
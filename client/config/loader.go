@@ -0,0 +1,365 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"sqlbots-client/encryption"
+)
+
+// DefaultServerURL 默认服务器地址
+const DefaultServerURL = "https://api.sqlbots.online"
+
+// Source 配置值的来源
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourcePrompt  Source = "prompt"
+	SourceSecret  Source = "secret file"
+	SourceVault   Source = "credentials"
+)
+
+// LoadOptions 加载选项
+type LoadOptions struct {
+	// Name 命令名（命令行帮助中显示，为空时使用 sqlbots-client）
+	Name string
+	// Args 命令行参数（不含程序名）
+	Args []string
+	// Getenv 读取环境变量（为 nil 时使用 os.Getenv）
+	Getenv func(key string) string
+	// Credentials 读取 login 保存的 API Key 和加密密钥（为 nil 时不读取）
+	// 只在命令行参数、环境变量、配置文件和密钥文件都没有提供时调用
+	Credentials func(cfg *Config) (apiKey, encryptionKey string, err error)
+	// Prompt 必填项缺失时交互式输入（为 nil 时不提示，直接报错）
+	Prompt func(key string) (string, error)
+	// ExtraFlags 注册额外的命令行参数（例如子命令自己的参数）
+	ExtraFlags func(fs *flag.FlagSet)
+	// Output 命令行帮助输出（为 nil 时使用 os.Stderr）
+	Output io.Writer
+	// SkipValidation 不校验配置（例如 config show 需要显示不完整的配置）
+	SkipValidation bool
+}
+
+// flagValue 记录命令行参数是否被设置
+type flagValue struct {
+	value   string
+	set     bool
+	boolean bool
+}
+
+func (v *flagValue) String() string   { return v.value }
+func (v *flagValue) IsBoolFlag() bool { return v.boolean }
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	v.set = true
+	return nil
+}
+
+// Load 按优先级合并配置：命令行参数 > 环境变量 > 配置文件 > 默认值
+// API Key 和加密密钥仍然缺失时依次读取密钥文件、login 保存的凭据，最后交互式输入
+//
+// 配置文件路径依次取 --config、SQLBOTS_CONFIG 环境变量、默认配置目录下的 config.toml / config.yaml
+func Load(opts LoadOptions) (*Config, error) {
+	getenv := opts.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+
+	// 解析命令行参数（先解析才能知道 --config）
+	name := opts.Name
+	if name == "" {
+		name = "sqlbots-client"
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if opts.Output != nil {
+		fs.SetOutput(opts.Output)
+	}
+	configPath := fs.String("config", "", "Config file (TOML or YAML, can also use SQLBOTS_CONFIG env var)")
+	flagValues := make(map[string]*flagValue, len(fields))
+	for _, f := range fields {
+		v := &flagValue{boolean: f.boolean}
+		flagValues[f.key] = v
+		fs.Var(v, f.flag, fmt.Sprintf("%s (can also use %s env var)", f.usage, f.env))
+	}
+	if opts.ExtraFlags != nil {
+		opts.ExtraFlags(fs)
+	}
+	if err := fs.Parse(opts.Args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg := &Config{
+		ServerURL:     DefaultServerURL,
+		HashMachineID: true,
+		sources:       make(map[string]Source),
+	}
+
+	// 配置文件
+	path := *configPath
+	if path == "" {
+		path = getenv("SQLBOTS_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		path = findConfigFile()
+	}
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			if explicit || !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		for _, f := range fields {
+			if value, ok := values[f.key]; ok {
+				if err := cfg.apply(f, value, SourceFile); err != nil {
+					return nil, err
+				}
+			}
+		}
+		cfg.file = path
+	}
+
+	// 环境变量
+	for _, f := range fields {
+		if value := getenv(f.env); value != "" {
+			if err := cfg.apply(f, value, SourceEnv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 命令行参数
+	for _, f := range fields {
+		if v := flagValues[f.key]; v.set {
+			if err := cfg.apply(f, v.value, SourceFlag); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 从文件读取密钥（按来源优先级比较，同一来源中直接设置的值优先）
+	if err := cfg.readSecretFile("api_key", &cfg.APIKey, "api_key_file", cfg.APIKeyFile); err != nil {
+		return nil, err
+	}
+	if err := cfg.readSecretFile("encryption_key", &cfg.EncryptionKey, "encryption_key_file", cfg.EncryptionKeyFile); err != nil {
+		return nil, err
+	}
+
+	// login 保存的凭据
+	if opts.Credentials != nil && (cfg.APIKey == "" || cfg.EncryptionKey == "") {
+		apiKey, encryptionKey, err := opts.Credentials(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load saved credentials: %w", err)
+		}
+		if cfg.APIKey == "" && apiKey != "" {
+			cfg.APIKey = apiKey
+			cfg.sources["api_key"] = SourceVault
+		}
+		if cfg.EncryptionKey == "" && encryptionKey != "" {
+			cfg.EncryptionKey = encryptionKey
+			cfg.sources["encryption_key"] = SourceVault
+		}
+	}
+
+	// 交互式输入（无界面模式下不提示）
+	if opts.Prompt != nil && !cfg.Headless {
+		for _, f := range fields {
+			if !f.required || f.get(cfg) != "" {
+				continue
+			}
+			value, err := opts.Prompt(f.key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.key, err)
+			}
+			if err := cfg.apply(f, value, SourcePrompt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !opts.SkipValidation {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// apply 设置配置项并记录来源
+func (c *Config) apply(f field, value string, source Source) error {
+	if err := f.set(c, value); err != nil {
+		return fmt.Errorf("invalid %s from %s: %w", f.key, source, err)
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[f.key] = source
+	return nil
+}
+
+// readSecretFile 配置了文件且值为空、或文件路径来自更高优先级的来源时，从文件读取（去掉首尾空白）
+//
+// 例如配置文件中的 api_key 不会覆盖命令行参数 --api-key-file
+func (c *Config) readSecretFile(key string, value *string, fileKey, path string) error {
+	if path == "" {
+		return nil
+	}
+	if *value != "" && sourceRank(c.Source(fileKey)) <= sourceRank(c.Source(key)) {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %w", key, err)
+	}
+	*value = strings.TrimSpace(string(data))
+	c.sources[key] = SourceSecret
+	return nil
+}
+
+// sourceRank 合并配置时来源的优先级（数值越大优先级越高）
+func sourceRank(source Source) int {
+	switch source {
+	case SourceFile:
+		return 1
+	case SourceEnv:
+		return 2
+	case SourceFlag:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Source 返回配置项的来源（未设置时为 default）
+func (c *Config) Source(key string) Source {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Value 返回配置项的值（与 config show 显示的格式相同，未知的配置项返回空字符串）
+func (c *Config) Value(key string) string {
+	if f, ok := lookupField(key); ok {
+		return f.get(c)
+	}
+	return ""
+}
+
+// File 返回使用的配置文件路径（没有使用配置文件时为空）
+func (c *Config) File() string {
+	return c.file
+}
+
+// Changed 返回两份配置中值不同的配置项（按配置项顺序）
+func Changed(old, current *Config) []string {
+	var keys []string
+	for _, f := range fields {
+		if f.get(old) != f.get(current) {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+// Validate 校验所有配置项，返回全部错误
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.APIKey == "" {
+		errs = append(errs, fmt.Errorf("api_key is required (use --api-key, API_KEY, the config file or login)"))
+	} else if len(c.APIKey) > 256 || strings.ContainsAny(c.APIKey, " \t\r\n") {
+		errs = append(errs, fmt.Errorf("api_key must be at most 256 characters without whitespace"))
+	}
+
+	if u, err := url.Parse(c.ServerURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("server_url must be an http:// or https:// URL (got %q)", c.ServerURL))
+	}
+
+	if c.EncryptionKey == "" {
+		errs = append(errs, fmt.Errorf("encryption_key is required (use --encryption-key, ENCRYPTION_KEY, the config file or login)"))
+	} else if len(c.EncryptionKey) < 16 {
+		errs = append(errs, fmt.Errorf("encryption_key must be at least 16 characters"))
+	}
+
+	for _, scheme := range c.EncryptionSchemes {
+		supported := false
+		for _, s := range encryption.SupportedSchemes {
+			if s == scheme {
+				supported = true
+			}
+		}
+		if !supported {
+			errs = append(errs, fmt.Errorf("encryption_schemes: unsupported scheme %q (supported: %s)", scheme, strings.Join(encryption.SupportedSchemes, ", ")))
+		}
+	}
+
+	if c.ServerPublicKey != "" {
+		if _, err := encryption.ParseX25519PublicKey(c.ServerPublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("server_public_key: %w", err))
+		}
+	} else if !c.AllowLegacyKeyExchange {
+		errs = append(errs, fmt.Errorf("server_public_key is required unless the legacy key exchange is allowed (set SERVER_PUBLIC_KEY, or ALLOW_LEGACY_KEY_EXCHANGE=1 for servers without x25519 key agreement)"))
+	}
+
+	if c.CommandPublicKey != "" {
+		if _, err := encryption.ParseEd25519PublicKey(c.CommandPublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("command_public_key: %w", err))
+		}
+	}
+
+	if c.SessionRefreshFraction < 0 || c.SessionRefreshFraction >= 1 {
+		errs = append(errs, fmt.Errorf("session_refresh_fraction must be between 0 and 1 (got %v)", c.SessionRefreshFraction))
+	}
+	if c.ClockSkewTolerance < 0 || c.RetryMaxElapsed < 0 || c.CircuitBreakerCooldown < 0 || c.OfflineGracePeriod < 0 ||
+		c.TelemetryInterval < 0 || c.CollectorInterval < 0 || c.CollectorTimeout < 0 || c.WorkloadStopTimeout < 0 {
+		errs = append(errs, fmt.Errorf("durations must not be negative"))
+	}
+	if c.LogFormat != "" && c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("log_format must be json or text (got %q)", c.LogFormat))
+	}
+	if c.CircuitBreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("circuit_breaker_threshold must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Show 以配置文件格式输出当前配置和每一项的来源（redacted 为 true 时隐藏敏感信息）
+func (c *Config) Show(w io.Writer, redacted bool) {
+	if c.file != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.file)
+	}
+	for _, f := range fields {
+		value := f.get(c)
+		if redacted && f.secret {
+			value = Redact(value)
+		}
+		fmt.Fprintf(w, "%s = %q  # %s\n", f.key, value, c.Source(f.key))
+	}
+}
+
+// Redact 隐藏敏感信息（只保留最后 4 个字符）
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
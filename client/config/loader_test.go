@@ -0,0 +1,241 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sqlbots-client/encryption"
+)
+
+// writeFile 在临时目录中写入文件，返回路径
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// load 使用给定的参数和环境变量加载配置（不读取真实环境和默认配置文件）
+func load(t *testing.T, args []string, env map[string]string) *Config {
+	t.Helper()
+	if env == nil {
+		env = map[string]string{}
+	}
+	if _, ok := env["SQLBOTS_CONFIG"]; !ok {
+		env["SQLBOTS_CONFIG"] = writeFile(t, "empty.toml", "")
+	}
+	cfg, err := Load(LoadOptions{
+		Args:           args,
+		Getenv:         func(key string) string { return env[key] },
+		SkipValidation: true,
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return cfg
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.toml", "server_url = \"https://file.example\"\napi_key = \"file-key\"\nencryption_key = \"file-enc\"\n")
+
+	cfg := load(t, []string{"--config", file, "--api-key", "flag-key"}, map[string]string{
+		"API_KEY":        "env-key",
+		"ENCRYPTION_KEY": "env-enc",
+	})
+
+	if cfg.ServerURL != "https://file.example" || cfg.Source("server_url") != SourceFile {
+		t.Errorf("server_url: got %q from %s", cfg.ServerURL, cfg.Source("server_url"))
+	}
+	if cfg.EncryptionKey != "env-enc" || cfg.Source("encryption_key") != SourceEnv {
+		t.Errorf("encryption_key: got %q from %s", cfg.EncryptionKey, cfg.Source("encryption_key"))
+	}
+	if cfg.APIKey != "flag-key" || cfg.Source("api_key") != SourceFlag {
+		t.Errorf("api_key: got %q from %s", cfg.APIKey, cfg.Source("api_key"))
+	}
+	if cfg.Source("headless") != SourceDefault {
+		t.Errorf("headless: got source %s, want default", cfg.Source("headless"))
+	}
+}
+
+// 旧的密钥交换流程没有前向保密，只有显式开启时才允许
+func TestLoadLegacyKeyExchangeDefault(t *testing.T) {
+	if cfg := load(t, nil, nil); cfg.AllowLegacyKeyExchange || cfg.Source("allow_legacy_key_exchange") != SourceDefault {
+		t.Errorf("default: got %v from %s", cfg.AllowLegacyKeyExchange, cfg.Source("allow_legacy_key_exchange"))
+	}
+	if cfg := load(t, nil, map[string]string{"ALLOW_LEGACY_KEY_EXCHANGE": "1"}); !cfg.AllowLegacyKeyExchange {
+		t.Error("ALLOW_LEGACY_KEY_EXCHANGE=1 did not enable the legacy key exchange")
+	}
+}
+
+// 默认发送按租户哈希的机器 ID，可以显式关闭
+func TestLoadHashMachineIDDefault(t *testing.T) {
+	if cfg := load(t, nil, nil); !cfg.HashMachineID || cfg.Source("hash_machine_id") != SourceDefault {
+		t.Errorf("default: got %v from %s", cfg.HashMachineID, cfg.Source("hash_machine_id"))
+	}
+	if cfg := load(t, nil, map[string]string{"HASH_MACHINE_ID": "false"}); cfg.HashMachineID {
+		t.Error("HASH_MACHINE_ID=false did not disable hashing")
+	}
+}
+
+// 无界面模式下缺少必填项时直接报错，不交互式输入
+func TestLoadHeadlessDisablesPrompt(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		headless bool
+	}{
+		{"interactive", nil, nil, false},
+		{"headless flag", []string{"--headless"}, nil, true},
+		{"headless env", nil, map[string]string{"SQLBOTS_HEADLESS": "true"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{
+				"SQLBOTS_CONFIG":            writeFile(t, "empty.toml", ""),
+				"SERVER_URL":                "https://api.example",
+				"ALLOW_LEGACY_KEY_EXCHANGE": "1",
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			var prompted []string
+			cfg, err := Load(LoadOptions{
+				Args:   tt.args,
+				Getenv: func(key string) string { return env[key] },
+				Prompt: func(key string) (string, error) {
+					prompted = append(prompted, key)
+					return "prompted-" + key + "-0123456789", nil
+				},
+			})
+
+			if !tt.headless {
+				if err != nil {
+					t.Fatalf("load: %v", err)
+				}
+				if len(prompted) != 2 || cfg.Source("api_key") != SourcePrompt || cfg.APIKey != "prompted-api_key-0123456789" {
+					t.Fatalf("prompted %v, api_key %q from %s", prompted, cfg.APIKey, cfg.Source("api_key"))
+				}
+				return
+			}
+			if len(prompted) != 0 {
+				t.Fatalf("prompted for %v in headless mode", prompted)
+			}
+			if err == nil || !strings.Contains(err.Error(), "api_key is required") {
+				t.Fatalf("got %v, want a missing api_key error", err)
+			}
+		})
+	}
+}
+
+// 没有固定服务器公钥又不允许旧的密钥交换时无法登录，校验时就报告
+func TestValidateRequiresKeyExchange(t *testing.T) {
+	publicKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := Config{APIKey: "api-key", ServerURL: "https://api.example", EncryptionKey: "0123456789abcdef"}
+
+	tests := []struct {
+		name            string
+		serverPublicKey string
+		allowLegacy     bool
+		wantErr         bool
+	}{
+		{"neither", "", false, true},
+		{"pinned key", encryption.EncodeX25519PublicKey(publicKey.PublicKey()), false, false},
+		{"legacy allowed", "", true, false},
+	}
+	for _, tt := range tests {
+		cfg := base
+		cfg.ServerPublicKey, cfg.AllowLegacyKeyExchange = tt.serverPublicKey, tt.allowLegacy
+		err := cfg.Validate()
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: got %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !(strings.Contains(err.Error(), "SERVER_PUBLIC_KEY") && strings.Contains(err.Error(), "ALLOW_LEGACY_KEY_EXCHANGE")) {
+			t.Errorf("%s: error does not name the settings: %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoadSecretFilePrecedence(t *testing.T) {
+	secret := writeFile(t, "api_key", "  secret-key\n")
+
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		env    map[string]string
+		want   string
+		source Source
+	}{
+		{
+			name:   "flag file beats config file value",
+			config: "api_key = \"file-key\"\n",
+			args:   []string{"--api-key-file", secret},
+			want:   "secret-key",
+			source: SourceSecret,
+		},
+		{
+			name:   "env file beats config file value",
+			config: "api_key = \"file-key\"\n",
+			env:    map[string]string{"API_KEY_FILE": secret},
+			want:   "secret-key",
+			source: SourceSecret,
+		},
+		{
+			name:   "flag value beats env file",
+			args:   []string{"--api-key", "flag-key"},
+			env:    map[string]string{"API_KEY_FILE": secret},
+			want:   "flag-key",
+			source: SourceFlag,
+		},
+		{
+			name:   "direct value wins within the same source",
+			config: "api_key = \"file-key\"\napi_key_file = \"" + filepath.ToSlash(secret) + "\"\n",
+			want:   "file-key",
+			source: SourceFile,
+		},
+		{
+			name:   "file used when no value is set",
+			args:   []string{"--api-key-file", secret},
+			want:   "secret-key",
+			source: SourceSecret,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			args := tt.args
+			if tt.config != "" {
+				args = append([]string{"--config", writeFile(t, "config.toml", tt.config)}, args...)
+			}
+
+			cfg := load(t, args, env)
+			if cfg.APIKey != tt.want || cfg.Source("api_key") != tt.source {
+				t.Fatalf("api_key: got %q from %s, want %q from %s", cfg.APIKey, cfg.Source("api_key"), tt.want, tt.source)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidValue(t *testing.T) {
+	file := writeFile(t, "config.toml", "")
+	_, err := Load(LoadOptions{
+		Args:           []string{"--config", file, "--headless=maybe"},
+		Getenv:         func(string) string { return "" },
+		SkipValidation: true,
+	})
+	if err == nil {
+		t.Fatal("invalid boolean accepted")
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/credentials"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/hardware"
+	"sqlbots-client/keyexchange"
+	"sqlbots-client/protocol"
+	"sqlbots-client/session"
+	"sqlbots-client/ui"
+)
+
+// passphraseEnv 保护凭据的口令（无界面模式下无法交互输入时使用）
+const passphraseEnv = "CREDENTIALS_PASSPHRASE"
+
+// newVault 创建凭据文件存储（默认使用本机绑定的密钥加密）
+func newVault(cfg *config.Config) (*credentials.Vault, error) {
+	path := cfg.CredentialsFile
+	if path == "" {
+		var err error
+		if path, err = credentials.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	machineKey, err := hardware.ProtectedID("sqlbots-credentials")
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewVault(path, machineKey), nil
+}
+
+// loadCredentials 读取 login 保存的凭据（没有保存时返回空值）
+// 凭据用口令保护时，依次使用 CREDENTIALS_PASSPHRASE 环境变量和交互式输入
+func loadCredentials(interactive bool) func(cfg *config.Config) (string, string, error) {
+	return func(cfg *config.Config) (string, string, error) {
+		creds, err := openVault(cfg, interactive)
+		if errors.Is(err, credentials.ErrNoCredentials) {
+			return "", "", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return creds.APIKey, creds.EncryptionKey, nil
+	}
+}
+
+// openVault 读取并解密保存的凭据
+func openVault(cfg *config.Config, interactive bool) (*credentials.Credentials, error) {
+	vault, err := newVault(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := vault.Load(os.Getenv(passphraseEnv))
+	if !errors.Is(err, credentials.ErrPassphraseRequired) || !interactive {
+		return creds, err
+	}
+
+	ui.ShowPrompt("passphrase")
+	passphrase, err := ui.HideInput()
+	fmt.Println()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return vault.Load(passphrase)
+}
+
+// promptLoginValue login 时交互式输入 API Key 和加密密钥
+func promptLoginValue(key string) (string, error) {
+	switch key {
+	case "api_key":
+		ui.ShowLoginPrompt()
+	case "encryption_key":
+		ui.ShowPrompt("encryption key")
+	default:
+		return "", nil
+	}
+
+	value, err := ui.HideInput()
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// readNewPassphrase 读取新的口令（交互式输入时需要输入两次确认）
+func readNewPassphrase(interactive bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !interactive {
+		return "", fmt.Errorf("%s is required to protect credentials with a passphrase", passphraseEnv)
+	}
+
+	ui.ShowPrompt("new passphrase")
+	passphrase, err := ui.HideInput()
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+
+	ui.ShowPrompt("passphrase again")
+	confirm, err := ui.HideInput()
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// loginResult login 的输出
+type loginResult struct {
+	Username        string `json:"username"`
+	CredentialsFile string `json:"credentials_file"`
+	Protection      string `json:"protection"`
+}
+
+// runLogin 向服务器验证 API Key 和加密密钥，成功后加密保存到本地
+func runLogin(args []string) int {
+	var output string
+	var usePassphrase bool
+	interactive := ui.IsTerminal()
+	loadOptions := config.LoadOptions{
+		ExtraFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&usePassphrase, "passphrase", false, "Protect saved credentials with a passphrase instead of this machine's ID (can also use "+passphraseEnv+" env var)")
+		},
+	}
+	if interactive {
+		loadOptions.Prompt = promptLoginValue
+	}
+	cfg, code := loadCommandConfig("login", args, &output, loadOptions)
+	if cfg == nil {
+		return code
+	}
+
+	// 保存前先验证凭据，避免保存错误的 API Key
+	client := protocol.NewClient(cfg, session.NewManager())
+	username, err := keyexchange.Exchange(context.Background(), client)
+	if err != nil {
+		return commandFailed(output, apperrors.ExitCode(err), "Login failed", err)
+	}
+
+	passphrase := ""
+	if usePassphrase {
+		if passphrase, err = readNewPassphrase(interactive); err != nil {
+			return commandFailed(output, apperrors.ExitConfig, "Login failed", err)
+		}
+	}
+
+	vault, err := newVault(cfg)
+	if err == nil {
+		err = vault.Save(&credentials.Credentials{
+			APIKey:        cfg.APIKey,
+			EncryptionKey: cfg.EncryptionKey,
+			Username:      username,
+			ServerURL:     cfg.ServerURL,
+			SavedAt:       time.Now().UTC(),
+		}, passphrase)
+	}
+	if err != nil {
+		return commandFailed(output, apperrors.ExitFailure, "Failed to save credentials", err)
+	}
+
+	result := loginResult{Username: username, CredentialsFile: vault.Path(), Protection: string(credentials.ProtectionMachine)}
+	if passphrase != "" {
+		result.Protection = string(credentials.ProtectionPassphrase)
+	}
+	if output == "json" {
+		printJSON(result)
+		return apperrors.ExitOK
+	}
+
+	if username == "" {
+		username = "User"
+	}
+	fmt.Printf("Logged in as %s\n", username)
+	fmt.Printf("Credentials saved to %s\n", vault.Path())
+	return apperrors.ExitOK
+}
+
+// runLogout 删除保存的凭据
+func runLogout(args []string) int {
+	var output string
+	cfg, code := loadCommandConfig("logout", args, &output, config.LoadOptions{SkipValidation: true})
+	if cfg == nil {
+		return code
+	}
+
+	vault, err := newVault(cfg)
+	if err == nil {
+		err = vault.Clear()
+	}
+	removed := err == nil
+	if errors.Is(err, credentials.ErrNoCredentials) {
+		err = nil
+	}
+	if err != nil {
+		return commandFailed(output, apperrors.ExitFailure, "Logout failed", err)
+	}
+
+	switch {
+	case output == "json":
+		printJSON(map[string]any{"removed": removed, "credentials_file": vault.Path()})
+	case removed:
+		fmt.Printf("Removed saved credentials %s\n", vault.Path())
+	default:
+		fmt.Println("Not logged in")
+	}
+	return apperrors.ExitOK
+}
+
+// whoamiResult whoami 的输出
+type whoamiResult struct {
+	Username   string     `json:"username"`
+	APIKey     string     `json:"api_key"` // 部分隐藏
+	ServerURL  string     `json:"server_url,omitempty"`
+	LoggedInAt time.Time  `json:"logged_in_at"`
+	PlanType   string     `json:"plan_type,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // 为空表示不过期或没有许可证状态
+}
+
+// runWhoami 显示保存的凭据对应的用户和许可证状态（不连接服务器）
+func runWhoami(args []string) int {
+	var output string
+	cfg, code := loadCommandConfig("whoami", args, &output, config.LoadOptions{SkipValidation: true})
+	if cfg == nil {
+		return code
+	}
+
+	creds, err := openVault(cfg, ui.IsTerminal())
+	if errors.Is(err, credentials.ErrNoCredentials) {
+		return commandFailed(output, apperrors.ExitFailure, "Not logged in", nil)
+	}
+	if err != nil {
+		return commandFailed(output, apperrors.ExitFailure, "Failed to read credentials", err)
+	}
+
+	result := whoamiResult{
+		Username:   creds.Username,
+		APIKey:     config.Redact(creds.APIKey),
+		ServerURL:  creds.ServerURL,
+		LoggedInAt: creds.SavedAt,
+	}
+
+	// 最近一次心跳确认的许可证状态
+	cfg.APIKey = creds.APIKey
+	if licenseGuard, err := newLicenseGuard(cfg); err == nil {
+		if status := licenseGuard.Status(time.Now()); status.Known {
+			result.PlanType = status.PlanType
+			if !status.ExpiresAt.IsZero() {
+				result.ExpiresAt = &status.ExpiresAt
+			}
+		}
+	}
+
+	if output == "json" {
+		printJSON(result)
+		return apperrors.ExitOK
+	}
+
+	username := result.Username
+	if username == "" {
+		username = "-"
+	}
+	fmt.Printf("username     : %s\n", username)
+	fmt.Printf("api key      : %s\n", result.APIKey)
+	if result.ServerURL != "" {
+		fmt.Printf("server       : %s\n", result.ServerURL)
+	}
+	fmt.Printf("logged in at : %s\n", formatLocalTime(result.LoggedInAt))
+	if result.PlanType != "" {
+		fmt.Printf("plan         : %s\n", result.PlanType)
+		if result.ExpiresAt != nil {
+			fmt.Printf("expires at   : %s\n", formatLocalTime(*result.ExpiresAt))
+		}
+	}
+	return apperrors.ExitOK
+}
@@ -0,0 +1,223 @@
+// Package credentials 在本地加密保存 API Key 和加密密钥，避免每次启动重新输入
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sqlbots-client/encryption"
+)
+
+// vaultVersion 凭据文件格式版本
+const vaultVersion = 1
+
+// saltSize 口令派生密钥的盐值长度
+const saltSize = 16
+
+var (
+	// ErrNoCredentials 没有保存的凭据（尚未 login）
+	ErrNoCredentials = errors.New("no saved credentials")
+	// ErrPassphraseRequired 凭据用口令保护，需要提供口令
+	ErrPassphraseRequired = errors.New("credentials are protected by a passphrase")
+	// ErrInvalidPassphrase 口令错误或凭据文件被修改
+	ErrInvalidPassphrase = errors.New("invalid passphrase or credentials were modified")
+)
+
+// Protection 凭据文件的保护方式
+type Protection string
+
+const (
+	// ProtectionMachine 使用本机绑定的密钥加密（复制到其他机器无法解密）
+	ProtectionMachine Protection = "machine"
+	// ProtectionPassphrase 使用口令派生的密钥加密（可以在其他机器上用口令解密）
+	ProtectionPassphrase Protection = "passphrase"
+)
+
+// Credentials 保存的凭据
+type Credentials struct {
+	APIKey        string    `json:"api_key"`
+	EncryptionKey string    `json:"encryption_key"`
+	Username      string    `json:"username,omitempty"`
+	ServerURL     string    `json:"server_url,omitempty"`
+	SavedAt       time.Time `json:"saved_at"`
+}
+
+// vaultFile 凭据文件内容（data 是加密后的 Credentials）
+type vaultFile struct {
+	Version    int        `json:"version"`
+	Protection Protection `json:"protection"`
+	Salt       string     `json:"salt,omitempty"`
+	Iterations int        `json:"iterations,omitempty"`
+	Data       string     `json:"data"`
+}
+
+// Vault 本地加密凭据文件
+type Vault struct {
+	path       string
+	machineKey string
+}
+
+// NewVault 创建凭据文件存储，machineKey 是与本机绑定的密钥（例如 hardware.ProtectedID）
+func NewVault(path, machineKey string) *Vault {
+	return &Vault{path: path, machineKey: machineKey}
+}
+
+// DefaultPath 默认的凭据文件路径（用户配置目录下的 sqlbots/credentials.vault）
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(dir, "sqlbots", "credentials.vault"), nil
+}
+
+// Path 返回凭据文件路径
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Protection 返回凭据文件的保护方式（没有保存的凭据时返回 ErrNoCredentials）
+func (v *Vault) Protection() (Protection, error) {
+	file, err := v.read()
+	if err != nil {
+		return "", err
+	}
+	return file.Protection, nil
+}
+
+// Load 读取并解密凭据，passphrase 为空时只能读取本机绑定的凭据
+func (v *Vault) Load(passphrase string) (*Credentials, error) {
+	file, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	switch file.Protection {
+	case ProtectionMachine:
+		key = v.machineKey
+	case ProtectionPassphrase:
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		salt, err := base64.StdEncoding.DecodeString(file.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials salt: %w", err)
+		}
+		// 迭代次数来自文件，不能信任：太小会降低暴力破解的成本，太大会让 Load 长时间卡住
+		if file.Iterations < encryption.DefaultPassphraseIterations || file.Iterations > encryption.MaxPassphraseIterations {
+			return nil, fmt.Errorf("invalid credentials iteration count %d (must be between %d and %d)",
+				file.Iterations, encryption.DefaultPassphraseIterations, encryption.MaxPassphraseIterations)
+		}
+		key = passphraseKey(passphrase, salt, file.Iterations)
+	default:
+		return nil, fmt.Errorf("unsupported credentials protection %q", file.Protection)
+	}
+
+	plaintext, err := encryption.Open(file.Data, key, associatedData(file.Protection))
+	if err != nil {
+		if file.Protection == ProtectionPassphrase {
+			return nil, ErrInvalidPassphrase
+		}
+		return nil, fmt.Errorf("credentials are invalid or belong to another machine: %w", err)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal([]byte(plaintext), &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	return &creds, nil
+}
+
+// Save 加密并保存凭据（文件权限 0600），passphrase 为空时使用本机绑定的密钥
+func (v *Vault) Save(creds *Credentials, passphrase string) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+
+	file := vaultFile{Version: vaultVersion, Protection: ProtectionMachine}
+	key := v.machineKey
+	if passphrase != "" {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		file.Protection = ProtectionPassphrase
+		file.Salt = base64.StdEncoding.EncodeToString(salt)
+		file.Iterations = encryption.DefaultPassphraseIterations
+		key = passphraseKey(passphrase, salt, file.Iterations)
+	}
+
+	file.Data, err = encryption.Seal(string(data), key, associatedData(file.Protection))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save credentials: %w", err)
+	}
+	return nil
+}
+
+// Clear 删除凭据文件（文件不存在时返回 ErrNoCredentials）
+func (v *Vault) Clear() error {
+	if err := os.Remove(v.path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoCredentials
+		}
+		return fmt.Errorf("failed to remove credentials: %w", err)
+	}
+	return nil
+}
+
+// read 读取凭据文件（未解密）
+func (v *Vault) read() (*vaultFile, error) {
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoCredentials
+		}
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+	if file.Version != vaultVersion {
+		return nil, fmt.Errorf("unsupported credentials version %d", file.Version)
+	}
+	return &file, nil
+}
+
+// passphraseKey 从口令派生加密密钥
+func passphraseKey(passphrase string, salt []byte, iterations int) string {
+	return base64.StdEncoding.EncodeToString(encryption.DerivePassphraseKey(passphrase, salt, iterations))
+}
+
+// associatedData 绑定保护方式，防止修改文件头绕过口令
+func associatedData(protection Protection) []byte {
+	return []byte("sqlbots-credentials\x00" + string(protection))
+}
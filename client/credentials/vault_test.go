@@ -0,0 +1,108 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sqlbots-client/encryption"
+)
+
+// newTestVault 在临时目录中创建凭据文件存储
+func newTestVault(t *testing.T, machineKey string) *Vault {
+	t.Helper()
+	return NewVault(filepath.Join(t.TempDir(), "credentials.vault"), machineKey)
+}
+
+var testCredentials = &Credentials{APIKey: "api-key", EncryptionKey: "encryption-key", Username: "test"}
+
+func TestVaultMachineProtection(t *testing.T) {
+	vault := newTestVault(t, "machine-key")
+	if _, err := vault.Load(""); !errors.Is(err, ErrNoCredentials) {
+		t.Fatalf("empty vault: got %v, want ErrNoCredentials", err)
+	}
+
+	if err := vault.Save(testCredentials, ""); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := vault.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.APIKey != testCredentials.APIKey || creds.EncryptionKey != testCredentials.EncryptionKey {
+		t.Fatalf("loaded %+v", creds)
+	}
+
+	// 复制到其他机器无法解密
+	other := NewVault(vault.Path(), "other-machine-key")
+	if _, err := other.Load(""); err == nil {
+		t.Fatal("credentials decrypted with another machine key")
+	}
+}
+
+func TestVaultPassphraseProtection(t *testing.T) {
+	vault := newTestVault(t, "machine-key")
+	if err := vault.Save(testCredentials, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if protection, err := vault.Protection(); err != nil || protection != ProtectionPassphrase {
+		t.Fatalf("protection: got %q, %v", protection, err)
+	}
+
+	if _, err := vault.Load(""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("no passphrase: got %v, want ErrPassphraseRequired", err)
+	}
+	if _, err := vault.Load("wrong"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Fatalf("wrong passphrase: got %v, want ErrInvalidPassphrase", err)
+	}
+	creds, err := vault.Load("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.APIKey != testCredentials.APIKey {
+		t.Fatalf("loaded %+v", creds)
+	}
+}
+
+// 篡改文件中的迭代次数不能让 Load 长时间卡住，也不能降低派生成本
+func TestVaultRejectsTamperedIterations(t *testing.T) {
+	vault := newTestVault(t, "machine-key")
+	if err := vault.Save(testCredentials, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, iterations := range []int{0, 1, encryption.MaxPassphraseIterations + 1, 1 << 40} {
+		setIterations(t, vault.Path(), iterations)
+
+		start := time.Now()
+		if _, err := vault.Load("correct horse"); err == nil {
+			t.Errorf("iterations %d accepted", iterations)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("iterations %d: Load took %s", iterations, elapsed)
+		}
+	}
+}
+
+// setIterations 修改凭据文件中的迭代次数
+func setIterations(t *testing.T, path string, iterations int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Iterations = iterations
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,365 @@
+package diagnostics
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	"sqlbots-client/hardware"
+	"sqlbots-client/heartbeat"
+	"sqlbots-client/license"
+	"sqlbots-client/protocol"
+	"sqlbots-client/session"
+)
+
+// DefaultTimeout 每一步检查的默认超时时间
+const DefaultTimeout = 10 * time.Second
+
+// certExpiryWarning 服务器证书剩余有效期少于此值时警告
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// roundTripProbe 会话密钥加解密检查使用的数据
+const roundTripProbe = "sqlbots-diagnostics"
+
+// Options 诊断选项
+type Options struct {
+	// Timeout 每一步的超时时间（默认 10 秒）
+	Timeout time.Duration
+	// MachineInfo 试运行心跳使用的机器信息（为 nil 时跳过心跳检查）
+	MachineInfo *hardware.MachineInfo
+	// HTTPClient 发送请求使用的 HTTP 客户端（为 nil 时使用默认客户端，遵循 HTTPS_PROXY 等环境变量）
+	HTTPClient *http.Client
+	// Client 在运行中的客户端内诊断时使用它的协议客户端（共享请求序号和会话密钥，
+	// 避免新客户端的序号让服务器拒绝后续心跳）；为 nil 时创建不重试的新客户端
+	Client *protocol.Client
+}
+
+// step 一步检查：blocking 为 true 时失败会跳过后面的检查
+type step struct {
+	name     string
+	blocking bool
+	run      func(ctx context.Context) Result
+}
+
+// runner 诊断过程中的状态
+type runner struct {
+	cfg        *config.Config
+	opts       Options
+	server     *url.URL
+	httpClient *http.Client
+	client     *protocol.Client
+	proxy      *url.URL // 使用的 HTTP 代理（为 nil 表示直连）
+	dryRun     bool     // 服务器在密钥交换时声明支持试运行心跳
+}
+
+// Run 按顺序执行所有检查，返回诊断报告
+//
+// 心跳检查使用试运行模式（dry_run），服务器只检查机器数量和许可证，不注册或更新机器。
+// 不支持试运行的旧服务器会把它当作普通心跳处理（注册机器、占用名额），
+// 因此只有服务器在密钥交换时声明支持 dry_run 才发送
+func Run(ctx context.Context, cfg *config.Config, opts Options) *Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	// 诊断时不重试，尽快报告问题
+	clientOpts := []protocol.Option{protocol.WithoutRetry()}
+	httpClient := http.DefaultClient
+	if opts.HTTPClient != nil {
+		httpClient = opts.HTTPClient
+		clientOpts = append(clientOpts, protocol.WithHTTPClient(opts.HTTPClient))
+	}
+
+	report := &Report{ServerURL: cfg.ServerURL, StartedAt: time.Now()}
+	server, err := url.Parse(cfg.ServerURL)
+	if err != nil || server.Host == "" {
+		report.Results = append(report.Results, Result{
+			Name:   "config",
+			Status: StatusFail,
+			Detail: fmt.Sprintf("invalid server_url %q", cfg.ServerURL),
+			Hint:   "set server_url to an http:// or https:// URL",
+		})
+		return report
+	}
+
+	r := &runner{
+		cfg:        cfg,
+		opts:       opts,
+		server:     server,
+		httpClient: httpClient,
+		client:     opts.Client,
+	}
+	if r.client == nil {
+		r.client = protocol.NewClient(cfg, session.NewManager(), clientOpts...)
+	}
+	if req, err := http.NewRequest(http.MethodGet, cfg.ServerURL, nil); err == nil {
+		r.proxy, _ = http.ProxyFromEnvironment(req)
+	}
+
+	steps := []step{
+		{"dns", true, r.checkDNS},
+		{"tcp", true, r.checkTCP},
+		{"tls", true, r.checkTLS},
+		{"health", true, r.checkHealth},
+		{"clock", false, r.checkClock},
+		{"key exchange", true, r.checkKeyExchange},
+		{"session key", true, r.checkSessionKey},
+		{"heartbeat", true, r.checkHeartbeat},
+	}
+
+	blocked := ""
+	for _, s := range steps {
+		if blocked != "" {
+			report.Results = append(report.Results, Result{Name: s.name, Status: StatusSkip, Detail: fmt.Sprintf("skipped (%s failed)", blocked)})
+			continue
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		start := time.Now()
+		result := s.run(stepCtx)
+		cancel()
+
+		result.Name = s.name
+		result.DurationMS = time.Since(start).Milliseconds()
+		report.Results = append(report.Results, result)
+		if result.Status == StatusFail && s.blocking {
+			blocked = s.name
+		}
+	}
+	return report
+}
+
+// pass 检查通过
+func pass(format string, args ...any) Result {
+	return Result{Status: StatusPass, Detail: fmt.Sprintf(format, args...)}
+}
+
+// warn 检查通过但有问题
+func warn(hint, format string, args ...any) Result {
+	return Result{Status: StatusWarn, Detail: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// fail 检查失败
+func fail(hint string, err error) Result {
+	return Result{Status: StatusFail, Detail: err.Error(), Hint: hint}
+}
+
+// skip 不需要检查
+func skip(format string, args ...any) Result {
+	return Result{Status: StatusSkip, Detail: fmt.Sprintf(format, args...)}
+}
+
+// address 返回连接的目标地址（使用代理时连接代理）
+func (r *runner) address() string {
+	target := r.server
+	if r.proxy != nil {
+		target = r.proxy
+	}
+
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(target.Hostname(), port)
+}
+
+// checkDNS 解析服务器（或代理）的域名
+func (r *runner) checkDNS(ctx context.Context) Result {
+	host, _, _ := net.SplitHostPort(r.address())
+	if net.ParseIP(host) != nil {
+		return pass("%s is an IP address, no lookup needed", host)
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fail(hintDNS, fmt.Errorf("failed to resolve %s: %w", host, err))
+	}
+	return pass("%s resolves to %v", host, addrs)
+}
+
+// checkTCP 建立 TCP 连接
+func (r *runner) checkTCP(ctx context.Context) Result {
+	address := r.address()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fail(hintTCP, fmt.Errorf("failed to connect to %s: %w", address, err))
+	}
+	conn.Close()
+
+	if r.proxy != nil {
+		return pass("connected to proxy %s", address)
+	}
+	return pass("connected to %s", address)
+}
+
+// checkTLS TLS 握手并检查证书
+func (r *runner) checkTLS(ctx context.Context) Result {
+	if r.server.Scheme != "https" {
+		return warn(hintPlainHTTP, "server_url uses plain HTTP, TLS is not used")
+	}
+	if r.proxy != nil {
+		return skip("connecting through proxy %s, TLS is checked by the health check", r.proxy.Host)
+	}
+
+	dialer := tls.Dialer{Config: &tls.Config{ServerName: r.server.Hostname()}}
+	conn, err := dialer.DialContext(ctx, "tcp", r.address())
+	if err != nil {
+		return fail(hintTLS, fmt.Errorf("TLS handshake failed: %w", err))
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return fail(hintTLS, fmt.Errorf("server did not send a certificate"))
+	}
+	cert := state.PeerCertificates[0]
+	remaining := time.Until(cert.NotAfter)
+	if remaining < certExpiryWarning {
+		return warn(hintCertExpiry, "%s, certificate for %s expires in %s", tls.VersionName(state.Version), cert.Subject.CommonName, license.FormatRemaining(remaining))
+	}
+	return pass("%s, certificate for %s valid until %s", tls.VersionName(state.Version), cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+}
+
+// checkHealth 请求 /health
+func (r *runner) checkHealth(ctx context.Context) Result {
+	resp, err := r.client.Health(ctx)
+	if err != nil {
+		return fail(hintHealth, err)
+	}
+	if resp.Status != "ok" {
+		return warn(hintHealth, "server reports status %q", resp.Status)
+	}
+	return pass("server is healthy")
+}
+
+// checkClock 比较本地时间和服务器响应的 Date 头
+func (r *runner) checkClock(ctx context.Context) Result {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, r.cfg.ServerURL+protocol.PathHealth, nil)
+	if err != nil {
+		return fail(hintHealth, fmt.Errorf("failed to create request: %w", err))
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fail(hintHealth, err)
+	}
+	resp.Body.Close()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return skip("server did not send a Date header")
+	}
+	return r.compareClock(serverTime, "Date header")
+}
+
+// compareClock 比较本地时间和服务器时间（Date 头只精确到秒）
+func (r *runner) compareClock(serverTime time.Time, source string) Result {
+	tolerance := r.cfg.ClockSkewTolerance
+	if tolerance <= 0 {
+		tolerance = protocol.DefaultClockSkewTolerance
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew > tolerance || skew < -tolerance {
+		return fail(hintClock, fmt.Errorf("local clock differs from the server by %s (%s, tolerance %s)", skew, source, tolerance))
+	}
+	if skew > tolerance/2 || skew < -tolerance/2 {
+		return warn(hintClock, "local clock differs from the server by %s (%s, tolerance %s)", skew, source, tolerance)
+	}
+	return pass("local clock differs from the server by %s", skew)
+}
+
+// checkKeyExchange 密钥交换（验证 API Key、服务器公钥和加密方案）
+func (r *runner) checkKeyExchange(ctx context.Context) Result {
+	response, err := r.client.ExchangeKey(ctx)
+	if err != nil {
+		return fail(hintFor(err), err)
+	}
+	r.dryRun = response.Supports(protocol.FeatureDryRun)
+
+	agreement := "legacy key exchange"
+	if r.cfg.ServerPublicKey != "" {
+		agreement = "x25519 with pinned server key"
+	}
+	return pass("logged in as %s (%s, scheme %s)", response.Username, agreement, r.scheme())
+}
+
+// checkSessionKey 用会话密钥加密再解密，确认会话密钥可以用于心跳
+func (r *runner) checkSessionKey(ctx context.Context) Result {
+	current, valid := r.client.Sessions().GetSession()
+	if !valid {
+		return fail(hintSessionKey, fmt.Errorf("no valid session key after key exchange"))
+	}
+
+	scheme := r.scheme()
+	associatedData := encryption.AssociatedData(protocol.PathHeartbeat, r.cfg.APIKey)
+	ciphertext, err := encryption.EncryptWithScheme(scheme, roundTripProbe, current.Key, associatedData)
+	if err != nil {
+		return fail(hintSessionKey, fmt.Errorf("failed to encrypt with the session key: %w", err))
+	}
+	plaintext, detected, err := encryption.DecryptAny(ciphertext, current.Key, associatedData)
+	if err != nil {
+		return fail(hintSessionKey, fmt.Errorf("failed to decrypt with the session key: %w", err))
+	}
+	if plaintext != roundTripProbe || detected != scheme {
+		return fail(hintSessionKey, fmt.Errorf("session key round-trip returned different data"))
+	}
+	return pass("%s round-trip ok, session valid for %s", scheme, time.Until(current.ExpiresAt).Round(time.Second))
+}
+
+// checkHeartbeat 发送试运行心跳（服务器解密请求、检查机器和许可证，客户端解密响应）
+func (r *runner) checkHeartbeat(ctx context.Context) Result {
+	if r.opts.MachineInfo == nil {
+		return warn(hintMachineInfo, "machine info unavailable, heartbeat not checked")
+	}
+	// 不支持试运行的服务器会注册本机并占用机器名额
+	if !r.dryRun {
+		return skip("server does not support dry-run heartbeats, not sent to avoid registering this machine (use heartbeat --once)")
+	}
+
+	payload := heartbeat.NewPayload(r.opts.MachineInfo)
+	payload.DryRun = true
+	resp, err := r.client.SendHeartbeat(ctx, payload)
+	if err == nil {
+		err = heartbeat.HandleHeartbeatResponse(resp)
+	}
+	if err != nil {
+		return fail(hintFor(err), err)
+	}
+
+	machine := "not registered yet (registered on the first heartbeat)"
+	if resp.MachineInfo.ID != "" {
+		machine = "registered as " + resp.MachineInfo.ID
+	}
+	expires := "never expires"
+	if resp.LicenseInfo.ExpiresAt != "" {
+		expires = "expires " + resp.LicenseInfo.ExpiresAt
+	}
+	result := pass("plan %s, %s, machine %s", resp.LicenseInfo.PlanType, expires, machine)
+
+	// 服务器时间戳比 Date 头更接近请求处理的时间，偏差过大时给出警告
+	if resp.Timestamp != 0 {
+		if clock := r.compareClock(time.Unix(resp.Timestamp, 0), "heartbeat timestamp"); clock.Status != StatusPass {
+			result.Status = StatusWarn
+			result.Detail += "; " + clock.Detail
+			result.Hint = clock.Hint
+		}
+	}
+	return result
+}
+
+// scheme 密钥交换协商的加密方案
+func (r *runner) scheme() string {
+	if scheme := r.client.Sessions().Scheme(); scheme != "" {
+		return scheme
+	}
+	return encryption.SchemeLegacy
+}
@@ -0,0 +1,307 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/hardware"
+	"sqlbots-client/protocol"
+	"sqlbots-client/server"
+)
+
+const (
+	testAPIKey        = "test-api-key"
+	testEncryptionKey = "test-encryption-key"
+)
+
+// testServer 启动参考服务器（处理函数经过 wrap 包装），返回存储和客户端配置
+func testServer(t *testing.T, wrap func(http.Handler) http.Handler) (*server.MemoryStore, *config.Config) {
+	t.Helper()
+
+	privateKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := server.NewMemoryStore()
+	store.AddUser(server.User{ID: "user-1", APIKey: testAPIKey, Username: "test"})
+	store.SetLicense(server.License{UserID: "user-1", PlanType: "pro"})
+
+	var handler http.Handler = server.New(server.Config{EncryptionKey: testEncryptionKey, PrivateKey: privateKey}, store).Handler()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+
+	return store, &config.Config{
+		APIKey:          testAPIKey,
+		ServerURL:       httpServer.URL,
+		EncryptionKey:   testEncryptionKey,
+		ServerPublicKey: encryption.EncodeX25519PublicKey(privateKey.PublicKey()),
+	}
+}
+
+func testMachine() *hardware.MachineInfo {
+	return &hardware.MachineInfo{MachineID: "machine-1", MachineName: "test-machine", RAM: 8, Cores: 4}
+}
+
+// statuses 按检查名称返回结果
+func statuses(report *Report) map[string]Result {
+	results := make(map[string]Result)
+	for _, result := range report.Results {
+		results[result.Name] = result
+	}
+	return results
+}
+
+func assertStatus(t *testing.T, report *Report, name string, want Status) Result {
+	t.Helper()
+
+	result, ok := statuses(report)[name]
+	if !ok {
+		t.Fatalf("no %s check in %+v", name, report.Results)
+	}
+	if result.Status != want {
+		t.Fatalf("%s: got %s (%s), want %s", name, result.Status, result.Detail, want)
+	}
+	return result
+}
+
+// 试运行心跳不注册机器
+func TestRunAllChecks(t *testing.T) {
+	store, cfg := testServer(t, nil)
+
+	report := Run(context.Background(), cfg, Options{MachineInfo: testMachine(), Timeout: 5 * time.Second})
+	if !report.OK() {
+		var buf bytes.Buffer
+		report.WriteText(&buf)
+		t.Fatalf("report not OK:\n%s", buf.String())
+	}
+
+	names := make([]string, 0, len(report.Results))
+	for _, result := range report.Results {
+		names = append(names, result.Name)
+	}
+	if got := strings.Join(names, ","); got != "dns,tcp,tls,health,clock,key exchange,session key,heartbeat" {
+		t.Fatalf("checks: %s", got)
+	}
+	assertStatus(t, report, "tls", StatusWarn) // 测试服务器使用 http://
+	if result := assertStatus(t, report, "key exchange", StatusPass); !strings.Contains(result.Detail, "logged in as test") {
+		t.Errorf("key exchange detail: %s", result.Detail)
+	}
+	if result := assertStatus(t, report, "heartbeat", StatusPass); !strings.Contains(result.Detail, "not registered yet") {
+		t.Errorf("heartbeat detail: %s", result.Detail)
+	}
+
+	if count, err := store.CountMachines(testAPIKey); err != nil || count != 0 {
+		t.Fatalf("dry-run heartbeat registered %d machines (%v)", count, err)
+	}
+}
+
+// 服务器没有声明支持 dry_run（例如 Node 服务器）时不发送心跳，避免注册机器
+func TestRunSkipsHeartbeatWithoutDryRunSupport(t *testing.T) {
+	var heartbeats atomic.Int32
+	store, cfg := testServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case protocol.PathHeartbeat:
+				heartbeats.Add(1)
+			case protocol.PathKeyExchange:
+				// 去掉响应中的 features
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+				var body map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Errorf("key exchange response: %v", err)
+				}
+				delete(body, "features")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(rec.Code)
+				json.NewEncoder(w).Encode(body)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	report := Run(context.Background(), cfg, Options{MachineInfo: testMachine(), Timeout: 5 * time.Second})
+	if result := assertStatus(t, report, "heartbeat", StatusSkip); !strings.Contains(result.Detail, "dry-run") {
+		t.Errorf("heartbeat detail: %s", result.Detail)
+	}
+	if !report.OK() {
+		t.Error("skipped heartbeat reported as failure")
+	}
+	if heartbeats.Load() != 0 {
+		t.Fatalf("sent %d heartbeats to a server without dry-run support", heartbeats.Load())
+	}
+	if count, _ := store.CountMachines(testAPIKey); count != 0 {
+		t.Fatalf("registered %d machines", count)
+	}
+}
+
+func TestRunWithoutMachineInfo(t *testing.T) {
+	_, cfg := testServer(t, nil)
+
+	report := Run(context.Background(), cfg, Options{Timeout: 5 * time.Second})
+	if result := assertStatus(t, report, "heartbeat", StatusWarn); result.Hint != hintMachineInfo {
+		t.Errorf("hint: %q", result.Hint)
+	}
+}
+
+// 密钥交换失败时给出处理建议并跳过后续检查
+func TestRunInvalidAPIKey(t *testing.T) {
+	_, cfg := testServer(t, nil)
+	cfg.APIKey = "wrong-key"
+
+	report := Run(context.Background(), cfg, Options{MachineInfo: testMachine(), Timeout: 5 * time.Second})
+	if report.OK() {
+		t.Fatal("report OK with an invalid API key")
+	}
+	result := assertStatus(t, report, "key exchange", StatusFail)
+	if !strings.Contains(result.Hint, "api_key") {
+		t.Errorf("hint: %q", result.Hint)
+	}
+	for _, name := range []string{"session key", "heartbeat"} {
+		if result := assertStatus(t, report, name, StatusSkip); !strings.Contains(result.Detail, "key exchange failed") {
+			t.Errorf("%s detail: %s", name, result.Detail)
+		}
+	}
+}
+
+func TestRunUnreachableServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	cfg := &config.Config{APIKey: testAPIKey, ServerURL: "http://" + address, EncryptionKey: testEncryptionKey}
+	report := Run(context.Background(), cfg, Options{Timeout: time.Second})
+	assertStatus(t, report, "dns", StatusPass)
+	if result := assertStatus(t, report, "tcp", StatusFail); result.Hint != hintTCP {
+		t.Errorf("hint: %q", result.Hint)
+	}
+	if len(report.Results) != 8 {
+		t.Fatalf("got %d results, want 8", len(report.Results))
+	}
+	for _, result := range report.Results[2:] {
+		if result.Status != StatusSkip {
+			t.Errorf("%s not skipped after tcp failed: %s", result.Name, result.Status)
+		}
+	}
+}
+
+func TestRunInvalidServerURL(t *testing.T) {
+	report := Run(context.Background(), &config.Config{ServerURL: "not a url"}, Options{})
+	if len(report.Results) != 1 || report.Results[0].Name != "config" || report.Results[0].Status != StatusFail {
+		t.Fatalf("unexpected results: %+v", report.Results)
+	}
+}
+
+func TestCompareClock(t *testing.T) {
+	r := &runner{cfg: &config.Config{ClockSkewTolerance: time.Minute}}
+	tests := []struct {
+		skew time.Duration
+		want Status
+	}{
+		{0, StatusPass},
+		{20 * time.Second, StatusPass},
+		{-45 * time.Second, StatusWarn},
+		{2 * time.Minute, StatusFail},
+		{-2 * time.Minute, StatusFail},
+	}
+	for _, tt := range tests {
+		result := r.compareClock(time.Now().Add(-tt.skew), "test")
+		if result.Status != tt.want {
+			t.Errorf("skew %s: got %s (%s), want %s", tt.skew, result.Status, result.Detail, tt.want)
+		}
+		if tt.want != StatusPass && result.Hint != hintClock {
+			t.Errorf("skew %s: hint %q", tt.skew, result.Hint)
+		}
+	}
+}
+
+func TestHintFor(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("wrapped: %w", protocol.ErrLegacyKeyExchange), "allow_legacy_key_exchange"},
+		{protocol.ErrKeyAgreementUnsupported, "does not support X25519"},
+		{fmt.Errorf("key agreement failed: %w", encryption.ErrKeyConfirmationFailed), "does not match the server"},
+		{fmt.Errorf("%w: message authentication failed", protocol.ErrEncryptionKeyMismatch), "encryption_key"},
+		{apperrors.New(http.StatusUnauthorized, apperrors.CodeInvalidAPIKey, ""), "api_key"},
+		{apperrors.New(http.StatusForbidden, apperrors.CodeMachineLimitExceeded, ""), "unused machine"},
+		{apperrors.New(http.StatusBadRequest, apperrors.CodeStaleRequest, ""), hintClock},
+		{apperrors.Network(errors.New("connection reset")), "unreachable"},
+		{apperrors.New(http.StatusBadGateway, "", ""), "retry later"},
+		{errors.New("something else"), ""},
+	}
+	for _, tt := range tests {
+		got := hintFor(tt.err)
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("hintFor(%v) = %q, want it to contain %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReportWriteText(t *testing.T) {
+	report := &Report{
+		ServerURL: "https://api.example",
+		Results: []Result{
+			{Name: "dns", Status: StatusPass, Detail: "api.example resolves to [192.0.2.1]"},
+			{Name: "tls", Status: StatusWarn, Detail: "certificate expires in 3d 2h", Hint: hintCertExpiry},
+			{Name: "health", Status: StatusFail, Detail: "HTTP 502", Hint: hintHealth},
+			{Name: "clock", Status: StatusSkip, Detail: "skipped (health failed)"},
+		},
+	}
+
+	var buf bytes.Buffer
+	report.WriteText(&buf)
+	want := "Diagnosing https://api.example\n\n" +
+		"✅ dns           api.example resolves to [192.0.2.1]\n" +
+		"⚠️  tls           certificate expires in 3d 2h\n" +
+		"                 → " + hintCertExpiry + "\n" +
+		"❌ health        HTTP 502\n" +
+		"                 → " + hintHealth + "\n" +
+		"⏭️  clock         skipped (health failed)\n" +
+		"\nSome checks failed, see the hints above\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	report.Results = report.Results[:2]
+	if !report.OK() {
+		t.Fatal("warnings counted as failures")
+	}
+	buf.Reset()
+	report.WriteText(&buf)
+	if !strings.HasSuffix(buf.String(), "\nAll checks passed\n") {
+		t.Fatalf("got:\n%s", buf.String())
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	report := &Report{ServerURL: "https://api.example", Results: []Result{{Name: "dns", Status: StatusPass, Detail: "ok", DurationMS: 3}}}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"checks":[{"name":"dns","status":"pass","detail":"ok","duration_ms":3}]`)) {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+}
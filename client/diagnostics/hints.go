@@ -0,0 +1,56 @@
+package diagnostics
+
+import (
+	"errors"
+
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+// 处理建议
+const (
+	hintDNS         = "check the host name in server_url and the DNS settings of this machine"
+	hintTCP         = "check that the server is running and that a firewall or proxy (HTTPS_PROXY) allows outgoing connections to this port"
+	hintTLS         = "make sure the system clock is correct; if a proxy inspects TLS traffic, install its CA certificate"
+	hintHealth      = "the server accepts connections but /health failed; check server_url (scheme, port, path) and the server logs"
+	hintClock       = "sync the system clock (for example timedatectl set-ntp true, or w32tm /resync on Windows)"
+	hintCertExpiry  = "the server certificate expires soon, ask the server operator to renew it"
+	hintPlainHTTP   = "use an https:// server_url in production; requests are encrypted but metadata is visible"
+	hintSessionKey  = "local encryption failed; check encryption_schemes and reinstall the client if it persists"
+	hintMachineInfo = "the client could not read this machine's hardware info; check permissions"
+)
+
+// hintFor 根据密钥交换或心跳的错误给出处理建议
+func hintFor(err error) string {
+	switch {
+	case errors.Is(err, protocol.ErrLegacyKeyExchange):
+		return "set server_public_key (SERVER_PUBLIC_KEY) to the server's X25519 public key, or allow_legacy_key_exchange for old servers"
+	case errors.Is(err, protocol.ErrKeyAgreementUnsupported):
+		return "the server does not support X25519; unset server_public_key until the server is upgraded, or check for a proxy tampering with the key exchange"
+	case errors.Is(err, encryption.ErrKeyConfirmationFailed):
+		return "server_public_key does not match the server; check the pinned key with the server operator"
+	case errors.Is(err, protocol.ErrEncryptionKeyMismatch):
+		return "encryption_key (ENCRYPTION_KEY) does not match the server's key"
+	}
+
+	switch apperrors.CodeOf(err) {
+	case apperrors.CodeInvalidAPIKey:
+		return "check api_key (API_KEY) or run login again"
+	case apperrors.CodeDecryptionFailed:
+		return "encryption_key (ENCRYPTION_KEY) does not match the server's key"
+	case apperrors.CodeInvalidSignature:
+		return "the server rejected the request signature; check encryption_key and run doctor again"
+	case apperrors.CodeLicenseExpired:
+		return "the license has expired or does not exist; renew it"
+	case apperrors.CodeMachineLimitExceeded:
+		return "remove an unused machine from the account or upgrade the plan"
+	case apperrors.CodeReplayDetected, apperrors.CodeStaleRequest:
+		return hintClock
+	case apperrors.CodeNetworkError:
+		return "the server became unreachable during the check; check the network and proxy settings"
+	case apperrors.CodeServerError, apperrors.CodeHTTPError:
+		return "the server returned an error; retry later or check the server logs"
+	}
+	return ""
+}
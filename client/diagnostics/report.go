@@ -0,0 +1,71 @@
+// Package diagnostics 逐步检查客户端到服务器的完整链路（DNS、TCP、TLS、健康检查、时钟、密钥交换、会话密钥、心跳），
+// 并为每一步失败给出处理建议
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Status 检查结果
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Result 一项检查的结果
+type Result struct {
+	Name       string `json:"name"`
+	Status     Status `json:"status"`
+	Detail     string `json:"detail"`
+	Hint       string `json:"hint,omitempty"` // 处理建议（失败或警告时）
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report 诊断报告
+type Report struct {
+	ServerURL string    `json:"server_url"`
+	StartedAt time.Time `json:"started_at"`
+	Results   []Result  `json:"checks"`
+}
+
+// OK 是否所有检查都没有失败（警告不算失败）
+func (r *Report) OK() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText 以文本格式输出报告
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Diagnosing %s\n\n", r.ServerURL)
+	for _, result := range r.Results {
+		mark := "✅"
+		switch result.Status {
+		case StatusWarn:
+			mark = "⚠️ "
+		case StatusFail:
+			mark = "❌"
+		case StatusSkip:
+			mark = "⏭️ "
+		}
+		fmt.Fprintf(w, "%s %-13s %s\n", mark, result.Name, result.Detail)
+		if result.Hint != "" {
+			fmt.Fprintf(w, "   %-13s → %s\n", "", result.Hint)
+		}
+	}
+
+	if r.OK() {
+		fmt.Fprintf(w, "\nAll checks passed\n")
+	} else {
+		fmt.Fprintf(w, "\nSome checks failed, see the hints above\n")
+	}
+}
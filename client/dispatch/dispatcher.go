@@ -0,0 +1,322 @@
+// Package dispatch 校验并执行服务器在心跳响应中下发的指令
+//
+// 每条指令都要通过签名、目标机器、有效期和白名单校验才会执行；指令按 ID 去重，
+// 执行结果在下一次心跳中发送给服务器确认
+package dispatch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+const (
+	// DefaultTimeout 单条指令的默认执行超时
+	DefaultTimeout = 2 * time.Minute
+
+	maxOutput  = 64 << 10 // 结果输出的最大长度
+	maxQueued  = 64       // 等待执行的指令上限（超出的指令不标记为已收到，服务器下次心跳重发）
+	maxPending = 256      // 等待确认的结果上限（超出时丢弃最早的结果）
+
+	// maxSeenTTL 去重记录的最长保留时间（VerifyCommand 拒绝过期时间更晚的指令）
+	maxSeenTTL = protocol.MaxCommandExpiry
+)
+
+// DefaultAllowed 默认允许的指令（deregister 会停止所有托管进程，需要显式允许）
+var DefaultAllowed = []string{
+	protocol.CommandRefreshConfig,
+	protocol.CommandRotateKeys,
+	protocol.CommandRestartWorkload,
+	protocol.CommandCollectDiagnostics,
+}
+
+// Handler 执行一条指令，返回发送给服务器的输出（可以为空）
+type Handler func(ctx context.Context, cmd protocol.Command) (string, error)
+
+// Options 分发选项
+type Options struct {
+	PublicKey  ed25519.PublicKey            // 服务器的指令签名公钥（为 nil 时拒绝所有指令）
+	MachineID  string                       // 本机在心跳中发送的 machine_id
+	InstanceID string                       // 本机的实例 ID
+	Allowed    []string                     // 允许执行的指令类型（为空时使用 DefaultAllowed）
+	Timeout    time.Duration                // 单条指令的执行超时（为 0 时使用 DefaultTimeout）
+	OnResult   func(protocol.CommandResult) // 每条指令执行完（或被拒绝）时调用
+}
+
+// Dispatcher 指令分发器：在后台按收到的顺序逐条执行指令
+type Dispatcher struct {
+	opts     Options
+	handlers map[string]Handler
+	allowed  map[string]bool
+	queue    chan protocol.Command
+
+	mu      sync.Mutex
+	seen    map[string]time.Time // 已收到的指令 ID 和去重记录的过期时间
+	pending []protocol.CommandResult
+}
+
+// NewDispatcher 创建分发器（允许的指令必须都有处理函数）
+func NewDispatcher(opts Options, handlers map[string]Handler) (*Dispatcher, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	allowed := opts.Allowed
+	if len(allowed) == 0 {
+		allowed = DefaultAllowed
+	}
+
+	d := &Dispatcher{
+		opts:     opts,
+		handlers: handlers,
+		allowed:  make(map[string]bool, len(allowed)),
+		queue:    make(chan protocol.Command, maxQueued),
+		seen:     make(map[string]time.Time),
+	}
+	for _, commandType := range allowed {
+		if _, ok := handlers[commandType]; !ok {
+			return nil, fmt.Errorf("unsupported command %q (supported: %s)", commandType, joinKeys(handlers))
+		}
+		d.allowed[commandType] = true
+	}
+	return d, nil
+}
+
+// Start 在后台执行收到的指令，直到 ctx 取消
+func (d *Dispatcher) Start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case cmd := <-d.queue:
+				d.finish(d.execute(ctx, cmd))
+			}
+		}
+	}()
+}
+
+// Dispatch 校验心跳响应中的指令，通过校验的指令排队执行，没有通过的直接记录为 rejected
+//
+// 已经收到过的指令（服务器在收到结果之前会重发）直接忽略
+func (d *Dispatcher) Dispatch(commands []protocol.Command) {
+	if d == nil {
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	d.pruneSeen(now)
+	d.mu.Unlock()
+
+	for _, cmd := range commands {
+		if d.isSeen(cmd.ID) {
+			continue
+		}
+
+		// 先校验再记录：没有通过校验的指令（签名错误、过期、发给其他机器）不占用 ID，
+		// 之后收到同一 ID 的有效指令仍然会执行
+		if err := d.verify(cmd, now); err != nil {
+			d.reject(cmd, err)
+			continue
+		}
+
+		if !d.markSeen(cmd, now) {
+			continue
+		}
+		select {
+		case d.queue <- cmd:
+		default:
+			// 队列已满：不记录为已收到，服务器下次心跳会重发
+			d.unmarkSeen(cmd.ID)
+		}
+	}
+}
+
+// Pending 返回等待服务器确认的执行结果
+func (d *Dispatcher) Pending() []protocol.CommandResult {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		return nil
+	}
+	return append([]protocol.CommandResult(nil), d.pending...)
+}
+
+// Ack 心跳成功后移除已经发送的结果
+//
+// 同一 ID 可能先被拒绝、之后又执行成功，所以按 ID 和状态匹配，不会移除发送之后才产生的结果
+func (d *Dispatcher) Ack(results []protocol.CommandResult) {
+	if d == nil || len(results) == 0 {
+		return
+	}
+
+	sent := make(map[resultKey]bool, len(results))
+	for _, r := range results {
+		sent[keyOf(r)] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	remaining := d.pending[:0]
+	for _, r := range d.pending {
+		if !sent[keyOf(r)] {
+			remaining = append(remaining, r)
+		}
+	}
+	d.pending = remaining
+}
+
+// resultKey 匹配已发送结果的键
+type resultKey struct {
+	id, status string
+}
+
+// keyOf 返回结果的匹配键
+func keyOf(r protocol.CommandResult) resultKey {
+	return resultKey{id: r.ID, status: r.Status}
+}
+
+// verify 校验签名、目标机器、有效期、白名单
+func (d *Dispatcher) verify(cmd protocol.Command, now time.Time) error {
+	if d.opts.PublicKey == nil {
+		return fmt.Errorf("commands are disabled (no command public key configured)")
+	}
+	if err := protocol.VerifyCommand(d.opts.PublicKey, &cmd, d.opts.MachineID, d.opts.InstanceID, now); err != nil {
+		return err
+	}
+	if _, ok := d.handlers[cmd.Type]; !ok {
+		return fmt.Errorf("unsupported command %q", cmd.Type)
+	}
+	if !d.allowed[cmd.Type] {
+		return fmt.Errorf("command %q is not allowed on this machine", cmd.Type)
+	}
+	return nil
+}
+
+// execute 执行一条指令（处理函数 panic 时记录为失败）
+func (d *Dispatcher) execute(ctx context.Context, cmd protocol.Command) (res protocol.CommandResult) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			res = result(cmd, protocol.CommandFailed, "", fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	output, err := d.handlers[cmd.Type](ctx, cmd)
+	if err != nil {
+		return result(cmd, protocol.CommandFailed, output, err)
+	}
+	return result(cmd, protocol.CommandSucceeded, output, nil)
+}
+
+// reject 记录没有通过校验的指令（服务器收到结果之前会重发，同一 ID 的拒绝结果只保留一条）
+func (d *Dispatcher) reject(cmd protocol.Command, err error) {
+	d.mu.Lock()
+	for _, r := range d.pending {
+		if r.ID == cmd.ID && r.Status == protocol.CommandRejected {
+			d.mu.Unlock()
+			return
+		}
+	}
+	d.mu.Unlock()
+
+	d.finish(result(cmd, protocol.CommandRejected, "", err))
+}
+
+// finish 保存结果等待下一次心跳发送
+func (d *Dispatcher) finish(res protocol.CommandResult) {
+	d.mu.Lock()
+	d.pending = append(d.pending, res)
+	if len(d.pending) > maxPending {
+		d.pending = d.pending[len(d.pending)-maxPending:]
+	}
+	d.mu.Unlock()
+
+	if d.opts.OnResult != nil {
+		d.opts.OnResult(res)
+	}
+}
+
+// isSeen 指令 ID 是否已经收到过
+func (d *Dispatcher) isSeen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.seen[id]
+	return ok
+}
+
+// markSeen 记录指令 ID，已经收到过时返回 false
+//
+// 去重记录保留到指令过期（最长 maxSeenTTL），过期的指令即使重发也会被拒绝
+func (d *Dispatcher) markSeen(cmd protocol.Command, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.seen[cmd.ID]; ok {
+		return false
+	}
+	until := time.Unix(cmd.ExpiresAt, 0)
+	if until.Before(now) || until.After(now.Add(maxSeenTTL)) {
+		until = now.Add(maxSeenTTL)
+	}
+	d.seen[cmd.ID] = until
+	return true
+}
+
+// unmarkSeen 删除去重记录
+func (d *Dispatcher) unmarkSeen(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, id)
+}
+
+// pruneSeen 删除过期的去重记录（调用方持有锁）
+func (d *Dispatcher) pruneSeen(now time.Time) {
+	for id, until := range d.seen {
+		if now.After(until) {
+			delete(d.seen, id)
+		}
+	}
+}
+
+// result 构建执行结果（输出超过上限时截断）
+func result(cmd protocol.Command, status, output string, err error) protocol.CommandResult {
+	if len(output) > maxOutput {
+		output = output[:maxOutput] + "\n... (truncated)"
+	}
+	res := protocol.CommandResult{
+		ID:         cmd.ID,
+		Type:       cmd.Type,
+		Status:     status,
+		Output:     output,
+		FinishedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// joinKeys 按字母顺序拼接处理函数的指令类型
+func joinKeys(handlers map[string]Handler) string {
+	keys := make([]string, 0, len(handlers))
+	for key := range handlers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,196 @@
+package dispatch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+const testMachineID = "machine-1"
+
+// newTestDispatcher 创建分发器，返回签名私钥和每条指令执行结果的通知
+func newTestDispatcher(t *testing.T, allowed []string, handlers map[string]Handler) (*Dispatcher, ed25519.PrivateKey, <-chan protocol.CommandResult) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan protocol.CommandResult, 16)
+	d, err := NewDispatcher(Options{
+		PublicKey: publicKey,
+		MachineID: testMachineID,
+		Allowed:   allowed,
+		OnResult:  func(r protocol.CommandResult) { results <- r },
+	}, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d.Start(ctx)
+	return d, privateKey, results
+}
+
+// signed 构建并签名一条发给本机的指令
+func signed(key ed25519.PrivateKey, id, commandType string) protocol.Command {
+	now := time.Now()
+	cmd := protocol.Command{
+		ID:        id,
+		Type:      commandType,
+		MachineID: testMachineID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	protocol.SignCommand(key, &cmd)
+	return cmd
+}
+
+// waitResult 等待下一条执行结果
+func waitResult(t *testing.T, results <-chan protocol.CommandResult) protocol.CommandResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a command result")
+		return protocol.CommandResult{}
+	}
+}
+
+func TestDispatchExecutesOnce(t *testing.T) {
+	runs := 0
+	d, key, results := newTestDispatcher(t, []string{protocol.CommandRotateKeys}, map[string]Handler{
+		protocol.CommandRotateKeys: func(context.Context, protocol.Command) (string, error) {
+			runs++
+			return "rotated", nil
+		},
+	})
+
+	cmd := signed(key, "cmd-1", protocol.CommandRotateKeys)
+	d.Dispatch([]protocol.Command{cmd})
+	if r := waitResult(t, results); r.Status != protocol.CommandSucceeded || r.Output != "rotated" {
+		t.Fatalf("result: %+v", r)
+	}
+
+	// 服务器在收到结果之前会重发
+	d.Dispatch([]protocol.Command{cmd})
+	select {
+	case r := <-results:
+		t.Fatalf("resent command executed again: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if runs != 1 {
+		t.Fatalf("runs: got %d, want 1", runs)
+	}
+
+	pending := d.Pending()
+	if len(pending) != 1 {
+		t.Fatalf("pending: got %d, want 1", len(pending))
+	}
+	d.Ack(pending)
+	if len(d.Pending()) != 0 {
+		t.Fatal("acked result still pending")
+	}
+}
+
+func TestDispatchRejects(t *testing.T) {
+	handlers := map[string]Handler{
+		protocol.CommandRotateKeys: func(context.Context, protocol.Command) (string, error) { return "", nil },
+		protocol.CommandDeregister: func(context.Context, protocol.Command) (string, error) { return "", nil },
+	}
+	d, key, results := newTestDispatcher(t, []string{protocol.CommandRotateKeys}, handlers)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	wrongMachine := signed(key, "cmd-machine", protocol.CommandRotateKeys)
+	wrongMachine.MachineID = "machine-2"
+	protocol.SignCommand(key, &wrongMachine)
+
+	expired := signed(key, "cmd-expired", protocol.CommandRotateKeys)
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	protocol.SignCommand(key, &expired)
+
+	// 过期时间超过去重记录的保留时间：去重记录删除后可以被重放
+	farFuture := signed(key, "cmd-far-future", protocol.CommandRotateKeys)
+	farFuture.ExpiresAt = time.Now().Add(maxSeenTTL + time.Minute).Unix()
+	protocol.SignCommand(key, &farFuture)
+
+	tests := []protocol.Command{
+		signed(otherKey, "cmd-signature", protocol.CommandRotateKeys),
+		wrongMachine,
+		expired,
+		farFuture,
+		signed(key, "cmd-not-allowed", protocol.CommandDeregister),
+	}
+	for _, cmd := range tests {
+		d.Dispatch([]protocol.Command{cmd})
+		if r := waitResult(t, results); r.ID != cmd.ID || r.Status != protocol.CommandRejected {
+			t.Errorf("%s: got %+v, want rejected", cmd.ID, r)
+		}
+	}
+}
+
+// 没有通过校验的指令不能占用 ID：之后同一 ID 的有效指令仍然执行
+func TestDispatchRejectedCommandDoesNotBlockID(t *testing.T) {
+	d, key, results := newTestDispatcher(t, []string{protocol.CommandRotateKeys}, map[string]Handler{
+		protocol.CommandRotateKeys: func(context.Context, protocol.Command) (string, error) { return "", nil },
+	})
+
+	forged := signed(key, "cmd-1", protocol.CommandRotateKeys)
+	forged.Signature = "invalid"
+	d.Dispatch([]protocol.Command{forged})
+	if r := waitResult(t, results); r.Status != protocol.CommandRejected {
+		t.Fatalf("forged command: got %+v, want rejected", r)
+	}
+	rejected := d.Pending()
+
+	// 重发的无效指令只保留一条拒绝结果
+	d.Dispatch([]protocol.Command{forged})
+	if len(d.Pending()) != 1 {
+		t.Fatalf("pending after resend: got %d, want 1", len(d.Pending()))
+	}
+
+	d.Dispatch([]protocol.Command{signed(key, "cmd-1", protocol.CommandRotateKeys)})
+	if r := waitResult(t, results); r.Status != protocol.CommandSucceeded {
+		t.Fatalf("valid command: got %+v, want succeeded", r)
+	}
+
+	// 确认拒绝结果不会移除之后的成功结果
+	d.Ack(rejected)
+	pending := d.Pending()
+	if len(pending) != 1 || pending[0].Status != protocol.CommandSucceeded {
+		t.Fatalf("pending after ack: %+v", pending)
+	}
+}
+
+func TestDispatchHandlerFailure(t *testing.T) {
+	d, key, results := newTestDispatcher(t, []string{protocol.CommandRotateKeys, protocol.CommandRefreshConfig}, map[string]Handler{
+		protocol.CommandRotateKeys: func(context.Context, protocol.Command) (string, error) {
+			return "partial", errors.New("boom")
+		},
+		protocol.CommandRefreshConfig: func(context.Context, protocol.Command) (string, error) {
+			panic("handler bug")
+		},
+	})
+
+	d.Dispatch([]protocol.Command{signed(key, "cmd-1", protocol.CommandRotateKeys)})
+	if r := waitResult(t, results); r.Status != protocol.CommandFailed || r.Error != "boom" || r.Output != "partial" {
+		t.Fatalf("result: %+v", r)
+	}
+	d.Dispatch([]protocol.Command{signed(key, "cmd-2", protocol.CommandRefreshConfig)})
+	if r := waitResult(t, results); r.Status != protocol.CommandFailed {
+		t.Fatalf("panic: got %+v, want failed", r)
+	}
+}
+
+func TestNewDispatcherRequiresHandlers(t *testing.T) {
+	_, err := NewDispatcher(Options{Allowed: []string{protocol.CommandDeregister}}, map[string]Handler{})
+	if err == nil {
+		t.Fatal("allowed command without a handler accepted")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"sqlbots-client/config"
+	"sqlbots-client/diagnostics"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/ui"
+)
+
+// runDoctor 逐步检查到服务器的链路并给出处理建议（DNS、TCP、TLS、健康检查、时钟、密钥交换、会话密钥、试运行心跳）
+func runDoctor(args []string) int {
+	var output string
+	cfg, code := loadCommandConfig("doctor", args, &output, config.LoadOptions{
+		Credentials: loadCredentials(ui.IsTerminal()),
+	})
+	if cfg == nil {
+		return code
+	}
+
+	// 获取机器信息失败时仍然执行其他检查
+	machineInfo, _ := getMachineInfo(cfg)
+	report := diagnostics.Run(context.Background(), cfg, diagnostics.Options{MachineInfo: machineInfo})
+
+	if output == "json" {
+		printJSON(struct {
+			*diagnostics.Report
+			OK bool `json:"ok"`
+		}{report, report.OK()})
+	} else {
+		report.WriteText(os.Stdout)
+	}
+
+	if !report.OK() {
+		return apperrors.ExitFailure
+	}
+	return apperrors.ExitOK
+}
@@ -0,0 +1,194 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// 加密方案（密钥交换时协商）
+const (
+	// SchemeAESGCM AES-256-GCM + HKDF-SHA256（带认证，推荐）
+	SchemeAESGCM = "aes-256-gcm"
+	// SchemeLegacy OpenSSL "Salted__" 格式（EVP_BytesToKey + AES-256-CBC，无认证）
+	SchemeLegacy = "openssl-cbc"
+)
+
+// SupportedSchemes 客户端支持的加密方案（按优先级排序）
+var SupportedSchemes = []string{SchemeAESGCM, SchemeLegacy}
+
+const (
+	// envelopeMagic 版本化信封前缀
+	envelopeMagic = "SQB"
+	// envelopeVersionGCM AES-256-GCM 信封版本号
+	envelopeVersionGCM byte = 2
+
+	gcmSaltLen   = 16
+	gcmHeaderLen = len(envelopeMagic) + 1 + gcmSaltLen
+	hkdfInfoGCM  = "sqlbots aes-256-gcm v2"
+)
+
+// ErrAuthenticationFailed 密文被篡改或密钥/关联数据不匹配
+var ErrAuthenticationFailed = errors.New("message authentication failed")
+
+// AssociatedData 构建关联数据，将密文绑定到接口路径和 API Key
+// 同一密文不能被挪到其他接口或其他用户的请求中使用
+func AssociatedData(endpoint, apiKey string) []byte {
+	return []byte("sqlbots\x00" + endpoint + "\x00" + apiKey)
+}
+
+// Seal 使用 AES-256-GCM 加密数据
+// 信封格式：base64("SQB" + 版本号 + salt(16) + nonce(12) + 密文 + tag)
+func Seal(plaintext, password string, associatedData []byte) (string, error) {
+	header := make([]byte, gcmHeaderLen)
+	copy(header, envelopeMagic)
+	header[len(envelopeMagic)] = envelopeVersionGCM
+	salt := header[len(envelopeMagic)+1:]
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := newGCM(password, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	combined := append(header, nonce...)
+	combined = aead.Seal(combined, nonce, []byte(plaintext), gcmAdditionalData(header, associatedData))
+
+	return base64.StdEncoding.EncodeToString(combined), nil
+}
+
+// Open 解密 AES-256-GCM 信封，密文被篡改时返回 ErrAuthenticationFailed
+func Open(ciphertext, password string, associatedData []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	if !isGCMEnvelope(data) {
+		return "", errors.New("invalid encrypted data format: not an aes-256-gcm envelope")
+	}
+
+	header := data[:gcmHeaderLen]
+	salt := header[len(envelopeMagic)+1:]
+
+	aead, err := newGCM(password, salt)
+	if err != nil {
+		return "", err
+	}
+
+	rest := data[gcmHeaderLen:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("invalid encrypted data format: too short")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, gcmAdditionalData(header, associatedData))
+	if err != nil {
+		return "", ErrAuthenticationFailed
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptWithScheme 使用指定方案加密数据（关联数据仅对带认证的方案生效）
+func EncryptWithScheme(scheme, plaintext, password string, associatedData []byte) (string, error) {
+	switch scheme {
+	case SchemeAESGCM:
+		return Seal(plaintext, password, associatedData)
+	case SchemeLegacy, "":
+		return Encrypt(plaintext, password)
+	default:
+		return "", fmt.Errorf("unsupported encryption scheme: %s", scheme)
+	}
+}
+
+// DecryptAny 根据信封格式自动选择方案解密，返回明文和识别出的方案
+func DecryptAny(ciphertext, password string, associatedData []byte) (string, string, error) {
+	scheme := DetectScheme(ciphertext)
+	switch scheme {
+	case SchemeAESGCM:
+		plaintext, err := Open(ciphertext, password, associatedData)
+		return plaintext, scheme, err
+	case SchemeLegacy:
+		plaintext, err := Decrypt(ciphertext, password)
+		return plaintext, scheme, err
+	default:
+		return "", "", errors.New("invalid encrypted data format: unknown envelope")
+	}
+}
+
+// DetectScheme 识别密文使用的加密方案（无法识别时返回空字符串）
+func DetectScheme(ciphertext string) string {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case isGCMEnvelope(data):
+		return SchemeAESGCM
+	case bytes.HasPrefix(data, []byte(saltPrefix)):
+		return SchemeLegacy
+	default:
+		return ""
+	}
+}
+
+// NegotiateScheme 从对方提供的方案列表中选择第一个本地也支持的方案
+// 对方没有提供列表时（旧版本）使用 legacy 方案
+func NegotiateScheme(offered, supported []string) string {
+	if len(offered) == 0 {
+		return SchemeLegacy
+	}
+	for _, scheme := range offered {
+		for _, s := range supported {
+			if scheme == s {
+				return scheme
+			}
+		}
+	}
+	return ""
+}
+
+// newGCM 使用 HKDF 从密码和盐值派生密钥并创建 AES-GCM
+func newGCM(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := hkdfSHA256([]byte(password), salt, []byte(hkdfInfoGCM), 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// isGCMEnvelope 检查是否是 AES-256-GCM 信封
+func isGCMEnvelope(data []byte) bool {
+	return len(data) >= gcmHeaderLen &&
+		string(data[:len(envelopeMagic)]) == envelopeMagic &&
+		data[len(envelopeMagic)] == envelopeVersionGCM
+}
+
+// gcmAdditionalData 信封头（含版本号和盐值）也参与认证
+func gcmAdditionalData(header, associatedData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(associatedData))
+	ad = append(ad, header...)
+	return append(ad, associatedData...)
+}
@@ -0,0 +1,209 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testPassword  = "session-key"
+	testPlaintext = `{"machine_id":"m-1","status":"ok"}`
+)
+
+// sealed 用测试密钥和关联数据加密，返回解码后的信封
+func sealed(t *testing.T) []byte {
+	t.Helper()
+	ciphertext, err := Seal(testPlaintext, testPassword, AssociatedData("/heartbeat", "api-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSealOpen(t *testing.T) {
+	ad := AssociatedData("/heartbeat", "api-key")
+	for _, plaintext := range []string{"", testPlaintext, strings.Repeat("x", 4096)} {
+		ciphertext, err := Seal(plaintext, testPassword, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Open(ciphertext, testPassword, ad)
+		if err != nil {
+			t.Fatalf("open %d bytes: %v", len(plaintext), err)
+		}
+		if got != plaintext {
+			t.Fatalf("round trip: got %q, want %q", got, plaintext)
+		}
+	}
+
+	// 每次加密使用新的盐值和 nonce
+	first, _ := Seal(testPlaintext, testPassword, ad)
+	second, _ := Seal(testPlaintext, testPassword, ad)
+	if first == second {
+		t.Fatal("identical ciphertexts for the same plaintext")
+	}
+}
+
+// 信封中任何位置被修改（信封头、盐值、nonce、密文、tag）都无法解密
+func TestOpenRejectsTampering(t *testing.T) {
+	data := sealed(t)
+	nonceStart := gcmHeaderLen
+	ciphertextStart := nonceStart + 12
+	tagStart := len(data) - 16
+
+	positions := map[string]int{
+		"salt":       len(envelopeMagic) + 1,
+		"nonce":      nonceStart,
+		"ciphertext": ciphertextStart,
+		"tag":        tagStart,
+		"last byte":  len(data) - 1,
+	}
+	for name, pos := range positions {
+		t.Run(name, func(t *testing.T) {
+			tampered := append([]byte(nil), data...)
+			tampered[pos] ^= 0x01
+			_, err := Open(base64.StdEncoding.EncodeToString(tampered), testPassword, AssociatedData("/heartbeat", "api-key"))
+			if !errors.Is(err, ErrAuthenticationFailed) {
+				t.Fatalf("got %v, want ErrAuthenticationFailed", err)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		truncated := base64.StdEncoding.EncodeToString(data[:gcmHeaderLen+12+15])
+		if _, err := Open(truncated, testPassword, AssociatedData("/heartbeat", "api-key")); err == nil {
+			t.Fatal("truncated envelope accepted")
+		}
+	})
+}
+
+// 关联数据把密文绑定到接口和 API Key
+func TestOpenRejectsMismatchedAssociatedData(t *testing.T) {
+	ciphertext := base64.StdEncoding.EncodeToString(sealed(t))
+	tests := map[string][]byte{
+		"other endpoint": AssociatedData("/commands/result", "api-key"),
+		"other api key":  AssociatedData("/heartbeat", "other-key"),
+		"none":           nil,
+	}
+	for name, ad := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Open(ciphertext, testPassword, ad); !errors.Is(err, ErrAuthenticationFailed) {
+				t.Fatalf("got %v, want ErrAuthenticationFailed", err)
+			}
+		})
+	}
+
+	if _, err := Open(ciphertext, "other-password", AssociatedData("/heartbeat", "api-key")); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("wrong password: got %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+func TestOpenRejectsUnknownEnvelope(t *testing.T) {
+	data := sealed(t)
+	badMagic := append([]byte(nil), data...)
+	copy(badMagic, "XQB")
+	badVersion := append([]byte(nil), data...)
+	badVersion[len(envelopeMagic)] = envelopeVersionGCM + 1
+
+	tests := map[string]string{
+		"bad magic":   base64.StdEncoding.EncodeToString(badMagic),
+		"bad version": base64.StdEncoding.EncodeToString(badVersion),
+		"too short":   base64.StdEncoding.EncodeToString(data[:gcmHeaderLen-1]),
+		"not base64":  "not base64!",
+	}
+	for name, ciphertext := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Open(ciphertext, testPassword, nil); err == nil {
+				t.Fatal("envelope accepted")
+			}
+			if _, _, err := DecryptAny(ciphertext, testPassword, nil); err == nil {
+				t.Fatal("DecryptAny accepted the envelope")
+			}
+			if scheme := DetectScheme(ciphertext); scheme != "" {
+				t.Fatalf("detected scheme %q", scheme)
+			}
+		})
+	}
+}
+
+// 两种方案加密的数据都能由 DecryptAny 识别并解密
+func TestEncryptWithSchemeRoundTrip(t *testing.T) {
+	ad := AssociatedData("/heartbeat", "api-key")
+	for _, scheme := range []string{SchemeAESGCM, SchemeLegacy, ""} {
+		ciphertext, err := EncryptWithScheme(scheme, testPlaintext, testPassword, ad)
+		if err != nil {
+			t.Fatalf("%q: %v", scheme, err)
+		}
+
+		want := scheme
+		if want == "" {
+			want = SchemeLegacy
+		}
+		if got := DetectScheme(ciphertext); got != want {
+			t.Fatalf("%q: detected %q", scheme, got)
+		}
+		plaintext, detected, err := DecryptAny(ciphertext, testPassword, ad)
+		if err != nil || plaintext != testPlaintext || detected != want {
+			t.Fatalf("%q: got %q, %q, %v", scheme, plaintext, detected, err)
+		}
+	}
+
+	if _, err := EncryptWithScheme("chacha20", testPlaintext, testPassword, ad); err == nil {
+		t.Fatal("unsupported scheme accepted")
+	}
+}
+
+// 旧格式的数据以 "Salted__" 开头，与 OpenSSL 兼容，并且不受关联数据影响
+func TestLegacyScheme(t *testing.T) {
+	ciphertext, err := Encrypt(testPlaintext, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(ciphertext)
+	if !strings.HasPrefix(string(data), saltPrefix) {
+		t.Fatalf("legacy envelope starts with %q", data[:len(saltPrefix)])
+	}
+
+	plaintext, scheme, err := DecryptAny(ciphertext, testPassword, AssociatedData("/heartbeat", "api-key"))
+	if err != nil || plaintext != testPlaintext || scheme != SchemeLegacy {
+		t.Fatalf("got %q, %q, %v", plaintext, scheme, err)
+	}
+
+	// AES-256-GCM 信封不能按旧格式解密，反之亦然
+	gcm := base64.StdEncoding.EncodeToString(sealed(t))
+	if _, err := Decrypt(gcm, testPassword); err == nil {
+		t.Fatal("legacy Decrypt accepted an aes-256-gcm envelope")
+	}
+	if _, err := Open(ciphertext, testPassword, nil); err == nil {
+		t.Fatal("Open accepted a legacy envelope")
+	}
+}
+
+func TestNegotiateScheme(t *testing.T) {
+	tests := []struct {
+		name      string
+		offered   []string
+		supported []string
+		want      string
+	}{
+		{"old peer offers nothing", nil, SupportedSchemes, SchemeLegacy},
+		{"prefers the first offered", []string{SchemeAESGCM, SchemeLegacy}, SupportedSchemes, SchemeAESGCM},
+		{"peer prefers legacy", []string{SchemeLegacy, SchemeAESGCM}, SupportedSchemes, SchemeLegacy},
+		{"skips unknown schemes", []string{"chacha20", SchemeAESGCM}, SupportedSchemes, SchemeAESGCM},
+		{"legacy disabled locally", []string{SchemeLegacy}, []string{SchemeAESGCM}, ""},
+		{"nothing in common", []string{"chacha20"}, SupportedSchemes, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateScheme(tt.offered, tt.supported); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
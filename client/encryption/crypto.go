@@ -125,7 +125,7 @@ func Decrypt(ciphertext, password string) (string, error) {
 	}
 
 	// 检查数据长度
-	if len(ciphertextOnly)%aes.BlockSize != 0 {
+	if len(ciphertextOnly) == 0 || len(ciphertextOnly)%aes.BlockSize != 0 {
 		return "", errors.New("ciphertext is not a multiple of block size")
 	}
 
@@ -134,11 +134,16 @@ func Decrypt(ciphertext, password string) (string, error) {
 	plaintext := make([]byte, len(ciphertextOnly))
 	mode.CryptBlocks(plaintext, ciphertextOnly)
 
-	// 移除 PKCS7 填充
+	// 移除 PKCS7 填充（检查所有填充字节，而不仅仅是最后一个）
 	padding := int(plaintext[len(plaintext)-1])
 	if padding > aes.BlockSize || padding == 0 {
 		return "", errors.New("invalid padding")
 	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return "", errors.New("invalid padding")
+		}
+	}
 	plaintext = plaintext[:len(plaintext)-padding]
 
 	return string(plaintext), nil
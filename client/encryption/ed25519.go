@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// GenerateEd25519Key 生成新的 Ed25519 签名私钥
+func GenerateEd25519Key() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ed25519 key: %w", err)
+	}
+	return key, nil
+}
+
+// EncodeEd25519PublicKey 将公钥编码为 base64
+func EncodeEd25519PublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// EncodeEd25519PrivateKey 将私钥编码为 base64（只编码 32 字节的种子）
+func EncodeEd25519PrivateKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Seed())
+}
+
+// ParseEd25519PublicKey 解析 base64 编码的公钥
+func ParseEd25519PublicKey(value string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ParseEd25519PrivateKey 解析 base64 编码的私钥种子
+func ParseEd25519PrivateKey(value string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	if len(raw) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid ed25519 private key: expected %d bytes, got %d", ed25519.SeedSize, len(raw))
+	}
+	return ed25519.NewKeyFromSeed(raw), nil
+}
+
+// SignEd25519 使用 Ed25519 对字段列表签名，返回 base64 编码的签名
+func SignEd25519(key ed25519.PrivateKey, fields ...string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, lengthPrefixed(fields)))
+}
+
+// VerifyEd25519 校验 Ed25519 签名
+func VerifyEd25519(key ed25519.PublicKey, signature string, fields ...string) bool {
+	given, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(given) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, lengthPrefixed(fields), given)
+}
+
+// lengthPrefixed 拼接字段列表（每个字段带长度前缀，避免拼接歧义）
+func lengthPrefixed(fields []string) []byte {
+	var buf []byte
+	var length [8]byte
+	for _, field := range fields {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		buf = append(buf, length[:]...)
+		buf = append(buf, field...)
+	}
+	return buf
+}
@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+)
+
+func TestEd25519Keys(t *testing.T) {
+	key, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+
+	parsedPublic, err := ParseEd25519PublicKey(EncodeEd25519PublicKey(public))
+	if err != nil || !parsedPublic.Equal(public) {
+		t.Fatalf("public key round trip: %v", err)
+	}
+	parsedPrivate, err := ParseEd25519PrivateKey(EncodeEd25519PrivateKey(key))
+	if err != nil || !parsedPrivate.Equal(key) {
+		t.Fatalf("private key round trip: %v", err)
+	}
+
+	invalid := []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString(make([]byte, 31)),
+		base64.StdEncoding.EncodeToString(make([]byte, 64)),
+	}
+	for _, value := range invalid {
+		if _, err := ParseEd25519PublicKey(value); err == nil {
+			t.Errorf("ParseEd25519PublicKey(%q) succeeded", value)
+		}
+		if _, err := ParseEd25519PrivateKey(value); err == nil {
+			t.Errorf("ParseEd25519PrivateKey(%q) succeeded", value)
+		}
+	}
+}
+
+func TestSignVerifyEd25519(t *testing.T) {
+	key, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+
+	fields := []string{"sqlbots command v1", "cmd-1", "rotate_keys", "machine-1"}
+	signature := SignEd25519(key, fields...)
+	if !VerifyEd25519(public, signature, fields...) {
+		t.Fatal("valid signature rejected")
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(signature)
+	raw[0] ^= 0x01
+	tests := []struct {
+		name      string
+		key       ed25519.PublicKey
+		signature string
+		fields    []string
+	}{
+		{"wrong key", otherKey.Public().(ed25519.PublicKey), signature, fields},
+		{"tampered field", public, signature, []string{"sqlbots command v1", "cmd-1", "deregister", "machine-1"}},
+		{"moved field boundary", public, signature, []string{"sqlbots command v1", "cmd-1rotate_keys", "", "machine-1"}},
+		{"tampered signature", public, base64.StdEncoding.EncodeToString(raw), fields},
+		{"truncated signature", public, base64.StdEncoding.EncodeToString(raw[:32]), fields},
+		{"invalid encoding", public, "not base64!", fields},
+	}
+	for _, tt := range tests {
+		if VerifyEd25519(tt.key, tt.signature, tt.fields...) {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+}
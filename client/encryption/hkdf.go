@@ -0,0 +1,36 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// hkdfSHA256 HKDF 密钥派生（RFC 5869，使用 SHA-256）
+func hkdfSHA256(secret, salt, info []byte, length int) ([]byte, error) {
+	if length > 255*sha256.Size {
+		return nil, errors.New("hkdf: requested key length too large")
+	}
+
+	// Extract：PRK = HMAC(salt, secret)
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extractor := hmac.New(sha256.New, salt)
+	extractor.Write(secret)
+	prk := extractor.Sum(nil)
+
+	// Expand：T(i) = HMAC(PRK, T(i-1) + info + i)
+	okm := make([]byte, 0, length)
+	var previous []byte
+	for counter := byte(1); len(okm) < length; counter++ {
+		expander := hmac.New(sha256.New, prk)
+		expander.Write(previous)
+		expander.Write(info)
+		expander.Write([]byte{counter})
+		previous = expander.Sum(nil)
+		okm = append(okm, previous...)
+	}
+
+	return okm[:length], nil
+}
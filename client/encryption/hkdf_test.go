@@ -0,0 +1,69 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// byteRange 返回 from 到 to（含）的连续字节
+func byteRange(from, to int) []byte {
+	b := make([]byte, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		b = append(b, byte(i))
+	}
+	return b
+}
+
+// RFC 5869 附录 A 的 HKDF-SHA256 测试向量（A.1 - A.3）
+func TestHKDFSHA256(t *testing.T) {
+	tests := []struct {
+		name         string
+		secret, salt []byte
+		info         []byte
+		length       int
+		want         string
+	}{
+		{
+			name:   "basic",
+			secret: bytes.Repeat([]byte{0x0b}, 22),
+			salt:   byteRange(0x00, 0x0c),
+			info:   byteRange(0xf0, 0xf9),
+			length: 42,
+			want:   "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			name:   "longer inputs",
+			secret: byteRange(0x00, 0x4f),
+			salt:   byteRange(0x60, 0xaf),
+			info:   byteRange(0xb0, 0xff),
+			length: 82,
+			want: "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c" +
+				"59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71" +
+				"cc30c58179ec3e87c14c01d5c1f3434f1d87",
+		},
+		{
+			name:   "empty salt and info",
+			secret: bytes.Repeat([]byte{0x0b}, 22),
+			length: 42,
+			want:   "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			okm, err := hkdfSHA256(tt.secret, tt.salt, tt.info, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(okm); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHKDFSHA256RejectsLongOutput(t *testing.T) {
+	if _, err := hkdfSHA256([]byte("secret"), nil, nil, 255*32+1); err == nil {
+		t.Fatal("accepted an output longer than 255 blocks")
+	}
+}
@@ -0,0 +1,43 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// DefaultPassphraseIterations 口令派生密钥的默认迭代次数
+	DefaultPassphraseIterations = 600000
+	// MaxPassphraseIterations 接受的最大迭代次数（迭代次数来自文件时，防止被篡改为极大的值导致长时间卡住）
+	MaxPassphraseIterations = 10 * DefaultPassphraseIterations
+)
+
+// DerivePassphraseKey 使用 PBKDF2-HMAC-SHA256（RFC 8018）从口令派生 32 字节密钥
+// 口令通常强度较低，迭代次数用于增加暴力破解的成本
+func DerivePassphraseKey(passphrase string, salt []byte, iterations int) []byte {
+	if iterations <= 0 {
+		iterations = DefaultPassphraseIterations
+	}
+
+	prf := hmac.New(sha256.New, []byte(passphrase))
+
+	// 只需要一个块：T1 = U1 ^ U2 ^ ... ^ Uc，U1 = PRF(salt + INT(1))
+	prf.Write(salt)
+	var counter [4]byte
+	binary.BigEndian.PutUint32(counter[:], 1)
+	prf.Write(counter[:])
+	u := prf.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
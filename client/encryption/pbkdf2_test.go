@@ -0,0 +1,25 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 7914 第 11 节的 PBKDF2-HMAC-SHA256 测试向量（取前 32 字节）
+func TestDerivePassphraseKey(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(DerivePassphraseKey(tt.passphrase, []byte(tt.salt), tt.iterations))
+		if got != tt.want {
+			t.Errorf("%s/%s/%d: got %s, want %s", tt.passphrase, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+const hkdfInfoSignature = "sqlbots request signature v1"
+
+// Sign 使用 HMAC-SHA256 对字段列表签名，返回 base64 编码的签名
+// 签名密钥由 HKDF 从加密密钥派生，与加密使用的密钥互不相同
+func Sign(key string, fields ...string) string {
+	return base64.StdEncoding.EncodeToString(signatureMAC(key, fields))
+}
+
+// Verify 校验签名（常量时间比较）
+func Verify(key, signature string, fields ...string) bool {
+	given, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(given, signatureMAC(key, fields))
+}
+
+// signatureMAC 计算字段列表的 HMAC（每个字段带长度前缀，避免拼接歧义）
+func signatureMAC(key string, fields []string) []byte {
+	signingKey, _ := hkdfSHA256([]byte(key), nil, []byte(hkdfInfoSignature), sha256.Size)
+
+	mac := hmac.New(sha256.New, signingKey)
+	var length [8]byte
+	for _, field := range fields {
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		mac.Write(length[:])
+		mac.Write([]byte(field))
+	}
+	return mac.Sum(nil)
+}
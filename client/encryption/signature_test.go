@@ -0,0 +1,48 @@
+package encryption
+
+import "testing"
+
+func TestSignVerify(t *testing.T) {
+	fields := []string{"/heartbeat", "api-key", "1700000000", "nonce", "payload"}
+	signature := Sign(testPassword, fields...)
+	if !Verify(testPassword, signature, fields...) {
+		t.Fatal("valid signature rejected")
+	}
+	if Sign(testPassword, fields...) != signature {
+		t.Fatal("signature is not deterministic")
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		signature string
+		fields    []string
+	}{
+		{"wrong key", "other-key", signature, fields},
+		{"tampered field", testPassword, signature, []string{"/heartbeat", "api-key", "1700000001", "nonce", "payload"}},
+		{"swapped fields", testPassword, signature, []string{"/heartbeat", "api-key", "1700000000", "payload", "nonce"}},
+		{"missing field", testPassword, signature, fields[:4]},
+		{"extra field", testPassword, signature, append(append([]string{}, fields...), "")},
+		{"invalid encoding", testPassword, "not base64!", fields},
+		{"empty signature", testPassword, "", fields},
+	}
+	for _, tt := range tests {
+		if Verify(tt.key, tt.signature, tt.fields...) {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+}
+
+// 字段带长度前缀：移动字段边界得到不同的签名
+func TestSignFieldBoundaries(t *testing.T) {
+	pairs := [][2][]string{
+		{{"ab", "c"}, {"a", "bc"}},
+		{{"abc"}, {"abc", ""}},
+		{{"", "abc"}, {"abc", ""}},
+	}
+	for _, pair := range pairs {
+		if Sign(testPassword, pair[0]...) == Sign(testPassword, pair[1]...) {
+			t.Errorf("%q and %q have the same signature", pair[0], pair[1])
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// KeyAgreementX25519 X25519 密钥协商标识
+const KeyAgreementX25519 = "x25519"
+
+const (
+	hkdfInfoX25519     = "sqlbots x25519 session key v1"
+	confirmationLabel  = "sqlbots x25519 server confirmation v1"
+	sessionKeyBytesLen = 32
+)
+
+// ErrKeyConfirmationFailed 服务器的密钥确认值不匹配（服务器不持有固定的私钥，或数据被篡改）
+var ErrKeyConfirmationFailed = errors.New("key confirmation failed")
+
+// GenerateX25519Key 生成新的 X25519 私钥
+func GenerateX25519Key() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// EncodeX25519PublicKey 将公钥编码为 base64
+func EncodeX25519PublicKey(key *ecdh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// EncodeX25519PrivateKey 将私钥编码为 base64
+func EncodeX25519PrivateKey(key *ecdh.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// ParseX25519PublicKey 解析 base64 编码的公钥
+func ParseX25519PublicKey(value string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x25519 public key: %w", err)
+	}
+	return key, nil
+}
+
+// ParseX25519PrivateKey 解析 base64 编码的私钥
+func ParseX25519PrivateKey(value string) (*ecdh.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x25519 private key: %w", err)
+	}
+	return key, nil
+}
+
+// ClientHandshake 客户端握手状态（临时密钥只在一次密钥交换中使用）
+//
+// 会话密钥 = HKDF(DH(客户端临时, 服务器固定) || DH(客户端临时, 服务器临时))
+// 第一个 DH 验证服务器身份（只有持有固定私钥的服务器能算出），第二个 DH 提供前向保密
+type ClientHandshake struct {
+	ephemeral    *ecdh.PrivateKey
+	serverStatic *ecdh.PublicKey
+}
+
+// NewClientHandshake 使用固定的服务器公钥创建客户端握手
+func NewClientHandshake(serverStatic *ecdh.PublicKey) (*ClientHandshake, error) {
+	ephemeral, err := GenerateX25519Key()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	return &ClientHandshake{
+		ephemeral:    ephemeral,
+		serverStatic: serverStatic,
+	}, nil
+}
+
+// PublicKey 返回客户端临时公钥（base64）
+func (h *ClientHandshake) PublicKey() string {
+	return EncodeX25519PublicKey(h.ephemeral.PublicKey())
+}
+
+// Finish 使用服务器临时公钥完成握手，校验密钥确认值并返回会话密钥
+func (h *ClientHandshake) Finish(serverEphemeral, confirmation, apiKey string) (string, error) {
+	serverEphemeralKey, err := ParseX25519PublicKey(serverEphemeral)
+	if err != nil {
+		return "", err
+	}
+
+	staticShared, err := h.ephemeral.ECDH(h.serverStatic)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	ephemeralShared, err := h.ephemeral.ECDH(serverEphemeralKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	sessionKey, err := deriveX25519SessionKey(staticShared, ephemeralShared,
+		h.ephemeral.PublicKey().Bytes(), serverEphemeralKey.Bytes(), apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	expected := keyConfirmation(sessionKey, h.ephemeral.PublicKey().Bytes(), serverEphemeralKey.Bytes())
+	given, err := base64.StdEncoding.DecodeString(confirmation)
+	if err != nil || !hmac.Equal(expected, given) {
+		return "", ErrKeyConfirmationFailed
+	}
+
+	return hex.EncodeToString(sessionKey), nil
+}
+
+// RespondX25519 服务器端完成握手：返回服务器临时公钥、密钥确认值和会话密钥
+func RespondX25519(serverStatic *ecdh.PrivateKey, clientEphemeral, apiKey string) (string, string, string, error) {
+	clientKey, err := ParseX25519PublicKey(clientEphemeral)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	ephemeral, err := GenerateX25519Key()
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	staticShared, err := serverStatic.ECDH(clientKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+	ephemeralShared, err := ephemeral.ECDH(clientKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	sessionKey, err := deriveX25519SessionKey(staticShared, ephemeralShared,
+		clientKey.Bytes(), ephemeral.PublicKey().Bytes(), apiKey)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	confirmation := keyConfirmation(sessionKey, clientKey.Bytes(), ephemeral.PublicKey().Bytes())
+
+	return EncodeX25519PublicKey(ephemeral.PublicKey()),
+		base64.StdEncoding.EncodeToString(confirmation),
+		hex.EncodeToString(sessionKey),
+		nil
+}
+
+// deriveX25519SessionKey 从两个共享密钥派生会话密钥（双方公钥作为盐值，API Key 绑定到 info）
+func deriveX25519SessionKey(staticShared, ephemeralShared, clientPublic, serverPublic []byte, apiKey string) ([]byte, error) {
+	secret := append(append([]byte{}, staticShared...), ephemeralShared...)
+	salt := append(append([]byte{}, clientPublic...), serverPublic...)
+	info := []byte(hkdfInfoX25519 + "\x00" + apiKey)
+	return hkdfSHA256(secret, salt, info, sessionKeyBytesLen)
+}
+
+// keyConfirmation 计算密钥确认值（证明服务器算出了相同的会话密钥）
+func keyConfirmation(sessionKey, clientPublic, serverPublic []byte) []byte {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte(confirmationLabel))
+	mac.Write(clientPublic)
+	mac.Write(serverPublic)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,152 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testAPIKey = "api-key"
+
+// handshake 生成服务器固定密钥并创建客户端握手
+func handshake(t *testing.T) (*ecdh.PrivateKey, *ClientHandshake) {
+	t.Helper()
+	serverStatic, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientHandshake(serverStatic.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serverStatic, client
+}
+
+func TestX25519Handshake(t *testing.T) {
+	serverStatic, client := handshake(t)
+
+	serverEphemeral, confirmation, serverKey, err := RespondX25519(serverStatic, client.PublicKey(), testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := client.Finish(serverEphemeral, confirmation, testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientKey != serverKey {
+		t.Fatalf("session keys differ: client %s, server %s", clientKey, serverKey)
+	}
+	if raw, err := hex.DecodeString(clientKey); err != nil || len(raw) != sessionKeyBytesLen {
+		t.Fatalf("session key %q: %d bytes (%v)", clientKey, len(raw), err)
+	}
+
+	// 每次握手使用新的临时密钥
+	_, _, otherKey, err := RespondX25519(serverStatic, client.PublicKey(), testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherKey == serverKey {
+		t.Fatal("two handshakes derived the same session key")
+	}
+}
+
+// 密钥确认值不匹配时不返回会话密钥
+func TestX25519KeyConfirmationMismatch(t *testing.T) {
+	serverStatic, client := handshake(t)
+	serverEphemeral, confirmation, _, err := RespondX25519(serverStatic, client.PublicKey(), testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一个服务器私钥（客户端固定的公钥不属于该服务器）
+	impostor, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostorEphemeral, impostorConfirmation, _, err := RespondX25519(impostor, client.PublicKey(), testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(confirmation)
+	raw[0] ^= 0x01
+	tampered := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name                          string
+		serverEphemeral, confirmation string
+		apiKey                        string
+	}{
+		{"wrong server key", impostorEphemeral, impostorConfirmation, testAPIKey},
+		{"tampered confirmation", serverEphemeral, tampered, testAPIKey},
+		{"invalid confirmation encoding", serverEphemeral, "not base64!", testAPIKey},
+		{"empty confirmation", serverEphemeral, "", testAPIKey},
+		{"other API key", serverEphemeral, confirmation, "other-key"},
+	}
+	for _, tt := range tests {
+		key, err := client.Finish(tt.serverEphemeral, tt.confirmation, tt.apiKey)
+		if !errors.Is(err, ErrKeyConfirmationFailed) || key != "" {
+			t.Errorf("%s: got %q, %v, want ErrKeyConfirmationFailed", tt.name, key, err)
+		}
+	}
+}
+
+// 低阶点（共享密钥全零）被拒绝
+func TestX25519RejectsLowOrderPoints(t *testing.T) {
+	serverStatic, client := handshake(t)
+
+	lowOrder := []string{
+		strings.Repeat("00", 32),
+		"01" + strings.Repeat("00", 31),
+		"e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800",
+	}
+	for _, point := range lowOrder {
+		raw, _ := hex.DecodeString(point)
+		encoded := base64.StdEncoding.EncodeToString(raw)
+
+		if _, err := client.Finish(encoded, "", testAPIKey); err == nil || errors.Is(err, ErrKeyConfirmationFailed) {
+			t.Errorf("client accepted low-order point %s: %v", point, err)
+		}
+		if _, _, _, err := RespondX25519(serverStatic, encoded, testAPIKey); err == nil {
+			t.Errorf("server accepted low-order point %s", point)
+		}
+	}
+}
+
+func TestParseX25519PublicKey(t *testing.T) {
+	key, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseX25519PublicKey(EncodeX25519PublicKey(key.PublicKey()))
+	if err != nil || !parsed.Equal(key.PublicKey()) {
+		t.Fatalf("round trip: %v", err)
+	}
+	private, err := ParseX25519PrivateKey(EncodeX25519PrivateKey(key))
+	if err != nil || !private.Equal(key) {
+		t.Fatalf("private key round trip: %v", err)
+	}
+
+	for _, value := range []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString(make([]byte, 31)),
+		base64.StdEncoding.EncodeToString(make([]byte, 33)),
+	} {
+		if _, err := ParseX25519PublicKey(value); err == nil {
+			t.Errorf("ParseX25519PublicKey(%q) succeeded", value)
+		}
+	}
+
+	// 握手的任何一方收到无效公钥都失败
+	serverStatic, client := handshake(t)
+	if _, _, _, err := RespondX25519(serverStatic, "not base64!", testAPIKey); err == nil {
+		t.Error("server accepted an invalid client key")
+	}
+	if _, err := client.Finish(base64.StdEncoding.EncodeToString(make([]byte, 16)), "", testAPIKey); err == nil || errors.Is(err, ErrKeyConfirmationFailed) {
+		t.Errorf("client accepted an invalid server key: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package errors 定义客户端与服务器通信时的错误类型和分类
+//
+// 导入时建议使用别名以避免与标准库冲突：
+//
+//	apperrors "sqlbots-client/errors"
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 服务器状态码（与服务器 utils/errors.js 保持一致，客户端、protocol 包和内置服务器都使用这里的定义；
+// 签名和重放相关状态码为 Go 服务器新增）
+const (
+	CodeSuccess              = "SUCCESS"
+	CodeInvalidAPIKey        = "INVALID_API_KEY"
+	CodeDecryptionFailed     = "DECRYPTION_FAILED"
+	CodeLicenseExpired       = "LICENSE_EXPIRED"
+	CodeMachineLimitExceeded = "MACHINE_LIMIT_EXCEEDED"
+	CodeServerError          = "SERVER_ERROR"
+	CodeInvalidSignature     = "INVALID_SIGNATURE"
+	CodeReplayDetected       = "REPLAY_DETECTED"
+	CodeStaleRequest         = "STALE_REQUEST"
+
+	// CodeHTTPError 服务器未返回状态码的 HTTP 错误（例如反向代理返回的 502）
+	CodeHTTPError = "HTTP_ERROR"
+	// CodeNetworkError 请求未能到达服务器（DNS、连接、超时等）
+	CodeNetworkError = "NETWORK_ERROR"
+)
+
+// Class 错误分类，决定调用方如何处理
+type Class int
+
+const (
+	// ClassUnknown 未知错误，不终止程序也不立即重试
+	ClassUnknown Class = iota
+	// ClassFatal 致命错误，需要终止程序
+	ClassFatal
+	// ClassRetryable 服务器临时错误，可以重试
+	ClassRetryable
+	// ClassReauthenticate 会话密钥失效，需要重新交换密钥后重试
+	// （不属于 ClassRetryable：用同一个密钥立即重发没有意义，由 heartbeat.Send 重新交换密钥后重发一次）
+	ClassReauthenticate
+	// ClassNetwork 网络暂时不可用，可以稍后重试
+	ClassNetwork
+)
+
+// String 返回分类名称
+func (c Class) String() string {
+	switch c {
+	case ClassFatal:
+		return "fatal"
+	case ClassRetryable:
+		return "retryable"
+	case ClassReauthenticate:
+		return "reauthenticate"
+	case ClassNetwork:
+		return "network"
+	default:
+		return "unknown"
+	}
+}
+
+// ProtocolError 协议错误（服务器返回的非成功状态或网络错误）
+type ProtocolError struct {
+	StatusCode string // 服务器状态码，例如 INVALID_API_KEY
+	HTTPStatus int    // HTTP 状态码（未知时为 0）
+	Message    string // 服务器返回的错误信息
+	Class      Class  // 错误分类
+	Err        error  // 底层错误（网络错误等）
+}
+
+// New 根据服务器返回的状态码创建协议错误
+func New(httpStatus int, statusCode, message string) *ProtocolError {
+	if statusCode == "" {
+		statusCode = CodeHTTPError
+	}
+	if message == "" {
+		message = DefaultMessage(statusCode)
+	}
+	return &ProtocolError{
+		StatusCode: statusCode,
+		HTTPStatus: httpStatus,
+		Message:    message,
+		Class:      Classify(statusCode, httpStatus),
+	}
+}
+
+// Network 创建网络错误
+func Network(err error) *ProtocolError {
+	return &ProtocolError{
+		StatusCode: CodeNetworkError,
+		Message:    "failed to send request",
+		Class:      ClassNetwork,
+		Err:        err,
+	}
+}
+
+// Error 实现 error 接口
+func (e *ProtocolError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+
+	msg := e.StatusCode
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", e.StatusCode, e.Message)
+	}
+	if e.HTTPStatus != 0 && e.HTTPStatus != http.StatusOK {
+		msg = fmt.Sprintf("%s (HTTP %d)", msg, e.HTTPStatus)
+	}
+	return msg
+}
+
+// Unwrap 返回底层错误
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// Classify 根据状态码和 HTTP 状态码对错误分类
+func Classify(statusCode string, httpStatus int) Class {
+	switch statusCode {
+	case CodeInvalidAPIKey, CodeLicenseExpired, CodeMachineLimitExceeded:
+		return ClassFatal
+	case CodeDecryptionFailed, CodeInvalidSignature:
+		return ClassReauthenticate
+	case CodeServerError, CodeReplayDetected:
+		return ClassRetryable
+	case CodeNetworkError:
+		return ClassNetwork
+	}
+
+	if httpStatus >= http.StatusInternalServerError || httpStatus == http.StatusTooManyRequests {
+		return ClassRetryable
+	}
+	return ClassUnknown
+}
+
+// DefaultMessage 服务器未返回 message 时使用的默认错误信息
+func DefaultMessage(statusCode string) string {
+	switch statusCode {
+	case CodeInvalidAPIKey:
+		return "API Key is invalid"
+	case CodeLicenseExpired:
+		return "License has expired"
+	case CodeMachineLimitExceeded:
+		return "Maximum machines limit exceeded"
+	case CodeDecryptionFailed:
+		return "Failed to decrypt data"
+	case CodeServerError:
+		return "Server error occurred"
+	case CodeInvalidSignature:
+		return "Request signature is invalid"
+	case CodeReplayDetected:
+		return "Request was already processed"
+	case CodeStaleRequest:
+		return "Request timestamp is outside the allowed clock skew"
+	default:
+		return ""
+	}
+}
+
+// ClassOf 返回错误的分类（非 ProtocolError 返回 ClassUnknown）
+func ClassOf(err error) Class {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		return protocolErr.Class
+	}
+	return ClassUnknown
+}
+
+// CodeOf 返回错误的服务器状态码（非 ProtocolError 返回空字符串）
+func CodeOf(err error) string {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		return protocolErr.StatusCode
+	}
+	return ""
+}
+
+// IsFatal 是否是致命错误（需要终止程序）
+func IsFatal(err error) bool {
+	return ClassOf(err) == ClassFatal
+}
+
+// IsRetryable 是否可以重试（服务器临时错误或网络错误）
+func IsRetryable(err error) bool {
+	class := ClassOf(err)
+	return class == ClassRetryable || class == ClassNetwork
+}
+
+// NeedsReauth 是否需要重新交换会话密钥
+func NeedsReauth(err error) bool {
+	return ClassOf(err) == ClassReauthenticate
+}
+
+// 进程退出码（无界面模式下供 systemd、Docker 等根据退出原因决定是否重启）
+const (
+	ExitOK                   = 0 // 正常退出
+	ExitFailure              = 1 // 其他错误
+	ExitConfig               = 2 // 配置错误
+	ExitUsage                = 2 // 命令行用法错误（未知的子命令、参数或输出格式，与配置错误使用相同的退出码）
+	ExitInvalidAPIKey        = 3 // API Key 无效
+	ExitLicenseExpired       = 4 // 许可证已过期
+	ExitMachineLimitExceeded = 5 // 机器数量超过限制
+	ExitServerUnreachable    = 6 // 服务器不可达且离线宽限期已过
+)
+
+// ExitCode 根据错误返回进程退出码
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	switch CodeOf(err) {
+	case CodeInvalidAPIKey:
+		return ExitInvalidAPIKey
+	case CodeLicenseExpired:
+		return ExitLicenseExpired
+	case CodeMachineLimitExceeded:
+		return ExitMachineLimitExceeded
+	}
+	if IsRetryable(err) {
+		return ExitServerUnreachable
+	}
+	return ExitFailure
+}
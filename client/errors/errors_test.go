@@ -0,0 +1,111 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code       string
+		httpStatus int
+		want       Class
+	}{
+		{CodeInvalidAPIKey, http.StatusUnauthorized, ClassFatal},
+		{CodeLicenseExpired, http.StatusForbidden, ClassFatal},
+		{CodeMachineLimitExceeded, http.StatusForbidden, ClassFatal},
+		{CodeDecryptionFailed, http.StatusBadRequest, ClassReauthenticate},
+		{CodeInvalidSignature, http.StatusUnauthorized, ClassReauthenticate},
+		{CodeServerError, http.StatusInternalServerError, ClassRetryable},
+		{CodeReplayDetected, http.StatusBadRequest, ClassRetryable},
+		{CodeNetworkError, 0, ClassNetwork},
+		{CodeHTTPError, http.StatusBadGateway, ClassRetryable},
+		{CodeHTTPError, http.StatusTooManyRequests, ClassRetryable},
+		{CodeHTTPError, http.StatusNotFound, ClassUnknown},
+		{CodeStaleRequest, http.StatusBadRequest, ClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.code, tt.httpStatus); got != tt.want {
+			t.Errorf("Classify(%s, %d): got %s, want %s", tt.code, tt.httpStatus, got, tt.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"invalid api key", New(http.StatusUnauthorized, CodeInvalidAPIKey, ""), ExitInvalidAPIKey},
+		{"license expired", New(http.StatusForbidden, CodeLicenseExpired, ""), ExitLicenseExpired},
+		{"machine limit", New(http.StatusForbidden, CodeMachineLimitExceeded, ""), ExitMachineLimitExceeded},
+		{"wrapped", fmt.Errorf("heartbeat: %w", fmt.Errorf("send: %w", New(http.StatusUnauthorized, CodeInvalidAPIKey, ""))), ExitInvalidAPIKey},
+		{"server error", New(http.StatusInternalServerError, CodeServerError, ""), ExitServerUnreachable},
+		{"bad gateway", New(http.StatusBadGateway, "", ""), ExitServerUnreachable},
+		{"network", Network(errors.New("connection refused")), ExitServerUnreachable},
+		{"wrapped network", fmt.Errorf("heartbeat: %w", Network(errors.New("timeout"))), ExitServerUnreachable},
+		{"decryption failed", New(http.StatusBadRequest, CodeDecryptionFailed, ""), ExitFailure},
+		{"stale request", New(http.StatusBadRequest, CodeStaleRequest, ""), ExitFailure},
+		{"not found", New(http.StatusNotFound, "", ""), ExitFailure},
+		{"plain", errors.New("boom"), ExitFailure},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: ExitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHelpersSeeWrappedErrors(t *testing.T) {
+	err := fmt.Errorf("heartbeat failed: %w", New(http.StatusForbidden, CodeLicenseExpired, ""))
+
+	if !IsFatal(err) || IsRetryable(err) || NeedsReauth(err) {
+		t.Errorf("license expired: fatal=%v retryable=%v reauth=%v", IsFatal(err), IsRetryable(err), NeedsReauth(err))
+	}
+	if code := CodeOf(err); code != CodeLicenseExpired {
+		t.Errorf("CodeOf: got %q", code)
+	}
+	if code := ExitCode(err); code != ExitLicenseExpired {
+		t.Errorf("ExitCode: got %d, want %d", code, ExitLicenseExpired)
+	}
+
+	// 会话密钥失效不是可以立即重试的错误
+	reauth := fmt.Errorf("heartbeat failed: %w", New(http.StatusBadRequest, CodeDecryptionFailed, ""))
+	if !NeedsReauth(reauth) || IsRetryable(reauth) {
+		t.Errorf("decryption failed: reauth=%v retryable=%v", NeedsReauth(reauth), IsRetryable(reauth))
+	}
+
+	plain := errors.New("boom")
+	if ClassOf(plain) != ClassUnknown || CodeOf(plain) != "" || ExitCode(plain) != ExitFailure {
+		t.Errorf("plain error: class=%s code=%q exit=%d", ClassOf(plain), CodeOf(plain), ExitCode(plain))
+	}
+	if ExitCode(nil) != ExitOK {
+		t.Error("ExitCode(nil) != ExitOK")
+	}
+}
+
+func TestNetworkError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Network(cause)
+
+	if !errors.Is(err, cause) {
+		t.Error("network error does not unwrap to its cause")
+	}
+	if !IsRetryable(err) || ExitCode(err) != ExitServerUnreachable {
+		t.Errorf("network error: retryable=%v exit=%d", IsRetryable(err), ExitCode(err))
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := New(http.StatusForbidden, CodeMachineLimitExceeded, "")
+	if got, want := err.Error(), "MACHINE_LIMIT_EXCEEDED: Maximum machines limit exceeded (HTTP 403)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := New(0, "", "").StatusCode; got != CodeHTTPError {
+		t.Errorf("empty status code: got %q, want %q", got, CodeHTTPError)
+	}
+}
@@ -0,0 +1,159 @@
+// Package fingerprint 机器硬件指纹：每个组件的值单独哈希，比较时按组件加权计算相似度，
+// 小的硬件变化（升级内存、更换网卡）仍然视为同一台机器，而复制到其他主机的虚拟机镜像不是
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// 组件名称
+const (
+	ProductUUID    = "product_uuid"   // 主板/虚拟机的 UUID（DMI）
+	Board          = "board"          // 主板序列号
+	BIOS           = "bios"           // BIOS 厂商和版本
+	CPU            = "cpu"            // CPU 型号
+	Disks          = "disks"          // 磁盘序列号
+	MACs           = "macs"           // 物理网卡的 MAC 地址
+	Memory         = "memory"         // 内存大小（GB）
+	OS             = "os"             // 操作系统和版本
+	Kernel         = "kernel"         // 内核版本
+	Virtualization = "virtualization" // 虚拟化平台和角色
+)
+
+// DefaultWeights 各组件在相似度中的权重（越能唯一标识机器的组件权重越高）
+var DefaultWeights = map[string]float64{
+	ProductUUID:    3,
+	Board:          3,
+	Disks:          2,
+	CPU:            2,
+	BIOS:           1,
+	MACs:           1,
+	Virtualization: 1,
+	Memory:         0.5,
+	OS:             0.5,
+	Kernel:         0.25,
+}
+
+// identityComponents 唯一标识机器的组件：两边都有且完全不同时视为不同的机器
+var identityComponents = []string{ProductUUID, Board}
+
+// DefaultThreshold 视为同一台机器的最低相似度
+const DefaultThreshold = 0.7
+
+// hashLength 组件哈希的长度（十六进制字符）
+const hashLength = 32
+
+// Fingerprint 硬件指纹：组件名称 -> 哈希后的值（排序、去重）
+type Fingerprint map[string][]string
+
+// Hash 哈希组件的值（忽略大小写和首尾空白），不在网络上传输原始序列号和 MAC 地址
+func Hash(component, value string) string {
+	sum := sha256.Sum256([]byte(component + "\x00" + strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
+
+// Add 添加组件的值（空值被忽略，没有有效值时不添加组件）
+func (f Fingerprint) Add(component string, values ...string) {
+	seen := make(map[string]bool, len(f[component]))
+	for _, hash := range f[component] {
+		seen[hash] = true
+	}
+
+	hashes := f[component]
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		hash := Hash(component, value)
+		if !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	sort.Strings(hashes)
+	f[component] = hashes
+}
+
+// Comparison 两个指纹的比较结果
+type Comparison struct {
+	Score    float64  // 加权相似度（0~1，只计算两边都有的组件）
+	Changed  []string // 有变化的组件
+	Conflict string   // 完全不同的唯一标识组件（为空表示没有冲突）
+}
+
+// Match 是否视为同一台机器
+func (c Comparison) Match(threshold float64) bool {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return c.Conflict == "" && c.Score >= threshold
+}
+
+// Compare 比较两个指纹：每个组件按集合的 Jaccard 相似度计分，再按权重加权平均
+// 只有一边有的组件（例如没有权限读取主板序列号）不参与计算；没有共同组件时相似度为 0
+func Compare(a, b Fingerprint) Comparison {
+	var c Comparison
+	var total, matched float64
+
+	components := make([]string, 0, len(DefaultWeights))
+	for component := range DefaultWeights {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	for _, component := range components {
+		left, right := a[component], b[component]
+		if len(left) == 0 || len(right) == 0 {
+			continue
+		}
+
+		similarity := jaccard(left, right)
+		weight := DefaultWeights[component]
+		total += weight
+		matched += weight * similarity
+		if similarity < 1 {
+			c.Changed = append(c.Changed, component)
+		}
+		if similarity == 0 && isIdentity(component) && c.Conflict == "" {
+			c.Conflict = component
+		}
+	}
+
+	if total > 0 {
+		c.Score = matched / total
+	}
+	return c
+}
+
+// jaccard 两个已排序集合的 Jaccard 相似度（交集 / 并集）
+func jaccard(a, b []string) float64 {
+	set := make(map[string]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+
+	intersection := 0
+	for _, v := range b {
+		if set[v] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	return float64(intersection) / float64(union)
+}
+
+// isIdentity 是否是唯一标识机器的组件
+func isIdentity(component string) bool {
+	for _, c := range identityComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package fingerprint
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fp 由组件的原始值构造指纹
+func fp(components map[string][]string) Fingerprint {
+	f := Fingerprint{}
+	for component, values := range components {
+		f.Add(component, values...)
+	}
+	return f
+}
+
+func TestCompare(t *testing.T) {
+	base := map[string][]string{
+		ProductUUID: {"uuid-1"},
+		Board:       {"board-1"},
+		CPU:         {"Xeon"},
+		MACs:        {"aa", "bb"},
+		Memory:      {"16"},
+	}
+
+	tests := []struct {
+		name     string
+		a, b     map[string][]string
+		score    float64
+		changed  []string
+		conflict string
+		match    bool
+	}{
+		{
+			name:  "identical",
+			a:     base,
+			b:     base,
+			score: 1,
+			match: true,
+		},
+		{
+			// macs 的 Jaccard 相似度为 1/3：(3 + 3 + 2 + 1/3 + 0.5) / 9.5
+			name:    "one network card replaced",
+			a:       base,
+			b:       with(base, MACs, "aa", "cc"),
+			score:   (3 + 3 + 2 + 1.0/3 + 0.5) / 9.5,
+			changed: []string{MACs},
+			match:   true,
+		},
+		{
+			// (2 + 1 + 0.5) / 5 = 0.7：正好达到阈值
+			name:    "at the threshold",
+			a:       map[string][]string{CPU: {"Xeon"}, BIOS: {"bios"}, OS: {"linux"}, MACs: {"aa"}, Memory: {"16"}},
+			b:       map[string][]string{CPU: {"Xeon"}, BIOS: {"bios"}, OS: {"linux"}, MACs: {"bb"}, Memory: {"32"}},
+			score:   0.7,
+			changed: []string{MACs, Memory},
+			match:   true,
+		},
+		{
+			// (2 + 0.5 + 0.5) / 5 = 0.6
+			name:    "below the threshold",
+			a:       map[string][]string{Disks: {"disk-1"}, CPU: {"Xeon"}, Memory: {"16"}, OS: {"linux"}},
+			b:       map[string][]string{Disks: {"disk-2"}, CPU: {"Xeon"}, Memory: {"16"}, OS: {"linux"}},
+			score:   0.6,
+			changed: []string{Disks},
+		},
+		{
+			name:     "product uuid conflict",
+			a:        base,
+			b:        with(base, ProductUUID, "uuid-2"),
+			score:    6.5 / 9.5,
+			changed:  []string{ProductUUID},
+			conflict: ProductUUID,
+		},
+		{
+			// 其他组件完全相同也不匹配
+			name:     "board conflict",
+			a:        with(base, ProductUUID),
+			b:        with(with(base, ProductUUID), Board, "board-2"),
+			score:    3.5 / 6.5,
+			changed:  []string{Board},
+			conflict: Board,
+		},
+		{
+			name:  "component present on one side only",
+			a:     base,
+			b:     with(base, Board),
+			score: 1,
+			match: true,
+		},
+		{
+			name: "no shared components",
+			a:    map[string][]string{CPU: {"Xeon"}},
+			b:    map[string][]string{Disks: {"disk-1"}},
+		},
+		{
+			name: "empty fingerprint",
+			a:    base,
+			b:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Compare(fp(tt.a), fp(tt.b))
+			if math.Abs(c.Score-tt.score) > 1e-9 {
+				t.Errorf("score: got %v, want %v", c.Score, tt.score)
+			}
+			if !reflect.DeepEqual(c.Changed, tt.changed) {
+				t.Errorf("changed: got %v, want %v", c.Changed, tt.changed)
+			}
+			if c.Conflict != tt.conflict {
+				t.Errorf("conflict: got %q, want %q", c.Conflict, tt.conflict)
+			}
+			if c.Match(DefaultThreshold) != tt.match {
+				t.Errorf("match: got %v, want %v", c.Match(DefaultThreshold), tt.match)
+			}
+			if reverse := Compare(fp(tt.b), fp(tt.a)); math.Abs(reverse.Score-c.Score) > 1e-9 || reverse.Conflict != c.Conflict {
+				t.Errorf("comparison is not symmetric: %+v vs %+v", c, reverse)
+			}
+		})
+	}
+}
+
+func TestMatchThreshold(t *testing.T) {
+	c := Comparison{Score: 0.8}
+	if !c.Match(0) || c.Match(0.9) {
+		t.Fatal("threshold 0 should use the default, 0.9 should reject 0.8")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	f := Fingerprint{}
+	f.Add(MACs, "AA:BB", " aa:bb ", "", "cc:dd")
+	f.Add(Board, " ", "")
+
+	if len(f[MACs]) != 2 {
+		t.Fatalf("macs: got %d values, want 2 (case and whitespace ignored, duplicates removed)", len(f[MACs]))
+	}
+	if _, ok := f[Board]; ok {
+		t.Fatal("component without values added")
+	}
+	if Hash(MACs, "aa:bb") == Hash(Disks, "aa:bb") {
+		t.Fatal("hash does not depend on the component")
+	}
+}
+
+// with 返回替换了一个组件的副本（没有值时删除组件）
+func with(components map[string][]string, component string, values ...string) map[string][]string {
+	copied := make(map[string][]string, len(components))
+	for k, v := range components {
+		copied[k] = v
+	}
+	if len(values) == 0 {
+		delete(copied, component)
+	} else {
+		copied[component] = values
+	}
+	return copied
+}
@@ -7,4 +7,11 @@ require (
 	github.com/shirou/gopsutil/v3 v3.23.11
 )
 
-
+require (
+	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/shoenig/go-m1cpu v0.1.6 // indirect
+	github.com/tklauser/go-sysconf v0.3.12 // indirect
+	github.com/tklauser/numcpus v0.6.1 // indirect
+	github.com/yusufpapurcu/wmi v1.2.3 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,30 @@
+//go:build linux
+
+package hardware
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dmiDir Linux 的 DMI 信息目录
+const dmiDir = "/sys/class/dmi/id"
+
+// readDMI 读取 DMI 信息（board_serial、product_uuid 通常只有 root 可读，读取失败时返回空值）
+func readDMI() dmiInfo {
+	return dmiInfo{
+		ProductUUID: readDMIFile("product_uuid"),
+		BoardSerial: readDMIFile("board_serial"),
+		BIOS:        strings.TrimSpace(readDMIFile("bios_vendor") + " " + readDMIFile("bios_version")),
+	}
+}
+
+// readDMIFile 读取单个 DMI 文件，忽略厂商填写的占位值
+func readDMIFile(name string) string {
+	data, err := os.ReadFile(filepath.Join(dmiDir, name))
+	if err != nil {
+		return ""
+	}
+	return normalizeDMI(string(data))
+}
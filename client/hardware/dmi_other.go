@@ -0,0 +1,8 @@
+//go:build !linux
+
+package hardware
+
+// readDMI 非 Linux 系统暂不读取 DMI 信息（指纹使用其他组件）
+func readDMI() dmiInfo {
+	return dmiInfo{}
+}
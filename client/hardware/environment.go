@@ -0,0 +1,96 @@
+package hardware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// 运行环境类型
+const (
+	EnvPhysical  = "physical"
+	EnvVM        = "vm"
+	EnvContainer = "container"
+)
+
+// 实例 ID 的来源
+const (
+	InstanceFromMachine   = "machine"   // 物理机：与机器 ID 相同的来源
+	InstanceFromContainer = "container" // 容器 ID
+	InstanceFromHostname  = "hostname"  // 容器内读取不到容器 ID 时使用主机名
+	InstanceFromDMI       = "dmi"       // 虚拟机的 product_uuid（克隆时虚拟化平台会重新生成）
+	InstanceFromMAC       = "mac"       // 读取不到 product_uuid 时使用网卡 MAC 地址
+	InstanceFromConfig    = "config"    // 配置的实例名称（instance_id）
+)
+
+// Environment 运行环境（物理机、虚拟机或容器）
+type Environment struct {
+	Type     string   // physical、vm 或 container
+	Platform string   // 虚拟化或容器平台，例如 kvm、vmware、docker、kubernetes（未知时为空）
+	Signals  []string // 判断依据，例如 cgroup:docker、cpuinfo:hypervisor
+
+	containerID string // 容器 ID（只用于计算实例 ID，不发送）
+}
+
+// String 返回 type/platform 形式的描述
+func (e Environment) String() string {
+	if e.Platform == "" {
+		return e.Type
+	}
+	return e.Type + "/" + e.Platform
+}
+
+// DetectEnvironment 检测当前运行环境
+func DetectEnvironment() Environment {
+	return detectEnvironment()
+}
+
+// deriveInstanceID 计算实例 ID
+//
+// machineid 在克隆的虚拟机镜像和共享 /etc/machine-id 的容器中相同，因此再结合每个实例各自不同的值：
+// 容器使用容器 ID，虚拟机使用 product_uuid（读取不到时使用 MAC 地址），物理机只使用机器 ID
+func deriveInstanceID(machineID string, env Environment, dmi dmiInfo, macs []string) (string, string) {
+	switch env.Type {
+	case EnvContainer:
+		if env.containerID != "" {
+			return instanceHash(machineID, InstanceFromContainer, env.containerID), InstanceFromContainer
+		}
+		if hostname, err := os.Hostname(); err == nil && hostname != "" {
+			return instanceHash(machineID, InstanceFromHostname, hostname), InstanceFromHostname
+		}
+	case EnvVM:
+		if dmi.ProductUUID != "" {
+			return instanceHash(machineID, InstanceFromDMI, dmi.ProductUUID), InstanceFromDMI
+		}
+		if len(macs) > 0 {
+			return instanceHash(machineID, InstanceFromMAC, strings.Join(sortedCopy(macs), ",")), InstanceFromMAC
+		}
+	}
+	return instanceHash(machineID, InstanceFromMachine, ""), InstanceFromMachine
+}
+
+// instanceHash 哈希机器 ID 和实例的区分值（不泄露原始的容器 ID 或 UUID）
+func instanceHash(machineID, source, value string) string {
+	sum := sha256.Sum256([]byte("sqlbots-instance\x00" + machineID + "\x00" + source + "\x00" + strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(sum[:16])
+}
+
+// EphemeralInstance 实例 ID 是否来自容器 ID 或容器的主机名
+//
+// 这类实例 ID 在容器重新部署（例如 Deployment 滚动更新）后会变化，服务器会把它当作新机器并占用一个新的机器名额，
+// 编排部署时应通过 SetInstanceName 配置稳定的实例名称
+func (m *MachineInfo) EphemeralInstance() bool {
+	return m.InstanceSource == InstanceFromContainer || m.InstanceSource == InstanceFromHostname
+}
+
+// SetInstanceName 使用配置的实例名称作为实例 ID（容器重建后容器 ID 会变化，可以用固定名称代替，例如 StatefulSet 的 Pod 名称）
+// 需要在 Protect 之前调用
+func (m *MachineInfo) SetInstanceName(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" || m.Protected {
+		return
+	}
+	m.InstanceID = instanceHash(m.MachineID, InstanceFromConfig, name)
+	m.InstanceSource = InstanceFromConfig
+}
@@ -0,0 +1,218 @@
+//go:build linux
+
+package hardware
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// containerIDPattern 容器 ID（64 位十六进制）
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// cgroupPlatforms cgroup 路径中的关键字 -> 容器平台（按顺序匹配，kubernetes 优先于容器运行时）
+var cgroupPlatforms = []struct {
+	keyword  string
+	platform string
+}{
+	{"kubepods", "kubernetes"},
+	{"libpod", "podman"},
+	{"/docker/", "docker"},
+	{"docker-", "docker"},
+	{"cri-containerd", "containerd"},
+	{"crio-", "cri-o"},
+	{"/lxc/", "lxc"},
+	{"lxc.payload", "lxc"},
+	{"machine.slice/machine-", "systemd-nspawn"},
+}
+
+// dmiVendors DMI 厂商或产品名称中的关键字 -> 虚拟化平台
+var dmiVendors = []struct {
+	keyword  string
+	platform string
+}{
+	{"qemu", "qemu"},
+	{"kvm", "kvm"},
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"innotek", "virtualbox"},
+	{"xen", "xen"},
+	{"bochs", "bochs"},
+	{"parallels", "parallels"},
+	{"amazon ec2", "aws"},
+	{"google compute engine", "gce"},
+	{"openstack", "openstack"},
+	{"digitalocean", "digitalocean"},
+	{"virtual machine", "hyperv"}, // Hyper-V：Microsoft Corporation / Virtual Machine
+}
+
+// detectEnvironment 依次检查容器（标记文件、PID 1 的环境变量、cgroup、挂载信息）和虚拟机（CPU hypervisor 标志、DMI、/sys/hypervisor）
+func detectEnvironment() Environment {
+	if env, ok := detectContainer(); ok {
+		return env
+	}
+	if env, ok := detectVM(); ok {
+		return env
+	}
+	return Environment{Type: EnvPhysical}
+}
+
+// detectContainer 检测容器
+func detectContainer() (Environment, bool) {
+	env := Environment{Type: EnvContainer}
+
+	if fileExists("/.dockerenv") {
+		env.Platform = "docker"
+		env.Signals = append(env.Signals, "file:/.dockerenv")
+	}
+	if fileExists("/run/.containerenv") {
+		env.Platform = "podman"
+		env.Signals = append(env.Signals, "file:/run/.containerenv")
+	}
+
+	// systemd-nspawn、lxc 等在 PID 1 的环境变量中设置 container=（通常只有 root 可读）
+	if value := processEnv("/proc/1/environ", "container"); value != "" {
+		if env.Platform == "" {
+			env.Platform = value
+		}
+		env.Signals = append(env.Signals, "environ:container="+value)
+	}
+
+	cgroup := readText("/proc/self/cgroup")
+	for _, p := range cgroupPlatforms {
+		if strings.Contains(cgroup, p.keyword) {
+			if env.Platform == "" || p.platform == "kubernetes" {
+				env.Platform = p.platform
+			}
+			env.Signals = append(env.Signals, "cgroup:"+p.platform)
+			break
+		}
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		env.Platform = "kubernetes"
+		env.Signals = append(env.Signals, "env:KUBERNETES_SERVICE_HOST")
+	}
+
+	// cgroup v2 的私有命名空间中 cgroup 只有 0::/，容器 ID 只能从挂载信息中找到
+	env.containerID = containerIDPattern.FindString(cgroup)
+	if env.containerID == "" {
+		env.containerID = containerIDFromMounts("/proc/self/mountinfo")
+	}
+	if env.containerID != "" && len(env.Signals) == 0 {
+		env.Signals = append(env.Signals, "mountinfo:container-id")
+	}
+
+	return env, len(env.Signals) > 0
+}
+
+// detectVM 检测虚拟机
+func detectVM() (Environment, bool) {
+	env := Environment{Type: EnvVM}
+
+	if cpuHasHypervisorFlag("/proc/cpuinfo") {
+		env.Signals = append(env.Signals, "cpuinfo:hypervisor")
+	}
+
+	dmi := strings.ToLower(readDMIFile("sys_vendor") + " " + readDMIFile("product_name") + " " + readDMIFile("bios_vendor"))
+	for _, v := range dmiVendors {
+		if strings.Contains(dmi, v.keyword) {
+			env.Platform = v.platform
+			env.Signals = append(env.Signals, "dmi:"+v.platform)
+			break
+		}
+	}
+
+	if hypervisor := strings.TrimSpace(readText("/sys/hypervisor/type")); hypervisor != "" {
+		if env.Platform == "" {
+			env.Platform = hypervisor
+		}
+		env.Signals = append(env.Signals, "hypervisor:"+hypervisor)
+	}
+
+	// WSL2 运行在 Hyper-V 虚拟机中
+	if strings.Contains(strings.ToLower(readText("/proc/sys/kernel/osrelease")), "microsoft") {
+		env.Platform = "wsl"
+		env.Signals = append(env.Signals, "osrelease:microsoft")
+	}
+
+	return env, len(env.Signals) > 0
+}
+
+// cpuHasHypervisorFlag CPU 标志中是否有 hypervisor（CPUID 的 hypervisor 位，虚拟机中由虚拟化平台设置）
+func cpuHasHypervisorFlag(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "flags") {
+			continue
+		}
+		if _, flags, ok := strings.Cut(line, ":"); ok {
+			for _, flag := range strings.Fields(flags) {
+				if flag == "hypervisor" {
+					return true
+				}
+			}
+		}
+		return false // 只需要检查第一个 CPU
+	}
+	return false
+}
+
+// containerIDFromMounts 从挂载信息中查找容器 ID（Docker 把 /etc/hostname 等文件从 containers/<id>/ 挂载进容器）
+func containerIDFromMounts(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "/containers/") && !strings.Contains(line, "/sandboxes/") {
+			continue
+		}
+		if id := containerIDPattern.FindString(line); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// processEnv 读取进程环境变量文件中的一个变量
+func processEnv(path, name string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range strings.Split(string(data), "\x00") {
+		if key, value, ok := strings.Cut(entry, "="); ok && key == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// readText 读取文本文件，失败时返回空字符串
+func readText(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fileExists 文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package hardware
+
+import "github.com/shirou/gopsutil/v3/host"
+
+// detectEnvironment 非 Linux 系统使用 gopsutil 检测虚拟化（Windows 和 macOS 上的容器不常见，不检测）
+func detectEnvironment() Environment {
+	system, role, err := host.Virtualization()
+	if err != nil || system == "" || role != "guest" {
+		return Environment{Type: EnvPhysical}
+	}
+	return Environment{Type: EnvVM, Platform: system, Signals: []string{"gopsutil:" + system}}
+}
@@ -0,0 +1,114 @@
+package hardware
+
+import (
+	"testing"
+
+	"sqlbots-client/protocol"
+)
+
+func TestDeriveInstanceID(t *testing.T) {
+	const machineID = "shared-machine-id"
+	vm := Environment{Type: EnvVM, Platform: "kvm"}
+
+	tests := []struct {
+		name   string
+		env    Environment
+		dmi    dmiInfo
+		macs   []string
+		source string
+	}{
+		{"physical", Environment{Type: EnvPhysical}, dmiInfo{ProductUUID: "uuid-1"}, []string{"aa"}, InstanceFromMachine},
+		{"vm", vm, dmiInfo{ProductUUID: "uuid-1"}, []string{"aa"}, InstanceFromDMI},
+		{"vm without product uuid", vm, dmiInfo{}, []string{"aa", "bb"}, InstanceFromMAC},
+		{"vm without uuid or mac", vm, dmiInfo{}, nil, InstanceFromMachine},
+		{"container", Environment{Type: EnvContainer, containerID: "abc123"}, dmiInfo{}, nil, InstanceFromContainer},
+		{"container without id", Environment{Type: EnvContainer}, dmiInfo{}, nil, InstanceFromHostname},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, source := deriveInstanceID(machineID, tt.env, tt.dmi, tt.macs)
+			if source != tt.source || len(id) != 32 {
+				t.Fatalf("got %q from %s, want a 32-character ID from %s", id, source, tt.source)
+			}
+			again, _ := deriveInstanceID(machineID, tt.env, tt.dmi, tt.macs)
+			if again != id {
+				t.Fatal("instance ID is not stable")
+			}
+		})
+	}
+}
+
+// 克隆的虚拟机镜像共享 /etc/machine-id，但虚拟化平台会重新生成 product_uuid 和 MAC 地址
+func TestDeriveInstanceIDDistinguishesClones(t *testing.T) {
+	const machineID = "cloned-machine-id"
+	vm := Environment{Type: EnvVM}
+
+	original, _ := deriveInstanceID(machineID, vm, dmiInfo{ProductUUID: "uuid-original"}, nil)
+	clone, _ := deriveInstanceID(machineID, vm, dmiInfo{ProductUUID: "uuid-clone"}, nil)
+	if original == clone {
+		t.Fatal("cloned VM got the same instance ID")
+	}
+
+	byMAC, _ := deriveInstanceID(machineID, vm, dmiInfo{}, []string{"aa", "bb"})
+	cloneByMAC, _ := deriveInstanceID(machineID, vm, dmiInfo{}, []string{"aa", "cc"})
+	reordered, _ := deriveInstanceID(machineID, vm, dmiInfo{}, []string{"bb", "aa"})
+	if byMAC == cloneByMAC || byMAC != reordered {
+		t.Fatal("MAC-based instance ID must differ for clones and ignore the order of interfaces")
+	}
+
+	// 同一个容器 ID 在不同机器上也不相同
+	c := Environment{Type: EnvContainer, containerID: "abc123"}
+	first, _ := deriveInstanceID("machine-a", c, dmiInfo{}, nil)
+	second, _ := deriveInstanceID("machine-b", c, dmiInfo{}, nil)
+	if first == second {
+		t.Fatal("instance ID does not depend on the machine ID")
+	}
+}
+
+func TestProtect(t *testing.T) {
+	m := &MachineInfo{MachineID: "raw-id", InstanceID: "instance"}
+	m.SetInstanceName("orders-0")
+	if m.InstanceSource != InstanceFromConfig {
+		t.Fatalf("instance source: got %s", m.InstanceSource)
+	}
+	instanceID := m.InstanceID
+
+	m.Protect("api-key")
+	m.Protect("api-key")
+	if m.MachineID != protocol.HashMachineID("raw-id", "api-key") || m.InstanceID != protocol.HashInstanceID(instanceID, "api-key") {
+		t.Fatal("IDs not hashed exactly once")
+	}
+
+	// 哈希之后不再修改实例 ID
+	m.SetInstanceName("other")
+	if m.InstanceID != protocol.HashInstanceID(instanceID, "api-key") {
+		t.Fatal("instance name changed after Protect")
+	}
+}
+
+func TestEphemeralInstance(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{InstanceFromContainer, true},
+		{InstanceFromHostname, true},
+		{InstanceFromConfig, false},
+		{InstanceFromDMI, false},
+		{InstanceFromMAC, false},
+		{InstanceFromMachine, false},
+	}
+	for _, tt := range tests {
+		m := &MachineInfo{MachineID: "raw-id", InstanceSource: tt.source}
+		if got := m.EphemeralInstance(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.source, got, tt.want)
+		}
+	}
+
+	// 配置了实例名称后不再是临时的实例 ID
+	m := &MachineInfo{MachineID: "raw-id", InstanceSource: InstanceFromContainer}
+	m.SetInstanceName("orders-0")
+	if m.EphemeralInstance() {
+		t.Fatal("configured instance name reported as ephemeral")
+	}
+}
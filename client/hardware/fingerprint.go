@@ -0,0 +1,140 @@
+package hardware
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+
+	"sqlbots-client/fingerprint"
+)
+
+// dmiInfo 主板和 BIOS 信息
+type dmiInfo struct {
+	ProductUUID string
+	BoardSerial string
+	BIOS        string
+}
+
+// dmiPlaceholders 厂商没有填写时常见的占位值
+var dmiPlaceholders = []string{
+	"none", "n/a", "na", "not specified", "not applicable", "default string",
+	"to be filled by o.e.m.", "system serial number", "0",
+	"00000000-0000-0000-0000-000000000000", "ffffffff-ffff-ffff-ffff-ffffffffffff",
+	"03000200-0400-0500-0006-000700080009",
+}
+
+// virtualInterfacePrefixes 虚拟网卡名称前缀（容器、网桥、隧道，MAC 地址不稳定）
+var virtualInterfacePrefixes = []string{
+	"veth", "docker", "br-", "virbr", "vmnet", "vboxnet", "tun", "tap", "wg", "zt", "cni", "flannel", "cali", "lxc", "lxd",
+}
+
+// systemDetails CPU 型号、操作系统和内核信息
+type systemDetails struct {
+	CPUModel string
+	OS       string
+	Kernel   string
+}
+
+// normalizeDMI 去掉首尾空白，占位值返回空字符串
+func normalizeDMI(value string) string {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	for _, placeholder := range dmiPlaceholders {
+		if lower == placeholder {
+			return ""
+		}
+	}
+	return value
+}
+
+// collectFingerprint 收集硬件指纹（尽力而为，读取失败的组件不加入指纹）
+func collectFingerprint(ramBytes uint64, dmi dmiInfo, macs []string, env Environment) (fingerprint.Fingerprint, systemDetails) {
+	fp := fingerprint.Fingerprint{}
+	var details systemDetails
+
+	fp.Add(fingerprint.ProductUUID, dmi.ProductUUID)
+	fp.Add(fingerprint.Board, dmi.BoardSerial)
+	fp.Add(fingerprint.BIOS, dmi.BIOS)
+
+	if infos, err := cpu.Info(); err == nil && len(infos) > 0 {
+		details.CPUModel = strings.TrimSpace(infos[0].ModelName)
+		fp.Add(fingerprint.CPU, details.CPUModel)
+	}
+
+	fp.Add(fingerprint.Disks, diskSerials()...)
+	fp.Add(fingerprint.MACs, macs...)
+
+	// 按最接近的 GB 计算，避免内核保留内存不同导致变化
+	fp.Add(fingerprint.Memory, fmt.Sprintf("%d", (ramBytes+(1<<29))>>30))
+
+	if info, err := host.Info(); err == nil {
+		details.OS = strings.TrimSpace(info.Platform + " " + info.PlatformVersion)
+		if details.OS == "" {
+			details.OS = info.OS
+		}
+		details.Kernel = info.KernelVersion
+		fp.Add(fingerprint.OS, details.OS)
+		fp.Add(fingerprint.Kernel, details.Kernel)
+	}
+
+	fp.Add(fingerprint.Virtualization, env.String())
+
+	return fp, details
+}
+
+// diskSerials 返回所有磁盘的序列号
+func diskSerials() []string {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil
+	}
+
+	var serials []string
+	for _, counter := range counters {
+		if serial := normalizeDMI(counter.SerialNumber); serial != "" {
+			serials = append(serials, serial)
+		}
+	}
+	return serials
+}
+
+// macAddresses 返回物理网卡的 MAC 地址（忽略回环、虚拟网卡和容器网卡）
+func macAddresses() []string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var macs []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 || isVirtualInterface(iface.Name) {
+			continue
+		}
+		if mac := iface.HardwareAddr.String(); mac != "00:00:00:00:00:00" {
+			macs = append(macs, mac)
+		}
+	}
+	return macs
+}
+
+// isVirtualInterface 是否是虚拟网卡
+func isVirtualInterface(name string) bool {
+	for _, prefix := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedCopy 返回排序后的副本
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -7,14 +7,35 @@ import (
 	"github.com/denisbrodbeck/machineid"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
+
+	"sqlbots-client/fingerprint"
+	"sqlbots-client/protocol"
 )
 
 // MachineInfo 机器信息结构体
 type MachineInfo struct {
-	MachineID   string
+	MachineID   string // 原始机器 ID，或 Protect 之后的哈希 ID
 	MachineName string
 	RAM         int // GB
 	Cores       int
+
+	// 扩展信息（读取失败时为空）
+	CPUModel string
+	OS       string
+	Kernel   string
+
+	// Environment 运行环境（物理机、虚拟机或容器）
+	Environment Environment
+	// InstanceID 实例 ID：克隆的虚拟机和共享机器 ID 的容器各不相同
+	InstanceID string
+	// InstanceSource 实例 ID 的来源（machine、container、hostname、dmi、mac、config）
+	InstanceSource string
+
+	// Protected 机器 ID、实例 ID 已经按租户哈希（见 Protect）
+	Protected bool
+
+	// Fingerprint 硬件指纹（各组件哈希后的值），服务器据此判断是否是同一台机器
+	Fingerprint fingerprint.Fingerprint
 }
 
 // GetMachineInfo 获取机器信息
@@ -48,11 +69,50 @@ func GetMachineInfo() (*MachineInfo, error) {
 		}
 	}
 
+	// 检测运行环境，收集硬件指纹，计算实例 ID
+	env := detectEnvironment()
+	dmi := readDMI()
+	macs := macAddresses()
+	fp, details := collectFingerprint(memInfo.Total, dmi, macs, env)
+	instanceID, instanceSource := deriveInstanceID(machineID, env, dmi, macs)
+
 	return &MachineInfo{
-		MachineID:   machineID,
-		MachineName: hostname,
-		RAM:         ramGB,
-		Cores:       cpuCount,
+		MachineID:      machineID,
+		MachineName:    hostname,
+		RAM:            ramGB,
+		Cores:          cpuCount,
+		CPUModel:       details.CPUModel,
+		OS:             details.OS,
+		Kernel:         details.Kernel,
+		Environment:    env,
+		InstanceID:     instanceID,
+		InstanceSource: instanceSource,
+		Fingerprint:    fp,
 	}, nil
 }
 
+// ProtectedID 返回与本机绑定的应用专用 ID（机器 ID 经过 HMAC，不泄露原始机器 ID）
+func ProtectedID(appID string) (string, error) {
+	id, err := machineid.ProtectedID(appID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get protected machine ID: %w", err)
+	}
+	return id, nil
+}
+
+// RedactHostname 用脱敏的主机名代替真实主机名（需要在 Protect 之前调用，以原始机器 ID 为密钥）
+func (m *MachineInfo) RedactHostname(apiKey string) {
+	m.MachineName = protocol.RedactHostname(m.MachineName, m.MachineID, apiKey)
+}
+
+// Protect 按租户（API Key）哈希机器 ID 和实例 ID，原始值不再发送给服务器
+func (m *MachineInfo) Protect(apiKey string) {
+	if m.Protected {
+		return
+	}
+	m.MachineID = protocol.HashMachineID(m.MachineID, apiKey)
+	if m.InstanceID != "" {
+		m.InstanceID = protocol.HashInstanceID(m.InstanceID, apiKey)
+	}
+	m.Protected = true
+}
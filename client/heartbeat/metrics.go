@@ -0,0 +1,59 @@
+package heartbeat
+
+import "time"
+
+// Metrics 会话密钥失效后自动重新交换密钥的统计
+type Metrics struct {
+	Reauthentications uint64    // 服务器拒绝会话密钥（DECRYPTION_FAILED 等）的次数
+	ReauthFailures    uint64    // 重新交换密钥失败的次数
+	RetrySuccesses    uint64    // 重新交换密钥后心跳重发成功的次数
+	LastReauthAt      time.Time // 最近一次重新交换密钥的时间
+	LastReauthReason  string    // 最近一次触发重新交换密钥的状态码
+}
+
+// LogArgs 以 slog 键值对的形式返回统计（用于心跳日志）
+func (m Metrics) LogArgs() []any {
+	args := []any{
+		"reauthentications", m.Reauthentications,
+		"reauth_failures", m.ReauthFailures,
+		"retry_successes", m.RetrySuccesses,
+	}
+	if !m.LastReauthAt.IsZero() {
+		args = append(args, "last_reauth_at", m.LastReauthAt, "last_reauth_reason", m.LastReauthReason)
+	}
+	return args
+}
+
+// Stats 返回统计快照
+func (s *Sender) Stats() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.metrics
+}
+
+// recordReauth 记录一次重新交换密钥
+func (s *Sender) recordReauth(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics.Reauthentications++
+	s.metrics.LastReauthAt = time.Now()
+	s.metrics.LastReauthReason = reason
+}
+
+// recordReauthFailure 记录一次重新交换密钥失败
+func (s *Sender) recordReauthFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics.ReauthFailures++
+}
+
+// recordRetrySuccess 记录一次重发成功
+func (s *Sender) recordRetrySuccess() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics.RetrySuccesses++
+}
@@ -1,16 +1,15 @@
 package heartbeat
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"sync"
 	"time"
 
 	"sqlbots-client/config"
-	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
 	"sqlbots-client/hardware"
+	"sqlbots-client/protocol"
 	"sqlbots-client/session"
 )
 
@@ -19,134 +18,121 @@ const (
 )
 
 // HeartbeatResponse 心跳响应结构体
-type HeartbeatResponse struct {
-	StatusCode  string `json:"status_code"`
-	LicenseInfo struct {
-		ExpiresAt string `json:"expires_at"`
-		PlanType  string `json:"plan_type"`
-	} `json:"license_info"`
-	MachineInfo struct {
-		ID           string `json:"id"`
-		Name         string `json:"name"`
-		RegisteredAt string `json:"registered_at"`
-	} `json:"machine_info"`
-	Message string `json:"message,omitempty"`
-}
+type HeartbeatResponse = protocol.HeartbeatResponse
 
-// SendHeartbeat 发送心跳
-func SendHeartbeat(cfg *config.Config, machineInfo *hardware.MachineInfo, sessionManager *session.Manager) (*HeartbeatResponse, error) {
-	// 构建请求数据
-	requestData := map[string]interface{}{
-		"machine_id":   machineInfo.MachineID,
-		"machine_name": machineInfo.MachineName,
-		"ram":          machineInfo.RAM,
-		"cores":        machineInfo.Cores,
-	}
+// SendOption 补充心跳数据的选项
+type SendOption func(payload *protocol.HeartbeatPayload)
 
-	// 序列化为 JSON
-	jsonData, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request data: %w", err)
+// WithTelemetry 在心跳中附带遥测数据（为 nil 时不附带）
+func WithTelemetry(telemetry *protocol.Telemetry) SendOption {
+	return func(payload *protocol.HeartbeatPayload) {
+		payload.Telemetry = telemetry
 	}
+}
 
-	// 确定使用哪个加密密钥：优先使用会话密钥
-	encryptionKey := cfg.EncryptionKey
-	useSessionKey := false
-
-	if sessionManager != nil {
-		if sessionKey, valid := sessionManager.GetSessionKey(); valid {
-			encryptionKey = sessionKey
-			useSessionKey = true
-		}
+// WithMetrics 在心跳中附带采集器的结果（为空时不附带）
+func WithMetrics(results []protocol.CollectorResult) SendOption {
+	return func(payload *protocol.HeartbeatPayload) {
+		payload.Metrics = results
 	}
+}
 
-	// 加密数据
-	encryptedData, err := encryption.Encrypt(string(jsonData), encryptionKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+// WithWorkloads 在心跳中附带托管进程的状态（为空时不附带）
+func WithWorkloads(workloads []protocol.WorkloadStatus) SendOption {
+	return func(payload *protocol.HeartbeatPayload) {
+		payload.Workloads = workloads
 	}
+}
 
-	// 构建请求体
-	requestBody := map[string]interface{}{
-		"API_KEY":         cfg.APIKey,
-		"encrypted_data":  encryptedData,
-		"use_session_key": useSessionKey,
+// WithCommandResults 在心跳中附带指令执行结果（为空时不附带）
+func WithCommandResults(results []protocol.CommandResult) SendOption {
+	return func(payload *protocol.HeartbeatPayload) {
+		payload.CommandResults = results
 	}
+}
 
-	requestBodyJSON, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
+// NewPayload 根据机器信息构建心跳数据
+func NewPayload(machineInfo *hardware.MachineInfo, opts ...SendOption) *protocol.HeartbeatPayload {
+	payload := &protocol.HeartbeatPayload{
+		MachineID:   machineInfo.MachineID,
+		MachineName: machineInfo.MachineName,
+		RAM:         machineInfo.RAM,
+		Cores:       machineInfo.Cores,
+		Fingerprint: machineInfo.Fingerprint,
+		InstanceID:  machineInfo.InstanceID,
 
-	// 发送 HTTP POST 请求
-	url := fmt.Sprintf("%s/heartbeat", cfg.ServerURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBodyJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		MachineIDHashed: machineInfo.Protected,
+		Environment:     machineInfo.Environment.Type,
+		Platform:        machineInfo.Environment.Platform,
+	}
+	for _, opt := range opts {
+		opt(payload)
 	}
+	return payload
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// Sender 通过协议客户端发送心跳，并统计自动重新交换密钥的次数
+type Sender struct {
+	client *protocol.Client
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	mu      sync.Mutex
+	metrics Metrics
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+// NewSender 创建心跳发送器
+func NewSender(client *protocol.Client) *Sender {
+	return &Sender{client: client}
+}
 
-	// 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+// Send 使用协议客户端发送一次心跳（不保留重新交换密钥的统计，长期运行时使用 Sender）
+func Send(ctx context.Context, client *protocol.Client, machineInfo *hardware.MachineInfo, opts ...SendOption) (*HeartbeatResponse, error) {
+	return NewSender(client).Send(ctx, machineInfo, opts...)
+}
 
-	// 解析响应
-	var response struct {
-		EncryptedData string `json:"encrypted_data"`
-	}
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// Send 发送心跳
+//
+// 服务器不再认可缓存的会话密钥时（服务器重启、会话被替换等，返回 DECRYPTION_FAILED 或 INVALID_SIGNATURE），
+// 作废该密钥、重新交换密钥后重发一次心跳
+func (s *Sender) Send(ctx context.Context, machineInfo *hardware.MachineInfo, opts ...SendOption) (*HeartbeatResponse, error) {
+	client := s.client
+	sessions := client.Sessions()
+	var generation uint64
+	if sessions != nil {
+		generation = sessions.Generation()
 	}
 
-	// 解密响应数据（使用相同的密钥）
-	decryptedText, err := encryption.Decrypt(response.EncryptedData, encryptionKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt response: %w", err)
+	resp, err := client.SendHeartbeat(ctx, NewPayload(machineInfo, opts...))
+	if err == nil || sessions == nil || !apperrors.NeedsReauth(err) {
+		return resp, err
 	}
 
-	// 解析解密后的响应
-	var heartbeatResp HeartbeatResponse
-	if err := json.Unmarshal([]byte(decryptedText), &heartbeatResp); err != nil {
-		return nil, fmt.Errorf("failed to parse decrypted response: %w", err)
+	s.recordReauth(apperrors.CodeOf(err))
+
+	// 只有密钥没有被其他地方（例如后台刷新）换掉时才需要重新交换
+	if sessions.Invalidate(generation) {
+		if _, exchangeErr := client.ExchangeKey(ctx); exchangeErr != nil {
+			s.recordReauthFailure()
+			return resp, fmt.Errorf("failed to re-exchange session key after %v: %w", err, exchangeErr)
+		}
 	}
 
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		return &heartbeatResp, fmt.Errorf("server returned status %d: %s", resp.StatusCode, heartbeatResp.StatusCode)
+	resp, err = client.SendHeartbeat(ctx, NewPayload(machineInfo, opts...))
+	if err == nil {
+		s.recordRetrySuccess()
 	}
+	return resp, err
+}
 
-	return &heartbeatResp, nil
+// SendHeartbeat 发送心跳
+func SendHeartbeat(cfg *config.Config, machineInfo *hardware.MachineInfo, sessionManager *session.Manager) (*HeartbeatResponse, error) {
+	return Send(context.Background(), protocol.NewClient(cfg, sessionManager), machineInfo)
 }
 
 // HandleHeartbeatResponse 处理心跳响应，根据状态码决定是否终止程序
+// 非 SUCCESS 状态返回 *errors.ProtocolError，调用方通过其分类决定如何处理
 func HandleHeartbeatResponse(resp *HeartbeatResponse) error {
-	switch resp.StatusCode {
-	case "SUCCESS":
+	if resp.StatusCode == apperrors.CodeSuccess {
 		return nil
-	case "INVALID_API_KEY":
-		return fmt.Errorf("INVALID_API_KEY: API Key is invalid")
-	case "LICENSE_EXPIRED":
-		return fmt.Errorf("LICENSE_EXPIRED: License has expired")
-	case "MACHINE_LIMIT_EXCEEDED":
-		return fmt.Errorf("MACHINE_LIMIT_EXCEEDED: Maximum machines limit exceeded")
-	case "DECRYPTION_FAILED":
-		return fmt.Errorf("DECRYPTION_FAILED: Failed to decrypt data")
-	case "SERVER_ERROR":
-		return fmt.Errorf("SERVER_ERROR: Server error occurred")
-	default:
-		return fmt.Errorf("unknown status code: %s", resp.StatusCode)
 	}
+	return apperrors.New(0, resp.StatusCode, resp.Message)
 }
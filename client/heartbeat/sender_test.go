@@ -0,0 +1,127 @@
+package heartbeat_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/hardware"
+	"sqlbots-client/heartbeat"
+	"sqlbots-client/protocol"
+	"sqlbots-client/server"
+	"sqlbots-client/session"
+)
+
+const (
+	testAPIKey        = "test-api-key"
+	testEncryptionKey = "test-encryption-key"
+)
+
+// newTestClient 启动内置服务器并返回连接它的客户端
+func newTestClient(t *testing.T, license server.License) *protocol.Client {
+	return newWrappedTestClient(t, license, func(h http.Handler) http.Handler { return h })
+}
+
+// newWrappedTestClient 与 newTestClient 相同，服务器的处理函数经过 wrap 包装
+func newWrappedTestClient(t *testing.T, license server.License, wrap func(http.Handler) http.Handler) *protocol.Client {
+	t.Helper()
+
+	privateKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := server.NewMemoryStore()
+	store.AddUser(server.User{ID: "user-1", APIKey: testAPIKey, Username: "test"})
+	license.UserID = "user-1"
+	store.SetLicense(license)
+
+	httpServer := httptest.NewServer(wrap(server.New(server.Config{EncryptionKey: testEncryptionKey, PrivateKey: privateKey}, store).Handler()))
+	t.Cleanup(httpServer.Close)
+
+	cfg := &config.Config{
+		APIKey:          testAPIKey,
+		ServerURL:       httpServer.URL,
+		EncryptionKey:   testEncryptionKey,
+		ServerPublicKey: encryption.EncodeX25519PublicKey(privateKey.PublicKey()),
+	}
+	return protocol.NewClient(cfg, session.NewManager())
+}
+
+func testMachine() *hardware.MachineInfo {
+	return &hardware.MachineInfo{MachineID: "machine-1", MachineName: "test-machine", RAM: 8, Cores: 4}
+}
+
+// 服务器不认可缓存的会话密钥（例如服务器重启后）时，重新交换密钥并重发一次
+func TestSendReauthenticatesOnDecryptionFailure(t *testing.T) {
+	client := newTestClient(t, server.License{PlanType: "pro"})
+	sessions := client.Sessions()
+	sessions.SetSession("unknown-session", "stale-key", 600)
+	stale := sessions.Generation()
+	sender := heartbeat.NewSender(client)
+
+	resp, err := sender.Send(context.Background(), testMachine())
+	if err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if resp.StatusCode != apperrors.CodeSuccess {
+		t.Fatalf("status: %s", resp.StatusCode)
+	}
+
+	if stats := sender.Stats(); stats.Reauthentications != 1 || stats.RetrySuccesses != 1 || stats.ReauthFailures != 0 ||
+		stats.LastReauthReason != apperrors.CodeDecryptionFailed || stats.LastReauthAt.IsZero() {
+		t.Fatalf("stats: %+v", stats)
+	}
+	if agreed, ok := sessions.GetSession(); !ok || agreed.ID == "unknown-session" || agreed.Generation <= stale {
+		t.Fatalf("session key was not replaced: %+v", agreed)
+	}
+}
+
+// 重新交换密钥失败时返回两个错误并记录失败，不再重发
+func TestSendReportsFailedReauthentication(t *testing.T) {
+	// API Key 在两次请求之间被吊销
+	client := newWrappedTestClient(t, server.License{PlanType: "pro"}, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == protocol.PathKeyExchange {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprintf(w, `{"status_code":%q,"message":"API Key revoked"}`, apperrors.CodeInvalidAPIKey)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	client.Sessions().SetSession("unknown-session", "stale-key", 600)
+	sender := heartbeat.NewSender(client)
+
+	_, err := sender.Send(context.Background(), testMachine())
+	if err == nil || !strings.Contains(err.Error(), "re-exchange") {
+		t.Fatalf("got %v, want a re-exchange failure", err)
+	}
+	if !apperrors.IsFatal(err) || apperrors.CodeOf(err) != apperrors.CodeInvalidAPIKey {
+		t.Fatalf("exchange error not preserved: %v (code %q)", err, apperrors.CodeOf(err))
+	}
+
+	if stats := sender.Stats(); stats.Reauthentications != 1 || stats.ReauthFailures != 1 || stats.RetrySuccesses != 0 {
+		t.Fatalf("stats: %+v", stats)
+	}
+}
+
+// 其他错误（例如许可证过期）不会触发重新交换密钥
+func TestSendDoesNotReauthenticateOtherErrors(t *testing.T) {
+	client := newTestClient(t, server.License{PlanType: "pro", ExpiresAt: "2000-01-01T00:00:00Z"})
+	sender := heartbeat.NewSender(client)
+
+	_, err := sender.Send(context.Background(), testMachine())
+	if apperrors.CodeOf(err) != apperrors.CodeLicenseExpired {
+		t.Fatalf("got %v, want %s", err, apperrors.CodeLicenseExpired)
+	}
+	if stats := sender.Stats(); stats.Reauthentications != 0 {
+		t.Fatalf("reauthenticated on %v", err)
+	}
+}
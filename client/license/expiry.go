@@ -0,0 +1,193 @@
+package license
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// DefaultWarningThresholds 默认的过期提醒时间点（过期前 30 天、7 天、1 天）
+var DefaultWarningThresholds = []time.Duration{
+	30 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+}
+
+// defaultMonitorInterval 默认的过期检查间隔
+const defaultMonitorInterval = time.Minute
+
+// Status 当前许可证状态（供界面和 status 命令显示）
+type Status struct {
+	Known           bool          // 是否有服务器确认过的许可证信息
+	Username        string        // 用户名
+	PlanType        string        // 套餐类型
+	ExpiresAt       time.Time     // 过期时间（为零表示不过期）
+	Remaining       time.Duration // 剩余时间（已过期时为 0）
+	Expired         bool          // 是否已过期
+	VerifiedAt      time.Time     // 最近一次服务器确认的时间
+	OfflineDeadline time.Time     // 服务器不可达时允许运行到的时间
+
+	Machine protocol.MachineInfo // 最近一次心跳时服务器登记的本机信息
+}
+
+// Warning 过期提醒
+type Warning struct {
+	Threshold time.Duration // 触发的提醒时间点
+	ExpiresAt time.Time     // 过期时间
+	Remaining time.Duration // 剩余时间
+	PlanType  string        // 套餐类型
+}
+
+// Status 返回当前许可证状态
+func (g *Guard) Status(now time.Time) Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		return Status{}
+	}
+
+	status := Status{
+		Known:           true,
+		Username:        g.state.Username,
+		PlanType:        g.state.PlanType,
+		ExpiresAt:       g.state.ExpiresAt,
+		VerifiedAt:      g.state.VerifiedAt,
+		OfflineDeadline: g.deadline(),
+		Machine:         g.state.Machine,
+	}
+	if !status.ExpiresAt.IsZero() {
+		status.Remaining = status.ExpiresAt.Sub(now)
+		if status.Remaining <= 0 {
+			status.Remaining = 0
+			status.Expired = true
+		}
+	}
+	return status
+}
+
+// Warner 过期提醒：每个时间点对同一个过期时间只提醒一次，续费后重新计算
+type Warner struct {
+	thresholds []time.Duration
+	expiresAt  time.Time
+	warned     map[time.Duration]bool
+}
+
+// NewWarner 创建过期提醒（thresholds 为空时使用默认的 30 天、7 天、1 天）
+func NewWarner(thresholds []time.Duration) *Warner {
+	if len(thresholds) == 0 {
+		thresholds = DefaultWarningThresholds
+	}
+
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	return &Warner{
+		thresholds: sorted,
+		warned:     make(map[time.Duration]bool),
+	}
+}
+
+// Check 检查是否需要提醒，返回剩余时间已进入的最近一个时间点
+// 同时跨过多个时间点时（例如启动时只剩 3 天）只提醒一次
+func (w *Warner) Check(status Status) (Warning, bool) {
+	if !status.Known || status.ExpiresAt.IsZero() || status.Expired {
+		return Warning{}, false
+	}
+
+	// 过期时间变化（续费或更换套餐）后重新提醒
+	if !status.ExpiresAt.Equal(w.expiresAt) {
+		w.expiresAt = status.ExpiresAt
+		w.warned = make(map[time.Duration]bool)
+	}
+
+	var warning Warning
+	found := false
+	for _, threshold := range w.thresholds {
+		if status.Remaining > threshold || w.warned[threshold] {
+			continue
+		}
+		w.warned[threshold] = true
+		warning = Warning{
+			Threshold: threshold,
+			ExpiresAt: status.ExpiresAt,
+			Remaining: status.Remaining,
+			PlanType:  status.PlanType,
+		}
+		found = true
+	}
+	return warning, found
+}
+
+// MonitorOptions 过期监控选项
+type MonitorOptions struct {
+	Thresholds []time.Duration     // 提醒时间点（默认 30 天、7 天、1 天）
+	Interval   time.Duration       // 检查间隔（默认 1 分钟）
+	OnWarning  func(w Warning)     // 进入提醒时间点时回调
+	OnExpired  func(status Status) // 许可证到期时回调（即使服务器不可达也会触发）
+	Now        func() time.Time    // 当前时间（默认 time.Now，测试时注入）
+}
+
+// StartMonitor 启动后台过期监控，直到 ctx 被取消或许可证到期
+func (g *Guard) StartMonitor(ctx context.Context, opts MonitorOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultMonitorInterval
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	go g.monitorLoop(ctx, NewWarner(opts.Thresholds), opts)
+}
+
+// monitorLoop 后台过期监控循环
+func (g *Guard) monitorLoop(ctx context.Context, warner *Warner, opts MonitorOptions) {
+	for {
+		status := g.Status(opts.Now())
+		if status.Expired {
+			if opts.OnExpired != nil {
+				opts.OnExpired(status)
+			}
+			return
+		}
+		if warning, ok := warner.Check(status); ok && opts.OnWarning != nil {
+			opts.OnWarning(warning)
+		}
+
+		// 到期时间早于下次检查时，在到期时刻立即检查
+		wait := opts.Interval
+		if !status.ExpiresAt.IsZero() && status.Remaining < wait {
+			wait = status.Remaining
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// FormatRemaining 格式化剩余时间（例如 12d 3h、5h 20m、45m）
+func FormatRemaining(d time.Duration) string {
+	if d <= 0 {
+		return "expired"
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,192 @@
+package license
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// statusAt 返回许可证在 now 时的状态
+func statusAt(expiresAt, now time.Time) Status {
+	status := Status{Known: true, PlanType: "pro", ExpiresAt: expiresAt}
+	if !expiresAt.IsZero() {
+		status.Remaining = expiresAt.Sub(now)
+		if status.Remaining <= 0 {
+			status.Remaining = 0
+			status.Expired = true
+		}
+	}
+	return status
+}
+
+func TestWarnerThresholds(t *testing.T) {
+	expires := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		remaining []time.Duration // 依次检查时的剩余时间
+		want      []time.Duration // 每次检查触发的时间点（0 表示不提醒）
+	}{
+		{"far from expiry", []time.Duration{60 * day}, []time.Duration{0}},
+		{"each threshold once", []time.Duration{29 * day, 20 * day, 6 * day, 5 * day, 12 * time.Hour, time.Hour},
+			[]time.Duration{30 * day, 0, 7 * day, 0, day, 0}},
+		{"several thresholds at start", []time.Duration{3 * day, 2 * day, 20 * time.Hour}, []time.Duration{7 * day, 0, day}},
+		{"exactly at threshold", []time.Duration{7 * day}, []time.Duration{7 * day}},
+		{"expired", []time.Duration{0}, []time.Duration{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWarner(nil)
+			for i, remaining := range tt.remaining {
+				warning, ok := w.Check(statusAt(expires, expires.Add(-remaining)))
+				if tt.want[i] == 0 {
+					if ok {
+						t.Fatalf("check %d (%s left): unexpected warning %+v", i, remaining, warning)
+					}
+					continue
+				}
+				if !ok || warning.Threshold != tt.want[i] || warning.Remaining != remaining || !warning.ExpiresAt.Equal(expires) {
+					t.Fatalf("check %d (%s left): got %+v (%v), want threshold %s", i, remaining, warning, ok, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// 续费后过期时间变化，重新按时间点提醒
+func TestWarnerResetsAfterRenewal(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewWarner([]time.Duration{day, 7 * day}) // 顺序无关
+
+	if warning, ok := w.Check(statusAt(now.Add(5*day), now)); !ok || warning.Threshold != 7*day {
+		t.Fatalf("first warning: got %+v (%v)", warning, ok)
+	}
+	if _, ok := w.Check(statusAt(now.Add(5*day), now)); ok {
+		t.Fatal("warned twice for the same threshold")
+	}
+	if warning, ok := w.Check(statusAt(now.Add(6*day), now)); !ok || warning.Threshold != 7*day {
+		t.Fatalf("after renewal: got %+v (%v)", warning, ok)
+	}
+	if _, ok := w.Check(Status{Known: true}); ok {
+		t.Fatal("warned for a license without expiry")
+	}
+	if _, ok := w.Check(Status{}); ok {
+		t.Fatal("warned without license state")
+	}
+}
+
+// fakeClock 可以手动调整的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// 服务器不可达时，监控也会在许可证到期时通知并停止
+func TestMonitorStopsAtExpiry(t *testing.T) {
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := newTestGuard(t, &State{PlanType: "pro", ExpiresAt: expires, VerifiedAt: expires.Add(-10 * day)}, 0)
+	clock := &fakeClock{now: expires.Add(-3 * day)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	warnings := make(chan Warning, 4)
+	expired := make(chan Status, 4)
+	g.StartMonitor(ctx, MonitorOptions{
+		Interval:  5 * time.Millisecond,
+		Now:       clock.Now,
+		OnWarning: func(w Warning) { warnings <- w },
+		OnExpired: func(s Status) { expired <- s },
+	})
+
+	select {
+	case w := <-warnings:
+		if w.Threshold != 7*day || w.Remaining != 3*day {
+			t.Fatalf("unexpected warning %+v", w)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no warning 3 days before expiry")
+	}
+
+	clock.Set(expires.Add(-12 * time.Hour))
+	select {
+	case w := <-warnings:
+		if w.Threshold != day {
+			t.Fatalf("unexpected warning %+v", w)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no warning 12 hours before expiry")
+	}
+
+	clock.Set(expires)
+	select {
+	case s := <-expired:
+		if !s.Expired || !s.ExpiresAt.Equal(expires) {
+			t.Fatalf("unexpected status %+v", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("monitor did not report expiry")
+	}
+
+	// 到期后监控停止，不再回调
+	time.Sleep(50 * time.Millisecond)
+	if len(expired) != 0 || len(warnings) != 0 {
+		t.Fatal("monitor kept running after expiry")
+	}
+}
+
+func TestMonitorStopsWithContext(t *testing.T) {
+	g := newTestGuard(t, &State{PlanType: "pro", VerifiedAt: time.Now()}, 0)
+	clock := &fakeClock{now: time.Now()}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := make(chan struct{}, 16)
+	g.StartMonitor(ctx, MonitorOptions{
+		Interval: 5 * time.Millisecond,
+		Now: func() time.Time {
+			calls <- struct{}{}
+			return clock.Now()
+		},
+	})
+	<-calls
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	for len(calls) > 0 {
+		<-calls
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(calls) != 0 {
+		t.Fatal("monitor kept running after the context was cancelled")
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "expired"},
+		{-time.Hour, "expired"},
+		{45 * time.Minute, "45m"},
+		{5*time.Hour + 20*time.Minute, "5h 20m"},
+		{12*day + 3*time.Hour + 59*time.Minute, "12d 3h"},
+	}
+	for _, tt := range tests {
+		if got := FormatRemaining(tt.d); got != tt.want {
+			t.Errorf("FormatRemaining(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package license
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// DefaultGracePeriod 默认的离线宽限期
+const DefaultGracePeriod = 24 * time.Hour
+
+// clockRollbackTolerance 允许本地时间比上次确认时间早多少（超过视为时钟被回拨）
+const clockRollbackTolerance = 5 * time.Minute
+
+var (
+	// ErrGracePeriodExpired 离线宽限期已过
+	ErrGracePeriodExpired = errors.New("offline grace period has expired")
+	// ErrLicenseExpired 许可证已过期
+	ErrLicenseExpired = errors.New("license has expired")
+	// ErrClockRollback 本地时间早于上次确认时间（时钟被回拨）
+	ErrClockRollback = errors.New("system clock is earlier than the last license verification")
+)
+
+// Guard 离线宽限期检查：心跳成功时保存许可证状态，服务器不可达时据此决定是否继续运行
+type Guard struct {
+	mu          sync.Mutex
+	store       *Store
+	gracePeriod time.Duration
+	state       *State
+	loadErr     error
+}
+
+// NewGuard 创建离线宽限期检查（gracePeriod 为 0 时使用默认值 24 小时），并读取已保存的状态
+func NewGuard(store *Store, gracePeriod time.Duration) *Guard {
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	g := &Guard{
+		store:       store,
+		gracePeriod: gracePeriod,
+	}
+	g.state, g.loadErr = store.Load()
+	return g
+}
+
+// Record 保存心跳成功时服务器返回的许可证信息和本机登记信息
+func (g *Guard) Record(resp *protocol.HeartbeatResponse, username string) error {
+	info := resp.LicenseInfo
+	// expires_at 为空表示永久有效
+	var expiresAt time.Time
+	if info.ExpiresAt != "" {
+		var err error
+		expiresAt, err = protocol.ParseTime(info.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to parse license expiry %q: %w", info.ExpiresAt, err)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if username == "" && g.state != nil {
+		username = g.state.Username
+	}
+	state := &State{
+		Username:   username,
+		PlanType:   info.PlanType,
+		ExpiresAt:  expiresAt,
+		VerifiedAt: time.Now(),
+		Machine:    resp.MachineInfo,
+	}
+	// 保存失败时仍然更新内存中的状态，过期提醒和本地过期检查使用最新的许可证信息
+	g.state = state
+	g.loadErr = nil
+	return g.store.Save(state)
+}
+
+// Check 检查服务器不可达时是否还能继续运行（返回 nil 表示仍在宽限期内）
+func (g *Guard) Check(now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		if g.loadErr != nil {
+			return g.loadErr
+		}
+		return ErrNoState
+	}
+
+	if now.Before(g.state.VerifiedAt.Add(-clockRollbackTolerance)) {
+		return ErrClockRollback
+	}
+	if !g.state.ExpiresAt.IsZero() && !now.Before(g.state.ExpiresAt) {
+		return ErrLicenseExpired
+	}
+	if !now.Before(g.deadline()) {
+		return fmt.Errorf("%w (last verified %s)", ErrGracePeriodExpired, g.state.VerifiedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Deadline 离线运行的截止时间（宽限期结束和许可证过期中较早的一个）
+func (g *Guard) Deadline() (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		return time.Time{}, false
+	}
+	return g.deadline(), true
+}
+
+// deadline 计算离线运行的截止时间（调用方必须持有锁）
+func (g *Guard) deadline() time.Time {
+	deadline := g.state.VerifiedAt.Add(g.gracePeriod)
+	if !g.state.ExpiresAt.IsZero() && g.state.ExpiresAt.Before(deadline) {
+		deadline = g.state.ExpiresAt
+	}
+	return deadline
+}
+
+// Username 返回保存的用户名
+func (g *Guard) Username() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		return ""
+	}
+	return g.state.Username
+}
+
+// Clear 删除保存的状态（许可证被服务器明确拒绝时调用）
+// 只删除属于当前 API Key 的状态，输错 API Key 不会删除其他用户保存的状态
+func (g *Guard) Clear() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state == nil {
+		return nil
+	}
+	g.state = nil
+	g.loadErr = nil
+	return g.store.Clear()
+}
@@ -0,0 +1,136 @@
+package license
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// newTestGuard 保存状态后创建离线宽限期检查（state 为 nil 时不保存）
+func newTestGuard(t *testing.T, state *State, gracePeriod time.Duration) *Guard {
+	t.Helper()
+
+	store := newTestStore(t)
+	if state != nil {
+		if err := store.Save(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewGuard(store, gracePeriod)
+}
+
+// 离线截止时间是宽限期结束和许可证过期中较早的一个
+func TestGuardDeadline(t *testing.T) {
+	verified := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		grace     time.Duration
+		want      time.Time
+	}{
+		{"grace period first", verified.Add(30 * 24 * time.Hour), 24 * time.Hour, verified.Add(24 * time.Hour)},
+		{"license expires first", verified.Add(6 * time.Hour), 24 * time.Hour, verified.Add(6 * time.Hour)},
+		{"no expiry", time.Time{}, 48 * time.Hour, verified.Add(48 * time.Hour)},
+		{"default grace period", time.Time{}, 0, verified.Add(DefaultGracePeriod)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGuard(t, &State{PlanType: "pro", ExpiresAt: tt.expiresAt, VerifiedAt: verified}, tt.grace)
+			got, ok := g.Deadline()
+			if !ok || !got.Equal(tt.want) {
+				t.Fatalf("got %s (%v), want %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardCheck(t *testing.T) {
+	verified := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := verified.Add(12 * time.Hour)
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{"just verified", verified, nil},
+		{"within grace period", verified.Add(6 * time.Hour), nil},
+		{"small clock drift", verified.Add(-time.Minute), nil},
+		{"clock rolled back", verified.Add(-time.Hour), ErrClockRollback},
+		{"license expired", expires, ErrLicenseExpired},
+		{"license expired long ago", expires.Add(time.Hour), ErrLicenseExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGuard(t, &State{PlanType: "pro", ExpiresAt: expires, VerifiedAt: verified}, 24*time.Hour)
+			if err := g.Check(tt.now); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 没有过期时间时由宽限期决定
+	g := newTestGuard(t, &State{PlanType: "pro", VerifiedAt: verified}, time.Hour)
+	if err := g.Check(verified.Add(59 * time.Minute)); err != nil {
+		t.Fatalf("within grace period: %v", err)
+	}
+	if err := g.Check(verified.Add(time.Hour)); !errors.Is(err, ErrGracePeriodExpired) {
+		t.Fatalf("after grace period: got %v, want ErrGracePeriodExpired", err)
+	}
+}
+
+// 没有保存的状态或状态文件无效时不允许离线运行
+func TestGuardWithoutState(t *testing.T) {
+	g := newTestGuard(t, nil, 0)
+	if err := g.Check(time.Now()); !errors.Is(err, ErrNoState) {
+		t.Fatalf("got %v, want ErrNoState", err)
+	}
+	if _, ok := g.Deadline(); ok {
+		t.Fatal("deadline without state")
+	}
+
+	// 其他机器的状态文件
+	store := newTestStore(t)
+	if err := store.Save(&State{PlanType: "pro", VerifiedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	copied := NewGuard(NewStore(store.Path(), "other-machine-key", testAPIKey), 0)
+	if err := copied.Check(time.Now()); err == nil || errors.Is(err, ErrNoState) {
+		t.Fatalf("copied state: got %v, want a decryption error", err)
+	}
+}
+
+func TestGuardRecordAndClear(t *testing.T) {
+	g := newTestGuard(t, nil, time.Hour)
+	resp := &protocol.HeartbeatResponse{
+		LicenseInfo: protocol.LicenseInfo{PlanType: "pro", ExpiresAt: "2099-01-01T00:00:00Z"},
+		MachineInfo: protocol.MachineInfo{ID: "machine-1"},
+	}
+	if err := g.Record(resp, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(time.Now()); err != nil {
+		t.Fatalf("after Record: %v", err)
+	}
+
+	// 重新读取保存的状态；没有用户名的心跳保留已保存的用户名
+	reloaded := NewGuard(g.store, time.Hour)
+	if err := reloaded.Record(resp, ""); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Username() != "alice" {
+		t.Fatalf("username: got %q, want alice", reloaded.Username())
+	}
+
+	if err := reloaded.Record(&protocol.HeartbeatResponse{LicenseInfo: protocol.LicenseInfo{ExpiresAt: "not a time"}}, ""); err == nil {
+		t.Fatal("invalid expiry accepted")
+	}
+
+	if err := reloaded.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewGuard(g.store, time.Hour).Check(time.Now()); !errors.Is(err, ErrNoState) {
+		t.Fatalf("after Clear: got %v, want ErrNoState", err)
+	}
+}
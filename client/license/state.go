@@ -0,0 +1,125 @@
+// Package license 保存最近一次服务器确认的许可证状态，用于服务器不可达时的离线宽限期
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sqlbots-client/encryption"
+	"sqlbots-client/protocol"
+)
+
+// stateVersion 状态文件格式版本
+const stateVersion = 1
+
+// ErrNoState 没有保存的许可证状态（从未成功连接过服务器）
+var ErrNoState = errors.New("no saved license state")
+
+// State 最近一次服务器确认的许可证状态
+type State struct {
+	Version    int       `json:"version"`
+	Username   string    `json:"username,omitempty"`
+	PlanType   string    `json:"plan_type"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	VerifiedAt time.Time `json:"verified_at"` // 最近一次心跳成功的时间
+
+	// Machine 服务器登记的本机信息（旧版本保存的状态没有此字段）
+	Machine protocol.MachineInfo `json:"machine"`
+}
+
+// Store 许可证状态文件（用机器绑定的密钥加密，被修改或复制到其他机器时无法解密）
+type Store struct {
+	path           string
+	key            string
+	associatedData []byte
+}
+
+// NewStore 创建许可证状态文件存储
+// machineKey 是与本机绑定的密钥（例如 hardware.ProtectedID），apiKey 用于区分不同用户的状态
+func NewStore(path, machineKey, apiKey string) *Store {
+	return &Store{
+		path:           path,
+		key:            machineKey,
+		associatedData: []byte("sqlbots-license-state\x00" + apiKey),
+	}
+}
+
+// DefaultPath 默认的状态文件路径（用户配置目录下的 sqlbots/license.state）
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(dir, "sqlbots", "license.state"), nil
+}
+
+// Path 返回状态文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load 读取并解密状态文件
+func (s *Store) Load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoState
+		}
+		return nil, fmt.Errorf("failed to read license state: %w", err)
+	}
+
+	plaintext, err := encryption.Open(string(data), s.key, s.associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("license state is invalid or was modified: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(plaintext), &state); err != nil {
+		return nil, fmt.Errorf("failed to parse license state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported license state version %d", state.Version)
+	}
+
+	return &state, nil
+}
+
+// Save 加密并保存状态文件（先写临时文件再重命名，避免写入中断导致文件损坏）
+func (s *Store) Save(state *State) error {
+	state.Version = stateVersion
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal license state: %w", err)
+	}
+
+	ciphertext, err := encryption.Seal(string(data), s.key, s.associatedData)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt license state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create license state directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(ciphertext), 0600); err != nil {
+		return fmt.Errorf("failed to write license state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save license state: %w", err)
+	}
+	return nil
+}
+
+// Clear 删除状态文件
+func (s *Store) Clear() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove license state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package license
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sqlbots-client/encryption"
+	"sqlbots-client/protocol"
+)
+
+const (
+	testMachineKey = "machine-key"
+	testAPIKey     = "api-key"
+)
+
+// newTestStore 在临时目录中创建状态文件存储
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	return NewStore(filepath.Join(t.TempDir(), "sqlbots", "license.state"), testMachineKey, testAPIKey)
+}
+
+func testState() *State {
+	return &State{
+		Username:   "alice",
+		PlanType:   "pro",
+		ExpiresAt:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		VerifiedAt: time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC),
+		Machine:    protocol.MachineInfo{ID: "machine-1", Name: "test-machine"},
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.Load(); !errors.Is(err, ErrNoState) {
+		t.Fatalf("missing file: got %v, want ErrNoState", err)
+	}
+
+	want := testState()
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != want.Username || got.PlanType != want.PlanType || !got.ExpiresAt.Equal(want.ExpiresAt) ||
+		!got.VerifiedAt.Equal(want.VerifiedAt) || got.Machine.ID != want.Machine.ID || got.Version != stateVersion {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	info, err := os.Stat(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 && os.PathSeparator == '/' {
+		t.Errorf("state file permissions %o, want 600", perm)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); !errors.Is(err, ErrNoState) {
+		t.Fatalf("after Clear: got %v, want ErrNoState", err)
+	}
+}
+
+// 被修改的状态文件无法解密，不会被当作有效的许可证状态
+func TestStoreRejectsTamperedState(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(testState()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := len(data) / 2
+	if data[i] == 'A' {
+		data[i] = 'B'
+	} else {
+		data[i] = 'A'
+	}
+	if err := os.WriteFile(store.Path(), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, err := store.Load(); err == nil {
+		t.Fatalf("tampered state accepted: %+v", state)
+	}
+}
+
+// 复制到其他机器（机器密钥不同）或属于其他 API Key 的状态文件无法读取
+func TestStoreRejectsStateFromOtherMachine(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(testState()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		machineKey string
+		apiKey     string
+	}{
+		{"other machine", "other-machine-key", testAPIKey},
+		{"other api key", testMachineKey, "other-api-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := NewStore(store.Path(), tt.machineKey, tt.apiKey)
+			if state, err := other.Load(); err == nil {
+				t.Fatalf("state readable with the wrong key: %+v", state)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsUnknownVersion(t *testing.T) {
+	store := newTestStore(t)
+	state := testState()
+	state.Version = stateVersion + 1
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := encryption.Seal(string(data), store.key, store.associatedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(store.Path()), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.Path(), []byte(ciphertext), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(); err == nil {
+		t.Fatal("state with an unknown version accepted")
+	}
+}
@@ -1,70 +1,101 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"sqlbots-client/collectors"
 	"sqlbots-client/config"
+	"sqlbots-client/dispatch"
+	apperrors "sqlbots-client/errors"
 	"sqlbots-client/hardware"
 	"sqlbots-client/heartbeat"
 	"sqlbots-client/keyexchange"
+	"sqlbots-client/license"
+	"sqlbots-client/protocol"
 	"sqlbots-client/session"
+	"sqlbots-client/supervisor"
+	"sqlbots-client/telemetry"
 	"sqlbots-client/ui"
 )
 
-const version = "v1.0"
+// 版本信息（构建时通过 -ldflags "-X main.version=v1.1.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=..." 设置）
+var (
+	version   = "v1.0"
+	commit    = ""
+	buildDate = ""
+)
 
 func main() {
-	// 显示欢迎界面
-	ui.ClearScreen()
-	ui.ShowBanner(version)
+	os.Exit(runCommand(os.Args[1:]))
+}
 
-	// 提示输入 API Key
-	ui.ShowLoginPrompt()
-	apiKey, err := ui.HideInput()
-	if err != nil {
-		fmt.Printf("\n❌ Failed to read input: %v\n", err)
-		os.Exit(1)
+// runClient 加载配置、登录并定时发送心跳，直到收到退出信号（run 命令）
+func runClient(args []string) int {
+	// 加载配置（命令行参数 > 环境变量 > 配置文件 > login 保存的凭据），API Key 缺失时提示输入
+	// 标准输入不是终端时（systemd、Docker、CI）自动使用无界面模式，不提示输入
+	interactive := ui.IsTerminal()
+	loadOptions := config.LoadOptions{
+		Args:        args,
+		Credentials: loadCredentials(interactive),
 	}
-
-	if apiKey == "" {
-		ui.ShowError("API Key cannot be empty")
-		os.Exit(1)
+	if interactive {
+		loadOptions.Prompt = promptConfigValue
 	}
-
-	// 创建配置（使用输入的 API Key）
-	cfg := &config.Config{
-		APIKey:        apiKey,
-		ServerURL:     getEnvOrDefault("SERVER_URL", "https://api.sqlbots.online"),
-		EncryptionKey: getEnvOrDefault("ENCRYPTION_KEY", ""),
+	cfg, err := config.Load(loadOptions)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return apperrors.ExitOK
+		}
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return apperrors.ExitConfig
 	}
+	return runLoop(cfg, interactive, configReloader(loadOptions, cfg))
+}
 
-	// 验证 ENCRYPTION_KEY
-	if cfg.EncryptionKey == "" {
-		ui.ShowError("ENCRYPTION_KEY is required (use ENCRYPTION_KEY environment variable)")
-		os.Exit(1)
+// runLoop 登录并定时发送心跳，直到收到退出信号（reload 用于服务器下发的 refresh_config 指令）
+func runLoop(cfg *config.Config, interactive bool, reload func() (*config.Config, error)) int {
+	// 无界面模式输出结构化日志到标准错误，否则使用终端界面
+	var out ui.Output
+	if cfg.Headless || !interactive {
+		out = ui.NewLogOutput(os.Stderr, cfg.LogFormat)
+	} else {
+		out = ui.NewTerminalOutput()
 	}
+	out.Start(version)
 
 	// 获取机器信息
-	machineInfo, err := hardware.GetMachineInfo()
+	machineInfo, err := getMachineInfo(cfg)
 	if err != nil {
-		ui.ShowError(fmt.Sprintf("Failed to get machine info: %v", err))
-		os.Exit(1)
+		fail(out, apperrors.ExitFailure, "Failed to get machine info", "error", err)
+	}
+
+	// 读取上次保存的许可证状态（用于服务器不可达时的离线宽限期）
+	licenseGuard, err := newLicenseGuard(cfg)
+	if err != nil {
+		fail(out, apperrors.ExitFailure, "Failed to initialize license state", "error", err)
 	}
 
 	// 初始化会话密钥管理器
 	sessionManager := session.NewManager()
 
+	// 创建协议客户端（所有请求复用同一个 HTTP 连接池）
+	client := protocol.NewClient(cfg, sessionManager)
+	ctx := context.Background()
+
 	// 进行密钥交换（获取用户名）
-	username, err := keyexchange.ExchangeKey(cfg, sessionManager)
-	if err != nil {
-		ui.ShowError(fmt.Sprintf("Authentication failed: %v", err))
-		os.Exit(1)
+	// 服务器不可达时，如果仍在离线宽限期内则使用保存的许可证状态继续运行
+	result, failure := authenticate(ctx, client, licenseGuard, time.Now())
+	if failure != nil {
+		fail(out, failure.code, failure.msg, failure.args...)
 	}
+	username, offlineErr := result.username, result.offline
 
 	// 如果服务器没有返回用户名，使用默认值
 	if username == "" {
@@ -72,69 +103,339 @@ func main() {
 	}
 
 	// 显示登录成功界面
-	ui.ShowLoggedIn(username, version)
+	out.LoggedIn(username, version)
+	if offlineErr != nil {
+		deadline, _ := licenseGuard.Deadline()
+		out.Warning(fmt.Sprintf("Server unreachable, running offline until %s", deadline.Local().Format("2006-01-02 15:04")), "error", offlineErr, "offline_until", deadline)
+	}
+
+	// 容器的实例 ID 每次重新部署都会变化，没有配置 INSTANCE_ID 时每次部署都会占用一个新的机器名额
+	if machineInfo.EphemeralInstance() {
+		out.Warning("Running in a container without INSTANCE_ID: every redeploy registers a new machine, set INSTANCE_ID to a stable name",
+			"environment", machineInfo.Environment.String(), "instance_source", machineInfo.InstanceSource)
+	}
 
 	// 显示机器信息（可选，可以注释掉）
 	// fmt.Printf("Machine ID: %s\n", machineInfo.MachineID)
 	// fmt.Printf("Machine Name: %s\n", machineInfo.MachineName)
 	// fmt.Printf("RAM: %d GB | CPU Cores: %d\n\n", machineInfo.RAM, machineInfo.Cores)
 
+	// 开启遥测时在后台采样，每次心跳附带上次心跳以来的汇总
+	var collector *telemetry.Collector
+	if cfg.Telemetry {
+		collector = telemetry.NewCollector(cfg.TelemetryInterval)
+		collector.Start(ctx)
+	}
+
+	// 自定义指标采集器各自在后台运行，每次心跳附带最近一次的结果（单个采集器失败不影响心跳）
+	registry, err := newCollectorRegistry(cfg, func(name string, err error) {
+		out.Info("metric collector failed", "collector", name, "error", err)
+	})
+	if err != nil {
+		fail(out, apperrors.ExitConfig, "Invalid metric collectors", "error", err)
+	}
+	if registry != nil {
+		registry.Start(ctx)
+	}
+
+	// 托管进程在首次心跳确认许可证有效（或仍在离线宽限期内）之后启动
+	workloads, err := newWorkloadSupervisor(cfg, out, cfg.Headless || !interactive)
+	if err != nil {
+		fail(out, apperrors.ExitConfig, "Invalid workloads", "error", err)
+	}
+
+	// 服务器在心跳响应中下发的指令校验签名后在后台执行，结果随下一次心跳确认
+	remote := &remoteCommands{
+		running:     cfg,
+		current:     cfg,
+		reload:      reload,
+		client:      client,
+		machineInfo: machineInfo,
+		workloads:   workloads,
+		deregister:  make(chan struct{}, 1),
+	}
+	dispatcher, err := newCommandDispatcher(cfg, out, remote)
+	if err != nil {
+		fail(out, apperrors.ExitConfig, "Invalid server command settings", "error", err)
+	}
+
+	// 心跳发送器（统计会话密钥失效后重新交换的次数，随心跳日志输出）
+	sender := heartbeat.NewSender(client)
+	extras := &heartbeatExtras{
+		collector:  collector,
+		registry:   registry,
+		workloads:  workloads,
+		dispatcher: dispatcher,
+	}
+
 	// 设置优雅关闭
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// 启动时立即发送首次心跳
-	if err := sendHeartbeatAndHandle(cfg, machineInfo, sessionManager); err != nil {
-		ui.ShowError(fmt.Sprintf("Initial heartbeat failed: %v", err))
-		os.Exit(1)
+	// 网络错误和服务器临时错误已经按重试策略重试过，仍然失败时不终止程序，等待下一次心跳
+	if err := sendHeartbeatAndHandle(ctx, out, sender, machineInfo, extras, licenseGuard, username); err != nil {
+		if isFatalError(err) {
+			_ = licenseGuard.Clear()
+			fail(out, apperrors.ExitCode(err), "Initial heartbeat failed", "error", err, "status_code", apperrors.CodeOf(err))
+		}
+		enforceGracePeriod(out, licenseGuard, err)
+		if offlineErr == nil {
+			out.Warning("Initial heartbeat failed, will retry", "error", err)
+		}
 	}
 
+	// 许可证失效、机器数超限等致命错误由 fail 停止托管进程
+	activeWorkloads = workloads
+	workloads.Start(ctx)
+	dispatcher.Start(ctx)
+
+	// 推送长连接：立即接收指令和许可证变化，不可用时继续按间隔轮询
+	push := startPushStream(ctx, cfg, out, client)
+	remote.setPush(push)
+
+	// 显示许可证信息，并在后台提醒即将过期（服务器不可达时也会在到期时终止程序）
+	showLicenseStatus(out, licenseGuard)
+	licenseGuard.StartMonitor(ctx, license.MonitorOptions{
+		Thresholds: cfg.LicenseWarnings,
+		OnWarning: func(w license.Warning) {
+			out.Warning(fmt.Sprintf("License expires in %s (%s)", license.FormatRemaining(w.Remaining), w.ExpiresAt.Local().Format("2006-01-02 15:04")), "expires_at", w.ExpiresAt, "plan_type", w.PlanType)
+		},
+		OnExpired: func(status license.Status) {
+			fail(out, apperrors.ExitLicenseExpired, fmt.Sprintf("License expired at %s", status.ExpiresAt.Local().Format("2006-01-02 15:04")), "expires_at", status.ExpiresAt)
+		},
+	})
+
+	// 后台刷新会话密钥（有效期过去一定比例时重新交换，失败时退避重试）
+	sessionManager.StartRefresher(ctx, func(ctx context.Context) error {
+		_, err := keyexchange.Exchange(ctx, client)
+		return err
+	}, session.RefreshOptions{
+		Fraction: cfg.SessionRefreshFraction,
+		OnError: func(err error) {
+			if isFatalError(err) {
+				_ = licenseGuard.Clear()
+				fail(out, apperrors.ExitCode(err), "Fatal error", "error", err, "status_code", apperrors.CodeOf(err))
+			}
+			// 非致命错误由刷新器退避重试
+			out.Info("session key refresh failed, retrying", "error", err)
+		},
+		OnRotate: func(r session.Rotation) {
+			out.Info("session key rotated", "generation", r.Generation, "expires_at", r.ExpiresAt)
+		},
+	})
+
 	// 设置定时器每 10 分钟发送心跳
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
-	// 心跳循环
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				// 检查会话密钥是否即将过期（提前5分钟刷新）
-				if !sessionManager.HasValidSession() {
-					_, _ = keyexchange.ExchangeKey(cfg, sessionManager)
-				}
+	// 会话密钥由后台刷新器维护，发送前客户端还会确认密钥不会在途中过期
+	// 终端界面静默发送心跳（不显示日志，避免干扰界面）
+	// 网络错误和服务器临时错误由客户端按重试策略退避重试；推送连接可用时心跳通过它发送
+	heartbeatNow := func() {
+		err := sendHeartbeatAndHandle(ctx, out, sender, machineInfo, extras, licenseGuard, username)
+		if err != nil {
+			// 检查是否是致命错误
+			if isFatalError(err) {
+				_ = licenseGuard.Clear()
+				fail(out, apperrors.ExitCode(err), "Fatal error", "error", err, "status_code", apperrors.CodeOf(err))
+			}
+			// 非致命错误在离线宽限期内继续运行，宽限期结束后终止程序
+			out.Info("heartbeat failed", "error", err)
+			enforceGracePeriod(out, licenseGuard, err)
+		}
+	}
 
-				// 静默发送心跳（不显示日志，避免干扰界面）
-				if err := sendHeartbeatAndHandle(cfg, machineInfo, sessionManager); err != nil {
-					// 检查是否是致命错误
-					if isFatalError(err) {
-						ui.ShowError(fmt.Sprintf("Fatal error: %v", err))
-						os.Exit(1)
-					}
-					// 非致命错误继续运行（静默处理）
+	// 心跳循环（收到退出信号时返回）
+	for {
+		select {
+		case <-ticker.C:
+			heartbeatNow()
+		case <-push.Wake():
+			// 服务器推送了事件（或推送连接刚建立），立即发送心跳
+			heartbeatNow()
+		case <-remote.deregister:
+			// 发送心跳确认注销（服务器收到后删除机器记录），然后清除许可证状态并退出
+			// 结果已经随其他心跳确认时不再发送，避免服务器重新注册机器
+			if len(extras.dispatcher.Pending()) > 0 {
+				if err := sendHeartbeatAndHandle(ctx, out, sender, machineInfo, extras, licenseGuard, username); err != nil {
+					out.Info("failed to confirm deregistration", "error", err)
 				}
-			case <-sigChan:
-				ui.ClearScreen()
-				fmt.Println("Shutting down...")
-				return
 			}
+			_ = licenseGuard.Clear()
+			out.Warning("Machine deregistered by the server")
+			out.Shutdown()
+			return apperrors.ExitOK
+		case <-sigChan:
+			workloads.Stop()
+			out.Shutdown()
+			return apperrors.ExitOK
 		}
-	}()
+	}
+}
+
+// fail 输出错误，停止托管进程，并以指定退出码终止程序
+func fail(out ui.Output, code int, msg string, args ...any) {
+	out.Error(msg, append(args, "exit_code", code)...)
+	activeWorkloads.Stop()
+	os.Exit(code)
+}
+
+// authResult 启动时密钥交换的结果
+type authResult struct {
+	username string
+	offline  error // 服务器不可达、在离线宽限期内继续运行的原因（在线时为 nil）
+}
 
-	// 等待退出信号
-	<-sigChan
+// authFailure 启动时密钥交换失败，程序以 code 退出
+type authFailure struct {
+	code int
+	msg  string
+	args []any
 }
 
-// getEnvOrDefault 获取环境变量，如果不存在则返回默认值
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// authenticate 交换密钥获取用户名
+//
+// 只有网络错误和服务器临时错误才进入离线宽限期；配置错误（例如不允许旧的密钥交换、固定的服务器公钥或
+// ENCRYPTION_KEY 与服务器不一致）以 ExitConfig 退出，服务器明确拒绝时删除保存的许可证状态
+func authenticate(ctx context.Context, client *protocol.Client, licenseGuard *license.Guard, now time.Time) (authResult, *authFailure) {
+	username, err := keyexchange.Exchange(ctx, client)
+	switch {
+	case err == nil:
+		return authResult{username: username}, nil
+	case isFatalError(err):
+		_ = licenseGuard.Clear()
+		return authResult{}, &authFailure{apperrors.ExitCode(err), "Authentication failed", []any{"error", err, "status_code", apperrors.CodeOf(err)}}
+	case protocol.IsConfigError(err):
+		return authResult{}, &authFailure{apperrors.ExitConfig, "Invalid key exchange configuration", []any{"error", err}}
+	case !apperrors.IsRetryable(err):
+		return authResult{}, &authFailure{apperrors.ExitCode(err), "Authentication failed", []any{"error", err, "status_code", apperrors.CodeOf(err)}}
 	}
-	return defaultValue
+
+	if graceErr := licenseGuard.Check(now); graceErr != nil {
+		return authResult{}, &authFailure{graceExitCode(graceErr), fmt.Sprintf("Authentication failed: %v (offline mode unavailable)", err), []any{"error", graceErr}}
+	}
+	return authResult{username: licenseGuard.Username(), offline: err}, nil
 }
 
-// sendHeartbeatAndHandle 发送心跳并处理响应
-func sendHeartbeatAndHandle(cfg *config.Config, machineInfo *hardware.MachineInfo, sessionManager *session.Manager) error {
-	resp, err := heartbeat.SendHeartbeat(cfg, machineInfo, sessionManager)
+// graceExitCode 离线宽限期检查失败时的退出码
+func graceExitCode(err error) int {
+	if errors.Is(err, license.ErrLicenseExpired) {
+		return apperrors.ExitLicenseExpired
+	}
+	return apperrors.ExitServerUnreachable
+}
+
+// promptConfigValue 交互式输入缺失的必填配置项
+func promptConfigValue(key string) (string, error) {
+	if key != "api_key" {
+		// 其他必填项不提示，由配置校验报告缺失
+		return "", nil
+	}
+
+	ui.ClearScreen()
+	ui.ShowBanner(version)
+	ui.ShowLoginPrompt()
+	apiKey, err := ui.HideInput()
+	if err != nil {
+		return "", err
+	}
+	if apiKey == "" {
+		return "", fmt.Errorf("API Key cannot be empty")
+	}
+	return apiKey, nil
+}
+
+// runConfig 显示合并后的配置和每一项的来源（config show [--redacted]）
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "Usage: sqlbots-client config show [--redacted] [flags]")
+		return apperrors.ExitUsage
+	}
+
+	var redacted bool
+	cfg, err := config.Load(config.LoadOptions{
+		Name: "sqlbots-client config show",
+		Args: args[1:],
+		ExtraFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&redacted, "redacted", false, "Hide secrets (API key, encryption key)")
+		},
+		Credentials:    loadCredentials(ui.IsTerminal()),
+		SkipValidation: true,
+	})
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return apperrors.ExitOK
+		}
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return apperrors.ExitConfig
+	}
+	cfg.Show(os.Stdout, redacted)
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nInvalid configuration:\n%v\n", err)
+		return apperrors.ExitConfig
+	}
+	return apperrors.ExitOK
+}
+
+// newLicenseGuard 创建离线宽限期检查（状态文件用本机绑定的密钥加密）
+func newLicenseGuard(cfg *config.Config) (*license.Guard, error) {
+	path := cfg.LicenseStateFile
+	if path == "" {
+		var err error
+		if path, err = license.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	machineKey, err := hardware.ProtectedID("sqlbots-license")
+	if err != nil {
+		return nil, err
+	}
+
+	return license.NewGuard(license.NewStore(path, machineKey, cfg.APIKey), cfg.OfflineGracePeriod), nil
+}
+
+// showLicenseStatus 显示许可证套餐和过期时间
+func showLicenseStatus(out ui.Output, licenseGuard *license.Guard) {
+	status := licenseGuard.Status(time.Now())
+	if !status.Known {
+		return
+	}
+
+	expiresAt := ""
+	if !status.ExpiresAt.IsZero() {
+		expiresAt = status.ExpiresAt.Local().Format("2006-01-02 15:04")
+	}
+	out.License(status.PlanType, expiresAt, license.FormatRemaining(status.Remaining))
+}
+
+// enforceGracePeriod 服务器不可达且离线宽限期已过时终止程序
+func enforceGracePeriod(out ui.Output, licenseGuard *license.Guard, err error) {
+	if graceErr := licenseGuard.Check(time.Now()); graceErr != nil {
+		fail(out, graceExitCode(graceErr), fmt.Sprintf("Server unreachable: %v", err), "error", graceErr)
+	}
+}
+
+// heartbeatExtras 心跳附带的可选数据和服务器指令的分发（没有开启的为 nil）
+type heartbeatExtras struct {
+	collector  *telemetry.Collector
+	registry   *collectors.Registry
+	workloads  *supervisor.Supervisor
+	dispatcher *dispatch.Dispatcher
+}
+
+// sendHeartbeatAndHandle 发送心跳并处理响应，成功时保存许可证状态并分发服务器下发的指令
+// 遥测数据和指令执行结果只有在心跳成功后才确认，失败时随下一次心跳重新发送
+func sendHeartbeatAndHandle(ctx context.Context, out ui.Output, sender *heartbeat.Sender, machineInfo *hardware.MachineInfo, extras *heartbeatExtras, licenseGuard *license.Guard, username string) error {
+	results := extras.dispatcher.Pending()
+	resp, err := sender.Send(ctx, machineInfo,
+		heartbeat.WithTelemetry(extras.collector.Snapshot()),
+		heartbeat.WithMetrics(extras.registry.Results()),
+		heartbeat.WithWorkloads(extras.workloads.Status()),
+		heartbeat.WithCommandResults(results),
+	)
 	if err != nil {
 		return err
 	}
@@ -143,30 +444,20 @@ func sendHeartbeatAndHandle(cfg *config.Config, machineInfo *hardware.MachineInf
 	if err := heartbeat.HandleHeartbeatResponse(resp); err != nil {
 		return err
 	}
+	extras.collector.Ack()
+	extras.dispatcher.Ack(results)
 
-	// 静默处理成功响应（不显示日志）
-	_ = resp
+	// 终端界面静默处理成功响应，保存失败不影响运行
+	if err := licenseGuard.Record(resp, username); err != nil {
+		out.Warning("Failed to save license state", "error", err)
+	}
+	out.Info("heartbeat sent", append([]any{"plan_type", resp.LicenseInfo.PlanType, "expires_at", resp.LicenseInfo.ExpiresAt}, sender.Stats().LogArgs()...)...)
+
+	extras.dispatcher.Dispatch(resp.Commands)
 	return nil
 }
 
 // isFatalError 判断是否是致命错误（需要终止程序）
 func isFatalError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	errStr := err.Error()
-	fatalErrors := []string{
-		"INVALID_API_KEY",
-		"LICENSE_EXPIRED",
-		"MACHINE_LIMIT_EXCEEDED",
-	}
-
-	for _, fatalErr := range fatalErrors {
-		if strings.Contains(errStr, fatalErr) {
-			return true
-		}
-	}
-
-	return false
+	return apperrors.IsFatal(err)
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/license"
+	"sqlbots-client/protocol"
+	"sqlbots-client/server"
+	"sqlbots-client/session"
+)
+
+const (
+	testAPIKey        = "test-api-key"
+	testEncryptionKey = "test-encryption-key"
+)
+
+// newAuthTestServer 启动带一个用户的参考服务器，返回服务器公钥和地址
+func newAuthTestServer(t *testing.T) (string, string) {
+	t.Helper()
+
+	privateKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := server.NewMemoryStore()
+	store.AddUser(server.User{ID: "user-1", APIKey: testAPIKey, Username: "test"})
+	store.SetLicense(server.License{UserID: "user-1", PlanType: "pro"})
+	httpServer := httptest.NewServer(server.New(server.Config{EncryptionKey: testEncryptionKey, PrivateKey: privateKey}, store).Handler())
+	t.Cleanup(httpServer.Close)
+	return encryption.EncodeX25519PublicKey(privateKey.PublicKey()), httpServer.URL
+}
+
+// closedURL 没有服务监听的地址
+func closedURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return "http://" + listener.Addr().String()
+}
+
+// 启动时只有服务器不可达才进入离线宽限期；配置错误即使有保存的许可证状态也以 ExitConfig 退出
+func TestAuthenticate(t *testing.T) {
+	publicKey, serverURL := newAuthTestServer(t)
+	otherKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closedURL(t)
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		wantCode    int
+		wantOffline bool
+		stateKept   bool
+	}{
+		{"pinned key", config.Config{ServerURL: serverURL, ServerPublicKey: publicKey}, apperrors.ExitOK, false, true},
+		{"legacy exchange allowed", config.Config{ServerURL: serverURL, AllowLegacyKeyExchange: true}, apperrors.ExitOK, false, true},
+		{"legacy exchange not allowed", config.Config{ServerURL: serverURL}, apperrors.ExitConfig, false, true},
+		{"wrong pinned key", config.Config{ServerURL: serverURL, ServerPublicKey: encryption.EncodeX25519PublicKey(otherKey.PublicKey())}, apperrors.ExitConfig, false, true},
+		{"wrong encryption key", config.Config{ServerURL: serverURL, AllowLegacyKeyExchange: true, EncryptionKey: "wrong-encryption-key"}, apperrors.ExitConfig, false, true},
+		{"invalid api key", config.Config{ServerURL: serverURL, ServerPublicKey: publicKey, APIKey: "wrong-key"}, apperrors.ExitInvalidAPIKey, false, false},
+		{"server unreachable", config.Config{ServerURL: unreachable, ServerPublicKey: publicKey}, apperrors.ExitOK, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg.APIKey == "" {
+				cfg.APIKey = testAPIKey
+			}
+			if cfg.EncryptionKey == "" {
+				cfg.EncryptionKey = testEncryptionKey
+			}
+			cfg.RetryMaxElapsed = time.Millisecond
+
+			// 保存有效的许可证状态，配置错误时也可以进入离线宽限期
+			store := license.NewStore(filepath.Join(t.TempDir(), "license.state"), "machine-key", cfg.APIKey)
+			if err := store.Save(&license.State{Username: "saved", PlanType: "pro", VerifiedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			guard := license.NewGuard(store, time.Hour)
+
+			client := protocol.NewClient(&cfg, session.NewManager())
+			result, failure := authenticate(context.Background(), client, guard, time.Now())
+			code := apperrors.ExitOK
+			if failure != nil {
+				code = failure.code
+			}
+			if code != tt.wantCode || (result.offline != nil) != tt.wantOffline {
+				t.Fatalf("got exit code %d, offline %v (failure %+v), want %d, offline %v", code, result.offline, failure, tt.wantCode, tt.wantOffline)
+			}
+			if tt.wantOffline && result.username != "saved" {
+				t.Fatalf("offline username: %q", result.username)
+			}
+			if _, err := store.Load(); (err == nil) != tt.stateKept || (err != nil && !errors.Is(err, license.ErrNoState)) {
+				t.Fatalf("license state kept %v (%v), want %v", err == nil, err, tt.stateKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/retry"
+	"sqlbots-client/session"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// sessionRefreshMargin 会话密钥剩余有效期不足该时长时，发送请求前先同步交换密钥
+const sessionRefreshMargin = 30 * time.Second
+
+// Client 协议客户端（复用 HTTP 连接，统一处理请求/加密/解密流程）
+type Client struct {
+	cfg        *config.Config
+	httpClient *http.Client
+	sessions   *session.Manager
+	sequence   atomic.Uint64 // 请求序号（从启动时间开始递增）
+	sender     string        // 本进程的序号标识（同一台机器上的多个进程各自递增，互不影响）
+	exchangeMu sync.Mutex    // 串行化密钥交换（后台刷新和请求前的同步交换可能同时发生）
+
+	policies map[string]retry.Policy   // 按接口配置的重试策略
+	noRetry  bool                      // 关闭重试和熔断
+	retryers map[string]*retry.Retryer // 按接口的重试器
+
+	stream atomic.Pointer[Stream] // 推送连接（为 nil 时心跳不带连接 ID）
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 HTTP 客户端
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient 创建新的协议客户端
+func NewClient(cfg *config.Config, sessions *session.Manager, opts ...Option) *Client {
+	c := &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		sessions:   sessions,
+		policies:   make(map[string]retry.Policy),
+	}
+	for path, policy := range cfg.RetryPolicies {
+		c.policies[path] = policy
+	}
+	c.sequence.Store(uint64(time.Now().UnixNano()))
+	c.sender = newSender()
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.initRetryers()
+	return c
+}
+
+// Config 返回客户端配置
+func (c *Client) Config() *config.Config {
+	return c.cfg
+}
+
+// Sessions 返回会话密钥管理器
+func (c *Client) Sessions() *session.Manager {
+	return c.sessions
+}
+
+// ErrLegacyKeyExchange 需要回退到旧的密钥交换流程，但配置不允许
+var ErrLegacyKeyExchange = errors.New("legacy key exchange is not allowed (configure the server public key or allow legacy key exchange)")
+
+// ErrKeyAgreementUnsupported 配置了服务器公钥，但服务器没有进行 X25519 密钥协商（旧服务器或降级攻击）
+var ErrKeyAgreementUnsupported = errors.New("server did not perform x25519 key agreement although a server public key is pinned")
+
+// ErrEncryptionKeyMismatch 无法用 ENCRYPTION_KEY 解密服务器下发的会话密钥（与服务器配置的初始密钥不一致）
+var ErrEncryptionKeyMismatch = errors.New("failed to decrypt session key (encryption_key does not match the server)")
+
+// IsConfigError 密钥交换失败是否由本地配置引起（重试或离线运行都不能解决，需要修改配置）
+func IsConfigError(err error) bool {
+	return errors.Is(err, ErrLegacyKeyExchange) ||
+		errors.Is(err, ErrKeyAgreementUnsupported) ||
+		errors.Is(err, ErrEncryptionKeyMismatch) ||
+		errors.Is(err, encryption.ErrKeyConfirmationFailed)
+}
+
+// ExchangeKey 执行密钥交换，保存会话密钥并返回响应
+//
+// 配置了服务器公钥时使用 X25519 密钥协商（会话密钥由双方各自派生，不经过网络传输），服务器不支持时不会回退；
+// 没有配置服务器公钥时，只有显式开启 AllowLegacyKeyExchange（默认关闭）才接受服务器用 ENCRYPTION_KEY 加密下发的会话密钥。
+// 网络错误和服务器临时错误按密钥交换接口的重试策略重试
+func (c *Client) ExchangeKey(ctx context.Context) (*KeyExchangeResponse, error) {
+	c.exchangeMu.Lock()
+	defer c.exchangeMu.Unlock()
+
+	var response *KeyExchangeResponse
+	err := c.withRetry(ctx, PathKeyExchange, func(ctx context.Context) error {
+		var err error
+		response, err = c.exchangeKey(ctx)
+		return err
+	})
+	return response, err
+}
+
+// exchangeKey 执行密钥交换（调用方必须持有 exchangeMu）
+func (c *Client) exchangeKey(ctx context.Context) (*KeyExchangeResponse, error) {
+	// 构建请求（不需要加密，因为这是初始连接）
+	offered := c.offeredSchemes()
+	request := &KeyExchangeRequest{
+		APIKey:  c.cfg.APIKey,
+		Schemes: offered,
+	}
+
+	var handshake *encryption.ClientHandshake
+	if c.cfg.ServerPublicKey != "" {
+		serverKey, err := encryption.ParseX25519PublicKey(c.cfg.ServerPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server public key: %w", err)
+		}
+		handshake, err = encryption.NewClientHandshake(serverKey)
+		if err != nil {
+			return nil, err
+		}
+		request.KeyAgreement = encryption.KeyAgreementX25519
+		request.ClientPublicKey = handshake.PublicKey()
+	} else if !c.cfg.AllowLegacyKeyExchange {
+		return nil, ErrLegacyKeyExchange
+	}
+
+	var response KeyExchangeResponse
+	status, err := c.postJSON(ctx, PathKeyExchange, request, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != apperrors.CodeSuccess {
+		return nil, fmt.Errorf("key exchange failed: %w", apperrors.New(status, response.StatusCode, response.Message))
+	}
+
+	// 旧服务器不返回 scheme，表示使用 legacy 方案
+	scheme := response.Scheme
+	if scheme == "" {
+		scheme = encryption.SchemeLegacy
+	}
+	if !containsScheme(offered, scheme) {
+		return nil, fmt.Errorf("key exchange failed: server selected unsupported encryption scheme %q", scheme)
+	}
+	// 有效期为 0 或负数的会话密钥立即过期，每次请求前都会重新交换密钥
+	if response.ExpiresIn <= 0 {
+		return nil, fmt.Errorf("key exchange failed: server returned invalid expires_in %d", response.ExpiresIn)
+	}
+
+	var sessionKey string
+	if handshake != nil && response.KeyAgreement == encryption.KeyAgreementX25519 {
+		// 使用服务器临时公钥派生会话密钥，并校验服务器的密钥确认值
+		sessionKey, err = handshake.Finish(response.ServerPublicKey, response.KeyConfirmation, c.cfg.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("key agreement failed: %w", err)
+		}
+	} else {
+		// 服务器没有进行密钥协商：固定了服务器公钥时拒绝降级
+		if handshake != nil {
+			return nil, ErrKeyAgreementUnsupported
+		}
+
+		// 使用初始密钥解密会话密钥
+		sessionKey, err = c.decrypt(scheme, PathKeyExchange, response.SessionKey, c.cfg.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEncryptionKeyMismatch, err)
+		}
+		response.SessionID = ""
+	}
+
+	if c.sessions != nil {
+		c.sessions.SetSession(response.SessionID, sessionKey, response.ExpiresIn)
+		c.sessions.SetScheme(scheme)
+	}
+
+	return &response, nil
+}
+
+// SendHeartbeat 发送心跳（网络错误和服务器临时错误按心跳接口的重试策略重试）
+func (c *Client) SendHeartbeat(ctx context.Context, payload *HeartbeatPayload) (*HeartbeatResponse, error) {
+	var response *HeartbeatResponse
+	err := c.withRetry(ctx, PathHeartbeat, func(ctx context.Context) error {
+		var err error
+		response, err = c.sendHeartbeat(ctx, payload)
+		return err
+	})
+	return response, err
+}
+
+// sendHeartbeat 发送一次心跳（每次都会重新写入新鲜度字段并加密）
+func (c *Client) sendHeartbeat(ctx context.Context, payload *HeartbeatPayload) (*HeartbeatResponse, error) {
+	var response HeartbeatResponse
+	status, err := c.postEncrypted(ctx, PathHeartbeat, payload, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK || response.StatusCode != apperrors.CodeSuccess {
+		return &response, apperrors.New(status, response.StatusCode, response.Message)
+	}
+
+	return &response, nil
+}
+
+// Health 健康检查
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(PathHealth), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	var response HealthResponse
+	if _, err := c.do(req, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// ensureSession 确保发送请求时会话密钥不会在途中过期：剩余有效期不足时先同步交换密钥
+//
+// 交换失败时返回错误而不是回退到静态密钥；没有会话管理器时直接使用静态密钥
+func (c *Client) ensureSession(ctx context.Context) error {
+	if c.sessions == nil || c.sessions.ValidFor(sessionRefreshMargin) {
+		return nil
+	}
+
+	c.exchangeMu.Lock()
+	defer c.exchangeMu.Unlock()
+
+	// 等待锁期间可能已经由后台刷新换了新密钥
+	if c.sessions.ValidFor(sessionRefreshMargin) {
+		return nil
+	}
+	if _, err := c.exchangeKey(ctx); err != nil {
+		return fmt.Errorf("failed to refresh session key: %w", err)
+	}
+	return nil
+}
+
+// encryptionKey 确定使用哪个加密密钥：优先使用会话密钥，返回密钥、会话 ID 和是否使用会话密钥
+func (c *Client) encryptionKey() (string, string, bool) {
+	if c.sessions != nil {
+		if current, valid := c.sessions.GetSession(); valid {
+			return current.Key, current.ID, true
+		}
+	}
+	return c.cfg.EncryptionKey, "", false
+}
+
+// offeredSchemes 密钥交换时提供给服务器的加密方案
+func (c *Client) offeredSchemes() []string {
+	if len(c.cfg.EncryptionSchemes) > 0 {
+		return c.cfg.EncryptionSchemes
+	}
+	return encryption.SupportedSchemes
+}
+
+// scheme 当前使用的加密方案：使用密钥交换时协商的方案，未协商时使用 legacy 方案
+func (c *Client) scheme() string {
+	if c.sessions != nil {
+		if scheme := c.sessions.Scheme(); scheme != "" {
+			return scheme
+		}
+	}
+	return encryption.SchemeLegacy
+}
+
+// decrypt 解密服务器返回的数据，拒绝与协商方案不一致的信封（防止降级攻击）
+func (c *Client) decrypt(scheme, path, ciphertext, key string) (string, error) {
+	plaintext, detected, err := encryption.DecryptAny(ciphertext, key, encryption.AssociatedData(path, c.cfg.APIKey))
+	if err != nil {
+		return "", err
+	}
+	if detected != scheme {
+		return "", fmt.Errorf("unexpected encryption scheme %q (negotiated %q)", detected, scheme)
+	}
+	return plaintext, nil
+}
+
+// containsScheme 检查方案列表中是否包含指定方案
+func containsScheme(schemes []string, scheme string) bool {
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// postEncrypted 加密请求数据并发送，解密响应到 out，返回 HTTP 状态码
+func (c *Client) postEncrypted(ctx context.Context, path string, payload, out interface{}) (int, error) {
+	// 写入时间戳、序号和 nonce，服务器据此拒绝过期或重复的请求
+	var sent Freshness
+	if p, ok := payload.(stampable); ok {
+		var err error
+		if sent, err = c.nextFreshness(); err != nil {
+			return 0, err
+		}
+		*p.freshness() = sent
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+
+	if err := c.ensureSession(ctx); err != nil {
+		return 0, err
+	}
+
+	key, sessionID, useSessionKey := c.encryptionKey()
+	scheme := c.scheme()
+
+	encryptedData, err := encryption.EncryptWithScheme(scheme, string(jsonData), key, encryption.AssociatedData(path, c.cfg.APIKey))
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	request := &EncryptedRequest{
+		APIKey:        c.cfg.APIKey,
+		EncryptedData: encryptedData,
+		UseSessionKey: useSessionKey,
+		SessionID:     sessionID,
+	}
+	if scheme != encryption.SchemeLegacy {
+		request.Scheme = scheme
+	}
+	// 推送连接可用时，心跳带上连接 ID（服务器据此把连接绑定到这台机器，连接 ID 包含在签名中）
+	if s := c.stream.Load(); s != nil && path == PathHeartbeat {
+		request.StreamID = s.ID()
+	}
+	request.Signature = encryption.Sign(key, SignatureFields(path, request)...)
+
+	var env envelope
+	status, err := c.postJSON(ctx, path, request, &env)
+	if err != nil {
+		return status, err
+	}
+
+	// 明文错误响应：服务器在解密之前就拒绝了请求
+	if env.EncryptedData == "" {
+		if env.StatusCode == "" && status == http.StatusOK {
+			return status, fmt.Errorf("invalid response: missing encrypted_data")
+		}
+		return status, apperrors.New(status, env.StatusCode, env.Message)
+	}
+
+	// 解密响应数据（使用相同的密钥）
+	decryptedText, err := c.decrypt(scheme, path, env.EncryptedData, key)
+	if err != nil {
+		return status, fmt.Errorf("failed to decrypt response: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(decryptedText), out); err != nil {
+		return status, fmt.Errorf("failed to parse decrypted response: %w", err)
+	}
+
+	var received Freshness
+	if err := json.Unmarshal([]byte(decryptedText), &received); err != nil {
+		return status, fmt.Errorf("failed to parse decrypted response: %w", err)
+	}
+	if err := c.checkResponseFreshness(sent, received); err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// postJSON 发送 JSON POST 请求并解析 JSON 响应，返回 HTTP 状态码
+func (c *Client) postJSON(ctx context.Context, path string, body, out interface{}) (int, error) {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(path), bytes.NewReader(requestBody))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, out)
+}
+
+// do 发送请求并解析 JSON 响应，返回 HTTP 状态码
+func (c *Client) do(req *http.Request, out interface{}) (int, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, apperrors.Network(err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		// 非 JSON 的错误响应（例如反向代理返回的 502 页面）
+		if resp.StatusCode >= http.StatusBadRequest {
+			return resp.StatusCode, apperrors.New(resp.StatusCode, "", http.StatusText(resp.StatusCode))
+		}
+		return resp.StatusCode, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// url 拼接接口地址
+func (c *Client) url(path string) string {
+	return strings.TrimRight(c.cfg.ServerURL, "/") + path
+}
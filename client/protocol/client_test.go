@@ -0,0 +1,228 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+)
+
+const (
+	testAPIKey        = "test-api-key"
+	testEncryptionKey = "test-encryption-key"
+)
+
+// newTestClient 创建连接 handler 的客户端（没有会话密钥，使用初始密钥加密；不重试）
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg := &config.Config{APIKey: testAPIKey, ServerURL: server.URL, EncryptionKey: testEncryptionKey}
+	return NewClient(cfg, nil, append([]Option{WithoutRetry()}, opts...)...)
+}
+
+func testPayload() *HeartbeatPayload {
+	return &HeartbeatPayload{MachineID: "machine-1", MachineName: "test-machine", RAM: 8, Cores: 4}
+}
+
+// writeJSONResponse 写入 JSON 响应
+func writeJSONResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// 请求带签名，签名覆盖 SignatureFields 的所有字段；服务器用同一个密钥解密请求、加密响应
+func TestSendHeartbeatSignsRequest(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request EncryptedRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("request body: %v", err)
+			return
+		}
+		if request.APIKey != testAPIKey || request.EncryptedData == "" || request.Signature == "" || request.UseSessionKey {
+			t.Errorf("request: %+v", request)
+		}
+		if !encryption.Verify(testEncryptionKey, request.Signature, SignatureFields(PathHeartbeat, &request)...) {
+			t.Error("invalid request signature")
+		}
+		tampered := request
+		tampered.APIKey = "other-key"
+		if encryption.Verify(testEncryptionKey, request.Signature, SignatureFields(PathHeartbeat, &tampered)...) {
+			t.Error("signature does not cover the API key")
+		}
+
+		associatedData := encryption.AssociatedData(PathHeartbeat, testAPIKey)
+		plaintext, scheme, err := encryption.DecryptAny(request.EncryptedData, testEncryptionKey, associatedData)
+		if err != nil {
+			t.Errorf("decrypt request: %v", err)
+			return
+		}
+		var payload HeartbeatPayload
+		if err := json.Unmarshal([]byte(plaintext), &payload); err != nil || payload.MachineID != "machine-1" ||
+			payload.Timestamp == 0 || payload.Nonce == "" || payload.Sequence == 0 {
+			t.Errorf("payload: %+v (%v)", payload, err)
+		}
+
+		response, _ := json.Marshal(map[string]interface{}{
+			"status_code":  apperrors.CodeSuccess,
+			"license_info": map[string]string{"plan_type": "pro"},
+			"nonce":        payload.Nonce,
+			"timestamp":    time.Now().Unix(),
+		})
+		encrypted, err := encryption.EncryptWithScheme(scheme, string(response), testEncryptionKey, associatedData)
+		if err != nil {
+			t.Errorf("encrypt response: %v", err)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]string{"encrypted_data": encrypted})
+	})
+
+	resp, err := client.SendHeartbeat(context.Background(), testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != apperrors.CodeSuccess || resp.LicenseInfo.PlanType != "pro" {
+		t.Fatalf("response: %+v", resp)
+	}
+}
+
+// 服务器在解密之前拒绝请求时返回明文错误信封
+func TestSendHeartbeatPlaintextErrorEnvelope(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusForbidden, map[string]string{"status_code": apperrors.CodeMachineLimitExceeded, "message": "Too many machines"})
+	})
+
+	_, err := client.SendHeartbeat(context.Background(), testPayload())
+	var protocolErr *apperrors.ProtocolError
+	if !errors.As(err, &protocolErr) {
+		t.Fatalf("got %v, want a protocol error", err)
+	}
+	if protocolErr.StatusCode != apperrors.CodeMachineLimitExceeded || protocolErr.HTTPStatus != http.StatusForbidden ||
+		protocolErr.Message != "Too many machines" || protocolErr.Class != apperrors.ClassFatal {
+		t.Fatalf("protocol error: %+v", protocolErr)
+	}
+}
+
+// 反向代理返回的非 JSON 错误页按 HTTP 状态分类
+func TestSendHeartbeatNonJSONError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "<html><body>502 Bad Gateway</body></html>")
+	})
+
+	_, err := client.SendHeartbeat(context.Background(), testPayload())
+	var protocolErr *apperrors.ProtocolError
+	if !errors.As(err, &protocolErr) || protocolErr.StatusCode != apperrors.CodeHTTPError || protocolErr.HTTPStatus != http.StatusBadGateway {
+		t.Fatalf("got %v, want an HTTP 502 protocol error", err)
+	}
+	if !apperrors.IsRetryable(err) {
+		t.Fatalf("HTTP 502 not retryable: class %s", apperrors.ClassOf(err))
+	}
+
+	// 成功状态码但缺少 encrypted_data 不是协议错误
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, map[string]string{})
+	})
+	if _, err := client.SendHeartbeat(context.Background(), testPayload()); err == nil || errors.As(err, &protocolErr) {
+		t.Fatalf("got %v, want an invalid response error", err)
+	}
+}
+
+// 超时和连接失败归类为网络错误
+func TestSendHeartbeatNetworkErrors(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	refused := NewClient(&config.Config{APIKey: testAPIKey, ServerURL: "http://" + address, EncryptionKey: testEncryptionKey}, nil, WithoutRetry())
+
+	for name, client := range map[string]*Client{"timeout": slow, "connection refused": refused} {
+		_, err := client.SendHeartbeat(context.Background(), testPayload())
+		if apperrors.ClassOf(err) != apperrors.ClassNetwork || apperrors.CodeOf(err) != apperrors.CodeNetworkError {
+			t.Errorf("%s: got %v (class %s), want a network error", name, err, apperrors.ClassOf(err))
+		}
+		if apperrors.ExitCode(err) != apperrors.ExitServerUnreachable {
+			t.Errorf("%s: exit code %d", name, apperrors.ExitCode(err))
+		}
+	}
+}
+
+// 服务器返回的响应必须对应本次请求
+func TestSendHeartbeatRejectsMismatchedNonce(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		response := fmt.Sprintf(`{"status_code":%q,"nonce":"other","timestamp":%d}`, apperrors.CodeSuccess, time.Now().Unix())
+		encrypted, err := encryption.EncryptWithScheme(encryption.SchemeLegacy, response, testEncryptionKey, encryption.AssociatedData(PathHeartbeat, testAPIKey))
+		if err != nil {
+			t.Errorf("encrypt response: %v", err)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, map[string]string{"encrypted_data": encrypted})
+	})
+
+	if _, err := client.SendHeartbeat(context.Background(), testPayload()); err == nil {
+		t.Fatal("response with another request's nonce accepted")
+	}
+}
+
+// 服务器返回的状态码经过客户端后得到正确的分类和退出码
+func TestServerStatusCodeClassification(t *testing.T) {
+	tests := []struct {
+		code       string
+		httpStatus int
+		class      apperrors.Class
+		exitCode   int
+	}{
+		{apperrors.CodeInvalidAPIKey, http.StatusUnauthorized, apperrors.ClassFatal, apperrors.ExitInvalidAPIKey},
+		{apperrors.CodeLicenseExpired, http.StatusForbidden, apperrors.ClassFatal, apperrors.ExitLicenseExpired},
+		{apperrors.CodeDecryptionFailed, http.StatusBadRequest, apperrors.ClassReauthenticate, apperrors.ExitFailure},
+		{apperrors.CodeReplayDetected, http.StatusBadRequest, apperrors.ClassRetryable, apperrors.ExitServerUnreachable},
+		{apperrors.CodeStaleRequest, http.StatusBadRequest, apperrors.ClassUnknown, apperrors.ExitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				writeJSONResponse(w, tt.httpStatus, map[string]string{"status_code": tt.code, "message": "rejected"})
+			})
+
+			// 心跳和密钥交换的错误分类相同
+			_, heartbeatErr := client.SendHeartbeat(context.Background(), testPayload())
+			client.cfg.AllowLegacyKeyExchange = true
+			_, exchangeErr := client.ExchangeKey(context.Background())
+			for name, err := range map[string]error{"heartbeat": heartbeatErr, "key exchange": exchangeErr} {
+				if apperrors.CodeOf(err) != tt.code {
+					t.Errorf("%s: got %v, want status code %s", name, err, tt.code)
+				}
+				if class := apperrors.ClassOf(err); class != tt.class {
+					t.Errorf("%s: class %s, want %s", name, class, tt.class)
+				}
+				if code := apperrors.ExitCode(err); code != tt.exitCode {
+					t.Errorf("%s: exit code %d, want %d", name, code, tt.exitCode)
+				}
+			}
+		})
+	}
+}
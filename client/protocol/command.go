@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"sqlbots-client/encryption"
+)
+
+// 服务器可以下发的指令类型
+const (
+	CommandRefreshConfig      = "refresh_config"      // 重新读取配置并重新加载托管进程
+	CommandRotateKeys         = "rotate_keys"         // 作废当前会话密钥并重新交换
+	CommandRestartWorkload    = "restart_workload"    // 重启托管进程（参数 name）
+	CommandCollectDiagnostics = "collect_diagnostics" // 运行 doctor 检查并返回报告
+	CommandDeregister         = "deregister"          // 停止托管进程、清除许可证状态并注销本机
+)
+
+// 指令执行状态
+const (
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+	CommandRejected  = "rejected" // 签名、目标机器、有效期或白名单校验失败，没有执行
+)
+
+const (
+	// MaxCommandTTL 指令的最长有效期（服务器签发指令时的上限）
+	MaxCommandTTL = 24 * time.Hour
+	// MaxCommandExpiry 客户端接受的过期时间距当前时间的上限（最长有效期加上允许的时钟偏差）
+	//
+	// 客户端的去重记录至少保留这么久，过期时间更晚的指令在去重记录删除后可以被重放，因此直接拒绝
+	MaxCommandExpiry = MaxCommandTTL + DefaultClockSkewTolerance
+)
+
+// commandSignatureLabel 指令签名的用途标识（与请求签名区分）
+const commandSignatureLabel = "sqlbots command v1"
+
+// Command 服务器在心跳响应中下发的指令
+//
+// 服务器使用 Ed25519 私钥签名，客户端使用固定的公钥校验（见 CommandSignatureFields）。
+// 服务器在收到执行结果之前每次心跳都会重发，客户端按 ID 去重
+type Command struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Args       map[string]string `json:"args,omitempty"`
+	MachineID  string            `json:"machine_id"`            // 目标机器（心跳中发送的 machine_id）
+	InstanceID string            `json:"instance_id,omitempty"` // 目标实例（为空时不限制）
+	IssuedAt   int64             `json:"issued_at"`             // Unix 时间戳（秒）
+	ExpiresAt  int64             `json:"expires_at"`            // Unix 时间戳（秒），过期后不再执行
+	Signature  string            `json:"signature"`
+}
+
+// CommandResult 指令执行结果（在下一次心跳中发送给服务器确认）
+type CommandResult struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// CommandSignatureFields 指令签名覆盖的字段（参数按键排序，服务器和客户端必须使用相同的顺序）
+func CommandSignatureFields(cmd *Command) []string {
+	fields := []string{
+		commandSignatureLabel,
+		cmd.ID,
+		cmd.Type,
+		cmd.MachineID,
+		cmd.InstanceID,
+		strconv.FormatInt(cmd.IssuedAt, 10),
+		strconv.FormatInt(cmd.ExpiresAt, 10),
+	}
+
+	keys := make([]string, 0, len(cmd.Args))
+	for key := range cmd.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, key, cmd.Args[key])
+	}
+	return fields
+}
+
+// SignCommand 使用服务器的 Ed25519 私钥签名指令
+func SignCommand(key ed25519.PrivateKey, cmd *Command) {
+	cmd.Signature = encryption.SignEd25519(key, CommandSignatureFields(cmd)...)
+}
+
+// VerifyCommand 校验指令的签名、目标机器和有效期
+func VerifyCommand(key ed25519.PublicKey, cmd *Command, machineID, instanceID string, now time.Time) error {
+	if cmd.ID == "" || cmd.Type == "" {
+		return fmt.Errorf("command id and type are required")
+	}
+	if !encryption.VerifyEd25519(key, cmd.Signature, CommandSignatureFields(cmd)...) {
+		return fmt.Errorf("invalid command signature")
+	}
+	if cmd.MachineID != machineID {
+		return fmt.Errorf("command is addressed to another machine")
+	}
+	if cmd.InstanceID != "" && cmd.InstanceID != instanceID {
+		return fmt.Errorf("command is addressed to another instance")
+	}
+	if now.Unix() >= cmd.ExpiresAt {
+		return fmt.Errorf("command expired at %s", time.Unix(cmd.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	if time.Unix(cmd.ExpiresAt, 0).After(now.Add(MaxCommandExpiry)) {
+		return fmt.Errorf("command expires at %s, more than %s from now", time.Unix(cmd.ExpiresAt, 0).UTC().Format(time.RFC3339), MaxCommandExpiry)
+	}
+	return nil
+}
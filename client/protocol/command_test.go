@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	"sqlbots-client/encryption"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	key, err := encryption.GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := encryption.GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	// command 返回用 signingKey 签名、经过 modify 修改的指令
+	command := func(signingKey ed25519.PrivateKey, modify func(*Command)) *Command {
+		cmd := &Command{
+			ID:        "cmd-1",
+			Type:      CommandRestartWorkload,
+			Args:      map[string]string{"name": "worker"},
+			MachineID: "machine-1",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		}
+		if modify != nil {
+			modify(cmd)
+		}
+		SignCommand(signingKey, cmd)
+		return cmd
+	}
+
+	tests := []struct {
+		name    string
+		cmd     *Command
+		wantErr string
+	}{
+		{"valid", command(key, nil), ""},
+		{"instance", command(key, func(cmd *Command) { cmd.InstanceID = "instance-1" }), ""},
+		// 服务器按最长有效期签发，客户端时钟比服务器慢
+		{"max ttl with clock skew", command(key, func(cmd *Command) {
+			cmd.ExpiresAt = now.Add(MaxCommandTTL + time.Minute).Unix()
+		}), ""},
+		{"expires too late", command(key, func(cmd *Command) {
+			cmd.ExpiresAt = now.Add(MaxCommandExpiry + time.Second).Unix()
+		}), "from now"},
+		{"expired", command(key, func(cmd *Command) { cmd.ExpiresAt = now.Unix() }), "expired"},
+		{"wrong key", command(otherKey, nil), "signature"},
+		{"other machine", command(key, func(cmd *Command) { cmd.MachineID = "machine-2" }), "another machine"},
+		{"other instance", command(key, func(cmd *Command) { cmd.InstanceID = "instance-2" }), "another instance"},
+		{"missing id", command(key, func(cmd *Command) { cmd.ID = "" }), "required"},
+	}
+	for _, tt := range tests {
+		err := VerifyCommand(key.Public().(ed25519.PublicKey), tt.cmd, "machine-1", "instance-1", now)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// 签名覆盖所有字段（包括参数）
+	public := key.Public().(ed25519.PublicKey)
+	for name, modify := range map[string]func(*Command){
+		"args":       func(cmd *Command) { cmd.Args["name"] = "other" },
+		"type":       func(cmd *Command) { cmd.Type = CommandDeregister },
+		"expires_at": func(cmd *Command) { cmd.ExpiresAt++ },
+		"instance":   func(cmd *Command) { cmd.InstanceID = "instance-1" },
+	} {
+		cmd := command(key, nil)
+		modify(cmd)
+		if err := VerifyCommand(public, cmd, "machine-1", "instance-1", now); err == nil || !strings.Contains(err.Error(), "signature") {
+			t.Errorf("tampered %s: got %v, want a signature error", name, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultClockSkewTolerance 默认允许的时钟偏差
+const DefaultClockSkewTolerance = 5 * time.Minute
+
+// Freshness 新鲜度字段（放在加密数据中，用于防止重放）
+type Freshness struct {
+	Timestamp int64  `json:"timestamp,omitempty"` // Unix 时间戳（秒）
+	Sequence  uint64 `json:"sequence,omitempty"`  // 单调递增序号（同一个 sender 内递增）
+	Sender    string `json:"sender,omitempty"`    // 序号所属的客户端进程（每个进程随机生成）
+	Nonce     string `json:"nonce,omitempty"`     // 随机数（服务器在响应中原样返回）
+}
+
+// stampable 可以写入新鲜度字段的请求数据
+type stampable interface {
+	freshness() *Freshness
+}
+
+// freshness 返回新鲜度字段（嵌入 Freshness 的结构体自动实现 stampable）
+func (f *Freshness) freshness() *Freshness {
+	return f
+}
+
+// CheckSkew 检查时间戳是否在允许的时钟偏差范围内
+func (f *Freshness) CheckSkew(now time.Time, tolerance time.Duration) error {
+	skew := now.Sub(time.Unix(f.Timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return fmt.Errorf("timestamp is outside the allowed clock skew (%s > %s)", skew.Round(time.Second), tolerance)
+	}
+	return nil
+}
+
+// SignatureFields 请求签名覆盖的字段（客户端和服务器必须使用相同的顺序）
+//
+// 推送连接 ID 只在请求带上时才加入签名，不带连接 ID 的请求签名与旧版本相同
+func SignatureFields(path string, request *EncryptedRequest) []string {
+	fields := []string{
+		path,
+		request.APIKey,
+		request.SessionID,
+		request.Scheme,
+		strconv.FormatBool(request.UseSessionKey),
+		request.EncryptedData,
+	}
+	if request.StreamID != "" {
+		fields = append(fields, request.StreamID)
+	}
+	return fields
+}
+
+// nextFreshness 生成下一个请求的新鲜度字段
+func (c *Client) nextFreshness() (Freshness, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Freshness{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return Freshness{
+		Timestamp: time.Now().Unix(),
+		Sequence:  c.sequence.Add(1),
+		Sender:    c.sender,
+		Nonce:     hex.EncodeToString(nonce),
+	}, nil
+}
+
+// newSender 生成进程的序号标识（随机数不可用时退回到启动时间）
+func newSender() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id)
+}
+
+// clockSkewTolerance 允许的时钟偏差
+func (c *Client) clockSkewTolerance() time.Duration {
+	if c.cfg.ClockSkewTolerance > 0 {
+		return c.cfg.ClockSkewTolerance
+	}
+	return DefaultClockSkewTolerance
+}
+
+// checkResponseFreshness 校验响应是否对应本次请求（旧服务器不返回这些字段时跳过）
+func (c *Client) checkResponseFreshness(sent, received Freshness) error {
+	if received.Nonce != "" && received.Nonce != sent.Nonce {
+		return fmt.Errorf("response nonce does not match request")
+	}
+	if received.Timestamp != 0 {
+		if err := received.CheckSkew(time.Now(), c.clockSkewTolerance()); err != nil {
+			return fmt.Errorf("stale response: %w", err)
+		}
+	}
+	return nil
+}
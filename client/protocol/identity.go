@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// 标识哈希的用途（不同用途的哈希互不相关）
+const (
+	identityMachineID  = "sqlbots-machine-id"
+	identityInstanceID = "sqlbots-instance-id"
+	identityHostname   = "sqlbots-hostname"
+)
+
+// redactedHostnameLength 脱敏主机名中哈希部分的长度（十六进制字符）
+const redactedHostnameLength = 12
+
+// HashMachineID 计算发送给服务器的机器 ID：以原始机器 ID 为密钥，对租户（API Key 的哈希）做 HMAC-SHA256，
+// 与 machineid.ProtectedID 的构造相同。不同租户看到的 ID 互不相关，服务器也无法还原原始机器 ID；
+// 服务器可以用保存的原始 ID 计算同样的值，从而把旧记录迁移到哈希 ID
+func HashMachineID(rawID, apiKey string) string {
+	return identityHMAC(rawID, identityMachineID, apiKey, "")
+}
+
+// HashInstanceID 按租户哈希实例 ID（与机器 ID 使用同样的构造）
+func HashInstanceID(instanceID, apiKey string) string {
+	return identityHMAC(instanceID, identityInstanceID, apiKey, "")
+}
+
+// RedactHostname 返回脱敏的主机名（host- 加哈希），以原始机器 ID 为密钥，服务器无法通过字典还原主机名
+func RedactHostname(hostname, rawID, apiKey string) string {
+	return "host-" + identityHMAC(rawID, identityHostname, apiKey, hostname)[:redactedHostnameLength]
+}
+
+// identityHMAC HMAC-SHA256(key, purpose || 0 || sha256(apiKey) || 0 || value)
+func identityHMAC(key, purpose, apiKey, value string) string {
+	tenant := sha256.Sum256([]byte(apiKey))
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose + "\x00" + hex.EncodeToString(tenant[:]) + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"context"
+
+	"sqlbots-client/retry"
+)
+
+// WithRetryPolicy 为指定接口设置重试策略（覆盖配置中的策略）
+func WithRetryPolicy(path string, policy retry.Policy) Option {
+	return func(c *Client) {
+		c.policies[path] = policy
+	}
+}
+
+// WithoutRetry 关闭所有接口的重试和熔断
+func WithoutRetry() Option {
+	return func(c *Client) {
+		c.noRetry = true
+	}
+}
+
+// initRetryers 为每个接口创建重试器（每个接口使用独立的熔断器）
+func (c *Client) initRetryers() {
+	c.retryers = make(map[string]*retry.Retryer)
+	for _, path := range []string{PathKeyExchange, PathHeartbeat} {
+		if c.noRetry {
+			c.retryers[path] = retry.New(retry.NoRetry(), nil)
+			continue
+		}
+
+		policy, ok := c.policies[path]
+		if !ok {
+			policy = retry.DefaultPolicy()
+			if c.cfg.RetryMaxElapsed > 0 {
+				policy.MaxElapsedTime = c.cfg.RetryMaxElapsed
+			}
+		}
+		c.retryers[path] = retry.New(policy, retry.NewBreaker(c.cfg.CircuitBreakerThreshold, c.cfg.CircuitBreakerCooldown))
+	}
+}
+
+// withRetry 按接口的重试策略执行 fn
+func (c *Client) withRetry(ctx context.Context, path string, fn func(ctx context.Context) error) error {
+	retryer, ok := c.retryers[path]
+	if !ok {
+		return fn(ctx)
+	}
+	return retryer.Do(ctx, fn)
+}
+
+// BreakerState 返回指定接口的熔断器状态
+func (c *Client) BreakerState(path string) retry.State {
+	if retryer, ok := c.retryers[path]; ok && retryer.Breaker() != nil {
+		return retryer.Breaker().State()
+	}
+	return retry.StateClosed
+}
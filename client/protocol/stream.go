@@ -0,0 +1,323 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+)
+
+// PathStream 推送连接（Server-Sent Events）
+const PathStream = "/stream"
+
+// 打开推送连接时的认证请求头：时间戳和 nonce 防止重放，签名使用与加密请求相同的密钥（见 StreamSignatureFields）
+const (
+	HeaderAPIKey    = "X-SQLBots-Key"
+	HeaderSessionID = "X-SQLBots-Session"
+	HeaderTimestamp = "X-SQLBots-Timestamp"
+	HeaderNonce     = "X-SQLBots-Nonce"
+	HeaderSignature = "X-SQLBots-Signature"
+)
+
+// 服务器推送的事件（事件本身不携带数据，客户端收到后通过加密的心跳获取最新状态）
+const (
+	EventReady    = "ready"    // 连接建立后的第一个事件，数据为连接 ID
+	EventCommands = "commands" // 有新的指令
+	EventLicense  = "license"  // 许可证状态发生变化（例如被吊销或过期）
+)
+
+// StreamPingInterval 服务器发送注释行（ping）的间隔，客户端超过 StreamReadTimeout 没有收到任何数据时认为连接已断开
+const (
+	StreamPingInterval = 30 * time.Second
+	StreamReadTimeout  = 2*StreamPingInterval + 10*time.Second
+)
+
+// maxStreamLine 推送连接上一行的最大长度
+const maxStreamLine = 4096
+
+// ErrStreamClosed 推送连接已断开
+var ErrStreamClosed = errors.New("push stream closed")
+
+// Stream 与服务器的推送连接
+//
+// 连接通过客户端的 HTTP 客户端建立（与其他请求使用相同的代理、TLS 配置和连接池），请求用当前会话密钥签名。
+// 连接期间心跳仍然通过 POST /heartbeat 发送，并在签名的请求体中带上连接 ID；服务器在第一次心跳成功后才会推送事件。
+// 连接断开时自动从客户端上摘除，之后的心跳不再带连接 ID
+//
+// Server-Sent Events 只能由服务器发往客户端，因此推送连接只传递不带数据的提醒事件，不传递心跳、许可证或指令：
+// 这些数据只通过心跳传输，与轮询共用同一套加密、签名、重放保护和指令确认流程，连接上没有需要单独加密的内容。
+// 收到事件后立即发送一次心跳，延迟只多一次请求往返
+type Stream struct {
+	client *Client
+	id     string
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	events chan string
+
+	readTimeout time.Duration
+
+	mu       sync.Mutex
+	watchdog *time.Timer // 超过 readTimeout 没有收到数据时断开连接
+	closed   bool
+	err      error
+	done     chan struct{}
+}
+
+// OpenStream 连接服务器的推送接口，成功后心跳带上连接 ID
+//
+// ctx 只用于建立连接，连接建立后一直保持到 Close 或断开
+func (c *Client) OpenStream(ctx context.Context) (*Stream, error) {
+	return c.openStream(ctx, StreamReadTimeout)
+}
+
+// openStream 建立推送连接，超过 readTimeout 没有收到任何数据时断开
+func (c *Client) openStream(ctx context.Context, readTimeout time.Duration) (*Stream, error) {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	stopConnect := context.AfterFunc(ctx, cancel)
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, c.url(PathStream), nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if err := c.signStreamRequest(ctx, req); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := c.streamHTTPClient().Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, apperrors.Network(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		cancel()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, apperrors.New(resp.StatusCode, "", http.StatusText(resp.StatusCode))
+		}
+		return nil, fmt.Errorf("server does not support push streams (HTTP %d, %s)", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s := &Stream{
+		client:      c,
+		body:        resp.Body,
+		cancel:      cancel,
+		events:      make(chan string, 8),
+		readTimeout: readTimeout,
+		done:        make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.watchdog = time.AfterFunc(readTimeout, func() {
+		s.shutdown(fmt.Errorf("no data from the server for %s", readTimeout))
+	})
+	s.mu.Unlock()
+
+	// 第一个事件是连接 ID
+	reader := newEventReader(resp.Body)
+	event, data, err := s.next(reader)
+	if err == nil && (event != EventReady || data == "") {
+		err = fmt.Errorf("unexpected first event %q", event)
+	}
+	if !stopConnect() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		s.shutdown(err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, apperrors.Network(fmt.Errorf("failed to open push stream: %w", err))
+	}
+	s.id = data
+
+	go s.readLoop(reader)
+
+	if previous := c.stream.Swap(s); previous != nil {
+		previous.Close()
+	}
+	return s, nil
+}
+
+// signStreamRequest 为打开推送连接的请求添加认证头（会话密钥即将过期时先交换密钥）
+func (c *Client) signStreamRequest(ctx context.Context, req *http.Request) error {
+	if err := c.ensureSession(ctx); err != nil {
+		return err
+	}
+	fresh, err := c.nextFreshness()
+	if err != nil {
+		return err
+	}
+
+	key, sessionID, _ := c.encryptionKey()
+	timestamp := strconv.FormatInt(fresh.Timestamp, 10)
+	req.Header.Set(HeaderAPIKey, c.cfg.APIKey)
+	if sessionID != "" {
+		req.Header.Set(HeaderSessionID, sessionID)
+	}
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, fresh.Nonce)
+	req.Header.Set(HeaderSignature, encryption.Sign(key, StreamSignatureFields(c.cfg.APIKey, sessionID, timestamp, fresh.Nonce)...))
+	return nil
+}
+
+// StreamSignatureFields 打开推送连接的签名覆盖的字段（客户端和服务器必须使用相同的顺序）
+func StreamSignatureFields(apiKey, sessionID, timestamp, nonce string) []string {
+	return []string{PathStream, apiKey, sessionID, timestamp, nonce}
+}
+
+// streamHTTPClient 推送连接使用的 HTTP 客户端：与其他请求相同，但没有整体超时（连接由读取超时判断是否断开）
+func (c *Client) streamHTTPClient() *http.Client {
+	client := *c.httpClient
+	client.Timeout = 0
+	return &client
+}
+
+// ID 服务器分配的连接 ID
+func (s *Stream) ID() string {
+	return s.id
+}
+
+// Events 服务器推送的事件
+func (s *Stream) Events() <-chan string {
+	return s.events
+}
+
+// Done 连接断开时关闭
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 连接断开的原因
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close 关闭连接（心跳不再带连接 ID）
+func (s *Stream) Close() error {
+	s.shutdown(ErrStreamClosed)
+	return nil
+}
+
+// readLoop 读取服务器事件放入事件队列（队列满时丢弃，事件只是提醒）
+func (s *Stream) readLoop(reader *eventReader) {
+	for {
+		event, _, err := s.next(reader)
+		if err != nil {
+			s.shutdown(err)
+			return
+		}
+		select {
+		case s.events <- event:
+		default:
+		}
+	}
+}
+
+// next 读取下一个事件，收到任何数据（包括 ping）时重置读取超时
+func (s *Stream) next(reader *eventReader) (string, string, error) {
+	for {
+		line, err := reader.readLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrStreamClosed
+			}
+			return "", "", err
+		}
+		s.watchdog.Reset(s.readTimeout)
+		if event, data, ok := reader.parse(line); ok {
+			return event, data, nil
+		}
+	}
+}
+
+// shutdown 标记连接已断开、关闭响应体并从客户端摘除
+func (s *Stream) shutdown(err error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.err = err
+	watchdog := s.watchdog
+	s.mu.Unlock()
+
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	s.cancel()
+	_ = s.body.Close()
+	s.client.stream.CompareAndSwap(s, nil)
+	close(s.done)
+}
+
+// eventReader 按 Server-Sent Events 格式读取事件
+//
+// 只处理 event 和 data 字段；以冒号开头的注释行是服务器的 ping
+type eventReader struct {
+	reader *bufio.Reader
+	event  string
+	data   []string
+}
+
+// newEventReader 创建事件读取器
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{reader: bufio.NewReaderSize(r, maxStreamLine)}
+}
+
+// readLine 读取一行（去掉行尾的 \n 或 \r\n），超过 maxStreamLine 的行视为错误
+func (r *eventReader) readLine() (string, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("push stream line longer than %d bytes", maxStreamLine)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// parse 处理一行，空行结束一个事件时返回事件类型和数据
+func (r *eventReader) parse(line string) (string, string, bool) {
+	if line == "" {
+		if r.event == "" && len(r.data) == 0 {
+			return "", "", false
+		}
+		event, data := r.event, strings.Join(r.data, "\n")
+		if event == "" {
+			event = "message"
+		}
+		r.event, r.data = "", nil
+		return event, data, true
+	}
+	if strings.HasPrefix(line, ":") {
+		return "", "", false
+	}
+
+	name, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+	switch name {
+	case "event":
+		r.event = value
+	case "data":
+		r.data = append(r.data, value)
+	}
+	return "", "", false
+}
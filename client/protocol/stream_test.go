@@ -0,0 +1,214 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+)
+
+// newEventServer 启动一个推送接口，按顺序写入 frames 后保持连接直到 release 关闭
+func newEventServer(t *testing.T, frames ...string) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PathStream || r.Header.Get("Accept") != "text/event-stream" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, frame := range frames {
+			fmt.Fprint(w, frame)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		server.Close()
+	})
+	return server, release
+}
+
+// waitEvent 等待下一个事件
+func waitEvent(t *testing.T, s *Stream) string {
+	t.Helper()
+	select {
+	case event := <-s.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return ""
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	server, release := newEventServer(t,
+		"event: ready\ndata: stream-1\n\n",
+		": ping\n\n",
+		"event: commands\r\ndata:\r\n\r\n",
+		"event: license\ndata: first\ndata: second\n\n",
+	)
+	client := NewClient(&config.Config{ServerURL: server.URL}, nil)
+
+	s, err := client.OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID() != "stream-1" || client.stream.Load() != s {
+		t.Fatalf("stream id %q, attached %v", s.ID(), client.stream.Load() == s)
+	}
+	for _, want := range []string{EventCommands, EventLicense} {
+		if got := waitEvent(t, s); got != want {
+			t.Fatalf("event: got %q, want %q", got, want)
+		}
+	}
+
+	// 服务器关闭连接后从客户端摘除
+	close(release)
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not closed after the server ended it")
+	}
+	if !errors.Is(s.Err(), ErrStreamClosed) || client.stream.Load() != nil {
+		t.Fatalf("after close: err %v, attached %v", s.Err(), client.stream.Load() != nil)
+	}
+}
+
+func TestStreamReadTimeout(t *testing.T) {
+	server, _ := newEventServer(t, "event: ready\ndata: stream-1\n\n")
+	client := NewClient(&config.Config{ServerURL: server.URL}, nil)
+
+	s, err := client.openStream(context.Background(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("silent stream not closed")
+	}
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "no data") {
+		t.Fatalf("got %v, want a read timeout", err)
+	}
+}
+
+func TestOpenStreamRejectsUnsupportedServer(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"not found": http.NotFound,
+		"not an event stream": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		},
+		"missing ready event": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: commands\ndata:\n\n")
+		},
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			client := NewClient(&config.Config{ServerURL: server.URL}, nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if s, err := client.OpenStream(ctx); err == nil {
+				s.Close()
+				t.Fatal("stream opened")
+			}
+			if client.stream.Load() != nil {
+				t.Fatal("failed stream attached to the client")
+			}
+		})
+	}
+}
+
+// 打开推送连接的请求用当前密钥签名，带上时间戳和 nonce
+func TestOpenStreamSignsRequest(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ready\ndata: stream-1\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{ServerURL: server.URL, APIKey: "api-key", EncryptionKey: "initial-key"}, nil)
+	s, err := client.OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	req := <-requests
+	timestamp, nonce := req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderNonce)
+	if req.Header.Get(HeaderAPIKey) != "api-key" || req.Header.Get(HeaderSessionID) != "" || timestamp == "" || nonce == "" {
+		t.Fatalf("authentication headers: %v", req.Header)
+	}
+	if !encryption.Verify("initial-key", req.Header.Get(HeaderSignature), StreamSignatureFields("api-key", "", timestamp, nonce)...) {
+		t.Fatal("invalid stream signature")
+	}
+}
+
+// 推送连接使用客户端的 HTTP 客户端，与其他请求经过相同的代理
+func TestStreamUsesHTTPClientProxy(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ready\ndata: via-proxy\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := NewClient(&config.Config{ServerURL: "http://api.invalid"}, nil, WithHTTPClient(&http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}))
+	s, err := client.OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// HTTP 客户端的整体超时不适用于推送连接
+	time.Sleep(1500 * time.Millisecond)
+	select {
+	case <-s.Done():
+		t.Fatalf("stream closed by the HTTP client timeout: %v", s.Err())
+	default:
+	}
+
+	req := <-requests
+	if req.URL.String() != "http://api.invalid/stream" || s.ID() != "via-proxy" {
+		t.Fatalf("proxy request %s, stream id %q", req.URL, s.ID())
+	}
+}
+
+func TestEventReaderRejectsLongLines(t *testing.T) {
+	reader := newEventReader(strings.NewReader("data: " + strings.Repeat("x", maxStreamLine) + "\n"))
+	if _, err := reader.readLine(); err == nil {
+		t.Fatal("oversized line accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package protocol
+
+import (
+	"time"
+
+	"sqlbots-client/fingerprint"
+)
+
+// 接口路径
+const (
+	PathKeyExchange = "/key-exchange"
+	PathHeartbeat   = "/heartbeat"
+	PathHealth      = "/health"
+)
+
+// 服务器在密钥交换响应的 features 中声明的可选功能
+const (
+	// FeatureDryRun 支持试运行心跳（dry_run）：只检查机器和许可证，不注册或更新机器
+	FeatureDryRun = "dry_run"
+)
+
+// KeyExchangeRequest 密钥交换请求
+type KeyExchangeRequest struct {
+	APIKey          string   `json:"API_KEY"`
+	Schemes         []string `json:"schemes,omitempty"`           // 客户端支持的加密方案（按优先级排序）
+	KeyAgreement    string   `json:"key_agreement,omitempty"`     // 密钥协商算法（x25519）
+	ClientPublicKey string   `json:"client_public_key,omitempty"` // 客户端临时公钥（base64）
+}
+
+// KeyExchangeResponse 密钥交换响应
+type KeyExchangeResponse struct {
+	StatusCode string `json:"status_code"`
+	SessionKey string `json:"session_key"`      // 加密的会话密钥
+	ExpiresIn  int    `json:"expires_in"`       // 过期时间（秒）
+	Username   string `json:"username"`         // 用户名
+	Scheme     string `json:"scheme,omitempty"` // 服务器选择的加密方案（旧服务器不返回，表示 legacy）
+	Message    string `json:"message,omitempty"`
+
+	// X25519 密钥协商（旧服务器不返回，此时 session_key 为加密的会话密钥）
+	KeyAgreement    string `json:"key_agreement,omitempty"`
+	SessionID       string `json:"session_id,omitempty"`        // 会话 ID，后续请求需要携带
+	ServerPublicKey string `json:"server_public_key,omitempty"` // 服务器临时公钥（base64）
+	KeyConfirmation string `json:"key_confirmation,omitempty"`  // 密钥确认值（base64）
+
+	// Features 服务器支持的可选功能（旧服务器不返回）
+	Features []string `json:"features,omitempty"`
+}
+
+// Supports 服务器是否声明支持指定的可选功能
+func (r *KeyExchangeResponse) Supports(feature string) bool {
+	for _, f := range r.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// HeartbeatPayload 心跳请求中加密的数据
+type HeartbeatPayload struct {
+	MachineID   string `json:"machine_id"`
+	MachineName string `json:"machine_name"`
+	RAM         int    `json:"ram"`
+	Cores       int    `json:"cores"`
+	DryRun      bool   `json:"dry_run,omitempty"` // 试运行：服务器只检查机器和许可证，不注册或更新机器（doctor 使用）
+
+	// MachineIDHashed machine_id 是 HashMachineID 计算的哈希 ID（旧客户端发送原始机器 ID）
+	MachineIDHashed bool `json:"machine_id_hashed,omitempty"`
+
+	// Fingerprint 硬件指纹（只包含哈希后的组件值），旧客户端不发送
+	Fingerprint fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+	// InstanceID 实例 ID（克隆的虚拟机和容器各不相同），旧客户端不发送
+	InstanceID string `json:"instance_id,omitempty"`
+	// Environment 运行环境：physical、vm 或 container
+	Environment string `json:"environment,omitempty"`
+	// Platform 虚拟化或容器平台，例如 kvm、docker、kubernetes
+	Platform string `json:"platform,omitempty"`
+
+	// Telemetry 上次心跳以来的系统遥测数据（未开启遥测时为空）
+	Telemetry *Telemetry `json:"telemetry,omitempty"`
+	// Metrics 自定义采集器最近一次的结果（未配置采集器时为空）
+	Metrics []CollectorResult `json:"metrics,omitempty"`
+	// Workloads 托管进程的状态和资源占用（未配置托管进程时为空）
+	Workloads []WorkloadStatus `json:"workloads,omitempty"`
+	// CommandResults 上次心跳以来执行完的指令结果（服务器收到后不再重发这些指令）
+	CommandResults []CommandResult `json:"command_results,omitempty"`
+
+	Freshness // 由协议客户端在发送时填写
+}
+
+// EncryptedRequest 加密请求体（业务数据加密后放在 encrypted_data 中）
+type EncryptedRequest struct {
+	APIKey        string `json:"API_KEY"`
+	EncryptedData string `json:"encrypted_data"`
+	UseSessionKey bool   `json:"use_session_key"`
+	Scheme        string `json:"scheme,omitempty"`     // encrypted_data 使用的加密方案
+	SessionID     string `json:"session_id,omitempty"` // X25519 密钥协商得到的会话 ID
+	Signature     string `json:"signature,omitempty"`  // 请求签名（HMAC-SHA256，见 SignatureFields）
+	StreamID      string `json:"stream_id,omitempty"`  // 推送连接 ID（只用于心跳）
+}
+
+// HeartbeatRequest 心跳请求体
+type HeartbeatRequest = EncryptedRequest
+
+// LicenseInfo 许可证信息
+type LicenseInfo struct {
+	ExpiresAt string `json:"expires_at"`
+	PlanType  string `json:"plan_type"`
+}
+
+// ParseTime 解析服务器使用的时间字符串（兼容 RFC3339 和 Postgres 的时间格式，例如 expires_at）
+func ParseTime(value string) (time.Time, error) {
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02",
+	}
+
+	var lastErr error
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// MachineInfo 服务器登记的机器信息
+type MachineInfo struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	RegisteredAt string `json:"registered_at"`
+}
+
+// HeartbeatResponse 心跳响应（解密后）
+type HeartbeatResponse struct {
+	StatusCode  string      `json:"status_code"`
+	LicenseInfo LicenseInfo `json:"license_info"`
+	MachineInfo MachineInfo `json:"machine_info"`
+	Message     string      `json:"message,omitempty"`
+	// Commands 服务器下发的已签名指令（旧服务器不发送）
+	Commands []Command `json:"commands,omitempty"`
+
+	Freshness // 服务器时间戳和原样返回的请求 nonce
+}
+
+// Stat 一段时间内采样值的最小值、平均值和最大值
+type Stat struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// DiskUsage 挂载点的磁盘使用情况（发送心跳时读取）
+type DiskUsage struct {
+	Mount       string  `json:"mount"`
+	FSType      string  `json:"fstype,omitempty"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Telemetry 两次心跳之间的系统遥测数据（读取失败的指标为空）
+type Telemetry struct {
+	From    time.Time `json:"from"`    // 第一次采样时间
+	To      time.Time `json:"to"`      // 最后一次采样时间
+	Samples int       `json:"samples"` // 采样次数
+
+	CPUPercent    *Stat `json:"cpu_percent,omitempty"`
+	MemoryPercent *Stat `json:"memory_percent,omitempty"`
+	SwapPercent   *Stat `json:"swap_percent,omitempty"`
+	Load1         *Stat `json:"load1,omitempty"`
+	Load5         *Stat `json:"load5,omitempty"`
+	Load15        *Stat `json:"load15,omitempty"`
+	NetRxBytesSec *Stat `json:"net_rx_bytes_per_sec,omitempty"` // 所有网卡的接收速率
+	NetTxBytesSec *Stat `json:"net_tx_bytes_per_sec,omitempty"` // 所有网卡的发送速率
+
+	Disks         []DiskUsage `json:"disks,omitempty"`
+	UptimeSeconds uint64      `json:"uptime_seconds,omitempty"`
+}
+
+// Metric 采集器报告的一个指标
+type Metric struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"` // gauge 或 counter
+	Value  float64           `json:"value"`
+	Unit   string            `json:"unit,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CollectorResult 一个采集器最近一次采集的结果（失败时 Error 不为空，Metrics 为上一次成功的结果）
+type CollectorResult struct {
+	Collector   string    `json:"collector"`
+	CollectedAt time.Time `json:"collected_at"`
+	DurationMS  int64     `json:"duration_ms"`
+	Metrics     []Metric  `json:"metrics,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// WorkloadStatus 一个托管进程的状态
+//
+// CPUPercent 是上次上报以来的平均 CPU 占用（100 表示占满一个核心），RSSBytes 是当前常驻内存，只在运行中时有值
+type WorkloadStatus struct {
+	Name        string     `json:"name"`
+	State       string     `json:"state"`
+	PID         int        `json:"pid,omitempty"`
+	Restarts    int        `json:"restarts"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CPUPercent  float64    `json:"cpu_percent,omitempty"`
+	RSSBytes    uint64     `json:"rss_bytes,omitempty"`
+	Threads     int32      `json:"threads,omitempty"`
+	LastExit    string     `json:"last_exit,omitempty"`
+	LastExitAt  *time.Time `json:"last_exit_at,omitempty"`
+	NextStartAt *time.Time `json:"next_start_at,omitempty"`
+}
+
+// HealthResponse 健康检查响应
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// envelope 响应外层结构
+// 成功时只有 encrypted_data；服务器拒绝请求时（认证失败、解密失败等）返回明文的 status_code 和 message
+type envelope struct {
+	EncryptedData string `json:"encrypted_data,omitempty"`
+	StatusCode    string `json:"status_code,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
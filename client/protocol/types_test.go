@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"2026-03-01T12:30:00Z":      want,
+		"2026-03-01T12:30:00.000Z":  want,
+		"2026-03-01T14:30:00+02:00": want,
+		"2026-03-01T12:30:00":       want,
+		"2026-03-01 12:30:00+00:00": want,
+		"2026-03-01 12:30:00":       want,
+		"2026-03-01":                time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := ParseTime(value)
+		if err != nil {
+			t.Errorf("%s: %v", value, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", value, got, want)
+		}
+	}
+
+	if _, err := ParseTime("next tuesday"); err == nil {
+		t.Error("invalid time accepted")
+	}
+}
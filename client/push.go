@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/protocol"
+	"sqlbots-client/retry"
+	"sqlbots-client/ui"
+)
+
+const (
+	// pushConnectTimeout 建立推送连接的超时时间
+	pushConnectTimeout = 30 * time.Second
+	// pushStableAfter 连接保持超过此时长后重置重连退避（反复建立又断开的连接按失败退避）
+	pushStableAfter = time.Minute
+)
+
+// pushStream 推送连接：服务器推送事件时立即发送心跳（心跳带上连接 ID，服务器据此绑定连接）；
+// 断开后退避重连，重连之前只按间隔轮询
+type pushStream struct {
+	client    *protocol.Client
+	out       ui.Output
+	wake      chan struct{}
+	connected atomic.Bool
+}
+
+// startPushStream 在后台保持推送连接（没有开启 push 时返回 nil）
+func startPushStream(ctx context.Context, cfg *config.Config, out ui.Output, client *protocol.Client) *pushStream {
+	if !cfg.Push {
+		return nil
+	}
+	p := &pushStream{
+		client: client,
+		out:    out,
+		wake:   make(chan struct{}, 1),
+	}
+	go p.run(ctx)
+	return p
+}
+
+// Wake 需要立即发送心跳时收到通知（没有开启 push 时永远不会收到）
+func (p *pushStream) Wake() <-chan struct{} {
+	if p == nil {
+		return nil
+	}
+	return p.wake
+}
+
+// Connected 推送连接是否可用
+func (p *pushStream) Connected() bool {
+	return p != nil && p.connected.Load()
+}
+
+// Trigger 推送连接可用时请求立即发送心跳（例如及时确认指令执行结果）
+func (p *pushStream) Trigger() {
+	if p.Connected() {
+		p.trigger()
+	}
+}
+
+// trigger 通知心跳循环立即发送心跳（已有通知未处理时合并）
+func (p *pushStream) trigger() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 连接、转发事件，连接失败或断开后按 1 秒起每次翻倍（最长 5 分钟）的间隔重连
+func (p *pushStream) run(ctx context.Context) {
+	backoff := retry.Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Minute,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+
+	failures := 0
+	for {
+		connectCtx, cancel := context.WithTimeout(ctx, pushConnectTimeout)
+		stream, err := p.client.OpenStream(connectCtx)
+		cancel()
+		if ctx.Err() != nil {
+			if stream != nil {
+				stream.Close()
+			}
+			return
+		}
+
+		if err != nil {
+			if failures == 0 {
+				p.out.Info("push connection unavailable, using polling", "error", err)
+			}
+			failures++
+		} else {
+			connectedAt := time.Now()
+			p.connected.Store(true)
+			p.out.Info("push connection established")
+			// 立即发送心跳：服务器在第一次心跳后才推送事件，同时取回断开期间的变化
+			p.trigger()
+
+			p.forward(ctx, stream)
+			p.connected.Store(false)
+			if ctx.Err() != nil {
+				return
+			}
+			p.out.Info("push connection lost, using polling until it reconnects", "error", stream.Err())
+			if time.Since(connectedAt) >= pushStableAfter {
+				failures = 0
+			} else {
+				failures++
+			}
+		}
+
+		// 连接断开后的第一次重连也等待最短间隔，避免服务器刚关闭时立即重连
+		wait := backoff.Interval(1)
+		if failures > 0 {
+			wait = backoff.Interval(failures)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// forward 把服务器推送的事件转为立即发送心跳的通知，直到连接断开或 ctx 结束
+func (p *pushStream) forward(ctx context.Context, stream *protocol.Stream) {
+	for {
+		select {
+		case event := <-stream.Events():
+			p.out.Info("push event received", "event", event)
+			p.trigger()
+		case <-stream.Done():
+			return
+		case <-ctx.Done():
+			stream.Close()
+			return
+		}
+	}
+}
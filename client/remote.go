@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"sqlbots-client/config"
+	"sqlbots-client/diagnostics"
+	"sqlbots-client/dispatch"
+	"sqlbots-client/encryption"
+	"sqlbots-client/hardware"
+	"sqlbots-client/keyexchange"
+	"sqlbots-client/protocol"
+	"sqlbots-client/supervisor"
+	"sqlbots-client/ui"
+)
+
+// remoteCommands 服务器指令处理函数使用的运行状态
+type remoteCommands struct {
+	running     *config.Config                 // 启动时的配置（其他组件使用的配置）
+	reload      func() (*config.Config, error) // 用启动时的参数重新读取配置
+	client      *protocol.Client
+	machineInfo *hardware.MachineInfo
+	workloads   *supervisor.Supervisor
+	deregister  chan struct{} // deregister 执行成功后通知心跳循环
+
+	mu      sync.Mutex
+	current *config.Config // 最近一次读取的配置（诊断使用）
+	push    *pushStream    // 推送连接（没有开启时为 nil）
+}
+
+// setPush 设置推送连接，之后指令执行结果通过推送连接立即确认
+func (rc *remoteCommands) setPush(push *pushStream) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.push = push
+}
+
+// newCommandDispatcher 创建服务器指令分发器（没有配置 command_public_key 时所有指令都被拒绝）
+func newCommandDispatcher(cfg *config.Config, out ui.Output, rc *remoteCommands) (*dispatch.Dispatcher, error) {
+	var publicKey ed25519.PublicKey
+	if cfg.CommandPublicKey != "" {
+		var err error
+		if publicKey, err = encryption.ParseEd25519PublicKey(cfg.CommandPublicKey); err != nil {
+			return nil, fmt.Errorf("command_public_key: %w", err)
+		}
+	}
+
+	dispatcher, err := dispatch.NewDispatcher(dispatch.Options{
+		PublicKey:  publicKey,
+		MachineID:  rc.machineInfo.MachineID,
+		InstanceID: rc.machineInfo.InstanceID,
+		Allowed:    cfg.AllowedCommands,
+		OnResult: func(result protocol.CommandResult) {
+			logCommandResult(out, result)
+			if result.Type == protocol.CommandDeregister && result.Status == protocol.CommandSucceeded {
+				select {
+				case rc.deregister <- struct{}{}:
+				default:
+				}
+				return
+			}
+
+			// 推送连接可用时立即发送心跳确认结果，不用等到下一次轮询
+			rc.mu.Lock()
+			push := rc.push
+			rc.mu.Unlock()
+			push.Trigger()
+		},
+	}, map[string]dispatch.Handler{
+		protocol.CommandRefreshConfig:      rc.refreshConfig,
+		protocol.CommandRotateKeys:         rc.rotateKeys,
+		protocol.CommandRestartWorkload:    rc.restartWorkload,
+		protocol.CommandCollectDiagnostics: rc.collectDiagnostics,
+		protocol.CommandDeregister:         rc.deregisterMachine,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("allowed_commands: %w", err)
+	}
+	return dispatcher, nil
+}
+
+// logCommandResult 输出指令执行结果（失败和被拒绝的指令显示警告）
+func logCommandResult(out ui.Output, result protocol.CommandResult) {
+	switch result.Status {
+	case protocol.CommandSucceeded:
+		out.Info("server command executed", "command", result.Type, "id", result.ID)
+	case protocol.CommandRejected:
+		out.Warning(fmt.Sprintf("Rejected server command %s", result.Type), "command", result.Type, "id", result.ID, "error", result.Error)
+	default:
+		out.Warning(fmt.Sprintf("Server command %s failed", result.Type), "command", result.Type, "id", result.ID, "error", result.Error)
+	}
+}
+
+// refreshConfig 重新读取配置并重新加载托管进程，其他配置项的变化在重启后生效
+func (rc *remoteCommands) refreshConfig(ctx context.Context, cmd protocol.Command) (string, error) {
+	cfg, err := rc.reload()
+	if err != nil {
+		return "", fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	var workloads []supervisor.Workload
+	if cfg.WorkloadsFile != "" {
+		if workloads, err = supervisor.LoadFile(cfg.WorkloadsFile); err != nil {
+			return "", err
+		}
+	}
+	result, err := rc.workloads.Reload(workloads)
+	if err != nil {
+		return "", fmt.Errorf("failed to reload workloads: %w", err)
+	}
+
+	rc.mu.Lock()
+	rc.current = cfg
+	rc.mu.Unlock()
+
+	var lines []string
+	if len(result.Started) > 0 {
+		lines = append(lines, "workloads started: "+strings.Join(result.Started, ", "))
+	}
+	if len(result.Stopped) > 0 {
+		lines = append(lines, "workloads stopped: "+strings.Join(result.Stopped, ", "))
+	}
+	if len(result.Unchanged) > 0 {
+		lines = append(lines, "workloads unchanged: "+strings.Join(result.Unchanged, ", "))
+	}
+
+	var pending []string
+	for _, key := range config.Changed(rc.running, cfg) {
+		if key != "workloads_file" {
+			pending = append(pending, key)
+		}
+	}
+	if len(pending) > 0 {
+		lines = append(lines, "restart required to apply: "+strings.Join(pending, ", "))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "configuration unchanged")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// rotateKeys 作废当前会话密钥并重新交换
+func (rc *remoteCommands) rotateKeys(ctx context.Context, cmd protocol.Command) (string, error) {
+	sessions := rc.client.Sessions()
+	if sessions == nil {
+		return "", fmt.Errorf("session keys are not used")
+	}
+
+	sessions.Invalidate(sessions.Generation())
+	if _, err := keyexchange.Exchange(ctx, rc.client); err != nil {
+		return "", fmt.Errorf("failed to exchange key: %w", err)
+	}
+	return fmt.Sprintf("session key rotated (generation %d)", sessions.Generation()), nil
+}
+
+// restartWorkload 重启指定的托管进程（参数 name）
+func (rc *remoteCommands) restartWorkload(ctx context.Context, cmd protocol.Command) (string, error) {
+	name := cmd.Args["name"]
+	if name == "" {
+		return "", fmt.Errorf("argument name is required")
+	}
+	if err := rc.workloads.Restart(name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("workload %s restarting", name), nil
+}
+
+// collectDiagnostics 用运行中的客户端执行 doctor 检查，返回 JSON 报告
+func (rc *remoteCommands) collectDiagnostics(ctx context.Context, cmd protocol.Command) (string, error) {
+	rc.mu.Lock()
+	cfg := rc.current
+	rc.mu.Unlock()
+
+	report := diagnostics.Run(ctx, cfg, diagnostics.Options{MachineInfo: rc.machineInfo, Client: rc.client})
+	data, err := json.Marshal(struct {
+		*diagnostics.Report
+		OK bool `json:"ok"`
+	}{report, report.OK()})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+	return string(data), nil
+}
+
+// deregisterMachine 停止所有托管进程，结果确认后心跳循环清除许可证状态并退出
+func (rc *remoteCommands) deregisterMachine(ctx context.Context, cmd protocol.Command) (string, error) {
+	rc.workloads.Stop()
+	return "workloads stopped, machine deregistered", nil
+}
@@ -0,0 +1,122 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+)
+
+// ErrCircuitOpen 熔断器已打开，暂时不再向服务器发送请求
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	// DefaultFailureThreshold 默认连续失败多少次后打开熔断器
+	DefaultFailureThreshold = 5
+	// DefaultCooldown 默认熔断器打开后多久允许试探请求
+	DefaultCooldown = 30 * time.Second
+)
+
+// State 熔断器状态
+type State int
+
+const (
+	// StateClosed 正常状态，允许所有请求
+	StateClosed State = iota
+	// StateOpen 打开状态，拒绝所有请求
+	StateOpen
+	// StateHalfOpen 半开状态，只允许一个试探请求
+	StateHalfOpen
+)
+
+// String 返回状态名称
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker 熔断器：连续失败达到阈值后打开，冷却时间过后允许一个试探请求
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	probing   bool // 半开状态下是否已经有试探请求在进行
+}
+
+// NewBreaker 创建熔断器（参数为 0 时使用默认值）
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow 检查是否允许发送请求
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record 记录请求结果（只有可重试的错误才算失败，服务器明确拒绝的请求说明服务器可用）
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil || !apperrors.IsRetryable(err) {
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// State 返回当前状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
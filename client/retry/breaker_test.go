@@ -0,0 +1,53 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b := NewBreaker(3, 20*time.Millisecond)
+
+	// 服务器明确拒绝的请求不算失败
+	for i := 0; i < 5; i++ {
+		b.Record(errFatal)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("after fatal errors: %s", b.State())
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("allow %d: %v", i, err)
+		}
+		b.Record(errNetwork)
+	}
+	if b.State() != StateOpen || !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Fatalf("after threshold failures: %s", b.State())
+	}
+
+	// 冷却后只允许一个试探请求
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Fatal("second request allowed while probing")
+	}
+
+	// 试探失败立即重新打开
+	b.Record(errServer)
+	if b.State() != StateOpen {
+		t.Fatalf("after failed probe: %s", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	b.Record(nil)
+	if b.State() != StateClosed || b.Allow() != nil {
+		t.Fatalf("after successful probe: %s", b.State())
+	}
+}
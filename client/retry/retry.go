@@ -0,0 +1,144 @@
+// Package retry 提供指数退避重试策略和熔断器
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+)
+
+// Policy 重试策略
+type Policy struct {
+	InitialInterval time.Duration // 首次重试前的等待时间
+	MaxInterval     time.Duration // 单次等待时间上限
+	Multiplier      float64       // 每次失败后等待时间的倍数
+	Jitter          float64       // 随机抖动比例（0 到 1 之间，0.2 表示 ±20%）
+	MaxElapsedTime  time.Duration // 从第一次尝试开始的总时长上限（为 0 时不限制）
+	MaxAttempts     int           // 最大尝试次数（包括第一次，为 0 时不限制）
+}
+
+// DefaultPolicy 默认重试策略：1 秒起，每次翻倍，最长 30 秒，总时长不超过 2 分钟
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  2 * time.Minute,
+	}
+}
+
+// NoRetry 不重试的策略
+func NoRetry() Policy {
+	return Policy{MaxAttempts: 1}
+}
+
+// withDefaults 补全未设置的字段
+func (p Policy) withDefaults() Policy {
+	defaults := DefaultPolicy()
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = defaults.InitialInterval
+	}
+	if p.MaxInterval < p.InitialInterval {
+		p.MaxInterval = p.InitialInterval
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaults.Multiplier
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+// interval 计算第 attempt 次失败后的等待时间（attempt 从 1 开始）
+func (p Policy) interval(attempt int) time.Duration {
+	interval := float64(p.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		interval *= p.Multiplier
+		if interval >= float64(p.MaxInterval) {
+			interval = float64(p.MaxInterval)
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		// 在 [interval*(1-jitter), interval*(1+jitter)] 范围内随机
+		interval *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(interval)
+}
+
+// Interval 返回第 attempt 次失败后的等待时间（attempt 从 1 开始，未设置的字段使用默认值）
+func (p Policy) Interval(attempt int) time.Duration {
+	return p.withDefaults().interval(attempt)
+}
+
+// Retryer 组合重试策略和熔断器（可以在多次调用之间共享）
+type Retryer struct {
+	policy  Policy
+	breaker *Breaker
+}
+
+// New 创建重试器（breaker 为 nil 时不使用熔断）
+func New(policy Policy, breaker *Breaker) *Retryer {
+	return &Retryer{
+		policy:  policy.withDefaults(),
+		breaker: breaker,
+	}
+}
+
+// Breaker 返回熔断器
+func (r *Retryer) Breaker() *Breaker {
+	return r.breaker
+}
+
+// Do 执行 fn，遇到可重试错误（服务器临时错误或网络错误）时按策略退避重试
+//
+// 致命错误、需要重新认证的错误和未知错误直接返回；熔断器打开时返回 ErrCircuitOpen
+func (r *Retryer) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	start := time.Now()
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil {
+			if err := r.breaker.Allow(); err != nil {
+				// 重试过程中熔断器打开时返回最后一次的真实错误
+				if lastErr != nil {
+					return lastErr
+				}
+				return err
+			}
+		}
+
+		err := fn(ctx)
+		lastErr = err
+		if r.breaker != nil {
+			r.breaker.Record(err)
+		}
+		if err == nil || !apperrors.IsRetryable(err) {
+			return err
+		}
+
+		if r.policy.MaxAttempts > 0 && attempt >= r.policy.MaxAttempts {
+			return err
+		}
+
+		wait := r.policy.interval(attempt)
+		if r.policy.MaxElapsedTime > 0 && time.Since(start)+wait > r.policy.MaxElapsedTime {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+)
+
+// fastPolicy 测试用的短间隔策略
+func fastPolicy(attempts int) Policy {
+	return Policy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 2, MaxAttempts: attempts}
+}
+
+var (
+	errServer  = apperrors.New(http.StatusInternalServerError, apperrors.CodeServerError, "")
+	errFatal   = apperrors.New(http.StatusForbidden, apperrors.CodeLicenseExpired, "")
+	errReauth  = apperrors.New(http.StatusBadRequest, apperrors.CodeDecryptionFailed, "")
+	errNetwork = apperrors.Network(errors.New("connection refused"))
+)
+
+func TestIntervalBackoff(t *testing.T) {
+	p := Policy{InitialInterval: time.Second, MaxInterval: 10 * time.Second, Multiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := p.Interval(i + 1); got != w {
+			t.Errorf("attempt %d: got %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestIntervalJitter(t *testing.T) {
+	p := Policy{InitialInterval: time.Second, MaxInterval: time.Second, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if got := p.Interval(1); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("interval %s outside ±20%%", got)
+		}
+	}
+}
+
+func TestDoRetriesOnlyRetryableErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"server error", errServer, 3},
+		{"network error", errNetwork, 3},
+		{"fatal error", errFatal, 1},
+		{"reauthenticate", errReauth, 1},
+		{"unknown error", errors.New("boom"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := New(fastPolicy(3), nil).Do(context.Background(), func(context.Context) error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+			if calls != tt.calls {
+				t.Errorf("calls: got %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoSucceedsAfterRetry(t *testing.T) {
+	calls := 0
+	err := New(fastPolicy(5), nil).Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errServer
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestDoStopsWhenContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{InitialInterval: time.Hour, MaxInterval: time.Hour}
+	calls := 0
+	err := New(policy, nil).Do(ctx, func(context.Context) error {
+		calls++
+		cancel()
+		return errServer
+	})
+	if !errors.Is(err, errServer) || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestDoRespectsMaxElapsedTime(t *testing.T) {
+	policy := Policy{InitialInterval: time.Hour, MaxInterval: time.Hour, MaxElapsedTime: time.Minute}
+	calls := 0
+	start := time.Now()
+	_ = New(policy, nil).Do(context.Background(), func(context.Context) error {
+		calls++
+		return errServer
+	})
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("%d calls in %s", calls, time.Since(start))
+	}
+}
+
+func TestDoWithOpenBreaker(t *testing.T) {
+	b := NewBreaker(2, time.Hour)
+	r := New(fastPolicy(10), b)
+
+	calls := 0
+	err := r.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errNetwork
+	})
+	// 重试过程中熔断器打开时返回最后一次的真实错误
+	if !errors.Is(err, errNetwork) || calls != 2 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+
+	err = r.Do(context.Background(), func(context.Context) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Fatalf("open breaker: got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+const (
+	// PathAdminCommands 管理接口：向机器下发指令
+	PathAdminCommands = "/admin/commands"
+
+	// DefaultCommandTTL 指令默认有效期
+	DefaultCommandTTL = time.Hour
+	// MaxCommandTTL 指令最长有效期
+	MaxCommandTTL = protocol.MaxCommandTTL
+
+	maxCommandArgs = 16
+)
+
+// commandTypes 可以下发的指令类型
+var commandTypes = map[string]bool{
+	protocol.CommandRefreshConfig:      true,
+	protocol.CommandRotateKeys:         true,
+	protocol.CommandRestartWorkload:    true,
+	protocol.CommandCollectDiagnostics: true,
+	protocol.CommandDeregister:         true,
+}
+
+// ErrCommandsDisabled 服务器没有配置指令签名私钥
+var ErrCommandsDisabled = errors.New("commands are disabled (no command signing key)")
+
+// EnqueueCommand 为机器（machines 表的记录 ID）签名并保存一条指令，机器下一次心跳时下发
+//
+// 指令在客户端确认之前每次心跳都会重发，过期后不再下发；机器有推送连接时立即通知它发送心跳
+func (s *Server) EnqueueCommand(machineRecordID, commandType string, args map[string]string, ttl time.Duration) (*protocol.Command, error) {
+	if s.cfg.CommandKey == nil {
+		return nil, ErrCommandsDisabled
+	}
+	if !commandTypes[commandType] {
+		return nil, fmt.Errorf("unsupported command %q", commandType)
+	}
+	if len(args) > maxCommandArgs {
+		return nil, fmt.Errorf("too many command arguments (max %d)", maxCommandArgs)
+	}
+	if commandType == protocol.CommandRestartWorkload && args["name"] == "" {
+		return nil, fmt.Errorf("%s requires the name argument", commandType)
+	}
+	if ttl <= 0 {
+		ttl = DefaultCommandTTL
+	}
+	if ttl > MaxCommandTTL {
+		ttl = MaxCommandTTL
+	}
+
+	machine, err := s.store.FindMachineByID(machineRecordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find machine %s: %w", machineRecordID, err)
+	}
+
+	now := time.Now()
+	cmd := protocol.Command{
+		ID:         newRecordID(),
+		Type:       commandType,
+		Args:       args,
+		MachineID:  machine.MachineID,
+		InstanceID: machine.InstanceID,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(ttl).Unix(),
+	}
+	protocol.SignCommand(s.cfg.CommandKey, &cmd)
+
+	if err := s.store.CreateCommand(&CommandRecord{MachineRecordID: machine.ID, Command: cmd}); err != nil {
+		return nil, fmt.Errorf("failed to save command: %w", err)
+	}
+	s.logf("queued command %s (%s) for machine %s", cmd.ID, cmd.Type, machine.ID)
+	s.streams.notifyMachine(machine.ID, protocol.EventCommands)
+	return &cmd, nil
+}
+
+// exchangeCommands 保存心跳中确认的执行结果，返回还需要下发的指令
+//
+// 客户端确认 deregister 执行成功时删除机器记录（释放机器名额），返回 deregistered 为 true
+func (s *Server) exchangeCommands(machine *Machine, results []protocol.CommandResult) (commands []protocol.Command, deregistered bool, err error) {
+	for _, result := range results {
+		record, err := s.store.CompleteCommand(machine.ID, result)
+		if errors.Is(err, ErrNotFound) {
+			s.logf("machine %s acknowledged unknown command %s", machine.ID, result.ID)
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to save command result: %w", err)
+		}
+
+		s.logf("machine %s command %s (%s) %s%s", machine.ID, result.ID, record.Command.Type, result.Status, describeCommandError(result.Error))
+		if record.Command.Type == protocol.CommandDeregister && result.Status == protocol.CommandSucceeded {
+			deregistered = true
+		}
+	}
+
+	if deregistered {
+		if err := s.store.DeleteMachine(machine.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, false, fmt.Errorf("failed to delete machine: %w", err)
+		}
+		s.logf("machine %s deregistered", machine.ID)
+		return nil, true, nil
+	}
+
+	commands, err = s.store.PendingCommands(machine.ID, time.Now())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load pending commands: %w", err)
+	}
+	return commands, false, nil
+}
+
+// describeCommandError 日志中附带的错误信息
+func describeCommandError(message string) string {
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
+
+// checkAdminToken 校验管理接口的令牌（失败时已经写入错误响应）
+func (s *Server) checkAdminToken(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidAPIKey, "Invalid admin token"))
+		return false
+	}
+	return true
+}
+
+// adminCommandRequest 管理接口的请求体
+type adminCommandRequest struct {
+	Machine string            `json:"machine"` // machines 表的记录 ID
+	Type    string            `json:"type"`
+	Args    map[string]string `json:"args,omitempty"`
+	TTL     string            `json:"ttl,omitempty"` // 有效期，例如 30m（默认 1h，最长 24h）
+}
+
+// handleAdminCommands 管理接口：向机器下发指令（Authorization: Bearer <admin token>）
+func (s *Server) handleAdminCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse(apperrors.CodeServerError, "Method not allowed"))
+		return
+	}
+
+	if !s.checkAdminToken(w, r) {
+		return
+	}
+
+	var req adminCommandRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Invalid request body: %v", err)))
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Invalid ttl: %v", err)))
+			return
+		}
+	}
+
+	cmd, err := s.EnqueueCommand(req.Machine, req.Type, req.Args, ttl)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse(apperrors.CodeServerError, err.Error()))
+		return
+	case errors.Is(err, ErrCommandsDisabled):
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse(apperrors.CodeServerError, err.Error()))
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, successResponse(map[string]interface{}{"command": cmd}))
+}
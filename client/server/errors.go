@@ -0,0 +1,25 @@
+package server
+
+import apperrors "sqlbots-client/errors"
+
+// errorResponse 创建错误响应
+func errorResponse(statusCode, message string) map[string]interface{} {
+	response := map[string]interface{}{
+		"status_code": statusCode,
+	}
+	if message != "" {
+		response["message"] = message
+	}
+	return response
+}
+
+// successResponse 创建成功响应
+func successResponse(data map[string]interface{}) map[string]interface{} {
+	response := map[string]interface{}{
+		"status_code": apperrors.CodeSuccess,
+	}
+	for k, v := range data {
+		response[k] = v
+	}
+	return response
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sqlbots-client/protocol"
+)
+
+// FileStore 基于 JSON 文件的持久化存储
+// 所有数据保存在内存中，每次写操作后整体写回文件
+type FileStore struct {
+	*MemoryStore
+	path string
+
+	// writeMu 串行化“修改 + 写回”：并发请求不会同时写临时文件，较旧的快照也不会覆盖较新的
+	writeMu sync.Mutex
+}
+
+// NewFileStore 打开（或创建）文件存储
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	}
+
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &store.data); err != nil {
+			return nil, fmt.Errorf("failed to parse store file: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+// AddUser 添加用户并保存
+func (s *FileStore) AddUser(user User) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.MemoryStore.AddUser(user)
+	return s.save()
+}
+
+// SetLicense 设置许可证并保存
+func (s *FileStore) SetLicense(license License) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.MemoryStore.SetLicense(license)
+	return s.save()
+}
+
+// UpdateLicense 设置许可证并保存
+func (s *FileStore) UpdateLicense(license *License) error {
+	return s.SetLicense(*license)
+}
+
+// CreateMachine 创建新机器并保存
+func (s *FileStore) CreateMachine(machine *Machine) (*Machine, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	created, err := s.MemoryStore.CreateMachine(machine)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// CreateMachineWithLimit 在机器数量未达到上限时创建新机器并保存
+func (s *FileStore) CreateMachineWithLimit(machine *Machine, limit int) (*Machine, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	created, err := s.MemoryStore.CreateMachineWithLimit(machine, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateMachine 更新机器信息并保存
+func (s *FileStore) UpdateMachine(machine *Machine) (*Machine, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	updated, err := s.MemoryStore.UpdateMachine(machine)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteMachine 删除机器并保存
+func (s *FileStore) DeleteMachine(id string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryStore.DeleteMachine(id); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// CreateCommand 保存待下发的指令并写回文件
+func (s *FileStore) CreateCommand(record *CommandRecord) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryStore.CreateCommand(record); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// CompleteCommand 保存执行结果并写回文件
+func (s *FileStore) CompleteCommand(machineRecordID string, result protocol.CommandResult) (*CommandRecord, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	record, err := s.MemoryStore.CompleteCommand(machineRecordID, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// save 将数据写回文件（先写临时文件再重命名，避免写入中断导致文件损坏）
+//
+// 调用方必须持有 writeMu
+func (s *FileStore) save() error {
+	s.mu.RLock()
+	content, err := json.MarshalIndent(&s.data, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal store data: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create store directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace store file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const machines = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, machines)
+	for i := 0; i < machines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := store.CreateMachine(&Machine{MachineID: fmt.Sprintf("machine-%d", i), APIKey: "key"}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("create machine: %v", err)
+	}
+
+	// 重新打开文件：最后写入的快照必须包含所有机器
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := reopened.CountMachines("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != machines {
+		t.Fatalf("machines in file: got %d, want %d", count, machines)
+	}
+}
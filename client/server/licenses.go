@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+// PathAdminLicenses 管理接口：修改用户的许可证（例如吊销或续期）
+const PathAdminLicenses = "/admin/licenses"
+
+// SetLicense 保存用户的许可证，并通知该用户所有推送连接上的机器立即发送心跳确认新的许可证状态
+func (s *Server) SetLicense(license License) error {
+	if license.ExpiresAt != "" {
+		if _, err := protocol.ParseTime(license.ExpiresAt); err != nil {
+			return fmt.Errorf("invalid expires_at %q: %w", license.ExpiresAt, err)
+		}
+	}
+	if err := s.store.UpdateLicense(&license); err != nil {
+		return fmt.Errorf("failed to save license: %w", err)
+	}
+	s.logf("updated license of user %s (plan %s, expires %q)", license.UserID, license.PlanType, license.ExpiresAt)
+	s.streams.notifyUser(license.UserID, protocol.EventLicense)
+	return nil
+}
+
+// adminLicenseRequest 管理接口的请求体（省略的字段保持不变）
+type adminLicenseRequest struct {
+	User      string  `json:"user"`                 // 用户 ID
+	ExpiresAt *string `json:"expires_at,omitempty"` // RFC3339，空字符串表示永久有效，过去的时间表示吊销
+	PlanType  *string `json:"plan_type,omitempty"`
+}
+
+// handleAdminLicenses 管理接口：修改用户的许可证（Authorization: Bearer <admin token>）
+func (s *Server) handleAdminLicenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse(apperrors.CodeServerError, "Method not allowed"))
+		return
+	}
+	if !s.checkAdminToken(w, r) {
+		return
+	}
+
+	var req adminLicenseRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Invalid request body: %v", err)))
+		return
+	}
+	if req.User == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, "user is required"))
+		return
+	}
+
+	license := License{UserID: req.User}
+	existing, err := s.store.FindLicenseByUserID(req.User)
+	switch {
+	case err == nil:
+		license = *existing
+	case !errors.Is(err, ErrNotFound):
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+	if req.ExpiresAt != nil {
+		license.ExpiresAt = *req.ExpiresAt
+	}
+	if req.PlanType != nil {
+		license.PlanType = *req.PlanType
+	}
+
+	if err := s.SetLicense(license); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, successResponse(map[string]interface{}{"license": license}))
+}
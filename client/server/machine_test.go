@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+
+	"sqlbots-client/fingerprint"
+)
+
+// testFingerprint 由组件的原始值构造指纹
+func testFingerprint(components map[string]string) fingerprint.Fingerprint {
+	fp := fingerprint.Fingerprint{}
+	for component, value := range components {
+		fp.Add(component, value)
+	}
+	return fp
+}
+
+func TestMatchMachine(t *testing.T) {
+	host := testFingerprint(map[string]string{fingerprint.ProductUUID: "uuid-1", fingerprint.CPU: "Xeon", fingerprint.Disks: "disk-1", fingerprint.Memory: "16"})
+	upgraded := testFingerprint(map[string]string{fingerprint.ProductUUID: "uuid-1", fingerprint.CPU: "Xeon", fingerprint.Disks: "disk-1", fingerprint.Memory: "32"})
+	copied := testFingerprint(map[string]string{fingerprint.ProductUUID: "uuid-2", fingerprint.CPU: "Xeon", fingerprint.Disks: "disk-1", fingerprint.Memory: "16"})
+	other := testFingerprint(map[string]string{fingerprint.CPU: "EPYC", fingerprint.Disks: "disk-9", fingerprint.Memory: "16"})
+
+	tests := []struct {
+		name       string
+		candidates []Machine
+		fp         fingerprint.Fingerprint
+		want       string // 匹配的记录 ID（为空表示作为新机器注册）
+	}{
+		{"no records", nil, host, ""},
+		{"same hardware", []Machine{{ID: "a", Fingerprint: host}}, host, "a"},
+		{"memory upgrade", []Machine{{ID: "a", Fingerprint: host}}, upgraded, "a"},
+		{"image copied to another host", []Machine{{ID: "a", Fingerprint: host}}, copied, ""},
+		{"different hardware", []Machine{{ID: "a", Fingerprint: host}}, other, ""},
+		{"most similar record wins", []Machine{{ID: "a", Fingerprint: upgraded}, {ID: "b", Fingerprint: host}}, host, "b"},
+		{"fingerprinted match preferred over legacy record", []Machine{{ID: "legacy"}, {ID: "b", Fingerprint: host}}, host, "b"},
+		{"legacy record without fingerprint", []Machine{{ID: "legacy"}}, host, "legacy"},
+		{"old client without fingerprint", []Machine{{ID: "a", Fingerprint: host}}, nil, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine, comparison := matchMachine(tt.candidates, tt.fp)
+			got := ""
+			if machine != nil {
+				got = machine.ID
+			}
+			if got != tt.want {
+				t.Fatalf("matched %q, want %q (%s)", got, tt.want, describeComparison(comparison))
+			}
+		})
+	}
+
+	// 没有匹配时返回最接近的比较结果（用于日志）
+	_, comparison := matchMachine([]Machine{{ID: "a", Fingerprint: other}, {ID: "b", Fingerprint: host}}, copied)
+	if comparison.Conflict != fingerprint.ProductUUID {
+		t.Fatalf("closest comparison: %+v", comparison)
+	}
+}
+
+func TestInstanceCandidates(t *testing.T) {
+	machines := []Machine{{ID: "a", InstanceID: "i-1"}, {ID: "b", InstanceID: "i-2"}, {ID: "legacy"}}
+
+	tests := []struct {
+		instanceID string
+		want       []string
+	}{
+		{"i-1", []string{"a"}},
+		{"i-3", []string{"legacy"}}, // 新实例只能接管还没有实例 ID 的旧记录
+		{"", []string{"a", "b", "legacy"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range instanceCandidates(machines, tt.instanceID) {
+			got = append(got, m.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.instanceID, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.instanceID, got, tt.want)
+			}
+		}
+	}
+
+	if got := instanceCandidates([]Machine{{ID: "a", InstanceID: "i-1"}}, "i-2"); len(got) != 0 {
+		t.Errorf("instance %q matched another instance: %v", "i-2", got)
+	}
+}
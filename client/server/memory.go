@@ -0,0 +1,269 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"sqlbots-client/protocol"
+)
+
+// storeData 存储的全部数据（内存存储和文件存储共用）
+type storeData struct {
+	Users    []User          `json:"users"`
+	Licenses []License       `json:"licenses"`
+	Machines []Machine       `json:"machines"`
+	Commands []CommandRecord `json:"commands,omitempty"`
+}
+
+// MemoryStore 内存存储（重启后数据丢失，适合本地开发和测试）
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data storeData
+}
+
+// NewMemoryStore 创建新的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// AddUser 添加用户
+func (s *MemoryStore) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Users = append(s.data.Users, user)
+}
+
+// SetLicense 设置用户的许可证（已存在则覆盖）
+func (s *MemoryStore) SetLicense(license License) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Licenses {
+		if s.data.Licenses[i].UserID == license.UserID {
+			s.data.Licenses[i] = license
+			return
+		}
+	}
+	s.data.Licenses = append(s.data.Licenses, license)
+}
+
+// FindUserByAPIKey 通过 API Key 查找用户
+func (s *MemoryStore) FindUserByAPIKey(apiKey string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.data.Users {
+		if user.APIKey == apiKey {
+			u := user
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FindMachines 通过 machine_id 和 api_key 查找机器（没有时返回空列表）
+func (s *MemoryStore) FindMachines(machineID, apiKey string) ([]Machine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var machines []Machine
+	for _, machine := range s.data.Machines {
+		if machine.MachineID == machineID && machine.APIKey == apiKey {
+			machines = append(machines, machine)
+		}
+	}
+	return machines, nil
+}
+
+// ListMachines 列出 API Key 下的所有机器
+func (s *MemoryStore) ListMachines(apiKey string) ([]Machine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var machines []Machine
+	for _, machine := range s.data.Machines {
+		if machine.APIKey == apiKey {
+			machines = append(machines, machine)
+		}
+	}
+	return machines, nil
+}
+
+// CountMachines 统计 API Key 下的机器数量
+func (s *MemoryStore) CountMachines(apiKey string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, machine := range s.data.Machines {
+		if machine.APIKey == apiKey {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CreateMachine 创建新机器
+func (s *MemoryStore) CreateMachine(machine *Machine) (*Machine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createMachine(machine), nil
+}
+
+// CreateMachineWithLimit 在 API Key 下的机器少于 limit 台时创建新机器
+func (s *MemoryStore) CreateMachineWithLimit(machine *Machine, limit int) (*Machine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, existing := range s.data.Machines {
+		if existing.APIKey == machine.APIKey {
+			count++
+		}
+	}
+	if count >= limit {
+		return nil, ErrMachineLimitExceeded
+	}
+	return s.createMachine(machine), nil
+}
+
+// createMachine 添加机器记录（调用方必须持有写锁）
+func (s *MemoryStore) createMachine(machine *Machine) *Machine {
+	m := *machine
+	if m.ID == "" {
+		m.ID = newRecordID()
+	}
+	now := time.Now().UTC()
+	m.CreatedAt = now
+	m.UpdatedAt = now
+	s.data.Machines = append(s.data.Machines, m)
+
+	return &m
+}
+
+// UpdateMachine 按记录 ID 更新机器信息
+func (s *MemoryStore) UpdateMachine(machine *Machine) (*Machine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Machines {
+		existing := &s.data.Machines[i]
+		if existing.ID == machine.ID {
+			id, createdAt := existing.ID, existing.CreatedAt
+			*existing = *machine
+			existing.ID = id
+			existing.CreatedAt = createdAt
+			existing.UpdatedAt = time.Now().UTC()
+			m := *existing
+			return &m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FindMachineByID 按记录 ID 查找机器
+func (s *MemoryStore) FindMachineByID(id string) (*Machine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, machine := range s.data.Machines {
+		if machine.ID == id {
+			m := machine
+			return &m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteMachine 按记录 ID 删除机器
+func (s *MemoryStore) DeleteMachine(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Machines {
+		if s.data.Machines[i].ID == id {
+			s.data.Machines = append(s.data.Machines[:i], s.data.Machines[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// CreateCommand 保存待下发的指令
+func (s *MemoryStore) CreateCommand(record *CommandRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := *record
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	s.data.Commands = append(s.data.Commands, r)
+	return nil
+}
+
+// PendingCommands 返回机器还没有确认且没有过期的指令
+func (s *MemoryStore) PendingCommands(machineRecordID string, now time.Time) ([]protocol.Command, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var commands []protocol.Command
+	for _, record := range s.data.Commands {
+		if record.MachineRecordID == machineRecordID && record.Result == nil && now.Unix() < record.Command.ExpiresAt {
+			commands = append(commands, record.Command)
+		}
+	}
+	return commands, nil
+}
+
+// CompleteCommand 保存客户端确认的执行结果
+func (s *MemoryStore) CompleteCommand(machineRecordID string, result protocol.CommandResult) (*CommandRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.data.Commands {
+		record := &s.data.Commands[i]
+		if record.MachineRecordID == machineRecordID && record.Command.ID == result.ID {
+			if record.Result == nil {
+				r := result
+				record.Result = &r
+			}
+			c := *record
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateLicense 设置用户的许可证（已存在则覆盖）
+func (s *MemoryStore) UpdateLicense(license *License) error {
+	s.SetLicense(*license)
+	return nil
+}
+
+// FindLicenseByUserID 通过用户 ID 查找许可证
+func (s *MemoryStore) FindLicenseByUserID(userID string) (*License, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, license := range s.data.Licenses {
+		if license.UserID == userID {
+			l := license
+			return &l, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// newRecordID 生成随机记录 ID
+func newRecordID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCreateMachineWithLimit(t *testing.T) {
+	store := NewMemoryStore()
+
+	const limit = 3
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = store.CreateMachineWithLimit(&Machine{MachineID: fmt.Sprintf("machine-%d", i), APIKey: "key"}, limit)
+		}(i)
+	}
+	wg.Wait()
+
+	if count, _ := store.CountMachines("key"); count != limit {
+		t.Fatalf("machines: got %d, want %d", count, limit)
+	}
+	if _, err := store.CreateMachineWithLimit(&Machine{MachineID: "other", APIKey: "key"}, limit); err != ErrMachineLimitExceeded {
+		t.Fatalf("got %v, want ErrMachineLimitExceeded", err)
+	}
+	// 上限按 API Key 计算
+	if _, err := store.CreateMachineWithLimit(&Machine{MachineID: "other", APIKey: "other-key"}, limit); err != nil {
+		t.Fatalf("other user: %v", err)
+	}
+}
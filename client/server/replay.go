@@ -0,0 +1,83 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+// replayGuard 重放保护：拒绝时间戳超出时钟偏差、nonce 重复或序号未递增的请求
+//
+// 序号按客户端进程（sender）分别递增：同一台机器上可能同时运行多个进程（例如 run 和 doctor、
+// 克隆出的实例），它们的序号互不相关。不带 sender 的请求只检查时间戳和 nonce
+type replayGuard struct {
+	mu        sync.Mutex
+	tolerance time.Duration
+	sequences map[string]sequenceRecord // 按 用户 ID + 机器 ID + sender 记录最后一个序号
+	nonces    map[string]time.Time      // nonce 过期时间（超过时钟偏差窗口后不会再被接受，可以删除）
+}
+
+// sequenceRecord 一个客户端进程最后的序号
+type sequenceRecord struct {
+	last      uint64
+	expiresAt time.Time // 超过时钟偏差窗口没有新请求后删除（更早的请求会因为时间戳被拒绝）
+}
+
+// newReplayGuard 创建重放保护
+func newReplayGuard(tolerance time.Duration) *replayGuard {
+	return &replayGuard{
+		tolerance: tolerance,
+		sequences: make(map[string]sequenceRecord),
+		nonces:    make(map[string]time.Time),
+	}
+}
+
+// check 检查请求的新鲜度并记录，返回非空状态码表示请求被拒绝
+func (g *replayGuard) check(userID, machineID string, f protocol.Freshness, now time.Time) (string, string) {
+	if err := f.CheckSkew(now, g.tolerance); err != nil {
+		return apperrors.CodeStaleRequest, err.Error()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f.Nonce != "" {
+		if _, seen := g.nonces[f.Nonce]; seen {
+			return apperrors.CodeReplayDetected, "Duplicate nonce"
+		}
+	}
+
+	if f.Sequence != 0 && f.Sender != "" {
+		key := userID + "\x00" + machineID + "\x00" + f.Sender
+		if record, ok := g.sequences[key]; ok && f.Sequence <= record.last {
+			return apperrors.CodeReplayDetected, "Sequence number did not increase"
+		}
+		g.sequences[key] = sequenceRecord{last: f.Sequence, expiresAt: now.Add(2 * g.tolerance)}
+	}
+
+	if f.Nonce != "" {
+		g.nonces[f.Nonce] = now.Add(2 * g.tolerance)
+	}
+
+	return "", ""
+}
+
+// cleanup 清理过期的 nonce 和序号记录
+func (g *replayGuard) cleanup() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for nonce, expiresAt := range g.nonces {
+		if now.After(expiresAt) {
+			delete(g.nonces, nonce)
+		}
+	}
+	for key, record := range g.sequences {
+		if now.After(record.expiresAt) {
+			delete(g.sequences, key)
+		}
+	}
+}
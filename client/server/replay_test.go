@@ -0,0 +1,76 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+func TestReplayGuardRejectsDuplicateNonce(t *testing.T) {
+	g := newReplayGuard(time.Minute)
+	now := time.Now()
+	f := protocol.Freshness{Timestamp: now.Unix(), Sequence: 1, Sender: "a", Nonce: "n1"}
+
+	if code, _ := g.check("u", "m", f, now); code != "" {
+		t.Fatalf("first request rejected: %s", code)
+	}
+	f.Sequence = 2
+	if code, _ := g.check("u", "m", f, now); code != apperrors.CodeReplayDetected {
+		t.Fatalf("duplicate nonce: got %q, want %q", code, apperrors.CodeReplayDetected)
+	}
+}
+
+func TestReplayGuardRejectsStaleTimestamp(t *testing.T) {
+	g := newReplayGuard(time.Minute)
+	now := time.Now()
+	f := protocol.Freshness{Timestamp: now.Add(-2 * time.Minute).Unix(), Nonce: "n1"}
+
+	if code, _ := g.check("u", "m", f, now); code != apperrors.CodeStaleRequest {
+		t.Fatalf("got %q, want %q", code, apperrors.CodeStaleRequest)
+	}
+}
+
+func TestReplayGuardSequencePerSender(t *testing.T) {
+	g := newReplayGuard(time.Minute)
+	now := time.Now()
+	check := func(sender string, sequence uint64, nonce string) string {
+		code, _ := g.check("u", "m", protocol.Freshness{Timestamp: now.Unix(), Sequence: sequence, Sender: sender, Nonce: nonce}, now)
+		return code
+	}
+
+	// 长期运行的进程
+	if code := check("run", 100, "n1"); code != "" {
+		t.Fatalf("run: %s", code)
+	}
+	// 同一台机器上之后启动的进程序号更大，不能影响已经运行的进程
+	if code := check("doctor", 1000, "n2"); code != "" {
+		t.Fatalf("doctor: %s", code)
+	}
+	if code := check("run", 101, "n3"); code != "" {
+		t.Fatalf("run after doctor: %s", code)
+	}
+	// 同一个进程的序号必须递增
+	if code := check("run", 101, "n4"); code != apperrors.CodeReplayDetected {
+		t.Fatalf("repeated sequence: got %q, want %q", code, apperrors.CodeReplayDetected)
+	}
+	// 不带 sender 的请求只检查时间戳和 nonce
+	if code := check("", 1, "n5"); code != "" {
+		t.Fatalf("no sender: %s", code)
+	}
+}
+
+func TestReplayGuardCleanup(t *testing.T) {
+	g := newReplayGuard(time.Minute)
+	past := time.Now().Add(-10 * time.Minute)
+	f := protocol.Freshness{Timestamp: past.Unix(), Sequence: 1, Sender: "a", Nonce: "n1"}
+	if code, _ := g.check("u", "m", f, past); code != "" {
+		t.Fatalf("rejected: %s", code)
+	}
+
+	g.cleanup()
+	if len(g.nonces) != 0 || len(g.sequences) != 0 {
+		t.Fatalf("expired records not removed: %d nonces, %d sequences", len(g.nonces), len(g.sequences))
+	}
+}
@@ -0,0 +1,783 @@
+package server
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/fingerprint"
+	"sqlbots-client/protocol"
+)
+
+const (
+	// DefaultMaxMachinesPerUser 每个用户默认允许的最大机器数量
+	DefaultMaxMachinesPerUser = 3
+	// DefaultSessionKeyTTL 会话密钥默认有效期（30分钟）
+	DefaultSessionKeyTTL = 30 * time.Minute
+
+	maxRequestBodySize = 1 << 20
+	maxTelemetryDisks  = 32 // 每台机器最多保存的挂载点数量
+
+	maxCollectors          = 64  // 每台机器最多保存的采集器数量
+	maxMetricsPerCollector = 256 // 每个采集器最多保存的指标数量
+	maxWorkloads           = 64  // 每台机器最多保存的托管进程数量
+
+	// agreedSessionsPerMachine 每个用户保存的密钥协商会话数量上限是最大机器数量的倍数
+	// （客户端刷新会话密钥时旧会话在过期前仍然有效，login、doctor 和 heartbeat --once 也各自交换一次密钥）
+	agreedSessionsPerMachine = 8
+)
+
+// Config 服务器配置
+type Config struct {
+	EncryptionKey      string           // 初始加密密钥（与客户端 ENCRYPTION_KEY 一致）
+	MaxMachinesPerUser int              // 每个用户允许的最大机器数量
+	SessionKeyTTL      time.Duration    // 会话密钥有效期
+	Schemes            []string         // 服务器支持的加密方案（为空时支持全部方案）
+	PrivateKey         *ecdh.PrivateKey // 服务器固定 X25519 私钥（为空时不支持密钥协商）
+
+	// ClockSkewTolerance 请求时间戳允许的时钟偏差（默认 5 分钟）
+	ClockSkewTolerance time.Duration
+	// StrictReplayProtection 要求所有请求带签名和时间戳（拒绝不支持重放保护的旧客户端）
+	StrictReplayProtection bool
+
+	// LegacyMachineIDsUntil 迁移窗口的截止时间：之前发送哈希 ID 的客户端可以匹配并迁移保存原始机器 ID 的旧记录
+	// （为零时不限制），之后旧记录不再匹配
+	LegacyMachineIDsUntil time.Time
+
+	// CommandKey 指令签名私钥（为空时不能下发指令，客户端固定对应的公钥）
+	CommandKey ed25519.PrivateKey
+	// AdminToken 管理接口的令牌（为空时不开放管理接口）
+	AdminToken string
+	// MaxPendingStreams 同时存在的未绑定推送连接的上限（为 0 时使用 DefaultMaxPendingStreams）
+	MaxPendingStreams int
+
+	Logger *log.Logger // 日志输出（为空时不输出日志）
+}
+
+// Server 参考服务器（实现与 Node 服务器相同的协议）
+type Server struct {
+	cfg      Config
+	store    Store
+	sessions *sessionStore
+	replay   *replayGuard
+	streams  *streamHub
+}
+
+// New 创建新的参考服务器
+func New(cfg Config, store Store) *Server {
+	if cfg.MaxMachinesPerUser <= 0 {
+		cfg.MaxMachinesPerUser = DefaultMaxMachinesPerUser
+	}
+	if cfg.SessionKeyTTL <= 0 {
+		cfg.SessionKeyTTL = DefaultSessionKeyTTL
+	}
+	if len(cfg.Schemes) == 0 {
+		cfg.Schemes = encryption.SupportedSchemes
+	}
+	if cfg.ClockSkewTolerance <= 0 {
+		cfg.ClockSkewTolerance = protocol.DefaultClockSkewTolerance
+	}
+	if cfg.MaxPendingStreams <= 0 {
+		cfg.MaxPendingStreams = DefaultMaxPendingStreams
+	}
+
+	return &Server{
+		cfg:      cfg,
+		store:    store,
+		sessions: newSessionStore(cfg.SessionKeyTTL, cfg.MaxMachinesPerUser*agreedSessionsPerMachine),
+		replay:   newReplayGuard(cfg.ClockSkewTolerance),
+		streams:  newStreamHub(cfg.MaxPendingStreams),
+	}
+}
+
+// Handler 返回服务器的 HTTP 处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(protocol.PathKeyExchange, s.withAuth(s.handleKeyExchange))
+	mux.HandleFunc(protocol.PathHeartbeat, s.withAuth(s.handleHeartbeat))
+	mux.HandleFunc(protocol.PathHealth, s.handleHealth)
+	mux.HandleFunc(protocol.PathStream, s.handleStream)
+	if s.cfg.AdminToken != "" {
+		mux.HandleFunc(PathAdminCommands, s.handleAdminCommands)
+		mux.HandleFunc(PathAdminLicenses, s.handleAdminLicenses)
+	}
+	return mux
+}
+
+// CleanupExpiredSessions 清理过期的会话密钥和重放保护记录
+func (s *Server) CleanupExpiredSessions() {
+	s.sessions.cleanup()
+	s.replay.cleanup()
+}
+
+// requestBody 请求体（所有需要认证的接口共用）
+type requestBody struct {
+	APIKey        string   `json:"API_KEY"`
+	EncryptedData string   `json:"encrypted_data"`
+	UseSessionKey *bool    `json:"use_session_key"`
+	Schemes       []string `json:"schemes"`
+	SessionID     string   `json:"session_id"`
+	Scheme        string   `json:"scheme"`
+	Signature     string   `json:"signature"`
+	StreamID      string   `json:"stream_id"`
+
+	KeyAgreement    string `json:"key_agreement"`
+	ClientPublicKey string `json:"client_public_key"`
+}
+
+// authedHandler 已通过 API Key 验证的处理函数
+type authedHandler func(w http.ResponseWriter, r *http.Request, user *User, body *requestBody)
+
+// withAuth API Key 验证中间件（对应 middleware/auth.js）
+func (s *Server) withAuth(next authedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse(apperrors.CodeServerError, "Method not allowed"))
+			return
+		}
+
+		content, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, "Failed to read request body"))
+			return
+		}
+
+		var body requestBody
+		if err := json.Unmarshal(content, &body); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, "Invalid JSON body"))
+			return
+		}
+
+		if body.APIKey == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeInvalidAPIKey, "API_KEY is required"))
+			return
+		}
+
+		user, err := s.store.FindUserByAPIKey(body.APIKey)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidAPIKey, "Invalid API Key"))
+				return
+			}
+			s.logf("auth error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+			return
+		}
+
+		next(w, r, user, &body)
+	}
+}
+
+// handleKeyExchange 密钥交换（对应 routes/keyExchange.js）
+func (s *Server) handleKeyExchange(w http.ResponseWriter, r *http.Request, user *User, body *requestBody) {
+	// 协商加密方案（旧客户端不提供方案列表，使用 legacy 方案）
+	scheme := encryption.NegotiateScheme(body.Schemes, s.cfg.Schemes)
+	if scheme == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, "No supported encryption scheme"))
+		return
+	}
+
+	data := map[string]interface{}{
+		"expires_in": int(s.cfg.SessionKeyTTL / time.Second),
+		"username":   displayName(user),
+		"features":   []string{protocol.FeatureDryRun},
+	}
+	if len(body.Schemes) > 0 {
+		data["scheme"] = scheme
+	}
+
+	// X25519 密钥协商：会话密钥由双方各自派生，不经过网络传输
+	if body.KeyAgreement == encryption.KeyAgreementX25519 && s.cfg.PrivateKey != nil {
+		serverPublicKey, confirmation, sessionKey, err := encryption.RespondX25519(s.cfg.PrivateKey, body.ClientPublicKey, user.APIKey)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Key agreement failed: %v", err)))
+			return
+		}
+
+		data["key_agreement"] = encryption.KeyAgreementX25519
+		data["session_id"] = s.sessions.putAgreed(user.ID, sessionKey, scheme)
+		data["server_public_key"] = serverPublicKey
+		data["key_confirmation"] = confirmation
+		writeJSON(w, http.StatusOK, successResponse(data))
+		return
+	}
+
+	// 旧流程：服务器生成会话密钥，使用初始密钥加密后下发
+	sessionKey, err := s.sessions.getOrCreate(user.ID)
+	if err != nil {
+		s.logf("key exchange error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+
+	// 使用初始密钥加密会话密钥
+	encryptedSessionKey, err := encryption.EncryptWithScheme(scheme, sessionKey, s.cfg.EncryptionKey,
+		encryption.AssociatedData(protocol.PathKeyExchange, user.APIKey))
+	if err != nil {
+		s.logf("key exchange error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+
+	data["session_key"] = encryptedSessionKey
+	writeJSON(w, http.StatusOK, successResponse(data))
+}
+
+// heartbeatPayload 心跳请求中加密的数据
+type heartbeatPayload struct {
+	MachineID   string `json:"machine_id"`
+	MachineName string `json:"machine_name"`
+	RAM         *int   `json:"ram"`
+	Cores       *int   `json:"cores"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+
+	Fingerprint fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+	InstanceID  string                  `json:"instance_id,omitempty"`
+	Environment string                  `json:"environment,omitempty"`
+	Platform    string                  `json:"platform,omitempty"`
+
+	MachineIDHashed bool                       `json:"machine_id_hashed,omitempty"`
+	Telemetry       *protocol.Telemetry        `json:"telemetry,omitempty"`
+	Metrics         []protocol.CollectorResult `json:"metrics,omitempty"`
+	Workloads       []protocol.WorkloadStatus  `json:"workloads,omitempty"`
+	CommandResults  []protocol.CommandResult   `json:"command_results,omitempty"`
+
+	protocol.Freshness
+}
+
+// handleHeartbeat 心跳处理（对应 routes/heartbeat.js）
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request, user *User, body *requestBody) {
+	// 确定使用哪个密钥：优先使用会话密钥，如果没有则使用初始密钥
+	encryptionKey := s.cfg.EncryptionKey
+	agreedScheme := "" // X25519 会话协商的加密方案（为空时接受服务器支持的任意方案）
+	if body.SessionID != "" && (body.UseSessionKey == nil || *body.UseSessionKey) {
+		// X25519 会话：会话不存在或已过期时客户端需要重新交换密钥
+		sessionKey, scheme, ok := s.sessions.getAgreed(body.SessionID, user.ID)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeDecryptionFailed, "Unknown or expired session"))
+			return
+		}
+		encryptionKey = sessionKey
+		agreedScheme = scheme
+	} else if body.UseSessionKey == nil || *body.UseSessionKey {
+		sessionKey, ok := s.sessions.get(user.ID)
+		if !ok {
+			var err error
+			sessionKey, err = s.sessions.getOrCreate(user.ID)
+			if err != nil {
+				s.logf("heartbeat error: %v", err)
+				writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+				return
+			}
+		}
+		encryptionKey = sessionKey
+	}
+
+	if body.EncryptedData == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeDecryptionFailed, "encrypted_data is required"))
+		return
+	}
+
+	if body.Signature == "" && s.cfg.StrictReplayProtection {
+		writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidSignature, "signature is required"))
+		return
+	}
+
+	// 解密请求数据（legacy 会话密钥失败时回退到初始密钥，向后兼容）
+	// X25519 会话只接受协商的会话密钥，不能降级为初始密钥；请求带签名时，只接受签名校验通过的密钥
+	candidates := []string{encryptionKey}
+	if agreedScheme == "" && encryptionKey != s.cfg.EncryptionKey {
+		candidates = append(candidates, s.cfg.EncryptionKey)
+	}
+
+	var payload heartbeatPayload
+	var scheme string
+	var firstErr error
+	associatedData := encryption.AssociatedData(protocol.PathHeartbeat, user.APIKey)
+	signatureFields := protocol.SignatureFields(protocol.PathHeartbeat, &protocol.EncryptedRequest{
+		APIKey:        body.APIKey,
+		EncryptedData: body.EncryptedData,
+		UseSessionKey: body.UseSessionKey != nil && *body.UseSessionKey,
+		Scheme:        body.Scheme,
+		SessionID:     body.SessionID,
+		StreamID:      body.StreamID,
+	})
+	decrypted, signatureMatched := false, false
+	for _, key := range candidates {
+		if body.Signature != "" {
+			if !encryption.Verify(key, body.Signature, signatureFields...) {
+				continue
+			}
+			signatureMatched = true
+		}
+
+		var err error
+		scheme, err = s.decryptJSON(body.EncryptedData, key, agreedScheme, associatedData, &payload)
+		if err == nil {
+			encryptionKey = key
+			decrypted = true
+			break
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if !decrypted {
+		if body.Signature != "" && !signatureMatched {
+			writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidSignature, "Invalid request signature"))
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeDecryptionFailed, fmt.Sprintf("Decryption failed: %v", firstErr)))
+		return
+	}
+
+	if payload.MachineID == "" || payload.MachineName == "" || payload.RAM == nil || payload.Cores == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeServerError, "Missing required fields in decrypted data"))
+		return
+	}
+
+	// 重放保护：旧客户端不发送时间戳，只有严格模式下才拒绝
+	if payload.Timestamp != 0 {
+		if statusCode, message := s.replay.check(user.ID, payload.MachineID, payload.Freshness, time.Now()); statusCode != "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(statusCode, message))
+			return
+		}
+	} else if s.cfg.StrictReplayProtection {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeStaleRequest, "timestamp is required"))
+		return
+	}
+
+	// 1. 验证或注册机器
+	machine, statusCode, message, err := s.verifyOrRegisterMachine(user, &payload)
+	if err != nil {
+		s.logf("heartbeat error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+	if statusCode != "" {
+		writeJSON(w, http.StatusForbidden, errorResponse(statusCode, message))
+		return
+	}
+
+	// 2. 验证许可证
+	license, statusCode, message, err := s.verifyLicense(user)
+	if err != nil {
+		s.logf("heartbeat error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+	if statusCode != "" {
+		writeJSON(w, http.StatusForbidden, errorResponse(statusCode, message))
+		return
+	}
+
+	// 3. 保存上次心跳以来的指令执行结果，下发还没有确认的指令（试运行不处理指令）
+	var commands []protocol.Command
+	var responseMessage string
+	if !payload.DryRun && machine.ID != "" {
+		var deregistered bool
+		commands, deregistered, err = s.exchangeCommands(machine, payload.CommandResults)
+		if err != nil {
+			s.logf("heartbeat error: %v", err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+			return
+		}
+		if deregistered {
+			responseMessage = "Machine deregistered"
+		}
+	}
+
+	// 构建并加密响应数据（试运行时未注册的机器没有 ID 和注册时间）
+	registeredAt := ""
+	if !machine.CreatedAt.IsZero() {
+		registeredAt = machine.CreatedAt.Format(time.RFC3339)
+	}
+	responseData := successResponse(map[string]interface{}{
+		"license_info": map[string]interface{}{
+			"expires_at": license.ExpiresAt,
+			"plan_type":  license.PlanType,
+		},
+		"machine_info": map[string]interface{}{
+			"id":            machine.ID,
+			"name":          machine.Name,
+			"registered_at": registeredAt,
+		},
+		"timestamp": time.Now().Unix(),
+	})
+	if payload.Nonce != "" {
+		responseData["nonce"] = payload.Nonce
+	}
+	if len(commands) > 0 {
+		responseData["commands"] = commands
+	}
+	if responseMessage != "" {
+		responseData["message"] = responseMessage
+	}
+
+	// 带推送连接 ID 的心跳：把连接绑定到机器，之后推送这台机器的事件（连接 ID 必须包含在校验通过的签名中）
+	if body.StreamID != "" && signatureMatched && !payload.DryRun && machine.ID != "" && responseMessage == "" {
+		s.streams.bind(body.StreamID, user.ID, machine.ID, licenseState(license, ""))
+	}
+
+	responseJSON, err := json.Marshal(responseData)
+	if err != nil {
+		s.logf("heartbeat error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+
+	// 使用与请求相同的加密方案加密响应
+	encryptedResponse, err := encryption.EncryptWithScheme(scheme, string(responseJSON), encryptionKey, associatedData)
+	if err != nil {
+		s.logf("heartbeat error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"encrypted_data": encryptedResponse,
+	})
+}
+
+// handleHealth 健康检查
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse(apperrors.CodeServerError, "Method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// verifyOrRegisterMachine 验证或注册机器（对应 services/machine.js 和 services/hardware.js）
+// 同一个 machine_id 下先按实例 ID 区分克隆的虚拟机和容器，再按硬件指纹找最相似的记录：
+// 小的硬件变化仍然是同一台机器，实例 ID 不同或指纹差别太大（例如虚拟机镜像被复制到其他主机）时作为新机器注册，
+// 占用一个机器名额
+// 返回非空状态码表示业务校验失败
+func (s *Server) verifyOrRegisterMachine(user *User, payload *heartbeatPayload) (*Machine, string, string, error) {
+	found, err := s.store.FindMachines(payload.MachineID, user.APIKey)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to find machine: %w", err)
+	}
+
+	// 迁移窗口内，发送哈希 ID 的客户端接管保存原始机器 ID 的旧记录
+	if payload.MachineIDHashed && s.acceptLegacyMachineIDs(time.Now()) {
+		migrated, err := s.migrateLegacyMachines(user, payload)
+		if err != nil {
+			return nil, "", "", err
+		}
+		found = append(found, migrated...)
+	}
+
+	candidates := instanceCandidates(found, payload.InstanceID)
+	machine, comparison := matchMachine(candidates, payload.Fingerprint)
+	if machine == nil {
+		switch {
+		case len(candidates) > 0:
+			s.logf("machine_id %s of user %s does not match any registered fingerprint (%s), registering as a new machine",
+				payload.MachineID, user.ID, describeComparison(comparison))
+		case len(found) > 0:
+			s.logf("machine_id %s of user %s is used by a new %s instance, registering as a new machine",
+				payload.MachineID, user.ID, describeEnvironment(payload.Environment, payload.Platform))
+		}
+
+		// 机器不存在，检查用户机器数量（试运行的结果；实际注册时由存储原子地再检查一次）
+		count, err := s.store.CountMachines(user.APIKey)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to count machines: %w", err)
+		}
+		if count >= s.cfg.MaxMachinesPerUser {
+			return nil, apperrors.CodeMachineLimitExceeded, fmt.Sprintf("Maximum %d machines allowed per user", s.cfg.MaxMachinesPerUser), nil
+		}
+
+		// 试运行只检查能否注册，不创建记录
+		if payload.DryRun {
+			return &Machine{MachineID: payload.MachineID, APIKey: user.APIKey, Name: payload.MachineName}, "", "", nil
+		}
+
+		// 注册新机器
+		machine, err = s.store.CreateMachineWithLimit(&Machine{
+			MachineID:   payload.MachineID,
+			APIKey:      user.APIKey,
+			Name:        payload.MachineName,
+			RAM:         *payload.RAM,
+			Cores:       *payload.Cores,
+			Fingerprint: payload.Fingerprint,
+			InstanceID:  payload.InstanceID,
+			Environment: describeEnvironment(payload.Environment, payload.Platform),
+			IDHashed:    payload.MachineIDHashed,
+			Telemetry:   limitTelemetry(payload.Telemetry),
+			Metrics:     limitMetrics(payload.Metrics),
+			Workloads:   limitWorkloads(payload.Workloads),
+		}, s.cfg.MaxMachinesPerUser)
+		if errors.Is(err, ErrMachineLimitExceeded) {
+			return nil, apperrors.CodeMachineLimitExceeded, fmt.Sprintf("Maximum %d machines allowed per user", s.cfg.MaxMachinesPerUser), nil
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to create machine: %w", err)
+		}
+		s.logf("registered machine %s for user %s", machine.ID, user.ID)
+		return machine, "", "", nil
+	}
+
+	if len(comparison.Changed) > 0 {
+		s.logf("machine %s hardware changed: %s", machine.ID, describeComparison(comparison))
+	}
+
+	// 机器已存在，硬件信息有变化时更新，指纹跟随逐步变化的硬件，旧记录补上实例 ID（试运行不更新）
+	updated := *machine
+	updated.Name = payload.MachineName
+	updated.RAM = *payload.RAM
+	updated.Cores = *payload.Cores
+	if len(payload.Fingerprint) > 0 {
+		updated.Fingerprint = payload.Fingerprint
+	}
+	if payload.InstanceID != "" {
+		updated.InstanceID = payload.InstanceID
+	}
+	if payload.Environment != "" {
+		updated.Environment = describeEnvironment(payload.Environment, payload.Platform)
+	}
+	if payload.Telemetry != nil {
+		updated.Telemetry = limitTelemetry(payload.Telemetry)
+	}
+	if len(payload.Metrics) > 0 {
+		updated.Metrics = limitMetrics(payload.Metrics)
+	}
+	if len(payload.Workloads) > 0 {
+		updated.Workloads = limitWorkloads(payload.Workloads)
+	}
+	if !payload.DryRun && !reflect.DeepEqual(&updated, machine) {
+		machine, err = s.store.UpdateMachine(&updated)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to update machine: %w", err)
+		}
+	}
+
+	return machine, "", "", nil
+}
+
+// limitTelemetry 限制保存的挂载点数量（遥测数据来自客户端，不能无限增长）
+func limitTelemetry(telemetry *protocol.Telemetry) *protocol.Telemetry {
+	if telemetry == nil || len(telemetry.Disks) <= maxTelemetryDisks {
+		return telemetry
+	}
+	limited := *telemetry
+	limited.Disks = limited.Disks[:maxTelemetryDisks]
+	return &limited
+}
+
+// limitMetrics 限制保存的采集器和指标数量
+func limitMetrics(results []protocol.CollectorResult) []protocol.CollectorResult {
+	if len(results) > maxCollectors {
+		results = results[:maxCollectors]
+	}
+	limited := make([]protocol.CollectorResult, len(results))
+	for i, result := range results {
+		if len(result.Metrics) > maxMetricsPerCollector {
+			result.Metrics = result.Metrics[:maxMetricsPerCollector]
+		}
+		limited[i] = result
+	}
+	return limited
+}
+
+// limitWorkloads 限制保存的托管进程数量
+func limitWorkloads(workloads []protocol.WorkloadStatus) []protocol.WorkloadStatus {
+	if len(workloads) > maxWorkloads {
+		return workloads[:maxWorkloads]
+	}
+	return workloads
+}
+
+// acceptLegacyMachineIDs 是否仍在原始机器 ID 的迁移窗口内
+func (s *Server) acceptLegacyMachineIDs(now time.Time) bool {
+	return s.cfg.LegacyMachineIDsUntil.IsZero() || now.Before(s.cfg.LegacyMachineIDsUntil)
+}
+
+// migrateLegacyMachines 查找用原始机器 ID 登记、哈希后等于 payload 中机器 ID 的旧记录，改为使用哈希 ID
+// 旧记录的实例 ID 按原始机器 ID 计算，迁移时清空，由第一个心跳重新接管（试运行只返回匹配的记录，不修改）
+func (s *Server) migrateLegacyMachines(user *User, payload *heartbeatPayload) ([]Machine, error) {
+	machines, err := s.store.ListMachines(user.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	var migrated []Machine
+	for _, machine := range machines {
+		if machine.IDHashed || protocol.HashMachineID(machine.MachineID, user.APIKey) != payload.MachineID {
+			continue
+		}
+
+		machine.MachineID = payload.MachineID
+		machine.IDHashed = true
+		machine.InstanceID = ""
+		if !payload.DryRun {
+			updated, err := s.store.UpdateMachine(&machine)
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate machine: %w", err)
+			}
+			machine = *updated
+			s.logf("migrated machine %s of user %s to a hashed machine ID", machine.ID, user.ID)
+		}
+		migrated = append(migrated, machine)
+	}
+	return migrated, nil
+}
+
+// instanceCandidates 选出可能是同一个实例的记录：实例 ID 相同的记录，没有时是还没有实例 ID 的旧记录
+// 客户端没有发送实例 ID（旧客户端）时所有记录都是候选
+func instanceCandidates(machines []Machine, instanceID string) []Machine {
+	if instanceID == "" {
+		return machines
+	}
+
+	var same, legacy []Machine
+	for _, machine := range machines {
+		switch machine.InstanceID {
+		case instanceID:
+			same = append(same, machine)
+		case "":
+			legacy = append(legacy, machine)
+		}
+	}
+	if len(same) > 0 {
+		return same
+	}
+	return legacy
+}
+
+// describeEnvironment 运行环境的描述（type/platform）
+func describeEnvironment(environment, platform string) string {
+	if environment == "" {
+		return ""
+	}
+	if platform == "" {
+		return environment
+	}
+	return environment + "/" + platform
+}
+
+// matchMachine 在同一个 machine_id 的记录中找指纹最相似且达到阈值的机器
+// 没有指纹的一方（旧客户端或旧记录）只按 machine_id 匹配；没有匹配时返回 nil 和最接近的比较结果
+func matchMachine(candidates []Machine, fp fingerprint.Fingerprint) (*Machine, fingerprint.Comparison) {
+	var best *Machine
+	var bestComparison, closest fingerprint.Comparison
+	closest.Score = -1
+
+	for i := range candidates {
+		candidate := &candidates[i]
+		if len(fp) == 0 || len(candidate.Fingerprint) == 0 {
+			if best == nil {
+				best = candidate
+			}
+			continue
+		}
+
+		comparison := fingerprint.Compare(candidate.Fingerprint, fp)
+		if comparison.Score > closest.Score {
+			closest = comparison
+		}
+		if !comparison.Match(fingerprint.DefaultThreshold) {
+			continue
+		}
+		if best == nil || len(best.Fingerprint) == 0 || comparison.Score > bestComparison.Score {
+			best, bestComparison = candidate, comparison
+		}
+	}
+
+	if best == nil {
+		return nil, closest
+	}
+	return best, bestComparison
+}
+
+// describeComparison 指纹比较结果的日志描述
+func describeComparison(c fingerprint.Comparison) string {
+	desc := fmt.Sprintf("similarity %.2f", c.Score)
+	if len(c.Changed) > 0 {
+		desc += ", changed " + strings.Join(c.Changed, ",")
+	}
+	if c.Conflict != "" {
+		desc += ", conflicting " + c.Conflict
+	}
+	return desc
+}
+
+// verifyLicense 验证许可证（对应 services/license.js）
+// 返回非空状态码表示许可证无效
+func (s *Server) verifyLicense(user *User) (*License, string, string, error) {
+	license, err := s.store.FindLicenseByUserID(user.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, apperrors.CodeLicenseExpired, "No license found for user", nil
+		}
+		return nil, "", "", fmt.Errorf("failed to find license: %w", err)
+	}
+
+	if license.ExpiresAt != "" {
+		expiresAt, err := protocol.ParseTime(license.ExpiresAt)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid license expiry %q: %w", license.ExpiresAt, err)
+		}
+		if time.Now().After(expiresAt) {
+			return nil, apperrors.CodeLicenseExpired, "License has expired", nil
+		}
+	}
+
+	return license, "", "", nil
+}
+
+// logf 输出日志
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.cfg.Logger != nil {
+		s.cfg.Logger.Printf(format, args...)
+	}
+}
+
+// decryptJSON 解密并解析 JSON 数据，返回密文使用的加密方案
+//
+// agreed 不为空时密文必须使用该方案（会话协商的方案），否则可以是服务器支持的任意方案
+func (s *Server) decryptJSON(ciphertext, key, agreed string, associatedData []byte, v interface{}) (string, error) {
+	plaintext, scheme, err := encryption.DecryptAny(ciphertext, key, associatedData)
+	if err != nil {
+		return "", err
+	}
+	if encryption.NegotiateScheme([]string{scheme}, s.cfg.Schemes) == "" {
+		return "", fmt.Errorf("encryption scheme %s is not allowed", scheme)
+	}
+	if agreed != "" && scheme != agreed {
+		return "", fmt.Errorf("encryption scheme %s does not match the negotiated scheme %s", scheme, agreed)
+	}
+	return scheme, json.Unmarshal([]byte(plaintext), v)
+}
+
+// displayName 返回用户显示名称
+func displayName(user *User) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	if user.Email != "" {
+		return user.Email
+	}
+	return "User"
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
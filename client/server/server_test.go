@@ -0,0 +1,562 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/fingerprint"
+	"sqlbots-client/hardware"
+	"sqlbots-client/heartbeat"
+	"sqlbots-client/protocol"
+	"sqlbots-client/server"
+	"sqlbots-client/session"
+)
+
+const (
+	testAPIKey        = "test-api-key"
+	testEncryptionKey = "test-encryption-key"
+)
+
+// newTestServer 启动一个带一个用户和永久许可证的参考服务器，返回客户端配置
+func newTestServer(t *testing.T, cfg server.Config) (*server.Server, *server.MemoryStore, *config.Config) {
+	t.Helper()
+
+	privateKey, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.EncryptionKey = testEncryptionKey
+	cfg.PrivateKey = privateKey
+
+	store := server.NewMemoryStore()
+	store.AddUser(server.User{ID: "user-1", APIKey: testAPIKey, Username: "test"})
+	store.SetLicense(server.License{UserID: "user-1", PlanType: "pro"})
+
+	srv := server.New(cfg, store)
+	httpServer := httptest.NewServer(srv.Handler())
+	t.Cleanup(httpServer.Close)
+
+	return srv, store, &config.Config{
+		APIKey:          testAPIKey,
+		ServerURL:       httpServer.URL,
+		EncryptionKey:   testEncryptionKey,
+		ServerPublicKey: encryption.EncodeX25519PublicKey(privateKey.PublicKey()),
+	}
+}
+
+// newTestClient 创建一个独立的客户端（相当于一个客户端进程）
+func newTestClient(cfg *config.Config) *protocol.Client {
+	return protocol.NewClient(cfg, session.NewManager())
+}
+
+// testMachine 测试用的机器信息
+func testMachine(machineID string) *hardware.MachineInfo {
+	return &hardware.MachineInfo{MachineID: machineID, MachineName: "test-machine", RAM: 8, Cores: 4}
+}
+
+// 不固定服务器公钥时只有显式允许才使用旧的密钥交换流程（与目前的 Node 服务器兼容）；
+// 固定了公钥但服务器不进行密钥协商时拒绝降级
+func TestKeyExchangeWithoutKeyAgreement(t *testing.T) {
+	store := server.NewMemoryStore()
+	store.AddUser(server.User{ID: "user-1", APIKey: testAPIKey, Username: "test"})
+	store.SetLicense(server.License{UserID: "user-1", PlanType: "pro"})
+	httpServer := httptest.NewServer(server.New(server.Config{EncryptionKey: testEncryptionKey}, store).Handler())
+	defer httpServer.Close()
+
+	pinned, err := encryption.GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		publicKey string
+		legacy    bool
+		wantErr   error
+	}{
+		{"default", "", false, protocol.ErrLegacyKeyExchange},
+		{"legacy allowed", "", true, nil},
+		{"pinned key", encryption.EncodeX25519PublicKey(pinned.PublicKey()), true, protocol.ErrKeyAgreementUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(&config.Config{
+				APIKey:                 testAPIKey,
+				ServerURL:              httpServer.URL,
+				EncryptionKey:          testEncryptionKey,
+				ServerPublicKey:        tt.publicKey,
+				AllowLegacyKeyExchange: tt.legacy,
+			})
+			_, err := client.ExchangeKey(context.Background())
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("key exchange: %v", err)
+				}
+				if session, ok := client.Sessions().GetSession(); !ok || session.ID != "" {
+					t.Fatalf("legacy session: %+v", session)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if client.Sessions().HasValidSession() {
+				t.Fatal("session key stored after a refused key exchange")
+			}
+		})
+	}
+}
+
+// 有效期不足一秒的会话密钥 expires_in 为 0，客户端拒绝而不是每次请求都重新交换
+func TestKeyExchangeRejectsNonPositiveExpiresIn(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{SessionKeyTTL: 500 * time.Millisecond})
+	client := newTestClient(cfg)
+
+	_, err := client.ExchangeKey(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "expires_in") {
+		t.Fatalf("got %v, want invalid expires_in", err)
+	}
+	if client.Sessions().HasValidSession() {
+		t.Fatal("session key stored for an invalid expires_in")
+	}
+}
+
+func TestHeartbeatRoundTrip(t *testing.T) {
+	_, store, cfg := newTestServer(t, server.Config{})
+	client := newTestClient(cfg)
+	ctx := context.Background()
+
+	if _, err := client.ExchangeKey(ctx); err != nil {
+		t.Fatalf("key exchange: %v", err)
+	}
+	resp, err := heartbeat.Send(ctx, client, testMachine("machine-1"))
+	if err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if resp.StatusCode != apperrors.CodeSuccess {
+		t.Fatalf("status: got %q, want %q", resp.StatusCode, apperrors.CodeSuccess)
+	}
+
+	count, err := store.CountMachines(testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("machines: got %d, want 1", count)
+	}
+}
+
+// 同一台机器上后启动的进程（doctor、heartbeat --once、克隆的实例）不能让正在运行的进程收到 REPLAY_DETECTED
+func TestHeartbeatConcurrentProcessesOnSameMachine(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{})
+	ctx := context.Background()
+	machine := testMachine("machine-1")
+
+	running := newTestClient(cfg)
+	if _, err := heartbeat.Send(ctx, running, machine); err != nil {
+		t.Fatalf("first heartbeat: %v", err)
+	}
+
+	// 后启动的进程序号从更晚的时间开始
+	later := newTestClient(cfg)
+	if _, err := heartbeat.Send(ctx, later, machine); err != nil {
+		t.Fatalf("second process heartbeat: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := heartbeat.Send(ctx, running, machine); err != nil {
+			t.Fatalf("heartbeat %d from the running process: %v", i, err)
+		}
+	}
+}
+
+// 并发的首次心跳不能超出每个用户的机器数量上限
+func TestHeartbeatConcurrentRegistrationRespectsLimit(t *testing.T) {
+	_, store, cfg := newTestServer(t, server.Config{MaxMachinesPerUser: 3})
+	ctx := context.Background()
+
+	const machines = 10
+	var wg sync.WaitGroup
+	for i := 0; i < machines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = heartbeat.Send(ctx, newTestClient(cfg), testMachine(fmt.Sprintf("machine-%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	count, err := store.CountMachines(testAPIKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("machines: got %d, want 3", count)
+	}
+}
+
+// postHeartbeat 发送一个手工构造的心跳请求，返回 HTTP 状态码和明文错误响应的状态码（成功时为空）
+func postHeartbeat(t *testing.T, serverURL, sessionID, scheme, key string) (int, string) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"machine_id": "machine-1", "machine_name": "test-machine", "ram": 8, "cores": 4,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryption.EncryptWithScheme(scheme, string(payload), key, encryption.AssociatedData(protocol.PathHeartbeat, testAPIKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &protocol.EncryptedRequest{
+		APIKey:        testAPIKey,
+		EncryptedData: encrypted,
+		UseSessionKey: true,
+		Scheme:        scheme,
+		SessionID:     sessionID,
+	}
+	request.Signature = encryption.Sign(key, protocol.SignatureFields(protocol.PathHeartbeat, request)...)
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(serverURL+protocol.PathHeartbeat, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode string `json:"status_code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result.StatusCode
+}
+
+// X25519 会话只接受协商的会话密钥和加密方案
+func TestHeartbeatSessionRejectsDowngrade(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{})
+	cfg.EncryptionSchemes = []string{encryption.SchemeAESGCM}
+	client := newTestClient(cfg)
+	if _, err := client.ExchangeKey(context.Background()); err != nil {
+		t.Fatalf("key exchange: %v", err)
+	}
+	agreed, ok := client.Sessions().GetSession()
+	if !ok || agreed.ID == "" {
+		t.Fatal("no X25519 session after key exchange")
+	}
+
+	if status, code := postHeartbeat(t, cfg.ServerURL, agreed.ID, encryption.SchemeAESGCM, agreed.Key); status != http.StatusOK {
+		t.Fatalf("session key: got HTTP %d (%s), want 200", status, code)
+	}
+	if status, _ := postHeartbeat(t, cfg.ServerURL, agreed.ID, encryption.SchemeAESGCM, testEncryptionKey); status == http.StatusOK {
+		t.Fatal("static key accepted for an X25519 session")
+	}
+	if status, _ := postHeartbeat(t, cfg.ServerURL, agreed.ID, encryption.SchemeLegacy, agreed.Key); status == http.StatusOK {
+		t.Fatal("scheme other than the negotiated one accepted")
+	}
+}
+
+// vmInstance 同一个虚拟机镜像（相同的原始机器 ID）的一个实例，按租户哈希后发送
+func vmInstance(productUUID, memory string) *hardware.MachineInfo {
+	m := testMachine("image-machine-id")
+	m.InstanceID = "instance-" + productUUID
+	m.Environment = hardware.Environment{Type: hardware.EnvVM, Platform: "kvm"}
+	m.Fingerprint = fingerprint.Fingerprint{}
+	m.Fingerprint.Add(fingerprint.ProductUUID, productUUID)
+	m.Fingerprint.Add(fingerprint.CPU, "Xeon")
+	m.Fingerprint.Add(fingerprint.Disks, "disk-"+productUUID)
+	m.Fingerprint.Add(fingerprint.Memory, memory)
+	m.Protect(testAPIKey)
+	return m
+}
+
+// heartbeatCode 发送心跳，返回响应或错误中的状态码
+func heartbeatCode(t *testing.T, client *protocol.Client, machine *hardware.MachineInfo) string {
+	t.Helper()
+	resp, err := heartbeat.Send(context.Background(), client, machine)
+	if err != nil {
+		if code := apperrors.CodeOf(err); code != "" {
+			return code
+		}
+		t.Fatalf("heartbeat: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// 克隆的虚拟机共享机器 ID，但作为不同的机器占用名额；同一台机器的硬件小变化不占用新名额
+func TestHeartbeatClonedVMsCountAgainstLimit(t *testing.T) {
+	_, store, cfg := newTestServer(t, server.Config{MaxMachinesPerUser: 2})
+	client := newTestClient(cfg)
+
+	if code := heartbeatCode(t, client, vmInstance("uuid-1", "16")); code != apperrors.CodeSuccess {
+		t.Fatalf("original: %s", code)
+	}
+	if code := heartbeatCode(t, client, vmInstance("uuid-1", "32")); code != apperrors.CodeSuccess {
+		t.Fatalf("memory upgrade: %s", code)
+	}
+	if count, _ := store.CountMachines(testAPIKey); count != 1 {
+		t.Fatalf("machines after memory upgrade: got %d, want 1", count)
+	}
+
+	if code := heartbeatCode(t, client, vmInstance("uuid-2", "16")); code != apperrors.CodeSuccess {
+		t.Fatalf("first clone: %s", code)
+	}
+	if count, _ := store.CountMachines(testAPIKey); count != 2 {
+		t.Fatalf("machines after clone: got %d, want 2", count)
+	}
+	if code := heartbeatCode(t, client, vmInstance("uuid-3", "16")); code != apperrors.CodeMachineLimitExceeded {
+		t.Fatalf("second clone: got %s, want %s", code, apperrors.CodeMachineLimitExceeded)
+	}
+}
+
+// 旧客户端用原始机器 ID 注册的记录，在迁移窗口内由发送哈希 ID 的客户端接管
+func TestHeartbeatMigratesLegacyMachineIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		until    time.Time
+		migrated bool
+	}{
+		{"no deadline", time.Time{}, true},
+		{"within the window", time.Now().Add(time.Hour), true},
+		{"after the window", time.Now().Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, store, cfg := newTestServer(t, server.Config{LegacyMachineIDsUntil: tt.until})
+			legacy, err := store.CreateMachine(&server.Machine{MachineID: "raw-machine-id", APIKey: testAPIKey, Name: "old", InstanceID: "raw-instance"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			machine := testMachine("raw-machine-id")
+			machine.InstanceID = "instance-1"
+			machine.Protect(testAPIKey)
+			if code := heartbeatCode(t, newTestClient(cfg), machine); code != apperrors.CodeSuccess {
+				t.Fatalf("heartbeat: %s", code)
+			}
+
+			machines, err := store.ListMachines(testAPIKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.migrated {
+				if len(machines) != 2 {
+					t.Fatalf("machines: got %d, want the legacy record and a new one", len(machines))
+				}
+				return
+			}
+			if len(machines) != 1 {
+				t.Fatalf("machines: got %d, want 1", len(machines))
+			}
+			m := machines[0]
+			if m.ID != legacy.ID || m.MachineID != protocol.HashMachineID("raw-machine-id", testAPIKey) || !m.IDHashed || m.InstanceID != machine.InstanceID {
+				t.Fatalf("migrated record: %+v", m)
+			}
+		})
+	}
+}
+
+// 推送连接：心跳带上连接 ID 后连接绑定到机器，新指令立即推送事件
+func TestHeartbeatOverStream(t *testing.T) {
+	commandKey, err := encryption.GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, store, cfg := newTestServer(t, server.Config{CommandKey: commandKey})
+	client := newTestClient(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := heartbeat.Send(ctx, client, testMachine("machine-1")); err != nil {
+		t.Fatalf("heartbeat over stream: %v", err)
+	}
+	machines, err := store.ListMachines(testAPIKey)
+	if err != nil || len(machines) != 1 {
+		t.Fatalf("machines: %v, %v", machines, err)
+	}
+
+	if _, err := srv.EnqueueCommand(machines[0].ID, protocol.CommandRotateKeys, nil, time.Minute); err != nil {
+		t.Fatalf("enqueue command: %v", err)
+	}
+	select {
+	case event := <-stream.Events():
+		if event != protocol.EventCommands {
+			t.Fatalf("event: got %q, want %q", event, protocol.EventCommands)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event after enqueuing a command")
+	}
+
+	resp, err := heartbeat.Send(ctx, client, testMachine("machine-1"))
+	if err != nil {
+		t.Fatalf("heartbeat after event: %v", err)
+	}
+	if len(resp.Commands) != 1 || resp.Commands[0].Type != protocol.CommandRotateKeys {
+		t.Fatalf("commands: %+v", resp.Commands)
+	}
+}
+
+// 未绑定的推送连接有数量上限，心跳绑定后释放名额
+func TestStreamLimitsUnboundConnections(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{MaxPendingStreams: 2})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var clients []*protocol.Client
+	for i := 0; i < 2; i++ {
+		client := newTestClient(cfg)
+		stream, err := client.OpenStream(ctx)
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		defer stream.Close()
+		clients = append(clients, client)
+	}
+
+	extra := newTestClient(cfg)
+	_, err := extra.OpenStream(ctx)
+	var protocolErr *apperrors.ProtocolError
+	if !errors.As(err, &protocolErr) || protocolErr.HTTPStatus != http.StatusServiceUnavailable {
+		t.Fatalf("stream over the limit: got %v, want HTTP 503", err)
+	}
+
+	if _, err := heartbeat.Send(ctx, clients[0], testMachine("machine-1")); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	stream, err := extra.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("stream after binding another: %v", err)
+	}
+	stream.Close()
+}
+
+// openSignedStream 用指定的认证头打开推送连接，返回 HTTP 状态码和状态码字段
+func openSignedStream(t *testing.T, serverURL string, headers map[string]string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, serverURL+protocol.PathStream, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, ""
+	}
+	var body struct {
+		StatusCode string `json:"status_code"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.StatusCode
+}
+
+// 打开推送连接需要用密钥签名，签名的请求不能重放
+func TestStreamRequiresSignedRequest(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{})
+	signed := func(apiKey, key, nonce string) map[string]string {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		return map[string]string{
+			protocol.HeaderAPIKey:    apiKey,
+			protocol.HeaderTimestamp: timestamp,
+			protocol.HeaderNonce:     nonce,
+			protocol.HeaderSignature: encryption.Sign(key, protocol.StreamSignatureFields(apiKey, "", timestamp, nonce)...),
+		}
+	}
+
+	valid := signed(testAPIKey, testEncryptionKey, "nonce-1")
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantHTTP int
+		wantCode string
+	}{
+		{"unsigned", nil, http.StatusUnauthorized, apperrors.CodeInvalidSignature},
+		{"wrong api key", signed("wrong-key", testEncryptionKey, "nonce-2"), http.StatusUnauthorized, apperrors.CodeInvalidAPIKey},
+		{"wrong signing key", signed(testAPIKey, "other-key", "nonce-3"), http.StatusUnauthorized, apperrors.CodeInvalidSignature},
+		{"unknown session", map[string]string{protocol.HeaderAPIKey: testAPIKey, protocol.HeaderSessionID: "unknown", protocol.HeaderSignature: "x"}, http.StatusBadRequest, apperrors.CodeDecryptionFailed},
+		{"signed", valid, http.StatusOK, ""},
+		{"replayed", valid, http.StatusBadRequest, apperrors.CodeReplayDetected},
+	}
+	for _, tt := range tests {
+		status, code := openSignedStream(t, cfg.ServerURL, tt.headers)
+		if status != tt.wantHTTP || code != tt.wantCode {
+			t.Errorf("%s: got HTTP %d %q, want HTTP %d %q", tt.name, status, code, tt.wantHTTP, tt.wantCode)
+		}
+	}
+}
+
+// streamIDInjector 在心跳请求体中替换连接 ID（不重新签名）
+type streamIDInjector struct {
+	streamID string
+}
+
+func (i *streamIDInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == protocol.PathHeartbeat {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		body["stream_id"] = i.streamID
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// 连接 ID 包含在心跳签名中，不能替换成其他连接的 ID
+func TestHeartbeatStreamIDIsSigned(t *testing.T) {
+	_, _, cfg := newTestServer(t, server.Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner := newTestClient(cfg)
+	stream, err := owner.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer stream.Close()
+
+	injected := protocol.NewClient(cfg, session.NewManager(), protocol.WithHTTPClient(&http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &streamIDInjector{streamID: stream.ID()},
+	}))
+	_, err = heartbeat.Send(ctx, injected, testMachine("machine-2"))
+	if apperrors.CodeOf(err) != apperrors.CodeInvalidSignature {
+		t.Fatalf("heartbeat with an injected stream id: got %v, want %s", err, apperrors.CodeInvalidSignature)
+	}
+}
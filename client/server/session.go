@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const sessionKeyChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// sessionEntry 单个会话密钥
+type sessionEntry struct {
+	userID    string
+	key       string
+	scheme    string // 交换时协商的加密方案（只记录 X25519 会话；legacy 会话密钥由用户的所有客户端共用）
+	expiresAt time.Time
+	createdAt time.Time
+}
+
+// sessionStore 会话密钥管理器（仅保存在内存中）
+// legacy 流程每个用户一个会话密钥；X25519 密钥协商每次交换一个会话，按会话 ID 保存，
+// 每个用户最多保存 maxAgreed 个，超出时删除该用户最早的会话
+type sessionStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	maxAgreed int
+	keys      map[string]*sessionEntry // 按用户 ID
+	agreed    map[string]*sessionEntry // 按会话 ID
+	userIDs   map[string][]string      // 每个用户的会话 ID（按创建时间排序）
+}
+
+// newSessionStore 创建会话密钥管理器
+func newSessionStore(ttl time.Duration, maxAgreed int) *sessionStore {
+	return &sessionStore{
+		ttl:       ttl,
+		maxAgreed: maxAgreed,
+		keys:      make(map[string]*sessionEntry),
+		agreed:    make(map[string]*sessionEntry),
+		userIDs:   make(map[string][]string),
+	}
+}
+
+// getOrCreate 获取或创建用户的会话密钥
+func (s *sessionStore) getOrCreate(userID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := s.keys[userID]; ok && now.Before(entry.expiresAt) {
+		return entry.key, nil
+	}
+
+	key, err := generateSessionKey()
+	if err != nil {
+		return "", err
+	}
+	s.keys[userID] = &sessionEntry{
+		userID:    userID,
+		key:       key,
+		expiresAt: now.Add(s.ttl),
+		createdAt: now,
+	}
+
+	return key, nil
+}
+
+// get 获取用户的会话密钥（不创建新密钥）
+func (s *sessionStore) get(userID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.keys[userID]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return "", false
+	}
+	return entry.key, true
+}
+
+// putAgreed 保存密钥协商得到的会话密钥和协商的加密方案，返回新的会话 ID
+//
+// 用户的会话达到上限时删除最早的会话：使用被删除会话的客户端收到 DECRYPTION_FAILED 后重新交换密钥
+func (s *sessionStore) putAgreed(userID, key, scheme string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	ids := s.pruneUser(userID, now)
+	for len(ids) >= s.maxAgreed {
+		delete(s.agreed, ids[0])
+		ids = ids[1:]
+	}
+
+	id := newRecordID()
+	s.agreed[id] = &sessionEntry{
+		userID:    userID,
+		key:       key,
+		scheme:    scheme,
+		expiresAt: now.Add(s.ttl),
+		createdAt: now,
+	}
+	s.userIDs[userID] = append(ids, id)
+	return id
+}
+
+// pruneUser 删除用户过期的会话，返回剩余的会话 ID（调用方持有锁）
+func (s *sessionStore) pruneUser(userID string, now time.Time) []string {
+	ids := s.userIDs[userID]
+	live := ids[:0]
+	for _, id := range ids {
+		if entry, ok := s.agreed[id]; ok && now.Before(entry.expiresAt) {
+			live = append(live, id)
+		} else {
+			delete(s.agreed, id)
+		}
+	}
+	if len(live) == 0 {
+		delete(s.userIDs, userID)
+		return nil
+	}
+	s.userIDs[userID] = live
+	return live
+}
+
+// getAgreed 通过会话 ID 获取会话密钥和协商的加密方案（会话必须属于该用户）
+func (s *sessionStore) getAgreed(id, userID string) (string, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.agreed[id]
+	if !ok || entry.userID != userID || !time.Now().Before(entry.expiresAt) {
+		return "", "", false
+	}
+	return entry.key, entry.scheme, true
+}
+
+// cleanup 清理过期的会话密钥
+func (s *sessionStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for userID, entry := range s.keys {
+		if !now.Before(entry.expiresAt) {
+			delete(s.keys, userID)
+		}
+	}
+	for userID := range s.userIDs {
+		s.pruneUser(userID, now)
+	}
+}
+
+// generateSessionKey 生成随机会话密钥（32字符）
+func generateSessionKey() (string, error) {
+	key := make([]byte, 32)
+	max := big.NewInt(int64(len(sessionKeyChars)))
+	for i := range key {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		key[i] = sessionKeyChars[n.Int64()]
+	}
+	return string(key), nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 用户的会话达到上限时删除最早的会话，其他用户的会话不受影响
+func TestSessionStoreEvictsOldestAgreedSession(t *testing.T) {
+	s := newSessionStore(time.Hour, 3)
+
+	other := s.putAgreed("user-2", "other-key", "aes-gcm")
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, s.putAgreed("user-1", fmt.Sprintf("key-%d", i), "aes-gcm"))
+	}
+
+	for i, id := range ids {
+		key, _, ok := s.getAgreed(id, "user-1")
+		if want := i >= 2; ok != want {
+			t.Errorf("session %d: found %v, want %v", i, ok, want)
+		}
+		if ok && key != fmt.Sprintf("key-%d", i) {
+			t.Errorf("session %d: key %q", i, key)
+		}
+	}
+	if _, _, ok := s.getAgreed(other, "user-2"); !ok {
+		t.Error("other user's session evicted")
+	}
+	if len(s.agreed) != 4 || len(s.userIDs["user-1"]) != 3 {
+		t.Fatalf("%d sessions, %d for user-1", len(s.agreed), len(s.userIDs["user-1"]))
+	}
+}
+
+// 过期的会话不占用名额，cleanup 同时清理会话 ID 列表
+func TestSessionStoreExpiredAgreedSessions(t *testing.T) {
+	s := newSessionStore(time.Hour, 2)
+	expired := s.putAgreed("user-1", "expired", "aes-gcm")
+	s.agreed[expired].expiresAt = time.Now().Add(-time.Second)
+	live := s.putAgreed("user-1", "live", "aes-gcm")
+	latest := s.putAgreed("user-1", "latest", "aes-gcm")
+
+	for _, id := range []string{live, latest} {
+		if _, _, ok := s.getAgreed(id, "user-1"); !ok {
+			t.Fatalf("session %s evicted while an expired session was kept", id)
+		}
+	}
+	if _, ok := s.agreed[expired]; ok {
+		t.Fatal("expired session kept")
+	}
+
+	for _, id := range []string{live, latest} {
+		s.agreed[id].expiresAt = time.Now().Add(-time.Second)
+	}
+	s.cleanup()
+	if len(s.agreed) != 0 || len(s.userIDs) != 0 {
+		t.Fatalf("after cleanup: %d sessions, %d users", len(s.agreed), len(s.userIDs))
+	}
+}
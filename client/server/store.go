@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"sqlbots-client/fingerprint"
+	"sqlbots-client/protocol"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("record not found")
+
+// ErrMachineLimitExceeded 用户的机器数量已达到上限
+var ErrMachineLimitExceeded = errors.New("machine limit exceeded")
+
+// User 用户记录（对应 users 表）
+type User struct {
+	ID       string `json:"id"`
+	APIKey   string `json:"api_key"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// License 许可证记录（对应 licenses 表）
+type License struct {
+	UserID    string `json:"user_id"`
+	ExpiresAt string `json:"expires_at,omitempty"` // RFC3339，空表示永久有效
+	PlanType  string `json:"plan_type"`
+}
+
+// Machine 机器记录（对应 machines 表）
+type Machine struct {
+	ID        string    `json:"id"`
+	MachineID string    `json:"machine"`
+	APIKey    string    `json:"api_key"`
+	Name      string    `json:"name"`
+	RAM       int       `json:"ram"`
+	Cores     int       `json:"cores"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// IDHashed MachineID 是客户端按租户哈希的 ID（旧记录保存原始机器 ID）
+	IDHashed bool `json:"id_hashed,omitempty"`
+	// InstanceID 实例 ID（同一个 machine_id 的克隆虚拟机和容器各不相同，旧记录为空）
+	InstanceID string `json:"instance_id,omitempty"`
+	// Environment 运行环境和平台，例如 vm/kvm、container/docker
+	Environment string `json:"environment,omitempty"`
+	// Fingerprint 最近一次心跳的硬件指纹（旧记录为空）
+	Fingerprint fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+	// Telemetry 最近一次心跳附带的遥测数据（客户端没有开启遥测时为空）
+	Telemetry *protocol.Telemetry `json:"telemetry,omitempty"`
+	// Metrics 最近一次心跳附带的自定义采集器结果
+	Metrics []protocol.CollectorResult `json:"metrics,omitempty"`
+	// Workloads 最近一次心跳附带的托管进程状态
+	Workloads []protocol.WorkloadStatus `json:"workloads,omitempty"`
+}
+
+// CommandRecord 下发给机器的指令（对应 commands 表）
+type CommandRecord struct {
+	MachineRecordID string                  `json:"machine"` // machines 表的记录 ID
+	Command         protocol.Command        `json:"command"`
+	Result          *protocol.CommandResult `json:"result,omitempty"` // 客户端确认之前为空
+	CreatedAt       time.Time               `json:"created_at"`
+}
+
+// Store 服务器数据存储接口
+type Store interface {
+	// FindUserByAPIKey 通过 API Key 查找用户
+	FindUserByAPIKey(apiKey string) (*User, error)
+	// FindMachines 通过 machine_id 和 api_key 查找机器（克隆的机器可能有多条记录）
+	FindMachines(machineID, apiKey string) ([]Machine, error)
+	// ListMachines 列出 API Key 下的所有机器
+	ListMachines(apiKey string) ([]Machine, error)
+	// CountMachines 统计 API Key 下的机器数量
+	CountMachines(apiKey string) (int, error)
+	// CreateMachineWithLimit 在 API Key 下的机器少于 limit 台时创建新机器，否则返回 ErrMachineLimitExceeded
+	// （检查和创建必须是原子的，并发的首次心跳不能超出上限）
+	CreateMachineWithLimit(machine *Machine, limit int) (*Machine, error)
+	// UpdateMachine 按记录 ID 更新机器信息
+	UpdateMachine(machine *Machine) (*Machine, error)
+	// FindMachineByID 按记录 ID 查找机器
+	FindMachineByID(id string) (*Machine, error)
+	// DeleteMachine 按记录 ID 删除机器（注销后释放机器名额）
+	DeleteMachine(id string) error
+	// CreateCommand 保存待下发的指令
+	CreateCommand(record *CommandRecord) error
+	// PendingCommands 返回机器还没有确认且没有过期的指令（按创建顺序）
+	PendingCommands(machineRecordID string, now time.Time) ([]protocol.Command, error)
+	// CompleteCommand 保存客户端确认的执行结果（重复确认时保留第一次的结果）
+	CompleteCommand(machineRecordID string, result protocol.CommandResult) (*CommandRecord, error)
+	// FindLicenseByUserID 通过用户 ID 查找许可证
+	FindLicenseByUserID(userID string) (*License, error)
+	// UpdateLicense 设置用户的许可证（已存在则覆盖）
+	UpdateLicense(license *License) error
+}
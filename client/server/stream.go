@@ -0,0 +1,389 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sqlbots-client/encryption"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/protocol"
+)
+
+const (
+	// streamAuthTimeout 连接建立后必须在此时间内通过心跳绑定到机器，否则断开
+	streamAuthTimeout = 30 * time.Second
+	// streamLicenseCheckInterval 检查已连接用户许可证状态的间隔，状态变化（例如到期或直接修改了存储）时推送 license 事件
+	streamLicenseCheckInterval = 30 * time.Second
+	// streamWriteTimeout 向连接写入一个事件的超时时间（客户端不再读取时断开）
+	streamWriteTimeout = 10 * time.Second
+
+	// DefaultMaxPendingStreams 默认允许同时存在的未绑定推送连接数量
+	DefaultMaxPendingStreams = 256
+	// maxPendingStreamsPerIP 每个来源地址允许同时存在的未绑定推送连接数量
+	maxPendingStreamsPerIP = 8
+)
+
+// errTooManyStreams 未绑定的推送连接过多
+var errTooManyStreams = errors.New("too many unbound push streams")
+
+// streamConn 一条推送连接（打开时已认证用户，该用户的心跳带上连接 ID 并成功后绑定到机器）
+type streamConn struct {
+	id     string
+	userID string // 打开连接的用户（只有该用户的心跳可以绑定）
+	remote string // 来源地址（用于限制未绑定的连接数量）
+	events chan string
+	closed chan struct{}
+	once   sync.Once
+
+	mu              sync.Mutex
+	machineRecordID string
+	license         string // 最近一次推送或心跳时的许可证状态
+}
+
+// machine 返回绑定的机器（未绑定时为空）
+func (c *streamConn) machine() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.machineRecordID
+}
+
+// licenseChanged 记录最新的许可证状态，返回是否与上次不同
+func (c *streamConn) licenseChanged(license string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.license == license {
+		return false
+	}
+	c.license = license
+	return true
+}
+
+// send 推送一个事件（队列满时丢弃，事件只是提醒客户端发送心跳）
+func (c *streamConn) send(event string) {
+	select {
+	case c.events <- event:
+	default:
+	}
+}
+
+// close 断开连接
+func (c *streamConn) close() {
+	c.once.Do(func() { close(c.closed) })
+}
+
+// streamHub 所有推送连接
+//
+// 每台机器只保留一条绑定的连接，因此每个用户的绑定连接数量不超过其机器数量
+type streamHub struct {
+	maxPending int
+
+	mu       sync.Mutex
+	conns    map[string]*streamConn
+	machines map[string]*streamConn // 按机器记录 ID 的绑定连接
+	pending  map[string]int         // 按来源地址统计的未绑定连接数量
+	total    int                    // 未绑定连接总数
+}
+
+// newStreamHub 创建推送连接集合
+func newStreamHub(maxPending int) *streamHub {
+	return &streamHub{
+		maxPending: maxPending,
+		conns:      make(map[string]*streamConn),
+		machines:   make(map[string]*streamConn),
+		pending:    make(map[string]int),
+	}
+}
+
+// open 为已认证的用户创建未绑定的连接（未绑定的连接总数或同一来源地址的数量达到上限时返回 errTooManyStreams）
+func (h *streamHub) open(userID, remote string) (*streamConn, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate stream id: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total >= h.maxPending || h.pending[remote] >= maxPendingStreamsPerIP {
+		return nil, errTooManyStreams
+	}
+	h.total++
+	h.pending[remote]++
+
+	c := &streamConn{
+		id:     hex.EncodeToString(id),
+		userID: userID,
+		remote: remote,
+		events: make(chan string, 8),
+		closed: make(chan struct{}),
+	}
+	h.conns[c.id] = c
+	return c, nil
+}
+
+// bind 心跳成功后把连接绑定到机器，之后才会推送事件
+//
+// 只有打开连接的用户可以绑定，其他用户的心跳带上这个连接 ID 时忽略。
+// 机器已经有绑定的连接时（例如客户端重连后旧连接还没有断开）关闭旧连接
+func (h *streamHub) bind(id, userID, machineRecordID, license string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.conns[id]
+	if !ok || c.userID != userID {
+		return
+	}
+	if previous, ok := h.machines[machineRecordID]; ok && previous != c {
+		previous.close()
+	}
+	h.machines[machineRecordID] = c
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.machineRecordID {
+	case "":
+		h.release(c.remote)
+	case machineRecordID:
+	default:
+		delete(h.machines, c.machineRecordID)
+	}
+	c.machineRecordID, c.license = machineRecordID, license
+}
+
+// remove 移除连接
+func (h *streamHub) remove(c *streamConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c.id]; !ok {
+		return
+	}
+	delete(h.conns, c.id)
+	machine := c.machine()
+	if machine == "" {
+		h.release(c.remote)
+	} else if h.machines[machine] == c {
+		delete(h.machines, machine)
+	}
+}
+
+// release 减少未绑定连接的计数（调用方持有 h.mu）
+func (h *streamHub) release(remote string) {
+	h.total--
+	if h.pending[remote]--; h.pending[remote] <= 0 {
+		delete(h.pending, remote)
+	}
+}
+
+// notifyMachine 向机器的所有推送连接发送事件
+func (h *streamHub) notifyMachine(machineRecordID, event string) {
+	h.notify(event, func(_, machine string) bool { return machine == machineRecordID })
+}
+
+// notifyUser 向用户的所有推送连接发送事件
+func (h *streamHub) notifyUser(userID, event string) {
+	h.notify(event, func(user, _ string) bool { return user == userID })
+}
+
+// notify 向绑定关系满足 match 的连接发送事件（未绑定的连接不会收到事件）
+func (h *streamHub) notify(event string, match func(userID, machineRecordID string) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.conns {
+		if machine := c.machine(); machine != "" && match(c.userID, machine) {
+			c.send(event)
+		}
+	}
+}
+
+// closeAll 关闭所有连接
+func (h *streamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.conns {
+		c.close()
+	}
+}
+
+// CloseStreams 关闭所有推送连接（客户端回到 HTTP 轮询并自动重连），用于服务器关闭时
+func (s *Server) CloseStreams() {
+	s.streams.closeAll()
+}
+
+// handleStream 推送连接（Server-Sent Events）
+//
+// 打开连接的请求用会话密钥签名（见 authenticateStream）。连接建立后先发送 ready 事件告知连接 ID；
+// 客户端发送心跳时在签名的请求体中带上连接 ID，心跳成功后连接绑定到机器，
+// 有新指令或许可证状态变化时推送事件，客户端收到后立即发送心跳。
+// 未绑定的连接只能收到 ready 和 ping，超时未绑定时断开，同时存在的数量也有上限
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse(apperrors.CodeServerError, "Method not allowed"))
+		return
+	}
+
+	user, ok := s.authenticateStream(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := s.streams.open(user.ID, remoteHost(r))
+	if err != nil {
+		if errors.Is(err, errTooManyStreams) {
+			w.Header().Set("Retry-After", "30")
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse(apperrors.CodeServerError, "Too many push streams"))
+			return
+		}
+		s.logf("stream error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return
+	}
+	defer s.streams.remove(conn)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // 反向代理不要缓冲事件
+	w.WriteHeader(http.StatusOK)
+
+	// 每次写入设置超时，客户端不再读取时断开
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...interface{}) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !write("event: %s\ndata: %s\n\n", protocol.EventReady, conn.id) {
+		return
+	}
+
+	ping := time.NewTicker(protocol.StreamPingInterval)
+	defer ping.Stop()
+	licenseCheck := time.NewTicker(streamLicenseCheckInterval)
+	defer licenseCheck.Stop()
+	authTimeout := time.NewTimer(streamAuthTimeout)
+	defer authTimeout.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-conn.closed:
+			return
+		case event := <-conn.events:
+			if !write("event: %s\ndata:\n\n", event) {
+				return
+			}
+		case <-ping.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-authTimeout.C:
+			if conn.machine() == "" {
+				s.logf("stream from %s was not bound by a heartbeat, closing", r.RemoteAddr)
+				return
+			}
+		case <-licenseCheck.C:
+			if conn.machine() == "" {
+				continue
+			}
+			license, statusCode, _, err := s.verifyLicense(&User{ID: conn.userID})
+			if err != nil {
+				s.logf("stream license check error: %v", err)
+				continue
+			}
+			if conn.licenseChanged(licenseState(license, statusCode)) && !write("event: %s\ndata:\n\n", protocol.EventLicense) {
+				return
+			}
+		}
+	}
+}
+
+// authenticateStream 验证打开推送连接的请求：API Key、时间戳和 nonce（重放保护），以及用会话密钥计算的签名
+//
+// X25519 会话只接受协商的会话密钥；legacy 会话接受用户的会话密钥或初始密钥（与心跳相同）。
+// 验证失败时写入错误响应并返回 false
+func (s *Server) authenticateStream(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	apiKey := r.Header.Get(protocol.HeaderAPIKey)
+	signature := r.Header.Get(protocol.HeaderSignature)
+	if apiKey == "" || signature == "" {
+		writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidSignature, "Signed stream request is required"))
+		return nil, false
+	}
+
+	user, err := s.store.FindUserByAPIKey(apiKey)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidAPIKey, "Invalid API Key"))
+			return nil, false
+		}
+		s.logf("stream error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(apperrors.CodeServerError, fmt.Sprintf("Internal server error: %v", err)))
+		return nil, false
+	}
+
+	sessionID := r.Header.Get(protocol.HeaderSessionID)
+	var candidates []string
+	if sessionID != "" {
+		key, _, ok := s.sessions.getAgreed(sessionID, user.ID)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeDecryptionFailed, "Unknown or expired session"))
+			return nil, false
+		}
+		candidates = []string{key}
+	} else {
+		if key, ok := s.sessions.get(user.ID); ok {
+			candidates = append(candidates, key)
+		}
+		candidates = append(candidates, s.cfg.EncryptionKey)
+	}
+
+	timestamp, nonce := r.Header.Get(protocol.HeaderTimestamp), r.Header.Get(protocol.HeaderNonce)
+	fields := protocol.StreamSignatureFields(apiKey, sessionID, timestamp, nonce)
+	verified := false
+	for _, key := range candidates {
+		if encryption.Verify(key, signature, fields...) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		writeJSON(w, http.StatusUnauthorized, errorResponse(apperrors.CodeInvalidSignature, "Invalid request signature"))
+		return nil, false
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse(apperrors.CodeStaleRequest, "timestamp and nonce are required"))
+		return nil, false
+	}
+	if statusCode, message := s.replay.check(user.ID, "", protocol.Freshness{Timestamp: unix, Nonce: nonce}, time.Now()); statusCode != "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse(statusCode, message))
+		return nil, false
+	}
+
+	return user, true
+}
+
+// remoteHost 请求的来源地址（不含端口）
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// licenseState 许可证状态的摘要（用于判断是否变化）
+func licenseState(license *License, statusCode string) string {
+	if statusCode != "" {
+		return statusCode
+	}
+	return license.ExpiresAt + "|" + license.PlanType
+}
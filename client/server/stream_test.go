@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+// 只有打开连接的用户可以把连接绑定到机器，绑定后释放未绑定连接的名额
+func TestStreamHubBindsOnlyOwner(t *testing.T) {
+	h := newStreamHub(1)
+	c, err := h.open("user-1", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.open("user-2", "192.0.2.2"); !errors.Is(err, errTooManyStreams) {
+		t.Fatalf("second unbound stream: got %v, want errTooManyStreams", err)
+	}
+
+	h.bind(c.id, "user-2", "machine-2", "")
+	if c.machine() != "" {
+		t.Fatal("stream bound by another user")
+	}
+	h.notifyUser("user-2", "license")
+	if len(c.events) != 0 {
+		t.Fatal("unbound stream received an event")
+	}
+
+	h.bind(c.id, "user-1", "machine-1", "")
+	if c.machine() != "machine-1" {
+		t.Fatalf("stream not bound by its owner: %q", c.machine())
+	}
+	h.notifyMachine("machine-1", "commands")
+	if event := <-c.events; event != "commands" {
+		t.Fatalf("event: %q", event)
+	}
+
+	other, err := h.open("user-2", "192.0.2.2")
+	if err != nil {
+		t.Fatalf("binding did not release the pending slot: %v", err)
+	}
+	h.remove(other)
+	h.remove(c)
+	if h.total != 0 || len(h.pending) != 0 || len(h.conns) != 0 {
+		t.Fatalf("hub not empty: total %d, pending %v, conns %d", h.total, h.pending, len(h.conns))
+	}
+}
+
+// 每台机器只保留最新绑定的连接，旧连接被关闭，关闭后移除的旧连接不影响新的绑定
+func TestStreamHubReplacesMachineStream(t *testing.T) {
+	h := newStreamHub(8)
+	first, err := h.open("user-1", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.open("user-1", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.bind(first.id, "user-1", "machine-1", "")
+	h.bind(first.id, "user-1", "machine-1", "") // 每次心跳都会重新绑定
+	select {
+	case <-first.closed:
+		t.Fatal("rebinding the same stream closed it")
+	default:
+	}
+
+	h.bind(second.id, "user-1", "machine-1", "")
+	select {
+	case <-first.closed:
+	default:
+		t.Fatal("previous stream of the machine not closed")
+	}
+	h.remove(first)
+	if h.machines["machine-1"] != second {
+		t.Fatal("removing the replaced stream dropped the new binding")
+	}
+	h.notifyMachine("machine-1", "commands")
+	if event := <-second.events; event != "commands" {
+		t.Fatalf("event: %q", event)
+	}
+
+	// 绑定到另一台机器时释放原来的机器
+	h.bind(second.id, "user-1", "machine-2", "")
+	if _, ok := h.machines["machine-1"]; ok || h.machines["machine-2"] != second {
+		t.Fatalf("machines: %v", h.machines)
+	}
+	h.remove(second)
+	if len(h.machines) != 0 || len(h.conns) != 0 || h.total != 0 {
+		t.Fatalf("hub not empty: machines %d, conns %d, total %d", len(h.machines), len(h.conns), h.total)
+	}
+}
@@ -7,14 +7,28 @@ import (
 
 // SessionKey 会话密钥结构
 type SessionKey struct {
-	Key       string
-	ExpiresAt time.Time
+	ID         string // 服务器分配的会话 ID（X25519 密钥协商时使用，legacy 流程为空）
+	Key        string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	Generation uint64 // 密钥代数（每次设置新密钥加一）
+}
+
+// Rotation 密钥轮换通知
+type Rotation struct {
+	Generation uint64
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
 }
 
 // Manager 会话密钥管理器
 type Manager struct {
-	mu        sync.RWMutex
-	sessionKey *SessionKey
+	mu          sync.RWMutex
+	sessionKey  *SessionKey
+	scheme      string // 密钥交换时协商的加密方案（会话密钥过期后保留）
+	generation  uint64
+	subscribers map[int]chan Rotation
+	nextSubID   int
 }
 
 // NewManager 创建新的会话密钥管理器
@@ -24,37 +38,80 @@ func NewManager() *Manager {
 
 // SetSessionKey 设置会话密钥
 func (m *Manager) SetSessionKey(key string, expiresIn int) {
+	m.SetSession("", key, expiresIn)
+}
+
+// SetSession 设置会话 ID 和会话密钥，并通知订阅者
+func (m *Manager) SetSession(id, key string, expiresIn int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
+	now := time.Now()
+	m.generation++
 	m.sessionKey = &SessionKey{
-		Key:       key,
-		ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second),
+		ID:         id,
+		Key:        key,
+		IssuedAt:   now,
+		ExpiresAt:  now.Add(time.Duration(expiresIn) * time.Second),
+		Generation: m.generation,
+	}
+
+	rotation := Rotation{
+		Generation: m.generation,
+		IssuedAt:   m.sessionKey.IssuedAt,
+		ExpiresAt:  m.sessionKey.ExpiresAt,
+	}
+	for _, ch := range m.subscribers {
+		// 非阻塞发送：订阅者处理不及时时丢弃旧通知，只保留最新的
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- rotation
 	}
 }
 
-// GetSessionKey 获取会话密钥（如果未过期）
-func (m *Manager) GetSessionKey() (string, bool) {
+// GetSession 获取当前会话（如果未过期）
+func (m *Manager) GetSession() (SessionKey, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
 	if m.sessionKey == nil {
-		return "", false
+		return SessionKey{}, false
 	}
-	
+
 	if time.Now().After(m.sessionKey.ExpiresAt) {
-		return "", false
+		return SessionKey{}, false
 	}
-	
-	return m.sessionKey.Key, true
+
+	return *m.sessionKey, true
+}
+
+// GetSessionKey 获取会话密钥（如果未过期）
+func (m *Manager) GetSessionKey() (string, bool) {
+	session, valid := m.GetSession()
+	return session.Key, valid
 }
 
 // ClearSessionKey 清除会话密钥
 func (m *Manager) ClearSessionKey() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
+	m.sessionKey = nil
+}
+
+// Invalidate 清除指定代数的会话密钥（服务器不再认可该密钥时调用）
+// 如果密钥已经被轮换成新的代数则保留新密钥并返回 false
+func (m *Manager) Invalidate(generation uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessionKey == nil || m.sessionKey.Generation != generation {
+		return false
+	}
 	m.sessionKey = nil
+	return true
 }
 
 // HasValidSession 检查是否有有效的会话密钥
@@ -63,4 +120,64 @@ func (m *Manager) HasValidSession() bool {
 	return valid
 }
 
+// ValidFor 检查会话密钥在接下来的 d 时间内是否仍然有效
+func (m *Manager) ValidFor(d time.Duration) bool {
+	session, valid := m.GetSession()
+	return valid && time.Now().Add(d).Before(session.ExpiresAt)
+}
+
+// Generation 返回当前密钥代数（从未设置过密钥时为 0）
+func (m *Manager) Generation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.generation
+}
+
+// Age 返回当前会话密钥的使用时长（没有会话密钥时返回 0）
+func (m *Manager) Age() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.sessionKey == nil {
+		return 0
+	}
+	return time.Since(m.sessionKey.IssuedAt)
+}
+
+// Subscribe 订阅密钥轮换通知，返回通知通道和取消订阅函数
+func (m *Manager) Subscribe() (<-chan Rotation, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.subscribers == nil {
+		m.subscribers = make(map[int]chan Rotation)
+	}
+	id := m.nextSubID
+	m.nextSubID++
+	ch := make(chan Rotation, 1)
+	m.subscribers[id] = ch
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		delete(m.subscribers, id)
+	}
+}
+
+// SetScheme 设置协商的加密方案
+func (m *Manager) SetScheme(scheme string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scheme = scheme
+}
+
+// Scheme 获取协商的加密方案（未协商时返回空字符串）
+func (m *Manager) Scheme() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
+	return m.scheme
+}
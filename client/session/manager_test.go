@@ -0,0 +1,98 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetSessionBumpsGeneration(t *testing.T) {
+	m := NewManager()
+	if m.Generation() != 0 || m.HasValidSession() {
+		t.Fatalf("new manager: generation %d, valid %v", m.Generation(), m.HasValidSession())
+	}
+
+	for want := uint64(1); want <= 3; want++ {
+		m.SetSession("id", "key", 60)
+		session, valid := m.GetSession()
+		if !valid || session.Generation != want || m.Generation() != want {
+			t.Fatalf("after set %d: session generation %d, manager generation %d, valid %v", want, session.Generation, m.Generation(), valid)
+		}
+	}
+
+	// 清除密钥不会重置代数
+	m.ClearSessionKey()
+	if m.HasValidSession() || m.Generation() != 3 {
+		t.Fatalf("after clear: generation %d, valid %v", m.Generation(), m.HasValidSession())
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	m := NewManager()
+	m.SetSessionKey("key", 60)
+	if !m.ValidFor(30*time.Second) || m.ValidFor(2*time.Minute) {
+		t.Fatal("ValidFor does not respect the expiry")
+	}
+
+	m.SetSessionKey("expired", -1)
+	if _, valid := m.GetSessionKey(); valid {
+		t.Fatal("expired key reported as valid")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m := NewManager()
+	first, unsubscribeFirst := m.Subscribe()
+	second, unsubscribeSecond := m.Subscribe()
+	defer unsubscribeSecond()
+
+	m.SetSessionKey("key-1", 60)
+	for _, ch := range []<-chan Rotation{first, second} {
+		if r := <-ch; r.Generation != 1 {
+			t.Fatalf("rotation generation: got %d, want 1", r.Generation)
+		}
+	}
+
+	// 没有及时读取的订阅者只收到最新的通知
+	m.SetSessionKey("key-2", 60)
+	m.SetSessionKey("key-3", 60)
+	if r := <-second; r.Generation != 3 {
+		t.Fatalf("latest rotation: got %d, want 3", r.Generation)
+	}
+	select {
+	case r := <-second:
+		t.Fatalf("stale rotation %d delivered", r.Generation)
+	default:
+	}
+
+	// 取消订阅后不再收到通知
+	<-first
+	unsubscribeFirst()
+	m.SetSessionKey("key-4", 60)
+	select {
+	case r := <-first:
+		t.Fatalf("rotation %d delivered after unsubscribe", r.Generation)
+	default:
+	}
+}
+
+// 请求发出后密钥被轮换：请求失败时只作废它使用的旧密钥，不影响新密钥
+func TestInvalidateKeepsNewerSession(t *testing.T) {
+	m := NewManager()
+	m.SetSessionKey("old", 60)
+	inFlight := m.Generation()
+
+	m.SetSessionKey("new", 60)
+	if m.Invalidate(inFlight) {
+		t.Fatal("stale generation invalidated the new key")
+	}
+	if key, valid := m.GetSessionKey(); !valid || key != "new" {
+		t.Fatalf("after stale invalidate: key %q, valid %v", key, valid)
+	}
+
+	if !m.Invalidate(m.Generation()) || m.HasValidSession() {
+		t.Fatal("current generation not invalidated")
+	}
+	if m.Invalidate(m.Generation()) {
+		t.Fatal("invalidated an already cleared key")
+	}
+}
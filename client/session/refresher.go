@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultRefreshFraction 默认在会话密钥有效期过去 75% 时刷新
+	DefaultRefreshFraction = 0.75
+	// defaultMinRetry 刷新失败后的初始重试间隔
+	defaultMinRetry = 2 * time.Second
+	// defaultMaxRetry 刷新失败后的最大重试间隔
+	defaultMaxRetry = time.Minute
+	// defaultMinInterval 两次刷新之间的最短间隔
+	defaultMinInterval = time.Second
+)
+
+// RefreshFunc 执行一次密钥交换（成功时应通过 SetSession 保存新密钥）
+type RefreshFunc func(ctx context.Context) error
+
+// RefreshOptions 后台刷新选项
+type RefreshOptions struct {
+	Fraction    float64          // 在有效期的多少比例时刷新（0 到 1 之间，默认 0.75）
+	MinRetry    time.Duration    // 刷新失败后的初始重试间隔（默认 2 秒）
+	MaxRetry    time.Duration    // 刷新失败后的最大重试间隔（默认 1 分钟）
+	MinInterval time.Duration    // 两次刷新之间的最短间隔（默认 1 秒），防止服务器给出很短的有效期时连续交换密钥
+	OnError     func(err error)  // 刷新失败回调（可选）
+	OnRotate    func(r Rotation) // 刷新成功回调（可选）
+}
+
+// StartRefresher 启动后台刷新：在会话密钥有效期达到指定比例时重新交换密钥，
+// 失败时按指数退避重试，直到 ctx 被取消
+func (m *Manager) StartRefresher(ctx context.Context, refresh RefreshFunc, opts RefreshOptions) {
+	if opts.Fraction <= 0 || opts.Fraction >= 1 {
+		opts.Fraction = DefaultRefreshFraction
+	}
+	if opts.MinRetry <= 0 {
+		opts.MinRetry = defaultMinRetry
+	}
+	if opts.MaxRetry < opts.MinRetry {
+		opts.MaxRetry = defaultMaxRetry
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = defaultMinInterval
+	}
+
+	go m.refreshLoop(ctx, refresh, opts)
+}
+
+// refreshLoop 后台刷新循环
+func (m *Manager) refreshLoop(ctx context.Context, refresh RefreshFunc, opts RefreshOptions) {
+	rotations, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	retry := opts.MinRetry
+	// 启动时没有会话则立即刷新，之后每次至少间隔 MinInterval
+	timer := time.NewTimer(m.nextRefresh(opts.Fraction, 0))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rotations:
+			// 其他地方已经换了新密钥（例如心跳前同步交换），重新计算刷新时间
+			resetTimer(timer, m.nextRefresh(opts.Fraction, opts.MinInterval))
+		case <-timer.C:
+			if err := refresh(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				resetTimer(timer, retry)
+				retry *= 2
+				if retry > opts.MaxRetry {
+					retry = opts.MaxRetry
+				}
+				continue
+			}
+
+			retry = opts.MinRetry
+			if opts.OnRotate != nil {
+				session, _ := m.GetSession()
+				opts.OnRotate(Rotation{
+					Generation: session.Generation,
+					IssuedAt:   session.IssuedAt,
+					ExpiresAt:  session.ExpiresAt,
+				})
+			}
+			// 刷新成功后 SetSession 会发出轮换通知，由上面的分支重新计算刷新时间
+			resetTimer(timer, m.nextRefresh(opts.Fraction, opts.MinInterval))
+		}
+	}
+}
+
+// nextRefresh 计算距离下次刷新的时间（没有有效会话或已经到了刷新时间时等待 floor）
+func (m *Manager) nextRefresh(fraction float64, floor time.Duration) time.Duration {
+	session, valid := m.GetSession()
+	if !valid {
+		return floor
+	}
+
+	lifetime := session.ExpiresAt.Sub(session.IssuedAt)
+	refreshAt := session.IssuedAt.Add(time.Duration(float64(lifetime) * fraction))
+	if wait := time.Until(refreshAt); wait > floor {
+		return wait
+	}
+	return floor
+}
+
+// resetTimer 安全地重置定时器
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
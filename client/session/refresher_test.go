@@ -0,0 +1,239 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitRotation 等待刷新器报告一次成功的轮换
+func waitRotation(t *testing.T, rotations <-chan Rotation) Rotation {
+	t.Helper()
+	select {
+	case r := <-rotations:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a refresh")
+		return Rotation{}
+	}
+}
+
+// 没有会话时立即刷新，之后在有效期达到指定比例时再次刷新
+func TestRefresherRefreshesBeforeExpiry(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rotations := make(chan Rotation, 4)
+	start := time.Now()
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		m.SetSession("id", "key", 1)
+		return nil
+	}, RefreshOptions{
+		Fraction:    0.25,
+		MinInterval: 10 * time.Millisecond,
+		OnRotate:    func(r Rotation) { rotations <- r },
+	})
+
+	first := waitRotation(t, rotations)
+	second := waitRotation(t, rotations)
+	if first.Generation != 1 || second.Generation != 2 {
+		t.Fatalf("generations: got %d and %d, want 1 and 2", first.Generation, second.Generation)
+	}
+	// 第二次刷新发生在 1 秒有效期的 25% 左右，早于过期时间
+	if elapsed := second.IssuedAt.Sub(first.IssuedAt); elapsed < 200*time.Millisecond || elapsed >= time.Second {
+		t.Fatalf("refreshed after %s, want about 250ms", elapsed)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("refresher too slow")
+	}
+}
+
+func TestRefresherRetriesWithBackoff(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failure := errors.New("server unavailable")
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+		errs     []error
+	)
+	rotations := make(chan Rotation, 1)
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) <= 4 {
+			return failure
+		}
+		m.SetSession("id", "key", 3600)
+		return nil
+	}, RefreshOptions{
+		MinRetry: 20 * time.Millisecond,
+		MaxRetry: 40 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+		OnRotate: func(r Rotation) { rotations <- r },
+	})
+
+	if r := waitRotation(t, rotations); r.Generation != 1 {
+		t.Fatalf("generation: got %d, want 1", r.Generation)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 4 {
+		t.Fatalf("OnError called %d times, want 4", len(errs))
+	}
+	for _, err := range errs {
+		if !errors.Is(err, failure) {
+			t.Fatalf("OnError got %v", err)
+		}
+	}
+	// 重试间隔 20ms、40ms，之后保持在上限 40ms
+	for i, want := range []time.Duration{20, 40, 40, 40} {
+		want *= time.Millisecond
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want {
+			t.Fatalf("retry %d after %s, want at least %s", i+1, gap, want)
+		}
+	}
+}
+
+// 其他地方换了新密钥时，刷新器按新密钥的有效期重新计算刷新时间
+func TestRefresherFollowsExternalRotation(t *testing.T) {
+	m := NewManager()
+	m.SetSessionKey("short", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	refreshed := make(chan struct{}, 1)
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		refreshed <- struct{}{}
+		return nil
+	}, RefreshOptions{Fraction: 0.5})
+
+	// 例如心跳前的同步密钥交换
+	m.SetSessionKey("long", 3600)
+
+	select {
+	case <-refreshed:
+		t.Fatal("refreshed on the schedule of the replaced key")
+	case <-time.After(800 * time.Millisecond):
+	}
+}
+
+// 服务器给出的有效期很短时，两次刷新之间至少间隔 MinInterval，不会连续交换密钥
+func TestRefresherMinInterval(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		m.SetSessionKey("key", 0) // 立即过期
+		return nil
+	}, RefreshOptions{MinInterval: 50 * time.Millisecond})
+
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) < 2 || len(attempts) > 7 {
+		t.Fatalf("refreshed %d times in 300ms, want about 6", len(attempts))
+	}
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < 50*time.Millisecond {
+			t.Fatalf("refresh %d after %s, want at least 50ms", i, gap)
+		}
+	}
+}
+
+func TestRefresherStopsWithContext(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := make(chan struct{}, 16)
+	errs := make(chan error, 16)
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		calls <- struct{}{}
+		cancel()
+		return ctx.Err()
+	}, RefreshOptions{
+		MinRetry: 10 * time.Millisecond,
+		OnError:  func(err error) { errs <- err },
+	})
+
+	<-calls
+	time.Sleep(100 * time.Millisecond)
+	if len(calls) != 0 {
+		t.Fatal("refresher kept running after the context was cancelled")
+	}
+	if len(errs) != 0 {
+		t.Fatalf("OnError called for a cancelled refresh: %v", <-errs)
+	}
+}
+
+// 刷新与进行中的请求并发：请求只会作废自己使用的那一代密钥
+func TestRefresherRacesInFlightRequests(t *testing.T) {
+	m := NewManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rotations := make(chan Rotation, 1)
+	m.StartRefresher(ctx, func(ctx context.Context) error {
+		m.SetSessionKey("key", 1)
+		return nil
+	}, RefreshOptions{
+		Fraction:    0.01,
+		MinInterval: time.Millisecond,
+		OnRotate: func(r Rotation) {
+			select {
+			case rotations <- r:
+			default:
+			}
+		},
+	})
+
+	// 请求读取当前代数和密钥，部分请求失败并作废它使用的那一代
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if session, valid := m.GetSession(); valid && j%10 == 0 {
+					m.Invalidate(session.Generation)
+				}
+			}
+		}()
+	}
+	for m.Generation() < 20 {
+		waitRotation(t, rotations)
+	}
+	close(done)
+	wg.Wait()
+
+	// 作废旧代数不会清除之后换上的密钥
+	m.SetSessionKey("final", 3600)
+	if m.Invalidate(m.Generation()-1) || !m.HasValidSession() {
+		t.Fatal("stale request cleared the newest key")
+	}
+}
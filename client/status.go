@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"sqlbots-client/collectors"
+	"sqlbots-client/config"
+	apperrors "sqlbots-client/errors"
+	"sqlbots-client/hardware"
+	"sqlbots-client/heartbeat"
+	"sqlbots-client/keyexchange"
+	"sqlbots-client/license"
+	"sqlbots-client/protocol"
+	"sqlbots-client/session"
+	"sqlbots-client/telemetry"
+	"sqlbots-client/ui"
+)
+
+// machineResult 本机信息和服务器登记信息
+type machineResult struct {
+	ID           string `json:"id,omitempty"` // 服务器登记的机器 ID
+	RegisteredAt string `json:"registered_at,omitempty"`
+	MachineID    string `json:"machine_id"`
+	MachineName  string `json:"machine_name"`
+	RAM          int    `json:"ram_gb"`
+	Cores        int    `json:"cores"`
+	Environment  string `json:"environment"`
+	InstanceID   string `json:"instance_id"`
+	InstanceFrom string `json:"instance_source"`
+}
+
+// statusResult status 的输出
+type statusResult struct {
+	Username        string        `json:"username"`
+	PlanType        string        `json:"plan_type"`
+	ExpiresAt       *time.Time    `json:"expires_at,omitempty"` // 为空表示不过期
+	Remaining       string        `json:"remaining,omitempty"`
+	Expired         bool          `json:"expired"`
+	LastHeartbeat   time.Time     `json:"last_heartbeat"`
+	OfflineDeadline time.Time     `json:"offline_deadline"`
+	Machine         machineResult `json:"machine"`
+}
+
+// heartbeatResult heartbeat --once 的输出
+type heartbeatResult struct {
+	Username   string        `json:"username"`
+	StatusCode string        `json:"status_code"`
+	PlanType   string        `json:"plan_type"`
+	ExpiresAt  string        `json:"expires_at,omitempty"`
+	Machine    machineResult `json:"machine"`
+
+	Telemetry *protocol.Telemetry        `json:"telemetry,omitempty"` // 随心跳发送的遥测数据
+	Metrics   []protocol.CollectorResult `json:"metrics,omitempty"`   // 随心跳发送的采集器结果
+}
+
+// versionResult version 的输出
+type versionResult struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// newMachineResult 合并本机信息和服务器登记信息
+func newMachineResult(machineInfo *hardware.MachineInfo, registered protocol.MachineInfo) machineResult {
+	return machineResult{
+		ID:           registered.ID,
+		RegisteredAt: registered.RegisteredAt,
+		MachineID:    machineInfo.MachineID,
+		MachineName:  machineInfo.MachineName,
+		RAM:          machineInfo.RAM,
+		Cores:        machineInfo.Cores,
+		Environment:  machineInfo.Environment.String(),
+		InstanceID:   machineInfo.InstanceID,
+		InstanceFrom: machineInfo.InstanceSource,
+	}
+}
+
+// getMachineInfo 获取机器信息：配置了 instance_id 时使用配置的实例名称，配置了 redact_hostname 时脱敏主机名，
+// hash_machine_id 开启（默认）时机器 ID 和实例 ID 按租户哈希后再发送
+func getMachineInfo(cfg *config.Config) (*hardware.MachineInfo, error) {
+	machineInfo, err := hardware.GetMachineInfo()
+	if err != nil {
+		return nil, err
+	}
+	machineInfo.SetInstanceName(cfg.InstanceID)
+	if cfg.RedactHostname {
+		machineInfo.RedactHostname(cfg.APIKey)
+	}
+	if cfg.HashMachineID {
+		machineInfo.Protect(cfg.APIKey)
+	}
+	return machineInfo, nil
+}
+
+// loadLicenseStatus 读取最近一次心跳保存的许可证状态（不连接服务器）
+func loadLicenseStatus(name string, args []string, output *string) (license.Status, *hardware.MachineInfo, int) {
+	cfg, code := loadCommandConfig(name, args, output, config.LoadOptions{
+		Credentials:    loadCredentials(ui.IsTerminal()),
+		SkipValidation: true,
+	})
+	if cfg == nil {
+		return license.Status{}, nil, code
+	}
+	if cfg.APIKey == "" {
+		return license.Status{}, nil, commandFailed(*output, apperrors.ExitConfig, "Not logged in (use login, --api-key or API_KEY)", nil)
+	}
+
+	licenseGuard, err := newLicenseGuard(cfg)
+	if err != nil {
+		return license.Status{}, nil, commandFailed(*output, apperrors.ExitFailure, "Failed to read license state", err)
+	}
+	status := licenseGuard.Status(time.Now())
+	if !status.Known {
+		return license.Status{}, nil, commandFailed(*output, apperrors.ExitFailure, "No heartbeat recorded yet (run heartbeat --once or run)", nil)
+	}
+
+	machineInfo, err := getMachineInfo(cfg)
+	if err != nil {
+		return license.Status{}, nil, commandFailed(*output, apperrors.ExitFailure, "Failed to get machine info", err)
+	}
+	return status, machineInfo, apperrors.ExitOK
+}
+
+// runStatus 显示最近一次心跳时的许可证和机器信息
+func runStatus(args []string) int {
+	var output string
+	status, machineInfo, code := loadLicenseStatus("status", args, &output)
+	if machineInfo == nil {
+		return code
+	}
+
+	result := statusResult{
+		Username:        status.Username,
+		PlanType:        status.PlanType,
+		Expired:         status.Expired,
+		LastHeartbeat:   status.VerifiedAt,
+		OfflineDeadline: status.OfflineDeadline,
+		Machine:         newMachineResult(machineInfo, status.Machine),
+	}
+	if !status.ExpiresAt.IsZero() {
+		result.ExpiresAt = &status.ExpiresAt
+		result.Remaining = license.FormatRemaining(status.Remaining)
+	}
+	if output == "json" {
+		printJSON(result)
+		return apperrors.ExitOK
+	}
+
+	fmt.Printf("username       : %s\n", result.Username)
+	fmt.Printf("plan           : %s\n", result.PlanType)
+	if result.ExpiresAt != nil {
+		fmt.Printf("expires at     : %s (%s left)\n", formatLocalTime(*result.ExpiresAt), result.Remaining)
+	} else {
+		fmt.Printf("expires at     : never\n")
+	}
+	fmt.Printf("last heartbeat : %s\n", formatLocalTime(result.LastHeartbeat))
+	fmt.Printf("offline until  : %s\n", formatLocalTime(result.OfflineDeadline))
+	fmt.Printf("machine        : %s (%d GB RAM, %d cores)\n", result.Machine.MachineName, result.Machine.RAM, result.Machine.Cores)
+	fmt.Printf("environment    : %s\n", result.Machine.Environment)
+	fmt.Printf("instance       : %s (from %s)\n", result.Machine.InstanceID, result.Machine.InstanceFrom)
+	if result.Machine.InstanceFrom == hardware.InstanceFromContainer || result.Machine.InstanceFrom == hardware.InstanceFromHostname {
+		fmt.Printf("                 changes on every redeploy, set INSTANCE_ID to a stable name\n")
+	}
+	if result.Machine.ID != "" {
+		fmt.Printf("registered as  : %s\n", result.Machine.ID)
+	}
+	return apperrors.ExitOK
+}
+
+// runMachines 显示本机在服务器上的登记信息（服务器不提供其他机器的列表）
+func runMachines(args []string) int {
+	var output string
+	status, machineInfo, code := loadLicenseStatus("machines", args, &output)
+	if machineInfo == nil {
+		return code
+	}
+
+	machines := []machineResult{newMachineResult(machineInfo, status.Machine)}
+	if output == "json" {
+		printJSON(machines)
+		return apperrors.ExitOK
+	}
+
+	fmt.Printf("%-38s %-20s %-8s %-6s %-20s %s\n", "ID", "NAME", "RAM", "CORES", "ENVIRONMENT", "REGISTERED AT")
+	for _, m := range machines {
+		id := m.ID
+		if id == "" {
+			id = "-"
+		}
+		registeredAt := m.RegisteredAt
+		if registeredAt == "" {
+			registeredAt = "-"
+		}
+		fmt.Printf("%-38s %-20s %-8s %-6d %-20s %s\n", id, m.MachineName, fmt.Sprintf("%d GB", m.RAM), m.Cores, m.Environment, registeredAt)
+	}
+	return apperrors.ExitOK
+}
+
+// runHeartbeat 发送一次心跳并显示结果（不带 --once 时与 run 相同）
+func runHeartbeat(args []string) int {
+	var output string
+	var once bool
+	interactive := ui.IsTerminal()
+	loadOptions := config.LoadOptions{
+		Credentials: loadCredentials(interactive),
+		ExtraFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&once, "once", false, "Send a single heartbeat and exit")
+		},
+	}
+	if interactive {
+		loadOptions.Prompt = promptLoginValue
+	}
+	cfg, code := loadCommandConfig("heartbeat", args, &output, loadOptions)
+	if cfg == nil {
+		return code
+	}
+	if !once {
+		// 重新读取配置时使用相同的参数（包括 heartbeat 的 --output 和 --once）
+		reloadOptions := loadOptions
+		reloadOptions.Name = "sqlbots-client heartbeat"
+		reloadOptions.Args = args
+		reloadOptions.ExtraFlags = func(fs *flag.FlagSet) {
+			fs.String("output", output, "Output format: text or json")
+			loadOptions.ExtraFlags(fs)
+		}
+		return runLoop(cfg, interactive, configReloader(reloadOptions, cfg))
+	}
+
+	machineInfo, err := getMachineInfo(cfg)
+	if err != nil {
+		return commandFailed(output, apperrors.ExitFailure, "Failed to get machine info", err)
+	}
+	licenseGuard, err := newLicenseGuard(cfg)
+	if err != nil {
+		return commandFailed(output, apperrors.ExitFailure, "Failed to initialize license state", err)
+	}
+
+	registry, err := newCollectorRegistry(cfg, nil)
+	if err != nil {
+		return commandFailed(output, apperrors.ExitConfig, "Invalid metric collectors", err)
+	}
+
+	result, err := sendSingleHeartbeat(context.Background(), cfg, machineInfo, registry, licenseGuard)
+	if err != nil {
+		if isFatalError(err) {
+			_ = licenseGuard.Clear()
+		}
+		return commandFailed(output, apperrors.ExitCode(err), "Heartbeat failed", err)
+	}
+
+	if output == "json" {
+		printJSON(result)
+		return apperrors.ExitOK
+	}
+	fmt.Printf("heartbeat      : %s\n", result.StatusCode)
+	fmt.Printf("username       : %s\n", result.Username)
+	fmt.Printf("plan           : %s\n", result.PlanType)
+	fmt.Printf("machine        : %s (%s)\n", result.Machine.MachineName, result.Machine.ID)
+	if t := result.Telemetry; t != nil {
+		if t.CPUPercent != nil {
+			fmt.Printf("cpu            : %.1f%%\n", t.CPUPercent.Avg)
+		}
+		if t.MemoryPercent != nil {
+			fmt.Printf("memory         : %.1f%%\n", t.MemoryPercent.Avg)
+		}
+		if t.Load1 != nil {
+			fmt.Printf("load           : %.2f %.2f %.2f\n", t.Load1.Avg, t.Load5.Avg, t.Load15.Avg)
+		}
+		for _, d := range t.Disks {
+			fmt.Printf("disk           : %s %.1f%% of %.1f GB\n", d.Mount, d.UsedPercent, float64(d.TotalBytes)/(1<<30))
+		}
+	}
+	for _, r := range result.Metrics {
+		if r.Error != "" {
+			fmt.Printf("collector      : %s failed: %s\n", r.Collector, r.Error)
+			continue
+		}
+		fmt.Printf("collector      : %s (%d metrics, %d ms)\n", r.Collector, len(r.Metrics), r.DurationMS)
+	}
+	return apperrors.ExitOK
+}
+
+// sendSingleHeartbeat 交换密钥并发送一次心跳，成功时保存许可证状态
+func sendSingleHeartbeat(ctx context.Context, cfg *config.Config, machineInfo *hardware.MachineInfo, registry *collectors.Registry, licenseGuard *license.Guard) (*heartbeatResult, error) {
+	client := protocol.NewClient(cfg, session.NewManager())
+	username, err := keyexchange.Exchange(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// 开启遥测时在一秒内采样两次（CPU 使用率和网络速率需要两次采样）
+	var report *protocol.Telemetry
+	if cfg.Telemetry {
+		report = telemetry.Collect(ctx, time.Second)
+	}
+
+	// 配置了采集器时运行一次所有采集器
+	metrics := registry.CollectAll(ctx)
+
+	resp, err := heartbeat.Send(ctx, client, machineInfo, heartbeat.WithTelemetry(report), heartbeat.WithMetrics(metrics))
+	if err != nil {
+		return nil, err
+	}
+	if err := heartbeat.HandleHeartbeatResponse(resp); err != nil {
+		return nil, err
+	}
+
+	// 保存失败不影响本次心跳的结果
+	if err := licenseGuard.Record(resp, username); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save license state: %v\n", err)
+	}
+
+	return &heartbeatResult{
+		Username:   username,
+		StatusCode: resp.StatusCode,
+		PlanType:   resp.LicenseInfo.PlanType,
+		ExpiresAt:  resp.LicenseInfo.ExpiresAt,
+		Telemetry:  report,
+		Metrics:    metrics,
+		Machine:    newMachineResult(machineInfo, resp.MachineInfo),
+	}, nil
+}
+
+// runVersion 显示版本和构建信息
+func runVersion(args []string) int {
+	var output string
+	fs := flag.NewFlagSet("sqlbots-client version", flag.ContinueOnError)
+	fs.StringVar(&output, "output", "text", "Output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return apperrors.ExitOK
+		}
+		return apperrors.ExitUsage
+	}
+	if err := checkOutput(output); err != nil {
+		return commandFailed("text", apperrors.ExitUsage, "Invalid arguments", err)
+	}
+	if fs.NArg() > 0 {
+		return commandFailed(output, apperrors.ExitUsage, "Invalid arguments", fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+
+	result := versionResult{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	// 没有通过 -ldflags 设置时，使用 go build 记录的版本控制信息
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && result.Commit == "":
+				result.Commit = setting.Value
+			case setting.Key == "vcs.time" && result.BuildDate == "":
+				result.BuildDate = setting.Value
+			}
+		}
+	}
+
+	if output == "json" {
+		printJSON(result)
+		return apperrors.ExitOK
+	}
+	fmt.Printf("sqlbots-client %s\n", result.Version)
+	if result.Commit != "" {
+		fmt.Printf("commit     : %s\n", result.Commit)
+	}
+	if result.BuildDate != "" {
+		fmt.Printf("built      : %s\n", result.BuildDate)
+	}
+	fmt.Printf("go         : %s (%s)\n", result.GoVersion, result.Platform)
+	return apperrors.ExitOK
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureCommand 在独立的进程组中运行托管进程，停止时向整个进程组发送信号（包括它启动的子进程）
+func configureCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcess 发送 SIGTERM，让进程有机会清理后退出
+func terminateProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcess 发送 SIGKILL 强制终止
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package supervisor
+
+import "os/exec"
+
+// configureCommand Windows 上直接启动进程
+func configureCommand(cmd *exec.Cmd) {}
+
+// terminateProcess Windows 没有 SIGTERM，直接终止进程
+func terminateProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killProcess 强制终止进程
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
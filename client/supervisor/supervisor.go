@@ -0,0 +1,644 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+
+	"sqlbots-client/protocol"
+	"sqlbots-client/retry"
+)
+
+// 托管进程状态
+const (
+	StateStarting = "starting" // 还没有启动
+	StateRunning  = "running"
+	StateBackoff  = "backoff" // 退出或启动失败，等待重启
+	StateExited   = "exited"  // 按重启策略不再重启
+	StateStopped  = "stopped" // 被 Stop 停止
+)
+
+// 事件类型
+const (
+	EventStarted = "started"
+	EventExited  = "exited" // 进程退出（Restart 为 0 时不再重启）
+	EventFailed  = "failed" // 启动失败（Restart 为 0 时不再重试）
+	EventStopped = "stopped"
+)
+
+const (
+	// DefaultStableAfter 进程持续运行超过该时间后重置退避
+	DefaultStableAfter = time.Minute
+	// DefaultStopTimeout 发送终止信号后等待进程退出的时间，超时后强制终止
+	DefaultStopTimeout = 10 * time.Second
+)
+
+// defaultBackoff 默认重启退避：1 秒起，每次翻倍，最长 5 分钟，不限次数
+func defaultBackoff() retry.Policy {
+	return retry.Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Minute,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Event 托管进程的状态变化
+type Event struct {
+	Workload string
+	Type     string
+	PID      int
+	Err      error         // 退出原因或启动错误（正常退出时为 nil）
+	Restart  time.Duration // 多久后重启
+}
+
+// Options 监管选项
+type Options struct {
+	Backoff     retry.Policy  // 重启退避策略（零值使用默认策略）
+	StableAfter time.Duration // 持续运行多久后重置退避（为 0 时使用 DefaultStableAfter）
+	StopTimeout time.Duration // 停止时等待进程退出的时间（为 0 时使用 DefaultStopTimeout）
+	Output      io.Writer     // 没有配置 log_file 的进程的输出（需要支持并发写入，例如 os.Stderr；为 nil 时丢弃）
+	OnEvent     func(Event)   // 状态变化回调（在监管协程中调用）
+}
+
+// Supervisor 托管进程监管器
+type Supervisor struct {
+	opts Options
+
+	mu       sync.Mutex
+	workers  []*worker
+	ctx      context.Context // Start 之后有效，所有托管进程的父 context
+	cancel   context.CancelFunc
+	started  bool
+	stopped  bool
+	stopOnce sync.Once
+}
+
+// worker 一个托管进程的运行状态
+type worker struct {
+	spec Workload
+
+	cancel context.CancelFunc // 启动监管协程后有效
+	done   chan struct{}      // 监管协程退出时关闭
+	wake   chan struct{}      // 请求立即重启（等待重启或已退出时唤醒）
+
+	mu               sync.Mutex
+	state            string
+	cmd              *exec.Cmd
+	logFile          *os.File
+	proc             *process.Process // 用于读取资源占用
+	runs             int
+	restarts         int
+	restartRequested bool
+	startedAt        time.Time
+	lastExit         string
+	lastExitAt       time.Time
+	nextStartAt      time.Time
+}
+
+// ReloadResult 重新加载托管进程的结果
+type ReloadResult struct {
+	Started   []string // 新增或配置变化后重新启动的进程
+	Stopped   []string // 删除或配置变化后停止的进程
+	Unchanged []string
+}
+
+// New 创建监管器（调用 Start 后才启动进程）
+func New(workloads []Workload, opts Options) *Supervisor {
+	if opts.Backoff == (retry.Policy{}) {
+		opts.Backoff = defaultBackoff()
+	}
+	if opts.StableAfter <= 0 {
+		opts.StableAfter = DefaultStableAfter
+	}
+	if opts.StopTimeout <= 0 {
+		opts.StopTimeout = DefaultStopTimeout
+	}
+
+	s := &Supervisor{opts: opts}
+	for _, w := range workloads {
+		s.workers = append(s.workers, newWorker(w))
+	}
+	return s
+}
+
+// newWorker 创建还没有启动的托管进程
+func newWorker(spec Workload) *worker {
+	return &worker{spec: spec, state: StateStarting, wake: make(chan struct{}, 1)}
+}
+
+// Len 托管进程数量
+func (s *Supervisor) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.workers)
+}
+
+// Start 在后台启动所有托管进程并监管（只有第一次调用有效，Stop 之后不再启动）
+func (s *Supervisor) Start(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, w := range s.workers {
+		s.launch(w)
+	}
+}
+
+// launch 启动托管进程的监管协程（调用方持有 s.mu）
+func (s *Supervisor) launch(w *worker) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		s.run(ctx, w)
+	}()
+}
+
+// Stop 停止所有托管进程并不再重启
+//
+// 先发送终止信号，StopTimeout 内没有退出时强制终止（Unix 上包括进程启动的子进程）。
+// 返回时所有进程都已退出；可以多次调用，并发调用会等待第一次调用完成
+func (s *Supervisor) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(s.stop)
+}
+
+// stop 停止所有托管进程
+func (s *Supervisor) stop() {
+	s.mu.Lock()
+	s.stopped = true // 之后调用 Start 和 Reload 不再启动进程
+	workers := append([]*worker(nil), s.workers...)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	s.stopWorkers(workers)
+}
+
+// stopWorkers 停止托管进程并等待监管协程退出（超时后强制终止）
+func (s *Supervisor) stopWorkers(workers []*worker) {
+	var running []*worker
+	for _, w := range workers {
+		if w.cancel == nil {
+			continue // 还没有启动
+		}
+		// 取消后不会再启动新进程，已经在运行的进程需要发送信号
+		w.cancel()
+		w.signal(terminateProcess)
+		running = append(running, w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, w := range running {
+			<-w.done
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(s.opts.StopTimeout):
+	}
+
+	for _, w := range running {
+		w.signal(killProcess)
+	}
+	<-done
+}
+
+// Restart 重启指定的托管进程（运行中的进程先终止，等待重启或已退出的进程立即启动，不计入退避）
+func (s *Supervisor) Restart(name string) error {
+	if s == nil {
+		return fmt.Errorf("unknown workload %q", name)
+	}
+
+	s.mu.Lock()
+	started, stopped := s.started, s.stopped
+	var target *worker
+	for _, w := range s.workers {
+		if w.spec.Name == name {
+			target = w
+		}
+	}
+	s.mu.Unlock()
+
+	switch {
+	case target == nil:
+		return fmt.Errorf("unknown workload %q", name)
+	case stopped:
+		return fmt.Errorf("workloads are stopped")
+	case !started:
+		return fmt.Errorf("workloads are not started yet")
+	}
+
+	// 持有 worker 的锁发送信号（与 Stop 相同）：监管协程在同一把锁下清除 cmd 之后才会启动新进程，
+	// 所以不会在读取 cmd 之后、发送信号之前被自动重启抢先，误终止刚启动的新进程
+	target.mu.Lock()
+	target.restartRequested = true
+	cmd := target.cmd
+	if cmd != nil {
+		_ = terminateProcess(cmd)
+	}
+	target.mu.Unlock()
+
+	if cmd == nil {
+		select {
+		case target.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	// 进程在 StopTimeout 内没有退出时强制终止
+	time.AfterFunc(s.opts.StopTimeout, func() {
+		target.signal(func(current *exec.Cmd) error {
+			if current != cmd {
+				return nil
+			}
+			return killProcess(cmd)
+		})
+	})
+	return nil
+}
+
+// Reload 按新的配置更新托管进程：配置没有变化的进程继续运行，删除或变化的进程停止，新增或变化的进程启动
+func (s *Supervisor) Reload(workloads []Workload) (ReloadResult, error) {
+	if s == nil {
+		return ReloadResult{}, fmt.Errorf("workloads are not supported")
+	}
+
+	var result ReloadResult
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return result, fmt.Errorf("workloads are stopped")
+	}
+
+	existing := make(map[string]*worker, len(s.workers))
+	for _, w := range s.workers {
+		existing[w.spec.Name] = w
+	}
+
+	var updated, added, removed []*worker
+	for _, spec := range workloads {
+		if w, ok := existing[spec.Name]; ok && reflect.DeepEqual(w.spec, spec) {
+			updated = append(updated, w)
+			delete(existing, spec.Name)
+			result.Unchanged = append(result.Unchanged, spec.Name)
+			continue
+		}
+		w := newWorker(spec)
+		updated = append(updated, w)
+		added = append(added, w)
+		result.Started = append(result.Started, spec.Name)
+	}
+	for _, w := range s.workers {
+		if _, ok := existing[w.spec.Name]; ok {
+			removed = append(removed, w)
+			result.Stopped = append(result.Stopped, w.spec.Name)
+		}
+	}
+	s.workers = updated
+	s.mu.Unlock()
+
+	// 先停止旧进程，避免配置变化的进程同时运行两份
+	s.stopWorkers(removed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started && !s.stopped {
+		for _, w := range added {
+			s.launch(w)
+		}
+	}
+	return result, nil
+}
+
+// Status 返回所有托管进程的状态和资源占用（按配置顺序）
+func (s *Supervisor) Status() []protocol.WorkloadStatus {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	workers := append([]*worker(nil), s.workers...)
+	s.mu.Unlock()
+	if len(workers) == 0 {
+		return nil
+	}
+
+	statuses := make([]protocol.WorkloadStatus, 0, len(workers))
+	for _, w := range workers {
+		statuses = append(statuses, w.status())
+	}
+	return statuses
+}
+
+// run 启动进程并在退出后按重启策略重启，直到 ctx 取消
+func (s *Supervisor) run(ctx context.Context, w *worker) {
+	attempt := 0
+	for {
+		startedAt := time.Now()
+		event := Event{Workload: w.spec.Name}
+
+		cmd, err := w.start(ctx, s.opts.Output)
+		if err != nil {
+			if ctx.Err() != nil {
+				w.setStopped()
+				return
+			}
+			event.Type = EventFailed
+		} else {
+			event.PID = cmd.Process.Pid
+			s.emit(Event{Workload: w.spec.Name, Type: EventStarted, PID: event.PID})
+
+			err = w.wait(cmd)
+			if ctx.Err() != nil {
+				w.setStopped()
+				s.emit(Event{Workload: w.spec.Name, Type: EventStopped, PID: event.PID, Err: err})
+				return
+			}
+			event.Type = EventExited
+		}
+		event.Err = err
+
+		// 按请求重启：立即启动，重置退避
+		if w.takeRestartRequest() {
+			attempt = 0
+			continue
+		}
+
+		if !w.shouldRestart(err) {
+			w.setState(StateExited, time.Time{})
+			s.emit(event)
+			// 不再自动重启，只等待 Restart 请求
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.wake:
+				w.takeRestartRequest()
+				attempt = 0
+				continue
+			}
+		}
+
+		// 运行足够久之后的退出视为新的故障，从最短的等待时间开始
+		if time.Since(startedAt) >= s.opts.StableAfter {
+			attempt = 0
+		}
+		attempt++
+		event.Restart = s.opts.Backoff.Interval(attempt)
+		w.setState(StateBackoff, time.Now().Add(event.Restart))
+		s.emit(event)
+
+		timer := time.NewTimer(event.Restart)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.setStopped()
+			return
+		case <-w.wake:
+			timer.Stop()
+			w.takeRestartRequest()
+			attempt = 0
+		case <-timer.C:
+		}
+	}
+}
+
+// emit 调用事件回调
+func (s *Supervisor) emit(event Event) {
+	if s.opts.OnEvent != nil {
+		s.opts.OnEvent(event)
+	}
+}
+
+// start 启动进程（ctx 已经取消时不启动）
+func (w *worker) start(ctx context.Context, output io.Writer) (*exec.Cmd, error) {
+	cmd := exec.Command(w.spec.Command[0], w.spec.Command[1:]...)
+	cmd.Dir = w.spec.Dir
+	if len(w.spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), envList(w.spec.Env)...)
+	}
+	// 进程退出后，它启动的子进程可能仍然占用输出管道，最多再等待一秒
+	cmd.WaitDelay = time.Second
+	configureCommand(cmd)
+
+	var logFile *os.File
+	if w.spec.LogFile != "" {
+		f, err := os.OpenFile(w.spec.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			w.recordExit(fmt.Sprintf("failed to open log file: %v", err))
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		logFile = f
+		cmd.Stdout = f
+		cmd.Stderr = f
+	} else if output != nil {
+		cmd.Stdout = output
+		cmd.Stderr = output
+	}
+
+	// 持有锁检查 ctx，避免和 Stop 竞争（Stop 先取消 ctx 再向进程发送信号）
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		closeFile(logFile)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		closeFile(logFile)
+		w.lastExit = err.Error()
+		w.lastExitAt = time.Now()
+		return nil, fmt.Errorf("failed to start %s: %w", w.spec.Command[0], err)
+	}
+
+	if w.runs > 0 {
+		w.restarts++
+	}
+	w.runs++
+	w.state = StateRunning
+	w.cmd = cmd
+	w.logFile = logFile
+	w.startedAt = time.Now()
+	w.nextStartAt = time.Time{}
+
+	// 第一次读取 CPU 时间作为基准，之后每次上报的是两次上报之间的平均占用
+	if proc, err := process.NewProcess(int32(cmd.Process.Pid)); err == nil {
+		_, _ = proc.Percent(0)
+		w.proc = proc
+	}
+	return cmd, nil
+}
+
+// wait 等待进程退出并记录退出原因
+func (w *worker) wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	closeFile(w.logFile)
+	w.cmd = nil
+	w.logFile = nil
+	w.proc = nil
+	w.lastExit = exitDescription(err)
+	w.lastExitAt = time.Now()
+	return err
+}
+
+// takeRestartRequest 返回并清除重启请求（同时清空唤醒信号）
+func (w *worker) takeRestartRequest() bool {
+	select {
+	case <-w.wake:
+	default:
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	requested := w.restartRequested
+	w.restartRequested = false
+	return requested
+}
+
+// shouldRestart 按重启策略判断进程退出（或启动失败）后是否重启
+func (w *worker) shouldRestart(err error) bool {
+	switch w.spec.Restart {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return true
+	}
+}
+
+// signal 向正在运行的进程发送信号
+func (w *worker) signal(send func(cmd *exec.Cmd) error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cmd != nil {
+		_ = send(w.cmd)
+	}
+}
+
+// setState 更新状态
+func (w *worker) setState(state string, nextStartAt time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+	w.nextStartAt = nextStartAt
+}
+
+// setStopped 标记为已停止
+func (w *worker) setStopped() {
+	w.setState(StateStopped, time.Time{})
+}
+
+// recordExit 记录没有启动成功的原因
+func (w *worker) recordExit(reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastExit = reason
+	w.lastExitAt = time.Now()
+}
+
+// status 返回当前状态，运行中时读取资源占用（读取失败的指标为空）
+func (w *worker) status() protocol.WorkloadStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := protocol.WorkloadStatus{
+		Name:       w.spec.Name,
+		State:      w.state,
+		Restarts:   w.restarts,
+		LastExit:   w.lastExit,
+		LastExitAt: timePtr(w.lastExitAt),
+	}
+	if w.state == StateBackoff {
+		status.NextStartAt = timePtr(w.nextStartAt)
+	}
+	if w.cmd == nil {
+		return status
+	}
+
+	status.PID = w.cmd.Process.Pid
+	status.StartedAt = timePtr(w.startedAt)
+	if w.proc != nil {
+		if percent, err := w.proc.Percent(0); err == nil {
+			status.CPUPercent = round(percent)
+		}
+		if mem, err := w.proc.MemoryInfo(); err == nil {
+			status.RSSBytes = mem.RSS
+		}
+		if threads, err := w.proc.NumThreads(); err == nil {
+			status.Threads = threads
+		}
+	}
+	return status
+}
+
+// exitDescription 进程退出原因，例如 exit status 1、signal: killed
+func exitDescription(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// envList 按键排序的环境变量列表
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// closeFile 关闭文件（为 nil 时忽略）
+func closeFile(f *os.File) {
+	if f != nil {
+		_ = f.Close()
+	}
+}
+
+// timePtr 返回时间的指针（零值返回 nil）
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// round 保留两位小数
+func round(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
@@ -0,0 +1,361 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"sqlbots-client/retry"
+)
+
+// recorder 记录监管器的事件
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// of 返回指定进程的指定类型的事件
+func (r *recorder) of(workload, eventType string) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []Event
+	for _, e := range r.events {
+		if e.Workload == workload && e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// testOptions 测试用的短退避
+func testOptions(r *recorder) Options {
+	return Options{
+		Backoff:     retry.Policy{InitialInterval: 20 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2},
+		StopTimeout: 5 * time.Second,
+		OnEvent:     r.record,
+	}
+}
+
+// shell 用 sh 执行脚本的托管进程
+func shell(name, script string) Workload {
+	return Workload{Name: name, Command: []string{"sh", "-c", script}}
+}
+
+// startSupervisor 启动监管器，测试结束时停止
+func startSupervisor(t *testing.T, workloads []Workload, opts Options) *Supervisor {
+	t.Helper()
+	s := New(workloads, opts)
+	s.Start(context.Background())
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// waitFor 等待条件成立（最多 5 秒）
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// statusOf 返回指定进程的状态
+func statusOf(s *Supervisor, name string) (state string, pid, restarts int) {
+	for _, st := range s.Status() {
+		if st.Name == name {
+			return st.State, st.PID, st.Restarts
+		}
+	}
+	return "", 0, 0
+}
+
+// alive 判断进程是否仍在运行（僵尸进程视为已退出）
+func alive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true // 没有 /proc 的系统
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestCrashRestartsWithBackoff(t *testing.T) {
+	r := &recorder{}
+	s := startSupervisor(t, []Workload{shell("crash", "exit 3")}, testOptions(r))
+
+	waitFor(t, "three restarts", func() bool { return len(r.of("crash", EventExited)) >= 4 })
+
+	exits := r.of("crash", EventExited)
+	for i, want := range []time.Duration{20, 40, 80, 160} {
+		if exits[i].Restart != want*time.Millisecond {
+			t.Errorf("exit %d: restart after %s, want %s", i+1, exits[i].Restart, want*time.Millisecond)
+		}
+		if exits[i].Err == nil || !strings.Contains(exits[i].Err.Error(), "exit status 3") {
+			t.Errorf("exit %d: got error %v", i+1, exits[i].Err)
+		}
+	}
+	if _, _, restarts := statusOf(s, "crash"); restarts < 3 {
+		t.Errorf("restarts: got %d, want at least 3", restarts)
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		script   string
+		restarts bool
+	}{
+		{RestartAlways, "exit 0", true},
+		{RestartAlways, "exit 1", true},
+		{RestartOnFailure, "exit 0", false},
+		{RestartOnFailure, "exit 1", true},
+		{RestartOnFailure, "kill -9 $$", true},
+		{RestartNever, "exit 0", false},
+		{RestartNever, "exit 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.script, func(t *testing.T) {
+			r := &recorder{}
+			w := shell("bot", tt.script)
+			w.Restart = tt.policy
+			s := startSupervisor(t, []Workload{w}, testOptions(r))
+
+			if tt.restarts {
+				waitFor(t, "a restart", func() bool { return len(r.of("bot", EventStarted)) >= 2 })
+				return
+			}
+			waitFor(t, "exited state", func() bool { state, _, _ := statusOf(s, "bot"); return state == StateExited })
+			time.Sleep(100 * time.Millisecond)
+			if started := len(r.of("bot", EventStarted)); started != 1 {
+				t.Fatalf("started %d times, want 1", started)
+			}
+			if exits := r.of("bot", EventExited); len(exits) != 1 || exits[0].Restart != 0 {
+				t.Fatalf("exit events: %+v", exits)
+			}
+		})
+	}
+}
+
+func TestStopKillsProcessGroupAfterTimeout(t *testing.T) {
+	dir := t.TempDir()
+	childPID := filepath.Join(dir, "child.pid")
+	// 忽略 SIGTERM 的进程和它启动的子进程（子进程继承忽略的信号）
+	script := `trap "" TERM; sleep 60 & echo $! > ` + childPID + `; wait`
+
+	r := &recorder{}
+	opts := testOptions(r)
+	opts.StopTimeout = 200 * time.Millisecond
+	s := New([]Workload{shell("stubborn", script)}, opts)
+	s.Start(context.Background())
+
+	var child int
+	waitFor(t, "child process", func() bool {
+		data, err := os.ReadFile(childPID)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			return false
+		}
+		child, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	})
+	_, pid, _ := statusOf(s, "stubborn")
+
+	start := time.Now()
+	s.Stop()
+	elapsed := time.Since(start)
+
+	if elapsed < opts.StopTimeout {
+		t.Errorf("Stop returned after %s, before the stop timeout", elapsed)
+	}
+	stopped := r.of("stubborn", EventStopped)
+	if len(stopped) != 1 || stopped[0].Err == nil || !strings.Contains(stopped[0].Err.Error(), "killed") {
+		t.Fatalf("stopped events: %+v", stopped)
+	}
+	if state, _, _ := statusOf(s, "stubborn"); state != StateStopped {
+		t.Errorf("state: got %s, want %s", state, StateStopped)
+	}
+	waitFor(t, "process group to exit", func() bool { return !alive(pid) && !alive(child) })
+
+	// 停止后不再启动
+	s.Start(context.Background())
+	if err := s.Restart("stubborn"); err == nil {
+		t.Error("Restart after Stop accepted")
+	}
+}
+
+func TestStopTerminatesGracefully(t *testing.T) {
+	r := &recorder{}
+	s := New([]Workload{shell("bot", "sleep 60")}, testOptions(r))
+	s.Start(context.Background())
+	waitFor(t, "running", func() bool { state, _, _ := statusOf(s, "bot"); return state == StateRunning })
+
+	start := time.Now()
+	s.Stop()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Stop took %s for a process that exits on SIGTERM", elapsed)
+	}
+	if stopped := r.of("bot", EventStopped); len(stopped) != 1 || !strings.Contains(stopped[0].Err.Error(), "terminated") {
+		t.Fatalf("stopped events: %+v", stopped)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	r := &recorder{}
+	s := startSupervisor(t, []Workload{shell("bot", "sleep 60")}, testOptions(r))
+	waitFor(t, "running", func() bool { state, _, _ := statusOf(s, "bot"); return state == StateRunning })
+	_, oldPID, _ := statusOf(s, "bot")
+
+	if err := s.Restart("bot"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "new process", func() bool {
+		state, pid, _ := statusOf(s, "bot")
+		return state == StateRunning && pid != oldPID && pid != 0
+	})
+	if exits := r.of("bot", EventExited); len(exits) != 0 {
+		t.Errorf("requested restart reported as a crash: %+v", exits)
+	}
+	if alive(oldPID) {
+		t.Error("old process still running")
+	}
+
+	if err := s.Restart("missing"); err == nil {
+		t.Error("unknown workload accepted")
+	}
+}
+
+func TestRestartExitedWorkload(t *testing.T) {
+	r := &recorder{}
+	w := shell("once", "exit 0")
+	w.Restart = RestartNever
+	s := startSupervisor(t, []Workload{w}, testOptions(r))
+	waitFor(t, "exited state", func() bool { state, _, _ := statusOf(s, "once"); return state == StateExited })
+
+	if err := s.Restart("once"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "second start", func() bool { return len(r.of("once", EventStarted)) == 2 })
+}
+
+func TestReload(t *testing.T) {
+	r := &recorder{}
+	s := startSupervisor(t, []Workload{
+		shell("keep", "sleep 60"),
+		shell("change", "sleep 60"),
+		shell("remove", "sleep 60"),
+	}, testOptions(r))
+	waitFor(t, "all running", func() bool {
+		return len(r.of("remove", EventStarted)) == 1 && len(r.of("change", EventStarted)) == 1 && len(r.of("keep", EventStarted)) == 1
+	})
+
+	_, keepPID, _ := statusOf(s, "keep")
+	_, changePID, _ := statusOf(s, "change")
+	_, removePID, _ := statusOf(s, "remove")
+
+	result, err := s.Reload([]Workload{
+		shell("keep", "sleep 60"),
+		shell("change", "sleep 61"),
+		shell("add", "sleep 60"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Unchanged, ",") != "keep" ||
+		strings.Join(result.Started, ",") != "change,add" ||
+		strings.Join(result.Stopped, ",") != "change,remove" {
+		t.Fatalf("result: %+v", result)
+	}
+
+	// 删除和变化的进程在 Reload 返回前已经退出
+	if alive(removePID) || alive(changePID) {
+		t.Fatal("removed or changed process still running after Reload")
+	}
+	waitFor(t, "new processes", func() bool {
+		_, changed, _ := statusOf(s, "change")
+		_, added, _ := statusOf(s, "add")
+		return changed != 0 && added != 0
+	})
+
+	var names []string
+	for _, st := range s.Status() {
+		names = append(names, st.Name)
+	}
+	if strings.Join(names, ",") != "keep,change,add" {
+		t.Fatalf("workloads after reload: %v", names)
+	}
+	if _, pid, _ := statusOf(s, "keep"); pid != keepPID {
+		t.Errorf("unchanged workload restarted: pid %d -> %d", keepPID, pid)
+	}
+	if _, pid, _ := statusOf(s, "change"); pid == changePID {
+		t.Error("changed workload not restarted")
+	}
+}
+
+func TestReloadBeforeStartDoesNotLaunch(t *testing.T) {
+	s := New([]Workload{shell("a", "sleep 60")}, testOptions(&recorder{}))
+	defer s.Stop()
+
+	if _, err := s.Reload([]Workload{shell("b", "sleep 60")}); err != nil {
+		t.Fatal(err)
+	}
+	if state, pid, _ := statusOf(s, "b"); state != StateStarting || pid != 0 {
+		t.Fatalf("workload launched before Start: %s pid %d", state, pid)
+	}
+
+	s.Stop()
+	if _, err := s.Reload(nil); err == nil {
+		t.Fatal("Reload after Stop accepted")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"workloads": [{"name": "bot-a", "command": ["/bin/true"], "restart": "on-failure"}]}`, ""},
+		{`{"workloads": [{"name": "bad name", "command": ["/bin/true"]}]}`, "invalid workload name"},
+		{`{"workloads": [{"name": "a", "command": []}]}`, "command is required"},
+		{`{"workloads": [{"name": "a", "command": ["x"], "restart": "sometimes"}]}`, "unsupported restart policy"},
+		{`{"workloads": [{"name": "a", "command": ["x"]}, {"name": "a", "command": ["y"]}]}`, "duplicate workload name"},
+		{`{"workloads": `, "failed to parse"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "workloads.json")
+		if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFile(path)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.content, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got %v, want %q", tt.content, err, tt.wantErr)
+		}
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Package supervisor 启动并监管本机运行的机器人进程（托管进程）
+//
+// 进程异常退出时按退避策略重启；许可证失效时由调用方停止所有托管进程
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// 重启策略
+const (
+	RestartAlways    = "always"     // 无论退出码是什么都重启（默认）
+	RestartOnFailure = "on-failure" // 只有非零退出码或被信号终止时重启
+	RestartNever     = "never"      // 不重启
+)
+
+// namePattern 托管进程名称：字母、数字、点、下划线和连字符
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Workload 一个托管进程的配置
+type Workload struct {
+	Name    string            `json:"name"`
+	Command []string          `json:"command"`            // 可执行文件和参数（不经过 shell）
+	Dir     string            `json:"dir,omitempty"`      // 工作目录（为空时使用客户端的工作目录）
+	Env     map[string]string `json:"env,omitempty"`      // 追加的环境变量
+	Restart string            `json:"restart,omitempty"`  // 重启策略（为空时为 always）
+	LogFile string            `json:"log_file,omitempty"` // 标准输出和标准错误追加写入的文件
+}
+
+// Validate 检查配置是否完整
+func (w Workload) Validate() error {
+	if !namePattern.MatchString(w.Name) {
+		return fmt.Errorf("invalid workload name %q", w.Name)
+	}
+	if len(w.Command) == 0 || w.Command[0] == "" {
+		return fmt.Errorf("workload %s: command is required", w.Name)
+	}
+	switch w.Restart {
+	case "", RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("workload %s: unsupported restart policy %q (supported: %s, %s, %s)", w.Name, w.Restart, RestartAlways, RestartOnFailure, RestartNever)
+	}
+	return nil
+}
+
+// file 托管进程配置文件格式
+type file struct {
+	Workloads []Workload `json:"workloads"`
+}
+
+// LoadFile 读取托管进程配置文件（JSON）
+//
+//	{"workloads": [{"name": "bot-a", "command": ["/opt/bots/a", "--queue", "orders"], "restart": "on-failure"}]}
+func LoadFile(path string) ([]Workload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workloads file: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse workloads file %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(f.Workloads))
+	for _, w := range f.Workloads {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("duplicate workload name %q", w.Name)
+		}
+		seen[w.Name] = true
+	}
+	return f.Workloads, nil
+}
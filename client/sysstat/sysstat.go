@@ -0,0 +1,75 @@
+// Package sysstat 遥测和内置采集器共用的 gopsutil 采样辅助函数：
+// CPU 使用率、累计计数器的速率和去重后的磁盘分区使用情况
+package sysstat
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// CPUTotal CPU 时间总和（Guest 已经计入 User，不重复计算）
+func CPUTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// CPUBusy 忙碌时间（总时间减去空闲和等待 I/O 的时间）
+func CPUBusy(t cpu.TimesStat) float64 {
+	return CPUTotal(t) - t.Idle - t.Iowait
+}
+
+// CPUPercent 根据两次 CPU 时间计算这段时间的使用率（0 到 100），时间没有前进时返回 false
+//
+// prev 为零值时得到开机以来的平均使用率
+func CPUPercent(prev, cur cpu.TimesStat) (float64, bool) {
+	total := CPUTotal(cur) - CPUTotal(prev)
+	if total <= 0 {
+		return 0, false
+	}
+	percent := (CPUBusy(cur) - CPUBusy(prev)) / total * 100
+	return math.Max(0, math.Min(100, percent)), true
+}
+
+// Rate 根据累计计数器的两次读数计算每秒速率，计数器回绕、重置或时间没有前进时返回 false
+func Rate(prev, cur uint64, elapsed time.Duration) (float64, bool) {
+	if elapsed <= 0 || cur < prev {
+		return 0, false
+	}
+	return float64(cur-prev) / elapsed.Seconds(), true
+}
+
+// Partition 一个挂载点的使用情况
+type Partition struct {
+	Mountpoint string
+	Fstype     string
+	Usage      *disk.UsageStat
+}
+
+// Partitions 读取物理分区的使用情况（同一设备只报告一次，跳过读取失败和容量为 0 的分区，最多 limit 个）
+func Partitions(ctx context.Context, limit int) ([]Partition, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var result []Partition
+	for _, partition := range partitions {
+		if len(result) >= limit {
+			break
+		}
+		if seen[partition.Device] {
+			continue
+		}
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		seen[partition.Device] = true
+		result = append(result, Partition{Mountpoint: partition.Mountpoint, Fstype: partition.Fstype, Usage: usage})
+	}
+	return result, nil
+}
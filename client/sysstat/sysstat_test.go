@@ -0,0 +1,81 @@
+package sysstat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+func TestCPUPercent(t *testing.T) {
+	prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 50}
+	tests := []struct {
+		name   string
+		cur    cpu.TimesStat
+		want   float64
+		wantOK bool
+	}{
+		{"half busy", cpu.TimesStat{User: 150, System: 100, Idle: 850, Iowait: 100}, 50, true},
+		{"idle", cpu.TimesStat{User: 100, System: 50, Idle: 900, Iowait: 50}, 0, true},
+		{"fully busy", cpu.TimesStat{User: 200, System: 50, Idle: 800, Iowait: 50}, 100, true},
+		// iowait 计为空闲，steal 和 irq 计为忙碌
+		{"iowait and steal", cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 125, Steal: 25}, 25, true},
+		// Guest 已经计入 User，不重复计算
+		{"guest", cpu.TimesStat{User: 200, System: 50, Idle: 900, Iowait: 50, Guest: 100}, 50, true},
+		{"not advanced", prev, 0, false},
+		{"counters reset", cpu.TimesStat{User: 1, Idle: 1}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := CPUPercent(prev, tt.cur)
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("got (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// 第一次采样与零值比较，得到开机以来的平均值
+	if got, ok := CPUPercent(cpu.TimesStat{}, prev); !ok || got != 15 {
+		t.Fatalf("since boot: got (%v, %v), want (15, true)", got, ok)
+	}
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		elapsed   time.Duration
+		want      float64
+		wantOK    bool
+	}{
+		{"steady", 1000, 3000, 2 * time.Second, 1000, true},
+		{"sub-second", 0, 500, 500 * time.Millisecond, 1000, true},
+		{"unchanged", 42, 42, time.Second, 0, true},
+		{"counter reset", 5000, 100, time.Second, 0, false},
+		{"no elapsed time", 0, 100, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Rate(tt.prev, tt.cur, tt.elapsed)
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("got (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPartitionsLimit(t *testing.T) {
+	partitions, err := Partitions(context.Background(), 1)
+	if err != nil {
+		t.Skipf("partitions unavailable: %v", err)
+	}
+	if len(partitions) > 1 {
+		t.Fatalf("got %d partitions, want at most 1", len(partitions))
+	}
+	for _, p := range partitions {
+		if p.Usage == nil || p.Usage.Total == 0 {
+			t.Fatalf("partition %s without usage", p.Mountpoint)
+		}
+	}
+}
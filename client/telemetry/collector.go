@@ -0,0 +1,275 @@
+// Package telemetry 在两次心跳之间定期采样系统指标（CPU、内存、交换分区、负载、网络吞吐），
+// 汇总为最小值、平均值和最大值，随心跳一起加密发送
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+
+	"sqlbots-client/protocol"
+	"sqlbots-client/sysstat"
+)
+
+// DefaultInterval 默认采样间隔
+const DefaultInterval = 30 * time.Second
+
+// maxDisks 最多报告的挂载点数量
+const maxDisks = 16
+
+// window 一段时间内的采样累计
+type window struct {
+	from, to time.Time
+	samples  int
+
+	cpu, memory, swap    aggregate
+	load1, load5, load15 aggregate
+	netRx, netTx         aggregate
+}
+
+// merge 合并另一段时间（较早的窗口）的累计
+func (w *window) merge(other *window) {
+	if other == nil || other.samples == 0 {
+		return
+	}
+	if w.samples == 0 || other.from.Before(w.from) {
+		w.from = other.from
+	}
+	if other.to.After(w.to) {
+		w.to = other.to
+	}
+	w.samples += other.samples
+	w.cpu.merge(other.cpu)
+	w.memory.merge(other.memory)
+	w.swap.merge(other.swap)
+	w.load1.merge(other.load1)
+	w.load5.merge(other.load5)
+	w.load15.merge(other.load15)
+	w.netRx.merge(other.netRx)
+	w.netTx.merge(other.netTx)
+}
+
+// Collector 遥测采集器
+//
+// Run 在后台定期采样；发送心跳前调用 Snapshot 取出上次确认以来的汇总，心跳成功后调用 Ack。
+// 没有确认的汇总会合并到下一次 Snapshot 中，服务器不可达期间的数据不会丢失。
+// nil 的 Collector 可以安全调用（Snapshot 返回 nil），未开启遥测时不需要判断
+type Collector struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	current window
+	pending *window // 已经取出但还没有确认的窗口
+
+	// 计算 CPU 使用率和网络速率需要上一次的累计值
+	lastCPU     *cpu.TimesStat
+	lastNet     *psnet.IOCountersStat
+	lastNetTime time.Time
+}
+
+// NewCollector 创建遥测采集器（interval 为 0 时使用默认值 30 秒）
+func NewCollector(interval time.Duration) *Collector {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Collector{interval: interval}
+}
+
+// Run 立即采样一次，之后按间隔采样，直到 ctx 取消
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.Sample()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sample()
+		}
+	}
+}
+
+// Start 在后台运行采集器
+func (c *Collector) Start(ctx context.Context) {
+	go c.Run(ctx)
+}
+
+// sample 一次采样读取的系统指标（读取失败的指标为 nil）
+type sample struct {
+	at     time.Time
+	cpu    *cpu.TimesStat
+	memory *mem.VirtualMemoryStat
+	swap   *mem.SwapMemoryStat
+	load   *load.AvgStat
+	net    *psnet.IOCountersStat // 所有网卡的合计
+}
+
+// readSample 读取系统指标
+func readSample() sample {
+	s := sample{at: time.Now()}
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		s.cpu = &times[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		s.memory = vm
+	}
+	if swap, err := mem.SwapMemory(); err == nil && swap.Total > 0 {
+		s.swap = swap
+	}
+	if avg, err := load.Avg(); err == nil {
+		s.load = avg
+	}
+	if counters, err := psnet.IOCounters(false); err == nil && len(counters) > 0 {
+		s.net = &counters[0]
+	}
+	return s
+}
+
+// Sample 采样一次（读取失败的指标跳过）
+func (c *Collector) Sample() {
+	// 在锁外读取系统指标（可能需要读取多个文件）
+	c.add(readSample())
+}
+
+// add 把一次采样加入当前窗口（CPU 使用率和网络速率与上一次采样比较）
+func (c *Collector) add(s sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &c.current
+	if w.samples == 0 {
+		w.from = s.at
+	}
+	w.to = s.at
+	w.samples++
+
+	if s.cpu != nil {
+		if c.lastCPU != nil {
+			if percent, ok := sysstat.CPUPercent(*c.lastCPU, *s.cpu); ok {
+				w.cpu.add(percent)
+			}
+		}
+		c.lastCPU = s.cpu
+	}
+	if s.memory != nil {
+		w.memory.add(s.memory.UsedPercent)
+	}
+	if s.swap != nil {
+		w.swap.add(s.swap.UsedPercent)
+	}
+	if s.load != nil {
+		w.load1.add(s.load.Load1)
+		w.load5.add(s.load.Load5)
+		w.load15.add(s.load.Load15)
+	}
+	if s.net != nil {
+		if c.lastNet != nil {
+			// 计数器回绕或网卡重置时跳过这一次
+			elapsed := s.at.Sub(c.lastNetTime)
+			rx, rxOK := sysstat.Rate(c.lastNet.BytesRecv, s.net.BytesRecv, elapsed)
+			tx, txOK := sysstat.Rate(c.lastNet.BytesSent, s.net.BytesSent, elapsed)
+			if rxOK && txOK {
+				w.netRx.add(rx)
+				w.netTx.add(tx)
+			}
+		}
+		c.lastNet = s.net
+		c.lastNetTime = s.at
+	}
+}
+
+// Snapshot 返回上次确认以来的汇总（包括没有确认的窗口）并开始新的窗口，没有采样时返回 nil
+// 磁盘使用情况和运行时间在调用时读取
+func (c *Collector) Snapshot() *protocol.Telemetry {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	w := c.current
+	w.merge(c.pending)
+	c.current = window{}
+	if w.samples > 0 {
+		c.pending = &w
+	}
+	c.mu.Unlock()
+
+	if w.samples == 0 {
+		return nil
+	}
+
+	report := &protocol.Telemetry{
+		From:          w.from.UTC(),
+		To:            w.to.UTC(),
+		Samples:       w.samples,
+		CPUPercent:    w.cpu.stat(),
+		MemoryPercent: w.memory.stat(),
+		SwapPercent:   w.swap.stat(),
+		Load1:         w.load1.stat(),
+		Load5:         w.load5.stat(),
+		Load15:        w.load15.stat(),
+		NetRxBytesSec: w.netRx.stat(),
+		NetTxBytesSec: w.netTx.stat(),
+		Disks:         diskUsage(),
+	}
+	if uptime, err := host.Uptime(); err == nil {
+		report.UptimeSeconds = uptime
+	}
+	return report
+}
+
+// Ack 确认最近一次 Snapshot 的数据已经发送（心跳成功后调用）
+func (c *Collector) Ack() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = nil
+}
+
+// Collect 在 duration 内采样两次并返回汇总（单次心跳使用，CPU 使用率和网络速率需要两次采样）
+func Collect(ctx context.Context, duration time.Duration) *protocol.Telemetry {
+	c := NewCollector(duration)
+	c.Sample()
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	c.Sample()
+	return c.Snapshot()
+}
+
+// diskUsage 读取物理分区的使用情况（同一设备只报告一次）
+func diskUsage() []protocol.DiskUsage {
+	partitions, err := sysstat.Partitions(context.Background(), maxDisks)
+	if err != nil {
+		return nil
+	}
+
+	disks := make([]protocol.DiskUsage, 0, len(partitions))
+	for _, partition := range partitions {
+		disks = append(disks, protocol.DiskUsage{
+			Mount:       partition.Mountpoint,
+			FSType:      partition.Fstype,
+			TotalBytes:  partition.Usage.Total,
+			UsedBytes:   partition.Usage.Used,
+			UsedPercent: round(partition.Usage.UsedPercent),
+		})
+	}
+	return disks
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+
+	"sqlbots-client/protocol"
+)
+
+var start = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeSample 构造一次采样：busy/idle 为 CPU 累计时间，rx/tx 为网卡累计字节数
+func fakeSample(offset time.Duration, busy, idle float64, memory float64, rx, tx uint64) sample {
+	return sample{
+		at:     start.Add(offset),
+		cpu:    &cpu.TimesStat{User: busy, Idle: idle},
+		memory: &mem.VirtualMemoryStat{UsedPercent: memory},
+		load:   &load.AvgStat{Load1: memory / 100, Load5: 0.5, Load15: 0.25},
+		net:    &psnet.IOCountersStat{BytesRecv: rx, BytesSent: tx},
+	}
+}
+
+func assertStat(t *testing.T, name string, got *protocol.Stat, min, avg, max float64) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("%s: no stat", name)
+	}
+	if got.Min != min || got.Avg != avg || got.Max != max {
+		t.Fatalf("%s: got %+v, want min %v avg %v max %v", name, *got, min, avg, max)
+	}
+}
+
+// CPU 使用率和网络速率由相邻两次采样的差值计算，第一次采样只作为基准
+func TestCollectorRates(t *testing.T) {
+	c := NewCollector(time.Second)
+	c.add(fakeSample(0, 100, 100, 40, 0, 0))
+	c.add(fakeSample(10*time.Second, 150, 150, 50, 10000, 5000)) // CPU 50%，收 1000 B/s，发 500 B/s
+	c.add(fakeSample(20*time.Second, 250, 150, 60, 40000, 5000)) // CPU 100%，收 3000 B/s，发 0
+	c.add(fakeSample(30*time.Second, 250, 250, 50, 100, 100))    // CPU 0%，网卡重置，跳过速率
+
+	report := c.Snapshot()
+	if report == nil {
+		t.Fatal("no report")
+	}
+	if report.Samples != 4 || !report.From.Equal(start) || !report.To.Equal(start.Add(30*time.Second)) {
+		t.Fatalf("window: %d samples from %s to %s", report.Samples, report.From, report.To)
+	}
+	assertStat(t, "cpu", report.CPUPercent, 0, 50, 100)
+	assertStat(t, "memory", report.MemoryPercent, 40, 50, 60)
+	assertStat(t, "rx", report.NetRxBytesSec, 1000, 2000, 3000)
+	assertStat(t, "tx", report.NetTxBytesSec, 0, 250, 500)
+	assertStat(t, "load5", report.Load5, 0.5, 0.5, 0.5)
+	if report.SwapPercent != nil {
+		t.Errorf("swap reported without samples: %+v", report.SwapPercent)
+	}
+}
+
+// 读取失败的指标不影响其他指标
+func TestCollectorMissingMetrics(t *testing.T) {
+	c := NewCollector(time.Second)
+	c.add(sample{at: start, memory: &mem.VirtualMemoryStat{UsedPercent: 30}})
+	c.add(sample{at: start.Add(time.Second), memory: &mem.VirtualMemoryStat{UsedPercent: 40}})
+
+	report := c.Snapshot()
+	assertStat(t, "memory", report.MemoryPercent, 30, 35, 40)
+	if report.CPUPercent != nil || report.NetRxBytesSec != nil || report.Load1 != nil {
+		t.Fatalf("unexpected stats: %+v", report)
+	}
+}
+
+// 没有确认的汇总合并到下一次 Snapshot，确认后开始新的窗口
+func TestCollectorSnapshotAck(t *testing.T) {
+	c := NewCollector(time.Second)
+	if c.Snapshot() != nil {
+		t.Fatal("report without samples")
+	}
+
+	c.add(fakeSample(0, 0, 0, 10, 0, 0))
+	c.add(fakeSample(time.Second, 0, 0, 20, 0, 0))
+	if first := c.Snapshot(); first.Samples != 2 {
+		t.Fatalf("first report: %d samples", first.Samples)
+	}
+
+	// 心跳失败：没有 Ack
+	c.add(fakeSample(2*time.Second, 0, 0, 30, 0, 0))
+	second := c.Snapshot()
+	if second.Samples != 3 || !second.From.Equal(start) || !second.To.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("unacknowledged window not merged: %d samples from %s to %s", second.Samples, second.From, second.To)
+	}
+	assertStat(t, "memory", second.MemoryPercent, 10, 20, 30)
+
+	c.Ack()
+	if c.Snapshot() != nil {
+		t.Fatal("acknowledged window reported again")
+	}
+	c.add(fakeSample(3*time.Second, 0, 0, 50, 0, 0))
+	third := c.Snapshot()
+	if third.Samples != 1 || !third.From.Equal(start.Add(3*time.Second)) {
+		t.Fatalf("new window: %d samples from %s", third.Samples, third.From)
+	}
+	assertStat(t, "memory", third.MemoryPercent, 50, 50, 50)
+
+	var nilCollector *Collector
+	if nilCollector.Snapshot() != nil {
+		t.Fatal("nil collector returned a report")
+	}
+	nilCollector.Ack()
+}
+
+func TestAggregate(t *testing.T) {
+	var a aggregate
+	if a.stat() != nil {
+		t.Fatal("stat without samples")
+	}
+	for _, v := range []float64{1.005, math.NaN(), 2, math.Inf(1), 3.333} {
+		a.add(v)
+	}
+	if a.count != 3 {
+		t.Fatalf("non-finite values counted: %d", a.count)
+	}
+
+	var b aggregate
+	b.add(0.5)
+	b.merge(aggregate{})
+	b.merge(a)
+	got := b.stat()
+	if got.Min != 0.5 || got.Max != 3.33 || got.Avg != round((0.5+1.005+2+3.333)/4) {
+		t.Fatalf("merged stat: %+v", *got)
+	}
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"math"
+
+	"sqlbots-client/protocol"
+)
+
+// aggregate 采样值的累计（只保存最小值、最大值、总和和次数，不保存每次采样）
+type aggregate struct {
+	min, max, sum float64
+	count         int
+}
+
+// add 加入一次采样
+func (a *aggregate) add(value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if a.count == 0 || value < a.min {
+		a.min = value
+	}
+	if a.count == 0 || value > a.max {
+		a.max = value
+	}
+	a.sum += value
+	a.count++
+}
+
+// merge 合并另一段时间的累计
+func (a *aggregate) merge(other aggregate) {
+	if other.count == 0 {
+		return
+	}
+	if a.count == 0 || other.min < a.min {
+		a.min = other.min
+	}
+	if a.count == 0 || other.max > a.max {
+		a.max = other.max
+	}
+	a.sum += other.sum
+	a.count += other.count
+}
+
+// stat 返回最小值、平均值和最大值（没有采样时返回 nil）
+func (a aggregate) stat() *protocol.Stat {
+	if a.count == 0 {
+		return nil
+	}
+	return &protocol.Stat{
+		Min: round(a.min),
+		Avg: round(a.sum / float64(a.count)),
+		Max: round(a.max),
+	}
+}
+
+// round 保留两位小数
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -15,6 +15,6 @@ Write-Host ""
 
 # 运行客户端
 cd $PSScriptRoot
-go run main.go
+go run .
 
 
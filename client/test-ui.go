@@ -1,3 +1,7 @@
+//go:build ignore
+
+// 界面组件测试程序，单独运行：go run test-ui.go
+
 package main
 
 import (
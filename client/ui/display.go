@@ -39,6 +39,11 @@ func ShowLoginPrompt() {
 	fmt.Print("please enter your api key: ")
 }
 
+// ShowPrompt 显示输入提示（例如 encryption key、passphrase）
+func ShowPrompt(label string) {
+	fmt.Printf("please enter your %s: ", label)
+}
+
 // ShowLoggedIn 显示登录成功界面
 func ShowLoggedIn(username, version string) {
 	ClearScreen()
@@ -56,3 +61,20 @@ func ShowSuccess(message string) {
 	fmt.Printf("\n✅ %s\n\n", message)
 }
 
+// ShowWarning 显示警告信息
+func ShowWarning(message string) {
+	fmt.Printf("\n⚠️  %s\n\n", message)
+}
+
+// ShowLicense 显示许可证信息
+func ShowLicense(planType, expiresAt, remaining string) {
+	if planType == "" {
+		planType = "-"
+	}
+	if expiresAt == "" {
+		fmt.Printf("plan         : %s\n\n", planType)
+		return
+	}
+	fmt.Printf("plan         : %s\n", planType)
+	fmt.Printf("expires at   : %s (%s left)\n\n", expiresAt, remaining)
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package ui
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hideInput Unix/Linux/Mac 系统隐藏输入
+func hideInput() (string, error) {
+	// 使用 stty 命令隐藏输入
+	exec.Command("stty", "-echo").Run()
+	defer exec.Command("stty", "echo").Run()
+
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	// 移除换行符
+	input = strings.TrimSpace(input)
+
+	return input, nil
+}
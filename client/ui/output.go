@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Output 程序运行状态的输出方式（终端界面或结构化日志）
+//
+// 参数 args 与 slog 相同，是交替的键和值；终端界面只显示 "error" 对应的值
+type Output interface {
+	Start(version string)
+	LoggedIn(username, version string)
+	License(planType, expiresAt, remaining string)
+	Info(msg string, args ...any)
+	Warning(msg string, args ...any)
+	Error(msg string, args ...any)
+	Shutdown()
+}
+
+// terminalOutput 终端界面
+type terminalOutput struct{}
+
+// NewTerminalOutput 创建终端界面输出
+func NewTerminalOutput() Output {
+	return terminalOutput{}
+}
+
+func (terminalOutput) Start(version string) {
+	ClearScreen()
+	ShowBanner(version)
+}
+
+func (terminalOutput) LoggedIn(username, version string) {
+	ShowLoggedIn(username, version)
+}
+
+func (terminalOutput) License(planType, expiresAt, remaining string) {
+	ShowLicense(planType, expiresAt, remaining)
+}
+
+// Info 终端界面不显示普通信息（避免干扰界面）
+func (terminalOutput) Info(msg string, args ...any) {}
+
+func (terminalOutput) Warning(msg string, args ...any) {
+	ShowWarning(withError(msg, args))
+}
+
+func (terminalOutput) Error(msg string, args ...any) {
+	ShowError(withError(msg, args))
+}
+
+func (terminalOutput) Shutdown() {
+	ClearScreen()
+	fmt.Println("Shutting down...")
+}
+
+// withError 在信息后附加 "error" 参数的值
+func withError(msg string, args []any) string {
+	for i := 0; i+1 < len(args); i += 2 {
+		if key, ok := args[i].(string); ok && key == "error" && args[i+1] != nil {
+			return fmt.Sprintf("%s: %v", msg, args[i+1])
+		}
+	}
+	return msg
+}
+
+// logOutput 结构化日志（无界面模式）
+type logOutput struct {
+	logger *slog.Logger
+}
+
+// NewLogOutput 创建结构化日志输出（format 为 text 时输出 key=value 格式，否则输出 JSON）
+func NewLogOutput(w io.Writer, format string) Output {
+	var handler slog.Handler
+	if format == "text" {
+		handler = slog.NewTextHandler(w, nil)
+	} else {
+		handler = slog.NewJSONHandler(w, nil)
+	}
+	return logOutput{logger: slog.New(handler)}
+}
+
+func (o logOutput) Start(version string) {
+	o.logger.Info("starting", "version", version)
+}
+
+func (o logOutput) LoggedIn(username, version string) {
+	o.logger.Info("logged in", "username", username, "version", version)
+}
+
+func (o logOutput) License(planType, expiresAt, remaining string) {
+	o.logger.Info("license", "plan_type", planType, "expires_at", expiresAt, "remaining", remaining)
+}
+
+func (o logOutput) Info(msg string, args ...any) {
+	o.logger.Info(msg, args...)
+}
+
+func (o logOutput) Warning(msg string, args ...any) {
+	o.logger.Warn(msg, args...)
+}
+
+func (o logOutput) Error(msg string, args ...any) {
+	o.logger.Error(msg, args...)
+}
+
+func (o logOutput) Shutdown() {
+	o.logger.Info("shutting down")
+}
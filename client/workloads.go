@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"sqlbots-client/config"
+	"sqlbots-client/supervisor"
+	"sqlbots-client/ui"
+)
+
+// activeWorkloads 正在监管的托管进程（fail 终止程序前先停止它们，许可证失效后不允许继续运行）
+var activeWorkloads *supervisor.Supervisor
+
+// newWorkloadSupervisor 根据配置创建托管进程监管器（没有配置托管进程时为空，refresh_config 指令可以加载新的进程）
+//
+// 无界面模式下托管进程的输出写到标准错误，终端界面下丢弃（配置了 log_file 的写到文件）
+func newWorkloadSupervisor(cfg *config.Config, out ui.Output, headless bool) (*supervisor.Supervisor, error) {
+	var workloads []supervisor.Workload
+	if cfg.WorkloadsFile != "" {
+		var err error
+		if workloads, err = supervisor.LoadFile(cfg.WorkloadsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var output io.Writer
+	if headless {
+		output = os.Stderr
+	}
+
+	return supervisor.New(workloads, supervisor.Options{
+		StopTimeout: cfg.WorkloadStopTimeout,
+		Output:      output,
+		OnEvent: func(e supervisor.Event) {
+			logWorkloadEvent(out, e)
+		},
+	}), nil
+}
+
+// logWorkloadEvent 输出托管进程的状态变化（异常退出和启动失败显示警告）
+func logWorkloadEvent(out ui.Output, e supervisor.Event) {
+	switch e.Type {
+	case supervisor.EventStarted:
+		out.Info("workload started", "workload", e.Workload, "pid", e.PID)
+	case supervisor.EventStopped:
+		out.Info("workload stopped", "workload", e.Workload, "pid", e.PID)
+	case supervisor.EventFailed:
+		if e.Restart > 0 {
+			out.Warning(fmt.Sprintf("Workload %s failed to start, retrying in %s", e.Workload, e.Restart.Round(100*time.Millisecond)), "workload", e.Workload, "error", e.Err)
+		} else {
+			out.Warning(fmt.Sprintf("Workload %s failed to start", e.Workload), "workload", e.Workload, "error", e.Err)
+		}
+	case supervisor.EventExited:
+		switch {
+		case e.Restart > 0:
+			out.Warning(fmt.Sprintf("Workload %s exited, restarting in %s", e.Workload, e.Restart.Round(100*time.Millisecond)), "workload", e.Workload, "pid", e.PID, "error", e.Err)
+		case e.Err != nil:
+			out.Warning(fmt.Sprintf("Workload %s exited", e.Workload), "workload", e.Workload, "pid", e.PID, "error", e.Err)
+		default:
+			out.Info("workload exited", "workload", e.Workload, "pid", e.PID)
+		}
+	}
+}